@@ -0,0 +1,290 @@
+// Package abi builds event registries from Cairo contract ABIs. A registry maps event selectors to
+// the events they select, so an emitted event is recognised with a map lookup on its keys.
+package abi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"junoplugin/utils"
+	"os"
+	"sort"
+	"strings"
+)
+
+// UnknownEvent is the name events no decoder recognises are stored under, with their keys and data as
+// they were emitted
+const UnknownEvent = "Unknown"
+
+// EventDecoder recognises emitted events. Registry is the decoder of an ABI.
+type EventDecoder interface {
+	// DecodeEvent returns the event an emitted event's keys and data hold, ok is false for events
+	// the decoder does not recognise
+	DecodeEvent(keys, data []string) (decoded *DecodedEvent, ok bool)
+}
+
+// DecodedEvent is a recognised event
+type DecodedEvent struct {
+	Name string
+	// Payload is the event's members as a JSON object, nil when its layout is unknown or does not match
+	Payload json.RawMessage
+	// Err is why an event with a known layout has no payload, for the caller to log
+	Err error
+}
+
+// Member is a field of an event
+type Member struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// Kind is key or data for events of Cairo 2 ABIs and nested or flat for enum variants
+	Kind string `json:"kind"`
+}
+
+// Event is an event a contract can emit
+type Event struct {
+	// Name is the name of the enum variant selecting the event, which is also the name it is stored under
+	Name string
+	// Type is the Cairo type of the event, e.g. pitch_lake::vault::Vault::Deposit
+	Type string
+	// Selectors is the number of leading keys that select the event, more than 1 for events of
+	// nested enum variants
+	Selectors int
+	// Members are the event's fields in the order they are emitted
+	Members []Member
+	// untyped events come from names alone and cannot be decoded
+	untyped bool
+}
+
+// Registry maps event selectors to events
+type Registry struct {
+	events map[string]*selectorNode
+	// types are the ABI's structs and enums by name
+	types map[string]*entry
+	len   int
+}
+
+// selectorNode is the event a key selects, or the next level of a nested enum
+type selectorNode struct {
+	event *Event
+	next  map[string]*selectorNode
+}
+
+// entry is an item of an ABI. Events, structs and enums are read.
+type entry struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// Kind is struct or enum for events of Cairo 2 ABIs and empty for older ones
+	Kind     string   `json:"kind"`
+	Members  []Member `json:"members"`
+	Variants []Member `json:"variants"`
+	// Inputs are the fields of Cairo 1 events before enum events
+	Inputs []Member `json:"inputs"`
+	// Keys and Data are the fields of Cairo 0 events
+	Keys []Member `json:"keys"`
+	Data []Member `json:"data"`
+}
+
+// Parse builds a registry from an ABI, given either as the ABI's JSON array or as a contract class
+// whose abi field holds it
+func Parse(data []byte) (*Registry, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var class struct {
+			ABI json.RawMessage `json:"abi"`
+		}
+		if err := json.Unmarshal(data, &class); err != nil {
+			return nil, fmt.Errorf("failed to parse contract class: %w", err)
+		}
+		// Compilers before Cairo 2.7 store the ABI as a string
+		var abi string
+		if err := json.Unmarshal(class.ABI, &abi); err == nil {
+			return Parse([]byte(abi))
+		}
+		return Parse(class.ABI)
+	}
+
+	var entries []entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse ABI: %w", err)
+	}
+	return build(entries), nil
+}
+
+// LoadFile builds a registry from an ABI JSON file or a compiled contract class file
+func LoadFile(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ABI file: %w", err)
+	}
+	registry, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ABI file %s: %w", path, err)
+	}
+	return registry, nil
+}
+
+// FromEventNames builds a registry of events selected by a single key, for contracts without an ABI
+func FromEventNames(names ...string) *Registry {
+	r := &Registry{events: make(map[string]*selectorNode, len(names))}
+	for _, name := range names {
+		r.add(r.events, &Event{Name: name, Type: name, Selectors: 1, untyped: true})
+	}
+	return r
+}
+
+// Lookup returns the event an emitted event's keys select
+func (r *Registry) Lookup(keys []string) (*Event, bool) {
+	level := r.events
+	for _, key := range keys {
+		node, ok := level[key]
+		if !ok {
+			return nil, false
+		}
+		if node.event != nil {
+			return node.event, true
+		}
+		level = node.next
+	}
+	return nil, false
+}
+
+// DecodeEvent implements EventDecoder. An event that does not match its ABI layout is still
+// recognised, without a payload and with the mismatch in Err.
+func (r *Registry) DecodeEvent(keys, data []string) (*DecodedEvent, bool) {
+	event, ok := r.Lookup(keys)
+	if !ok {
+		return nil, false
+	}
+	decoded := &DecodedEvent{Name: event.Name}
+	members, err := r.Decode(event, keys, data)
+	if err != nil {
+		if !errors.Is(err, ErrNoLayout) {
+			decoded.Err = fmt.Errorf("failed to decode event %s: %w", event.Name, err)
+		}
+		return decoded, true
+	}
+	if decoded.Payload, err = json.Marshal(members); err != nil {
+		decoded.Payload, decoded.Err = nil, fmt.Errorf("failed to encode event %s: %w", event.Name, err)
+	}
+	return decoded, true
+}
+
+// Len returns the number of events in the registry
+func (r *Registry) Len() int {
+	return r.len
+}
+
+// build registers the events reachable from the ABI's root events. The root of a Cairo 2 contract is
+// its Event enum, whose variants select events by name, recursing into nested enums. Older ABIs list
+// each event on its own.
+func build(entries []entry) *Registry {
+	events := make(map[string]*entry)
+	types := make(map[string]*entry)
+	for i := range entries {
+		switch entries[i].Type {
+		case "event":
+			events[entries[i].Name] = &entries[i]
+		case "struct", "enum":
+			types[entries[i].Name] = &entries[i]
+		}
+	}
+	referenced := make(map[string]struct{})
+	for _, event := range events {
+		for _, variant := range event.Variants {
+			referenced[variant.Type] = struct{}{}
+		}
+	}
+	roots := make([]string, 0, len(events))
+	for name := range events {
+		if _, ok := referenced[name]; !ok {
+			roots = append(roots, name)
+		}
+	}
+	sort.Strings(roots)
+
+	r := &Registry{events: make(map[string]*selectorNode), types: types}
+	for _, name := range roots {
+		root := events[name]
+		if root.Kind == "enum" {
+			r.addVariants(r.events, root, events, 1, map[string]bool{})
+			continue
+		}
+		r.add(r.events, &Event{Name: shortName(name), Type: name, Selectors: 1, Members: root.members()})
+	}
+	return r
+}
+
+// addVariants registers the events an enum's variants select at level, depth keys deep
+func (r *Registry) addVariants(level map[string]*selectorNode, enum *entry, events map[string]*entry, depth int, visiting map[string]bool) {
+	if visiting[enum.Name] {
+		return
+	}
+	visiting[enum.Name] = true
+	defer delete(visiting, enum.Name)
+
+	for _, variant := range enum.Variants {
+		inner := events[variant.Type]
+		// A flat variant emits the inner enum's events as if they were the outer enum's
+		if variant.Kind == "flat" && inner != nil && inner.Kind == "enum" {
+			r.addVariants(level, inner, events, depth, visiting)
+			continue
+		}
+		if inner != nil && inner.Kind == "enum" {
+			selector := utils.Keccak256(variant.Name)
+			node, ok := level[selector]
+			if !ok {
+				node = &selectorNode{}
+				level[selector] = node
+			}
+			if node.event != nil {
+				continue
+			}
+			if node.next == nil {
+				node.next = make(map[string]*selectorNode)
+			}
+			r.addVariants(node.next, inner, events, depth+1, visiting)
+			continue
+		}
+		event := &Event{Name: variant.Name, Type: variant.Type, Selectors: depth}
+		if inner != nil {
+			event.Members = inner.members()
+		}
+		r.add(level, event)
+	}
+}
+
+// add registers an event at level under its name's selector, keeping the first of conflicting events
+func (r *Registry) add(level map[string]*selectorNode, event *Event) {
+	selector := utils.Keccak256(event.Name)
+	if _, ok := level[selector]; ok {
+		return
+	}
+	level[selector] = &selectorNode{event: event}
+	r.len++
+}
+
+// members returns an event's fields, marking the keys and data of ABIs that list them apart
+func (e *entry) members() []Member {
+	switch {
+	case e.Members != nil:
+		return e.Members
+	case e.Inputs != nil:
+		return e.Inputs
+	}
+	members := make([]Member, 0, len(e.Keys)+len(e.Data))
+	for _, key := range e.Keys {
+		key.Kind = "key"
+		members = append(members, key)
+	}
+	for _, data := range e.Data {
+		data.Kind = "data"
+		members = append(members, data)
+	}
+	return members
+}
+
+// shortName returns the last path segment of a Cairo type
+func shortName(name string) string {
+	return name[strings.LastIndex(name, ":")+1:]
+}
@@ -0,0 +1,155 @@
+package abi
+
+import (
+	"encoding/json"
+	"junoplugin/utils"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// vaultABI is a trimmed Cairo 2 ABI with a struct event, a flat component and a nested component
+const vaultABI = `[
+	{"type": "function", "name": "deposit", "inputs": [], "outputs": [], "state_mutability": "external"},
+	{"type": "event", "name": "pitch_lake::vault::Vault::Deposit", "kind": "struct", "members": [
+		{"name": "account", "type": "core::starknet::contract_address::ContractAddress", "kind": "key"},
+		{"name": "amount", "type": "core::integer::u256", "kind": "data"}
+	]},
+	{"type": "event", "name": "openzeppelin::access::ownable::OwnableComponent::OwnershipTransferred", "kind": "struct", "members": [
+		{"name": "previous_owner", "type": "core::starknet::contract_address::ContractAddress", "kind": "key"},
+		{"name": "new_owner", "type": "core::starknet::contract_address::ContractAddress", "kind": "key"}
+	]},
+	{"type": "event", "name": "openzeppelin::access::ownable::OwnableComponent::Event", "kind": "enum", "variants": [
+		{"name": "OwnershipTransferred", "type": "openzeppelin::access::ownable::OwnableComponent::OwnershipTransferred", "kind": "nested"}
+	]},
+	{"type": "event", "name": "openzeppelin::upgrades::UpgradeableComponent::Upgraded", "kind": "struct", "members": [
+		{"name": "class_hash", "type": "core::starknet::class_hash::ClassHash", "kind": "data"}
+	]},
+	{"type": "event", "name": "openzeppelin::upgrades::UpgradeableComponent::Event", "kind": "enum", "variants": [
+		{"name": "Upgraded", "type": "openzeppelin::upgrades::UpgradeableComponent::Upgraded", "kind": "nested"}
+	]},
+	{"type": "event", "name": "pitch_lake::vault::Vault::Event", "kind": "enum", "variants": [
+		{"name": "Deposit", "type": "pitch_lake::vault::Vault::Deposit", "kind": "nested"},
+		{"name": "OwnableEvent", "type": "openzeppelin::access::ownable::OwnableComponent::Event", "kind": "flat"},
+		{"name": "UpgradeableEvent", "type": "openzeppelin::upgrades::UpgradeableComponent::Event", "kind": "nested"}
+	]}
+]`
+
+func TestParse(t *testing.T) {
+	registry, err := Parse([]byte(vaultABI))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if registry.Len() != 3 {
+		t.Errorf("Expected 3 events, got %d", registry.Len())
+	}
+
+	tests := []struct {
+		name      string
+		keys      []string
+		expected  string
+		selectors int
+		members   int
+	}{
+		{name: "struct variant", keys: []string{utils.Keccak256("Deposit"), "0x123"}, expected: "Deposit", selectors: 1, members: 2},
+		{name: "flat component", keys: []string{utils.Keccak256("OwnershipTransferred"), "0x1", "0x2"}, expected: "OwnershipTransferred", selectors: 1, members: 2},
+		{name: "nested component", keys: []string{utils.Keccak256("UpgradeableEvent"), utils.Keccak256("Upgraded")}, expected: "Upgraded", selectors: 2, members: 1},
+		{name: "nested component without its variant key", keys: []string{utils.Keccak256("UpgradeableEvent")}},
+		{name: "flat variant name", keys: []string{utils.Keccak256("OwnableEvent")}},
+		{name: "unknown selector", keys: []string{utils.Keccak256("Withdrawal")}},
+		{name: "no keys"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, ok := registry.Lookup(tt.keys)
+			if tt.expected == "" {
+				if ok {
+					t.Errorf("Expected no event, got %+v", event)
+				}
+				return
+			}
+			if !ok {
+				t.Fatalf("Expected event %s, got none", tt.expected)
+			}
+			if event.Name != tt.expected || event.Selectors != tt.selectors || len(event.Members) != tt.members {
+				t.Errorf("Expected %s with %d selectors and %d members, got %+v", tt.expected, tt.selectors, tt.members, event)
+			}
+		})
+	}
+}
+
+func TestParseFormats(t *testing.T) {
+	stringABI, _ := json.Marshal(vaultABI)
+	tests := []struct {
+		name     string
+		data     string
+		expected []string
+	}{
+		{name: "contract class", data: `{"contract_class_version": "0.1.0", "abi": ` + vaultABI + `}`, expected: []string{"Deposit", "OwnershipTransferred"}},
+		{name: "contract class with string ABI", data: `{"abi": ` + string(stringABI) + `}`, expected: []string{"Deposit", "OwnershipTransferred"}},
+		{name: "cairo 1 events", data: `[{"type": "event", "name": "Deposit", "inputs": [{"name": "amount", "type": "core::integer::u256"}]}]`, expected: []string{"Deposit"}},
+		{name: "cairo 0 events", data: `[{"type": "event", "name": "Transfer", "keys": [], "data": [{"name": "from_", "type": "felt"}]}]`, expected: []string{"Transfer"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, err := Parse([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for _, name := range tt.expected {
+				if event, ok := registry.Lookup([]string{utils.Keccak256(name)}); !ok || event.Name != name {
+					t.Errorf("Expected event %s, got %+v", name, event)
+				}
+			}
+		})
+	}
+
+	if _, err := Parse([]byte(`{"abi": 5}`)); err == nil {
+		t.Errorf("Expected error but got none")
+	}
+}
+
+func TestCairo0Members(t *testing.T) {
+	registry, err := Parse([]byte(`[{"type": "event", "name": "Transfer", "keys": [{"name": "from_", "type": "felt"}], "data": [{"name": "value", "type": "Uint256"}]}]`))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	event, _ := registry.Lookup([]string{utils.Keccak256("Transfer")})
+	expected := []Member{{Name: "from_", Type: "felt", Kind: "key"}, {Name: "value", Type: "Uint256", Kind: "data"}}
+	if event == nil || !reflect.DeepEqual(event.Members, expected) {
+		t.Errorf("Expected members %+v, got %+v", expected, event)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.contract_class.json")
+	if err := os.WriteFile(path, []byte(`{"abi": `+vaultABI+`}`), 0o600); err != nil {
+		t.Fatalf("Failed to write ABI file: %v", err)
+	}
+	registry, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if registry.Len() != 3 {
+		t.Errorf("Expected 3 events, got %d", registry.Len())
+	}
+
+	if _, err := LoadFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("Expected error but got none")
+	}
+}
+
+func TestFromEventNames(t *testing.T) {
+	registry := FromEventNames("Deposit", "Withdrawal")
+	for _, name := range []string{"Deposit", "Withdrawal"} {
+		if event, ok := registry.Lookup([]string{utils.Keccak256(name)}); !ok || event.Name != name || event.Selectors != 1 {
+			t.Errorf("Expected event %s, got %+v", name, event)
+		}
+	}
+	if _, ok := registry.Lookup([]string{utils.Keccak256("Unknown")}); ok {
+		t.Errorf("Expected unknown selector not to match")
+	}
+}
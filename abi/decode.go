@@ -0,0 +1,297 @@
+package abi
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrNoLayout is returned when decoding an event whose members are unknown, such as the events of
+// a registry built from event names
+var ErrNoLayout = errors.New("event layout unknown")
+
+// feltPrime is the Starknet field prime, negative integers are stored as their difference to it
+var feltPrime, _ = new(big.Int).SetString("800000000000011000000000000000000000000000000000000000000000001", 16)
+
+// Integer types whose values fit a JSON number exactly are decoded as numbers, wider ones as
+// decimal strings
+var (
+	smallIntegers = map[string]bool{"u8": true, "u16": true, "u32": true, "i8": true, "i16": true, "i32": true}
+	wideIntegers  = map[string]bool{"u64": true, "u128": true, "usize": true, "i64": true, "i128": true}
+)
+
+// feltTypes are decoded as 0x prefixed hex strings
+var feltTypes = map[string]bool{
+	"core::felt252": true,
+	"felt":          true,
+	"core::starknet::contract_address::ContractAddress": true,
+	"core::starknet::class_hash::ClassHash":             true,
+	"core::starknet::eth_address::EthAddress":           true,
+	"core::starknet::storage_access::StorageAddress":    true,
+	"core::bytes_31::bytes31":                           true,
+}
+
+// Decode decodes the members of an event emitted with keys and data into a JSON object, keyed by
+// member name. Numbers wider than 32 bits are decimal strings, felts, addresses and hashes are hex
+// strings, ByteArrays are strings, arrays and tuples are arrays, Option is its value or null, and an
+// enum is its variant name, or an object of the variant name and value when the variant has one.
+func (r *Registry) Decode(event *Event, keys, data []string) (map[string]any, error) {
+	if event.untyped {
+		return nil, ErrNoLayout
+	}
+	if len(keys) < event.Selectors {
+		return nil, fmt.Errorf("event %s has %d keys, expected at least %d selectors", event.Name, len(keys), event.Selectors)
+	}
+
+	keyFelts := &felts{kind: "keys", values: keys[event.Selectors:]}
+	dataFelts := &felts{kind: "data", values: data}
+	decoded := make(map[string]any, len(event.Members))
+	for _, member := range event.Members {
+		in := dataFelts
+		if member.Kind == "key" {
+			in = keyFelts
+		}
+		value, err := r.decodeValue(member.Type, in)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s.%s: %w", event.Name, member.Name, err)
+		}
+		decoded[member.Name] = value
+	}
+	for _, in := range []*felts{keyFelts, dataFelts} {
+		if left := len(in.values) - in.pos; left > 0 {
+			return nil, fmt.Errorf("event %s has %d %s left after its members", event.Name, left, in.kind)
+		}
+	}
+	return decoded, nil
+}
+
+// felts is the keys or data of an event, read in order
+type felts struct {
+	kind   string
+	values []string
+	pos    int
+}
+
+// next returns the next felt
+func (f *felts) next() (*big.Int, error) {
+	if f.pos >= len(f.values) {
+		return nil, fmt.Errorf("%s ended after %d felts", f.kind, len(f.values))
+	}
+	raw := f.values[f.pos]
+	f.pos++
+	value, ok := new(big.Int).SetString(strings.TrimPrefix(raw, "0x"), 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid felt %q", raw)
+	}
+	return value, nil
+}
+
+// nextLength returns the next felt as a length, bounded by the felts left so a corrupt length
+// fails instead of allocating
+func (f *felts) nextLength() (int, error) {
+	length, err := f.next()
+	if err != nil {
+		return 0, err
+	}
+	if !length.IsInt64() || length.Int64() > int64(len(f.values)-f.pos) {
+		return 0, fmt.Errorf("length %s exceeds the %d %s left", length, len(f.values)-f.pos, f.kind)
+	}
+	return int(length.Int64()), nil
+}
+
+// decodeValue reads a value of a Cairo type from in
+func (r *Registry) decodeValue(typ string, in *felts) (any, error) {
+	typ = strings.TrimSpace(typ)
+	if typ == "()" {
+		return nil, nil
+	}
+	if strings.HasPrefix(typ, "(") && strings.HasSuffix(typ, ")") {
+		elements := splitTypes(typ[1 : len(typ)-1])
+		values := make([]any, 0, len(elements))
+		for _, element := range elements {
+			value, err := r.decodeValue(element, in)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	}
+
+	base, args := genericType(typ)
+	switch {
+	case feltTypes[typ]:
+		value, err := in.next()
+		if err != nil {
+			return nil, err
+		}
+		return "0x" + value.Text(16), nil
+	case typ == "core::bool" || typ == "bool":
+		value, err := in.next()
+		if err != nil {
+			return nil, err
+		}
+		return value.Sign() != 0, nil
+	case typ == "core::integer::u256" || typ == "Uint256":
+		low, err := in.next()
+		if err != nil {
+			return nil, err
+		}
+		high, err := in.next()
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).Add(new(big.Int).Lsh(high, 128), low).String(), nil
+	case strings.HasPrefix(typ, "core::integer::"):
+		return decodeInteger(strings.TrimPrefix(typ, "core::integer::"), in)
+	case typ == "core::byte_array::ByteArray":
+		return decodeByteArray(in)
+	case (base == "core::array::Array" || base == "core::array::Span") && len(args) == 1:
+		length, err := in.nextLength()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]any, 0, length)
+		for range length {
+			value, err := r.decodeValue(args[0], in)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case base == "core::option::Option" && len(args) == 1:
+		variant, err := in.next()
+		if err != nil {
+			return nil, err
+		}
+		switch variant.Int64() {
+		case 0:
+			return r.decodeValue(args[0], in)
+		case 1:
+			return nil, nil
+		}
+		return nil, fmt.Errorf("invalid Option variant %s", variant)
+	}
+
+	definition, ok := r.types[typ]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %s", typ)
+	}
+	if definition.Type == "enum" {
+		return r.decodeEnum(definition, in)
+	}
+	value := make(map[string]any, len(definition.Members))
+	for _, member := range definition.members() {
+		decoded, err := r.decodeValue(member.Type, in)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", member.Name, err)
+		}
+		value[member.Name] = decoded
+	}
+	return value, nil
+}
+
+// decodeEnum reads an enum's variant index followed by the variant's value
+func (r *Registry) decodeEnum(definition *entry, in *felts) (any, error) {
+	index, err := in.next()
+	if err != nil {
+		return nil, err
+	}
+	if !index.IsInt64() || index.Int64() >= int64(len(definition.Variants)) {
+		return nil, fmt.Errorf("invalid variant %s of %s", index, definition.Name)
+	}
+	variant := definition.Variants[index.Int64()]
+	if variant.Type == "()" {
+		return variant.Name, nil
+	}
+	value, err := r.decodeValue(variant.Type, in)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", variant.Name, err)
+	}
+	return map[string]any{variant.Name: value}, nil
+}
+
+// decodeInteger reads an unsigned or signed integer type named without its core::integer:: path
+func decodeInteger(name string, in *felts) (any, error) {
+	if !smallIntegers[name] && !wideIntegers[name] {
+		return nil, fmt.Errorf("unknown integer type %s", name)
+	}
+	value, err := in.next()
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(name, "i") && value.Cmp(new(big.Int).Rsh(feltPrime, 1)) > 0 {
+		value.Sub(value, feltPrime)
+	}
+	if smallIntegers[name] {
+		return value.Int64(), nil
+	}
+	return value.String(), nil
+}
+
+// decodeByteArray reads a ByteArray: the number of full 31 byte words, the words, then a pending
+// word and its length in bytes
+func decodeByteArray(in *felts) (string, error) {
+	words, err := in.nextLength()
+	if err != nil {
+		return "", err
+	}
+	var text []byte
+	for range words {
+		word, err := in.next()
+		if err != nil {
+			return "", err
+		}
+		if word.BitLen() > 31*8 {
+			return "", fmt.Errorf("ByteArray word %s exceeds 31 bytes", word.Text(16))
+		}
+		text = append(text, word.FillBytes(make([]byte, 31))...)
+	}
+	pending, err := in.next()
+	if err != nil {
+		return "", err
+	}
+	pendingLen, err := in.next()
+	if err != nil {
+		return "", err
+	}
+	if !pendingLen.IsInt64() || pendingLen.Int64() > 30 || pending.BitLen() > int(pendingLen.Int64())*8 {
+		return "", fmt.Errorf("invalid pending word of %s bytes", pendingLen)
+	}
+	text = append(text, pending.FillBytes(make([]byte, pendingLen.Int64()))...)
+	return string(text), nil
+}
+
+// genericType splits a type like core::array::Span::<core::felt252> into its base and type arguments
+func genericType(typ string) (string, []string) {
+	start := strings.Index(typ, "::<")
+	if start < 0 || !strings.HasSuffix(typ, ">") {
+		return typ, nil
+	}
+	return typ[:start], splitTypes(typ[start+3 : len(typ)-1])
+}
+
+// splitTypes splits a comma separated list of types, ignoring the commas of nested generics and tuples
+func splitTypes(list string) []string {
+	var types []string
+	depth, start := 0, 0
+	for i, c := range list {
+		switch c {
+		case '<', '(':
+			depth++
+		case '>', ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				types = append(types, strings.TrimSpace(list[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if last := strings.TrimSpace(list[start:]); last != "" {
+		types = append(types, last)
+	}
+	return types
+}
@@ -0,0 +1,160 @@
+package abi
+
+import (
+	"encoding/json"
+	"errors"
+	"junoplugin/utils"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// vaultEventFixture is an emitted vault event and the JSON it decodes to. testdata/vault_abi.json
+// is hand-built in the layout of the vault's events, it is not a compiled class.
+type vaultEventFixture struct {
+	Event   string          `json:"event"`
+	Keys    []string        `json:"keys"`
+	Data    []string        `json:"data"`
+	Decoded json.RawMessage `json:"decoded"`
+}
+
+func TestDecodeVaultEvents(t *testing.T) {
+	registry, err := LoadFile("testdata/vault_abi.json")
+	if err != nil {
+		t.Fatalf("Failed to load ABI: %v", err)
+	}
+	raw, err := os.ReadFile("testdata/vault_events.json")
+	if err != nil {
+		t.Fatalf("Failed to read fixtures: %v", err)
+	}
+	var fixtures []vaultEventFixture
+	if err := json.Unmarshal(raw, &fixtures); err != nil {
+		t.Fatalf("Failed to parse fixtures: %v", err)
+	}
+	if len(fixtures) != registry.Len() || len(fixtures) != len(utils.VaultEventNames) {
+		t.Fatalf("Expected a fixture for each of the %d vault events, got %d for %d ABI events", len(utils.VaultEventNames), len(fixtures), registry.Len())
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(fixture.Event, func(t *testing.T) {
+			keys := append([]string{utils.Keccak256(fixture.Event)}, fixture.Keys...)
+			event, ok := registry.Lookup(keys)
+			if !ok || event.Name != fixture.Event {
+				t.Fatalf("Expected event %s, got %+v", fixture.Event, event)
+			}
+			decoded, err := registry.Decode(event, keys, fixture.Data)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// Round trip through JSON as the payload is stored
+			payload, err := json.Marshal(decoded)
+			if err != nil {
+				t.Fatalf("Failed to marshal payload: %v", err)
+			}
+			var got, expected any
+			json.Unmarshal(payload, &got)
+			json.Unmarshal(fixture.Decoded, &expected)
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("Expected %s, got %s", fixture.Decoded, payload)
+			}
+		})
+	}
+}
+
+// typesABI declares an event per Cairo type the decoder handles
+const typesABI = `[
+	{"type": "struct", "name": "demo::Bid", "members": [
+		{"name": "id", "type": "core::felt252"},
+		{"name": "amount", "type": "core::integer::u256"}
+	]},
+	{"type": "enum", "name": "demo::RoundState", "variants": [
+		{"name": "Open", "type": "()"},
+		{"name": "Settled", "type": "core::integer::u64"}
+	]},
+	{"type": "enum", "name": "core::bool", "variants": [{"name": "False", "type": "()"}, {"name": "True", "type": "()"}]},
+	{"type": "event", "name": "demo::Typed", "kind": "struct", "members": [
+		{"name": "owner", "type": "core::starknet::contract_address::ContractAddress", "kind": "key"},
+		{"name": "active", "type": "core::bool", "kind": "data"},
+		{"name": "label", "type": "core::byte_array::ByteArray", "kind": "data"},
+		{"name": "ids", "type": "core::array::Span::<core::felt252>", "kind": "data"},
+		{"name": "bids", "type": "core::array::Array::<demo::Bid>", "kind": "data"},
+		{"name": "state", "type": "demo::RoundState", "kind": "data"},
+		{"name": "settled", "type": "demo::RoundState", "kind": "data"},
+		{"name": "refund", "type": "core::option::Option::<core::integer::u128>", "kind": "data"},
+		{"name": "reserve", "type": "core::option::Option::<core::integer::u128>", "kind": "data"},
+		{"name": "range", "type": "(core::integer::u32, core::integer::i32)", "kind": "data"}
+	]},
+	{"type": "event", "name": "demo::Event", "kind": "enum", "variants": [
+		{"name": "Typed", "type": "demo::Typed", "kind": "nested"}
+	]}
+]`
+
+func TestDecodeTypes(t *testing.T) {
+	registry, err := Parse([]byte(typesABI))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	keys := []string{utils.Keccak256("Typed"), "0xabc"}
+	event, ok := registry.Lookup(keys)
+	if !ok {
+		t.Fatalf("Expected event Typed, got none")
+	}
+
+	data := []string{
+		"0x1", // active
+		// label: one full word of 31 bytes, then "!" pending
+		"0x1", "0x54686520717569636b2062726f776e20666f78206a756d7073206f76657220", "0x21", "0x1",
+		"0x2", "0x7", "0x8", // ids
+		"0x1", "0x9", "0x5", "0x1", // bids: one Bid, amount 5 + 2^128
+		// state: Open, settled: Settled(42)
+		"0x0", "0x1", "0x2a",
+		// refund: Some(100), reserve: None
+		"0x0", "0x64", "0x1",
+		// range: (3, -1)
+		"0x3", "0x800000000000011000000000000000000000000000000000000000000000000",
+	}
+	decoded, err := registry.Decode(event, keys, data)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	payload, _ := json.Marshal(decoded)
+	expected := `{"active":true,"bids":[{"amount":"340282366920938463463374607431768211461","id":"0x9"}],` +
+		`"ids":["0x7","0x8"],"label":"The quick brown fox jumps over !","owner":"0xabc","range":[3,-1],` +
+		`"refund":"100","reserve":null,"settled":{"Settled":"42"},"state":"Open"}`
+	if string(payload) != expected {
+		t.Errorf("Expected %s, got %s", expected, payload)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	registry, err := Parse([]byte(typesABI))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	event, _ := registry.Lookup([]string{utils.Keccak256("Typed")})
+
+	tests := []struct {
+		name string
+		keys []string
+		data []string
+	}{
+		{name: "missing key", keys: []string{utils.Keccak256("Typed")}, data: []string{"0x1"}},
+		{name: "truncated data", keys: []string{utils.Keccak256("Typed"), "0xabc"}, data: []string{"0x1", "0x0"}},
+		{name: "array longer than data", keys: []string{utils.Keccak256("Typed"), "0xabc"}, data: []string{"0x1", "0x0", "0x0", "0x0", "0xffffffff"}},
+		{name: "trailing keys", keys: []string{utils.Keccak256("Typed"), "0xabc", "0xdef"}, data: []string{"0x1", "0x0", "0x0", "0x0", "0x0", "0x0", "0x0", "0x0", "0x0", "0x1", "0x1", "0x2", "0x3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := registry.Decode(event, tt.keys, tt.data); err == nil {
+				t.Errorf("Expected error but got none")
+			}
+		})
+	}
+
+	untyped := FromEventNames("Deposit")
+	event, _ = untyped.Lookup([]string{utils.Keccak256("Deposit")})
+	if _, err := untyped.Decode(event, []string{utils.Keccak256("Deposit")}, nil); !errors.Is(err, ErrNoLayout) {
+		t.Errorf("Expected ErrNoLayout, got %v", err)
+	}
+}
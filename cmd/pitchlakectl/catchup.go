@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"junoplugin/logging"
+	"junoplugin/network"
+	"junoplugin/plugin/contract"
+	"junoplugin/plugin/vault"
+	"junoplugin/tracing"
+	"os"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (c *cli) catchup(args []string) error {
+	fs := newFlagSet("catchup")
+	address := fs.String("address", "", "vault contract address")
+	fromBlock := fs.Uint64("from", 0, "first block of the range (inclusive)")
+	toBlock := fs.Uint64("to", 0, "last block of the range (inclusive)")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	vaultAddress, err := addressFlag("address", *address)
+	if err != nil {
+		return err
+	}
+	if *toBlock == 0 || *fromBlock > *toBlock {
+		return fmt.Errorf("invalid block range %d-%d, -to is required and must not be below -from", *fromBlock, *toBlock)
+	}
+	if err := c.cfg.Validate(); err != nil {
+		return fmt.Errorf("catchup needs a complete plugin configuration: %w", err)
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	registered, err := c.db.GetVaultRegistryByAddress(vaultAddress)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("vault %s is not registered", vaultAddress)
+		}
+		return err
+	}
+
+	// Catchup progress goes to stderr so it never mixes with the result
+	logger, err := logging.New(os.Stderr, c.cfg.LogLevel, c.cfg.LogFormat)
+	if err != nil {
+		return err
+	}
+	networkClient, err := network.NewNetwork(c.cfg.RPCURLs(), network.Options{
+		RateLimit:   c.cfg.RPCRateLimit,
+		MaxAttempts: c.cfg.RPCMaxAttempts,
+		Concurrency: c.cfg.RPCConcurrency,
+		BatchSize:   c.cfg.RPCBatchSize,
+		Logger:      logger,
+	})
+	if err != nil {
+		return err
+	}
+	vaultManager := vault.NewManager(c.db, networkClient, c.cfg.UDCAddress, c.cfg.VaultClassHashes, c.cfg.CatchupWindow, c.cfg.CatchupWorkers, c.cfg.FetchVaultABIs, logger)
+	if err := vaultManager.RegisterDecoderVersions(c.cfg.VaultDecoders); err != nil {
+		return err
+	}
+	vaultManager.SetSubscriptionBackfill(contract.NewTracker(c.db, networkClient, vaultManager, c.cfg.TrackedContracts, c.cfg.Subscriptions, logger))
+
+	// Spans of the catchup are exported as the plugin's are
+	shutdownTracing, err := tracing.Setup(tracing.Options{
+		Exporter:    c.cfg.TraceExporter,
+		Endpoint:    c.cfg.TraceEndpoint,
+		File:        c.cfg.TraceFile,
+		SampleRatio: c.cfg.TraceSampleRatio,
+	})
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(context.Background())
+	if err := vaultManager.RecatchupVault(context.Background(), registered, *fromBlock, *toBlock); err != nil {
+		return err
+	}
+
+	return c.printResult(result{
+		Action:  "catchup",
+		Address: vaultAddress,
+		OK:      true,
+		Message: fmt.Sprintf("Re-indexed vault %s over blocks %d-%d", vaultAddress, *fromBlock, *toBlock),
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"junoplugin/models"
+	"math"
+	"text/tabwriter"
+)
+
+// chainIssue is a break in the starknet_blocks parent hash chain
+type chainIssue struct {
+	BlockNumber uint64 `json:"block_number"`
+	Kind        string `json:"kind"`
+	Expected    string `json:"expected,omitempty"`
+	Actual      string `json:"actual,omitempty"`
+}
+
+// chainReport is the outcome of chain verify
+type chainReport struct {
+	FromBlock     uint64       `json:"from_block"`
+	ToBlock       uint64       `json:"to_block"`
+	BlocksChecked int          `json:"blocks_checked"`
+	OK            bool         `json:"ok"`
+	Issues        []chainIssue `json:"issues"`
+}
+
+var errChainBroken = errors.New("chain verification failed")
+
+func (c *cli) chainVerify(args []string) error {
+	fs := newFlagSet("chain verify")
+	fromBlock := fs.Uint64("from", 0, "first block to verify")
+	toBlock := fs.Uint64("to", math.MaxInt64, "last block to verify")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *fromBlock > *toBlock {
+		return fmt.Errorf("invalid block range %d-%d", *fromBlock, *toBlock)
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	blocks, err := c.db.GetBlocksInRange(*fromBlock, *toBlock)
+	if err != nil {
+		return err
+	}
+
+	report := chainReport{FromBlock: *fromBlock, ToBlock: *toBlock, BlocksChecked: len(blocks), Issues: verifyChain(blocks)}
+	if len(blocks) > 0 {
+		report.FromBlock = blocks[0].BlockNumber
+		report.ToBlock = blocks[len(blocks)-1].BlockNumber
+	}
+	report.OK = len(report.Issues) == 0
+
+	err = c.print(report, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Checked %d blocks (%d-%d)\n", report.BlocksChecked, report.FromBlock, report.ToBlock)
+		if report.OK {
+			fmt.Fprintln(w, "Chain is consistent")
+			return
+		}
+		fmt.Fprintln(w, "BLOCK\tISSUE\tEXPECTED\tACTUAL")
+		for _, issue := range report.Issues {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", issue.BlockNumber, issue.Kind, orDash(issue.Expected), orDash(issue.Actual))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if !report.OK {
+		return errChainBroken
+	}
+	return nil
+}
+
+// verifyChain checks that blocks, ordered by number, form a gapless chain of parent hashes
+func verifyChain(blocks []*models.StarknetBlocks) []chainIssue {
+	issues := []chainIssue{}
+	for i := 1; i < len(blocks); i++ {
+		previous, current := blocks[i-1], blocks[i]
+		if current.BlockNumber != previous.BlockNumber+1 {
+			issues = append(issues, chainIssue{
+				BlockNumber: previous.BlockNumber + 1,
+				Kind:        "missing",
+				Actual:      fmt.Sprintf("next stored block is %d", current.BlockNumber),
+			})
+			continue
+		}
+		if current.ParentHash != previous.BlockHash {
+			issues = append(issues, chainIssue{
+				BlockNumber: current.BlockNumber,
+				Kind:        "parent_mismatch",
+				Expected:    previous.BlockHash,
+				Actual:      current.ParentHash,
+			})
+		}
+	}
+	return issues
+}
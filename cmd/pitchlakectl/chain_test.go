@@ -0,0 +1,60 @@
+package main
+
+import (
+	"junoplugin/models"
+	"testing"
+)
+
+func TestVerifyChain(t *testing.T) {
+	tests := []struct {
+		name     string
+		blocks   []*models.StarknetBlocks
+		expected []string
+	}{
+		{
+			name:     "empty",
+			blocks:   nil,
+			expected: nil,
+		},
+		{
+			name: "consistent chain",
+			blocks: []*models.StarknetBlocks{
+				{BlockNumber: 10, BlockHash: "0xa", ParentHash: "0x9"},
+				{BlockNumber: 11, BlockHash: "0xb", ParentHash: "0xa"},
+				{BlockNumber: 12, BlockHash: "0xc", ParentHash: "0xb"},
+			},
+			expected: nil,
+		},
+		{
+			name: "gap",
+			blocks: []*models.StarknetBlocks{
+				{BlockNumber: 10, BlockHash: "0xa", ParentHash: "0x9"},
+				{BlockNumber: 13, BlockHash: "0xd", ParentHash: "0xc"},
+			},
+			expected: []string{"missing"},
+		},
+		{
+			name: "parent mismatch",
+			blocks: []*models.StarknetBlocks{
+				{BlockNumber: 10, BlockHash: "0xa", ParentHash: "0x9"},
+				{BlockNumber: 11, BlockHash: "0xb", ParentHash: "0xf"},
+				{BlockNumber: 12, BlockHash: "0xc", ParentHash: "0xb"},
+			},
+			expected: []string{"parent_mismatch"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := verifyChain(tt.blocks)
+			if len(issues) != len(tt.expected) {
+				t.Fatalf("Expected %d issues, got %d: %v", len(tt.expected), len(issues), issues)
+			}
+			for i, issue := range issues {
+				if issue.Kind != tt.expected[i] {
+					t.Errorf("Expected issue %s, got %s", tt.expected[i], issue.Kind)
+				}
+			}
+		})
+	}
+}
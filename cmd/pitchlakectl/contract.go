@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"junoplugin/abi"
+	"junoplugin/models"
+	"junoplugin/plugin/config"
+	"path/filepath"
+	"text/tabwriter"
+)
+
+func (c *cli) contractAdd(args []string) error {
+	fs := newFlagSet("contract add")
+	address := fs.String("address", "", "contract address")
+	kind := fs.String("kind", "", fmt.Sprintf("contract kind, %s or %s", config.ContractKindERC20, config.ContractKindOracle))
+	startBlock := fs.Uint64("start-block", 0, "first block to index the contract's events from")
+	abiPath := fs.String("abi", "", "ABI or contract class file to decode the contract's events with")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	contractAddress, err := addressFlag("address", *address)
+	if err != nil {
+		return err
+	}
+	if *kind != config.ContractKindERC20 && *kind != config.ContractKindOracle {
+		return fmt.Errorf("-kind must be %s or %s, vaults are added with vault register", config.ContractKindERC20, config.ContractKindOracle)
+	}
+	contract := &models.TrackedContract{Address: contractAddress, Kind: models.ContractKind(*kind), StartBlock: *startBlock}
+	if *abiPath != "" {
+		// The plugin loads the file, so store where it is rather than where it is from here
+		if contract.ABI, err = filepath.Abs(*abiPath); err != nil {
+			return err
+		}
+		if _, err := abi.LoadFile(contract.ABI); err != nil {
+			return fmt.Errorf("-abi: %w", err)
+		}
+	}
+
+	if err := c.connect(); err != nil {
+		return err
+	}
+	c.db.BeginTx(context.Background())
+	if err := c.db.UpsertTrackedContract(contract); err != nil {
+		c.db.RollbackTx()
+		return err
+	}
+	c.db.CommitTx()
+
+	return c.printResult(result{
+		Action:  "add",
+		Address: contractAddress,
+		OK:      true,
+		Message: fmt.Sprintf("Tracking %s contract %s from block %d, restart the plugin to start indexing it", contract.Kind, contractAddress, contract.StartBlock),
+	})
+}
+
+func (c *cli) contractRemove(args []string) error {
+	fs := newFlagSet("contract remove")
+	address := fs.String("address", "", "contract address")
+	purge := fs.Bool("purge", false, "also delete the contract's indexed events")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	contractAddress, err := addressFlag("address", *address)
+	if err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	c.db.BeginTx(context.Background())
+	found, err := c.db.DeleteTrackedContract(contractAddress, *purge)
+	if err != nil {
+		c.db.RollbackTx()
+		return err
+	}
+	c.db.CommitTx()
+	if !found {
+		return fmt.Errorf("contract %s is not tracked, configured contracts are removed from the config", contractAddress)
+	}
+
+	return c.printResult(result{
+		Action:  "remove",
+		Address: contractAddress,
+		OK:      true,
+		Message: fmt.Sprintf("Removed contract %s, restart the plugin to stop indexing it", contractAddress),
+	})
+}
+
+func (c *cli) contractList(args []string) error {
+	fs := newFlagSet("contract list")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	contracts, err := c.db.GetTrackedContracts()
+	if err != nil {
+		return err
+	}
+	if contracts == nil {
+		contracts = []*models.TrackedContract{}
+	}
+	return c.print(contracts, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ADDRESS\tKIND\tSTART BLOCK\tABI")
+		for _, contract := range contracts {
+			abiPath := contract.ABI
+			if abiPath == "" {
+				abiPath = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", contract.Address, contract.Kind, contract.StartBlock, abiPath)
+		}
+	})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"junoplugin/models"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (c *cli) eventsList(args []string) error {
+	fs := newFlagSet("events list")
+	eventType := fs.String("type", "", "only show this event type (StartBlock, RevertBlock, CatchupVault)")
+	address := fs.String("vault", "", "only show events for this vault")
+	limit := fs.Int("limit", 50, "maximum number of events")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	vaultAddress, err := optionalAddress("vault", *address)
+	if err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	events, err := c.db.GetDriverEvents(*eventType, vaultAddress, *limit)
+	if err != nil {
+		return err
+	}
+	if events == nil {
+		events = []*models.DriverEvent{}
+	}
+	return c.print(events, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "SEQ\tTYPE\tTIMESTAMP\tBLOCK\tVAULT\tRANGE")
+		for _, event := range events {
+			printDriverEvent(w, event)
+		}
+	})
+}
+
+func (c *cli) eventsTail(args []string) error {
+	fs := newFlagSet("events tail")
+	eventType := fs.String("type", "", "only show this event type")
+	address := fs.String("vault", "", "only show events for this vault")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	vaultAddress, err := optionalAddress("vault", *address)
+	if err != nil {
+		return err
+	}
+	if c.cfg.DatabaseURL == "" {
+		return fmt.Errorf("database URL is required, set -db-url, DB_URL or db_url in the config file")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	conn, err := pgx.Connect(ctx, c.cfg.DatabaseURL)
+	if err != nil {
+		return fmt.Errorf("unable to connect to database: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN driver_events"); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		var event models.DriverEvent
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			fmt.Fprintf(os.Stderr, "skipping malformed notification: %v\n", err)
+			continue
+		}
+		if *eventType != "" && event.Type != *eventType {
+			continue
+		}
+		if vaultAddress != "" && event.VaultAddress != vaultAddress {
+			continue
+		}
+
+		if c.json {
+			// One object per line so the stream can be piped into jq
+			if err := json.NewEncoder(c.out).Encode(event); err != nil {
+				return err
+			}
+			continue
+		}
+		printDriverEvent(w, &event)
+		w.Flush()
+	}
+}
+
+func printDriverEvent(w *tabwriter.Writer, event *models.DriverEvent) {
+	blockRange := "-"
+	if event.StartBlockHash != "" || event.EndBlockHash != "" {
+		blockRange = event.StartBlockHash + ".." + event.EndBlockHash
+	}
+	fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n",
+		event.SequenceIndex,
+		event.Type,
+		event.Timestamp.Format(time.RFC3339),
+		orDash(event.BlockHash),
+		orDash(event.VaultAddress),
+		blockRange,
+	)
+}
+
+// optionalAddress validates a felt flag that may be left empty
+func optionalAddress(name, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	return addressFlag(name, value)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
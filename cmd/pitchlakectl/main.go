@@ -0,0 +1,195 @@
+// Command pitchlakectl operates the Pitchlake indexer: vault registry and tracked contract
+// management, indexing status, forced catchup, recording replay, driver event inspection, chain
+// verification and webhook subscriptions. It reads the same configuration as the plugin (CONFIG_FILE
+// and environment variables).
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"junoplugin/db"
+	"junoplugin/plugin/config"
+	"os"
+	"text/tabwriter"
+)
+
+const usage = `Usage: pitchlakectl [global flags] <command> [flags]
+
+Commands:
+  vault register        Register a vault for indexing
+  vault pause           Stop live indexing of a vault
+  vault resume          Resume live indexing of a vault
+  vault remove          Remove a vault from the registry
+  vault reindex         Rebuild a vault's events from its deployment block
+  vault list            List registered vaults
+  contract add          Track the events of an ERC-20 or oracle contract
+  contract remove       Stop tracking a contract
+  contract list         List tracked contracts
+  status                Show per-vault indexing status and lag
+  catchup               Re-index a vault over a block range
+  replay                Replay recorded block calls and compare the tables with a golden snapshot
+  events list           List driver events
+  events tail           Follow driver events as they are stored
+  chain verify          Verify the parent hash chain of starknet_blocks
+  webhook add           Subscribe a URL to vault events
+  webhook list          List webhook subscriptions
+  webhook enable        Resume sending to a webhook subscription
+  webhook disable       Stop sending to a webhook subscription
+  webhook remove        Remove a webhook subscription
+  webhook deliveries    Show the delivery log of a webhook subscription
+  webhook dead-letters  List the webhook deliveries given up on
+  webhook redeliver     Send a dead-lettered webhook delivery again
+  migrate               Apply the embedded database migrations (-dry-run to list them)
+
+Global flags:
+`
+
+// errUsage signals a command line error, usage has already been printed
+var errUsage = errors.New("invalid usage")
+
+// cli holds the state shared by all commands
+type cli struct {
+	configPath string
+	dbURL      string
+	json       bool
+	out        io.Writer
+	cfg        *config.Config
+	db         *db.DB
+}
+
+func main() {
+	c := &cli{out: os.Stdout}
+	if err := c.run(os.Args[1:]); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, "error:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func (c *cli) run(args []string) error {
+	global := flag.NewFlagSet("pitchlakectl", flag.ContinueOnError)
+	global.StringVar(&c.configPath, "config", os.Getenv("CONFIG_FILE"), "plugin config file (defaults to $CONFIG_FILE)")
+	global.StringVar(&c.dbURL, "db-url", "", "Postgres connection URL (overrides the config and $DB_URL)")
+	global.BoolVar(&c.json, "json", false, "print machine readable JSON")
+	global.Usage = func() {
+		fmt.Fprint(global.Output(), usage)
+		global.PrintDefaults()
+	}
+	if err := global.Parse(args); err != nil {
+		return errUsage
+	}
+
+	// Commands share the plugin's configuration, flags take precedence over it
+	cfg, err := config.Load(c.configPath)
+	if err != nil {
+		return err
+	}
+	if c.dbURL != "" {
+		cfg.DatabaseURL = c.dbURL
+	}
+	c.cfg = cfg
+
+	args = global.Args()
+	if len(args) == 0 {
+		global.Usage()
+		return errUsage
+	}
+
+	command, args := args[0], args[1:]
+	if (command == "vault" || command == "contract" || command == "events" || command == "chain" || command == "webhook") && len(args) > 0 {
+		command, args = command+" "+args[0], args[1:]
+	}
+
+	handlers := map[string]func([]string) error{
+		"vault register":       c.vaultRegister,
+		"vault pause":          func(args []string) error { return c.vaultSetPaused(args, true) },
+		"vault resume":         func(args []string) error { return c.vaultSetPaused(args, false) },
+		"vault remove":         c.vaultRemove,
+		"vault reindex":        c.vaultReindex,
+		"vault list":           c.vaultList,
+		"contract add":         c.contractAdd,
+		"contract remove":      c.contractRemove,
+		"contract list":        c.contractList,
+		"status":               c.status,
+		"catchup":              c.catchup,
+		"replay":               c.replayRecording,
+		"events list":          c.eventsList,
+		"events tail":          c.eventsTail,
+		"chain verify":         c.chainVerify,
+		"migrate":              c.migrate,
+		"webhook add":          c.webhookAdd,
+		"webhook list":         c.webhookList,
+		"webhook enable":       func(args []string) error { return c.webhookSetEnabled(args, true) },
+		"webhook disable":      func(args []string) error { return c.webhookSetEnabled(args, false) },
+		"webhook remove":       c.webhookRemove,
+		"webhook deliveries":   c.webhookDeliveries,
+		"webhook dead-letters": c.webhookDeadLetters,
+		"webhook redeliver":    c.webhookRedeliver,
+	}
+	handler, ok := handlers[command]
+	if !ok {
+		fmt.Fprintf(global.Output(), "unknown command %q\n\n", command)
+		global.Usage()
+		return errUsage
+	}
+	return handler(args)
+}
+
+// connect opens the database pool lazily so usage errors never need a database
+func (c *cli) connect() error {
+	if c.db != nil {
+		return nil
+	}
+	if c.cfg.DatabaseURL == "" {
+		return errors.New("database URL is required, set -db-url, DB_URL or db_url in the config file")
+	}
+	dbClient, err := db.Init(c.cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	c.db = dbClient
+	return nil
+}
+
+// newFlagSet creates a subcommand flag set that reports errors instead of exiting
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	return fs
+}
+
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	return nil
+}
+
+// print writes v as indented JSON in -json mode, or calls text to render a table otherwise
+func (c *cli) print(v any, text func(w *tabwriter.Writer)) error {
+	if c.json {
+		encoder := json.NewEncoder(c.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	w := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	text(w)
+	return w.Flush()
+}
+
+// result is the JSON shape of commands that only report an outcome
+type result struct {
+	Action  string `json:"action"`
+	Address string `json:"address,omitempty"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+func (c *cli) printResult(r result) error {
+	return c.print(r, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, r.Message)
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"junoplugin/db"
+	"log/slog"
+	"text/tabwriter"
+)
+
+func (c *cli) migrate(args []string) error {
+	fs := newFlagSet("migrate")
+	dryRun := fs.Bool("dry-run", false, "list pending migrations without applying them")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	mode := db.MigrateAuto
+	if *dryRun {
+		mode = db.MigrateDryRun
+	}
+	// The status is printed below, keep the migration log quiet
+	status, err := c.db.Migrate(db.MigrateOptions{Mode: mode, Logger: slog.New(slog.DiscardHandler)})
+	if err != nil && !(*dryRun && errors.Is(err, db.ErrPendingMigrations)) {
+		return err
+	}
+
+	return c.print(status, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Schema version %d, latest %d\n", status.CurrentVersion, status.LatestVersion)
+		if len(status.PendingNames) == 0 {
+			fmt.Fprintln(w, "Schema is up to date")
+			return
+		}
+		fmt.Fprintln(w, "Pending migrations:")
+		for _, name := range status.PendingNames {
+			fmt.Fprintf(w, "  %s\n", name)
+		}
+	})
+}
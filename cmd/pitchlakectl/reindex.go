@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"junoplugin/models"
+	"junoplugin/plugin/listener"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// vaultReindex asks the running plugin to rebuild one or all vaults. The reindex itself runs
+// inside the plugin so it can coordinate with live block processing.
+func (c *cli) vaultReindex(args []string) error {
+	fs := newFlagSet("vault reindex")
+	address := fs.String("address", "", "vault contract address")
+	all := fs.Bool("all", false, "reindex every registered vault")
+	wait := fs.Bool("wait", false, "wait for the ReindexVault driver events")
+	timeout := fs.Duration("timeout", 30*time.Minute, "how long -wait waits")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	if *all == (*address != "") {
+		return errors.New("exactly one of -address or -all is required")
+	}
+	target := listener.ReindexAll
+	if !*all {
+		vaultAddress, err := addressFlag("address", *address)
+		if err != nil {
+			return err
+		}
+		target = vaultAddress
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	// Vaults that have to report back before -wait returns
+	pending := make(map[string]struct{})
+	vaults, err := c.db.GetVaultRegistry()
+	if err != nil {
+		return err
+	}
+	for _, vault := range vaults {
+		if *all || vault.Address == target {
+			pending[vault.Address] = struct{}{}
+		}
+	}
+	if len(pending) == 0 {
+		if *all {
+			return errors.New("no vaults are registered")
+		}
+		return fmt.Errorf("vault %s is not registered", target)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	// Listen before notifying so a fast reindex cannot be missed
+	var conn *pgx.Conn
+	if *wait {
+		conn, err = pgx.Connect(ctx, c.cfg.DatabaseURL)
+		if err != nil {
+			return fmt.Errorf("unable to connect to database: %w", err)
+		}
+		defer conn.Close(context.Background())
+		if _, err := conn.Exec(ctx, "LISTEN driver_events"); err != nil {
+			return err
+		}
+	}
+
+	if _, err := c.db.Pool.Exec(ctx, "SELECT pg_notify('vault_reindex', $1)", target); err != nil {
+		return err
+	}
+	if !*wait {
+		return c.printResult(result{
+			Action:  "reindex",
+			Address: target,
+			OK:      true,
+			Message: fmt.Sprintf("Requested reindex of %d vault(s), follow with: events tail -type ReindexVault", len(pending)),
+		})
+	}
+
+	for len(pending) > 0 {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("waiting for reindex of %d vault(s): %w", len(pending), err)
+		}
+		var event models.DriverEvent
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			continue
+		}
+		if event.Type == "ReindexVault" {
+			delete(pending, event.VaultAddress)
+		}
+	}
+
+	return c.printResult(result{
+		Action:  "reindex",
+		Address: target,
+		OK:      true,
+		Message: fmt.Sprintf("Reindexed %s", target),
+	})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"junoplugin/logging"
+	"junoplugin/plugin/replay"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+var errReplayDiffers = errors.New("replay differs from the golden snapshot")
+
+// replayReport is the outcome of replay with -golden
+type replayReport struct {
+	Recording string   `json:"recording"`
+	Golden    string   `json:"golden"`
+	Calls     int      `json:"calls"`
+	OK        bool     `json:"ok"`
+	Diff      []string `json:"diff"`
+}
+
+// replayRecording replays a recording of block calls into a fresh plugin core against a throwaway
+// schema and compares the tables with a golden snapshot, or prints them without one
+func (c *cli) replayRecording(args []string) error {
+	fs := newFlagSet("replay")
+	recording := fs.String("recording", "", "recording written with RECORD_FILE")
+	seed := fs.String("seed", "", "SQL file run before the first call, such as the vault registry")
+	golden := fs.String("golden", "", "golden snapshot to compare the tables with")
+	update := fs.Bool("update", false, "write the tables to -golden instead of comparing")
+	keep := fs.Bool("keep", false, "keep the throwaway database for inspection")
+	timeout := fs.Duration("timeout", replay.DefaultTimeout, "how long to wait for startup sync and vault catchups")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *recording == "" {
+		return errors.New("-recording is required")
+	}
+	if *update && *golden == "" {
+		return errors.New("-update needs -golden")
+	}
+	if err := c.cfg.Validate(); err != nil {
+		return fmt.Errorf("replay needs a complete plugin configuration: %w", err)
+	}
+
+	opts := replay.Options{Config: c.cfg, Keep: *keep, Timeout: *timeout}
+	if *seed != "" {
+		contents, err := os.ReadFile(*seed)
+		if err != nil {
+			return fmt.Errorf("failed to read seed: %w", err)
+		}
+		opts.Seed = string(contents)
+	}
+	// Replay progress goes to stderr so it never mixes with the result
+	logger, err := logging.New(os.Stderr, c.cfg.LogLevel, c.cfg.LogFormat)
+	if err != nil {
+		return err
+	}
+	opts.Logger = logger
+
+	replayed, err := replay.Replay(context.Background(), *recording, opts)
+	if err != nil {
+		return err
+	}
+	if *keep {
+		fmt.Fprintf(os.Stderr, "Kept database %s\n", replayed.Database)
+	}
+
+	switch {
+	case *update:
+		if err := replayed.WriteGolden(*golden); err != nil {
+			return err
+		}
+		return c.printResult(result{
+			Action:  "replay",
+			OK:      true,
+			Message: fmt.Sprintf("Replayed %d calls, wrote %s", replayed.Calls, *golden),
+		})
+	case *golden == "":
+		return c.print(replayed, func(w *tabwriter.Writer) {
+			fmt.Fprintf(w, "Replayed %d calls, %d failed\n", replayed.Calls, len(replayed.Errors))
+			for _, callErr := range replayed.Errors {
+				fmt.Fprintf(w, "  call %d %s block %d: %s\n", callErr.Call, callErr.Kind, callErr.BlockNumber, callErr.Error)
+			}
+			fmt.Fprintln(w, "TABLE\tROWS")
+			for _, table := range sortedTables(replayed) {
+				fmt.Fprintf(w, "%s\t%d\n", table, len(replayed.Tables[table]))
+			}
+		})
+	}
+
+	expected, err := replay.ReadGolden(*golden)
+	if err != nil {
+		return err
+	}
+	report := replayReport{Recording: *recording, Golden: *golden, Calls: replayed.Calls, Diff: replayed.Diff(expected)}
+	if report.Diff == nil {
+		report.Diff = []string{}
+	}
+	report.OK = len(report.Diff) == 0
+	err = c.print(report, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Replayed %d calls\n", report.Calls)
+		if report.OK {
+			fmt.Fprintln(w, "Tables match the golden snapshot")
+			return
+		}
+		for _, line := range report.Diff {
+			fmt.Fprintln(w, line)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if !report.OK {
+		return errReplayDiffers
+	}
+	return nil
+}
+
+// sortedTables returns the names of the replayed tables in order
+func sortedTables(replayed *replay.Result) []string {
+	tables := make([]string, 0, len(replayed.Tables))
+	for table := range replayed.Tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"junoplugin/models"
+	"junoplugin/utils"
+	"text/tabwriter"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// addressFlag validates and normalizes a required felt flag
+func addressFlag(name, value string) (string, error) {
+	if value == "" {
+		return "", fmt.Errorf("-%s is required", name)
+	}
+	normalized, err := utils.ValidateFeltHex(value)
+	if err != nil {
+		return "", fmt.Errorf("-%s: %w", name, err)
+	}
+	return normalized, nil
+}
+
+func (c *cli) vaultRegister(args []string) error {
+	fs := newFlagSet("vault register")
+	address := fs.String("address", "", "vault contract address")
+	deployedAt := fs.String("deployed-at", "", "hash of the block the vault was deployed in")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	vaultAddress, err := addressFlag("address", *address)
+	if err != nil {
+		return err
+	}
+	deployBlockHash, err := addressFlag("deployed-at", *deployedAt)
+	if err != nil {
+		return err
+	}
+
+	if err := c.connect(); err != nil {
+		return err
+	}
+	_, err = c.db.GetVaultRegistryByAddress(vaultAddress)
+	if err == nil {
+		return fmt.Errorf("vault %s is already registered", vaultAddress)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	// The insert trigger notifies the plugin, which initializes the vault from its deployment block
+	c.db.BeginTx(context.Background())
+	if err := c.db.InsertVault(&models.VaultRegistry{Address: vaultAddress, DeployedAt: deployBlockHash}); err != nil {
+		c.db.RollbackTx()
+		return err
+	}
+	c.db.CommitTx()
+
+	return c.printResult(result{
+		Action:  "register",
+		Address: vaultAddress,
+		OK:      true,
+		Message: fmt.Sprintf("Registered vault %s deployed at %s", vaultAddress, deployBlockHash),
+	})
+}
+
+func (c *cli) vaultSetPaused(args []string, paused bool) error {
+	action := "resume"
+	if paused {
+		action = "pause"
+	}
+	fs := newFlagSet("vault " + action)
+	address := fs.String("address", "", "vault contract address")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	vaultAddress, err := addressFlag("address", *address)
+	if err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	c.db.BeginTx(context.Background())
+	found, err := c.db.SetVaultPaused(vaultAddress, paused)
+	if err != nil {
+		c.db.RollbackTx()
+		return err
+	}
+	c.db.CommitTx()
+	if !found {
+		return fmt.Errorf("vault %s is not registered", vaultAddress)
+	}
+
+	message := fmt.Sprintf("Resumed vault %s, run catchup to backfill blocks missed while paused", vaultAddress)
+	if paused {
+		message = fmt.Sprintf("Paused vault %s", vaultAddress)
+	}
+	return c.printResult(result{Action: action, Address: vaultAddress, OK: true, Message: message})
+}
+
+func (c *cli) vaultRemove(args []string) error {
+	fs := newFlagSet("vault remove")
+	address := fs.String("address", "", "vault contract address")
+	purge := fs.Bool("purge", false, "also delete the vault's indexed events, storage diffs, class history and subscription matches")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	vaultAddress, err := addressFlag("address", *address)
+	if err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	c.db.BeginTx(context.Background())
+	found, err := c.db.DeleteVault(vaultAddress, *purge)
+	if err != nil {
+		c.db.RollbackTx()
+		return err
+	}
+	c.db.CommitTx()
+	if !found {
+		return fmt.Errorf("vault %s is not registered", vaultAddress)
+	}
+
+	return c.printResult(result{
+		Action:  "remove",
+		Address: vaultAddress,
+		OK:      true,
+		Message: fmt.Sprintf("Removed vault %s", vaultAddress),
+	})
+}
+
+func (c *cli) vaultList(args []string) error {
+	fs := newFlagSet("vault list")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	vaults, err := c.db.GetVaultRegistry()
+	if err != nil {
+		return err
+	}
+	if vaults == nil {
+		vaults = []*models.VaultRegistry{}
+	}
+	return c.print(vaults, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ADDRESS\tDEPLOYED AT\tLAST INDEXED\tPAUSED")
+		for _, vault := range vaults {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%v\n", vault.Address, vault.DeployedAt, stringOrDash(vault.LastBlockIndexed), vault.Paused)
+		}
+	})
+}
+
+func (c *cli) status(args []string) error {
+	fs := newFlagSet("status")
+	address := fs.String("address", "", "only show this vault")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	var vaultAddress string
+	if *address != "" {
+		var err error
+		if vaultAddress, err = addressFlag("address", *address); err != nil {
+			return err
+		}
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	head, err := c.db.GetLastBlock()
+	if err != nil {
+		return err
+	}
+	statuses, err := c.db.GetVaultStatuses()
+	if err != nil {
+		return err
+	}
+
+	filtered := make([]*models.VaultStatus, 0, len(statuses))
+	for _, status := range statuses {
+		if vaultAddress != "" && status.Address != vaultAddress {
+			continue
+		}
+		if head != nil {
+			headNumber := head.BlockNumber
+			status.HeadBlockNumber = &headNumber
+			if status.LastBlockNumber != nil && *status.LastBlockNumber <= headNumber {
+				lag := headNumber - *status.LastBlockNumber
+				status.Lag = &lag
+			}
+		}
+		filtered = append(filtered, status)
+	}
+	if vaultAddress != "" && len(filtered) == 0 {
+		return fmt.Errorf("vault %s is not registered", vaultAddress)
+	}
+
+	return c.print(filtered, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ADDRESS\tPAUSED\tLAST INDEXED\tHEAD\tLAG\tEVENTS")
+		for _, status := range filtered {
+			fmt.Fprintf(w, "%s\t%v\t%s\t%s\t%s\t%d\n",
+				status.Address,
+				status.Paused,
+				uintOrDash(status.LastBlockNumber),
+				uintOrDash(status.HeadBlockNumber),
+				uintOrDash(status.Lag),
+				status.EventCount,
+			)
+		}
+	})
+}
+
+func stringOrDash(s *string) string {
+	if s == nil {
+		return "-"
+	}
+	return *s
+}
+
+func uintOrDash(n *uint64) string {
+	if n == nil {
+		return "-"
+	}
+	return fmt.Sprint(*n)
+}
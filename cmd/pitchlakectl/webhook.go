@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"junoplugin/models"
+	"junoplugin/plugin/webhook"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+)
+
+// listFlag splits a comma separated flag, nil when it is empty
+func listFlag(value string) []string {
+	var items []string
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// idFlag checks a required ID flag was set
+func idFlag(name string, value int64) error {
+	if value <= 0 {
+		return fmt.Errorf("-%s is required", name)
+	}
+	return nil
+}
+
+func (c *cli) webhookAdd(args []string) error {
+	fs := newFlagSet("webhook add")
+	endpoint := fs.String("url", "", "http or https URL the events are posted to")
+	secret := fs.String("secret", "", "secret signing the requests, generated when unset")
+	vaults := fs.String("vaults", "", "comma separated vault addresses to send the events of, all vaults when unset")
+	events := fs.String("events", "", "comma separated event names to send, such as Deposit,OptionRoundSettled, all events when unset")
+	disabled := fs.Bool("disabled", false, "add the subscription disabled")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	if *endpoint == "" {
+		return fmt.Errorf("-url is required")
+	}
+	parsed, err := url.Parse(*endpoint)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("-url must be an http or https URL, got %q", *endpoint)
+	}
+	subscription := &models.WebhookSubscription{URL: *endpoint, Secret: *secret, EventNames: listFlag(*events), Enabled: !*disabled}
+	for _, vault := range listFlag(*vaults) {
+		address, err := addressFlag("vaults", vault)
+		if err != nil {
+			return err
+		}
+		subscription.VaultAddresses = append(subscription.VaultAddresses, address)
+	}
+	generated := subscription.Secret == ""
+	if generated {
+		var key [32]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return fmt.Errorf("failed to generate secret: %w", err)
+		}
+		subscription.Secret = hex.EncodeToString(key[:])
+	}
+
+	if err := c.connect(); err != nil {
+		return err
+	}
+	if err := c.db.InsertWebhookSubscription(subscription); err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("Added webhook subscription %d for %s, the plugin picks it up within %v", subscription.ID, subscription.URL, webhook.DefaultReloadInterval)
+	if generated {
+		message += "\nSecret: " + subscription.Secret
+	}
+	return c.printResult(result{Action: "add", OK: true, Message: message})
+}
+
+func (c *cli) webhookSetEnabled(args []string, enabled bool) error {
+	action := "disable"
+	if enabled {
+		action = "enable"
+	}
+	fs := newFlagSet("webhook " + action)
+	id := fs.Int64("id", 0, "subscription ID")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := idFlag("id", *id); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	found, err := c.db.SetWebhookSubscriptionEnabled(*id, enabled)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("webhook subscription %d does not exist", *id)
+	}
+	return c.printResult(result{Action: action, OK: true, Message: fmt.Sprintf("Webhook subscription %d %sd", *id, action)})
+}
+
+func (c *cli) webhookRemove(args []string) error {
+	fs := newFlagSet("webhook remove")
+	id := fs.Int64("id", 0, "subscription ID")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := idFlag("id", *id); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	found, err := c.db.DeleteWebhookSubscription(*id)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("webhook subscription %d does not exist", *id)
+	}
+	return c.printResult(result{
+		Action:  "remove",
+		OK:      true,
+		Message: fmt.Sprintf("Removed webhook subscription %d with its delivery log and dead letters", *id),
+	})
+}
+
+func (c *cli) webhookList(args []string) error {
+	fs := newFlagSet("webhook list")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	subscriptions, err := c.db.GetWebhookSubscriptions()
+	if err != nil {
+		return err
+	}
+	if subscriptions == nil {
+		subscriptions = []*models.WebhookSubscription{}
+	}
+	return c.print(subscriptions, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tURL\tENABLED\tVAULTS\tEVENTS")
+		for _, subscription := range subscriptions {
+			fmt.Fprintf(w, "%d\t%s\t%t\t%s\t%s\n", subscription.ID, subscription.URL, subscription.Enabled,
+				orAll(subscription.VaultAddresses), orAll(subscription.EventNames))
+		}
+	})
+}
+
+// orAll joins a subscription filter, which selects everything when empty
+func orAll(items []string) string {
+	if len(items) == 0 {
+		return "all"
+	}
+	return strings.Join(items, ",")
+}
+
+func (c *cli) webhookDeliveries(args []string) error {
+	fs := newFlagSet("webhook deliveries")
+	id := fs.Int64("id", 0, "subscription ID")
+	limit := fs.Int("limit", 50, "maximum number of attempts")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := idFlag("id", *id); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	deliveries, err := c.db.GetWebhookDeliveries(*id, *limit)
+	if err != nil {
+		return err
+	}
+	if deliveries == nil {
+		deliveries = []*models.WebhookDelivery{}
+	}
+	return c.print(deliveries, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "TIME\tDELIVERY\tEVENT\tVAULT\tBLOCK\tATTEMPT\tSTATUS\tDURATION\tERROR")
+		for _, delivery := range deliveries {
+			status := "-"
+			if delivery.StatusCode != 0 {
+				status = fmt.Sprint(delivery.StatusCode)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%dms\t%s\n", delivery.CreatedAt.Format("2006-01-02 15:04:05"),
+				delivery.DeliveryID, delivery.EventName, delivery.VaultAddress, delivery.BlockNumber, delivery.Attempt,
+				status, delivery.DurationMs, delivery.Error)
+		}
+	})
+}
+
+func (c *cli) webhookDeadLetters(args []string) error {
+	fs := newFlagSet("webhook dead-letters")
+	id := fs.Int64("id", 0, "only list the dead letters of this subscription")
+	limit := fs.Int("limit", 50, "maximum number of dead letters")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	letters, err := c.db.GetWebhookDeadLetters(*id, *limit)
+	if err != nil {
+		return err
+	}
+	if letters == nil {
+		letters = []*models.WebhookDeadLetter{}
+	}
+	return c.print(letters, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tTIME\tSUBSCRIPTION\tDELIVERY\tEVENT\tATTEMPTS\tERROR")
+		for _, letter := range letters {
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%d\t%s\n", letter.ID, letter.CreatedAt.Format("2006-01-02 15:04:05"),
+				letter.SubscriptionID, letter.DeliveryID, letter.EventName, letter.Attempts, letter.Error)
+		}
+	})
+}
+
+func (c *cli) webhookRedeliver(args []string) error {
+	fs := newFlagSet("webhook redeliver")
+	id := fs.Int64("id", 0, "dead letter ID")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if err := idFlag("id", *id); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+
+	letter, subscription, err := c.db.GetWebhookDeadLetter(*id)
+	if err != nil {
+		return err
+	}
+	if letter == nil {
+		return fmt.Errorf("dead letter %d does not exist", *id)
+	}
+	var payload webhook.Payload
+	if err := json.Unmarshal(letter.Payload, &payload); err != nil || payload.Event == nil {
+		return fmt.Errorf("dead letter %d has an invalid payload", *id)
+	}
+
+	// The same delivery ID is sent again so receivers can deduplicate it
+	sent := webhook.NewSender(c.cfg.WebhookTimeout).Send(context.Background(), subscription, letter.DeliveryID, letter.EventName, letter.Payload)
+	delivery := &models.WebhookDelivery{
+		SubscriptionID: letter.SubscriptionID,
+		DeliveryID:     letter.DeliveryID,
+		EventName:      letter.EventName,
+		VaultAddress:   payload.Event.VaultAddress,
+		BlockNumber:    payload.Event.BlockNumber,
+		Attempt:        letter.Attempts + 1,
+		StatusCode:     sent.StatusCode,
+		DurationMs:     sent.Duration.Milliseconds(),
+	}
+	if sent.Err != nil {
+		delivery.Error = sent.Err.Error()
+	}
+	if err := c.db.InsertWebhookDelivery(delivery); err != nil {
+		return err
+	}
+	if sent.Err != nil {
+		return fmt.Errorf("failed to redeliver dead letter %d, it is kept: %w", *id, sent.Err)
+	}
+	if err := c.db.DeleteWebhookDeadLetter(*id); err != nil {
+		return err
+	}
+
+	return c.printResult(result{
+		Action:  "redeliver",
+		OK:      true,
+		Message: fmt.Sprintf("Redelivered %s %s to %s", letter.EventName, letter.DeliveryID, subscription.URL),
+	})
+}
@@ -0,0 +1,236 @@
+//go:build integration
+
+package db_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"junoplugin/db"
+	"junoplugin/db/dbtest"
+	"junoplugin/models"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// blockNotifications listens on the starknet_blocks channels
+type blockNotifications struct {
+	t    *testing.T
+	conn *pgx.Conn
+}
+
+func listenBlockNotifications(t *testing.T, dbURL string) *blockNotifications {
+	t.Helper()
+	conn, err := pgx.Connect(context.Background(), dbURL)
+	if err != nil {
+		t.Fatalf("Failed to connect listener: %v", err)
+	}
+	t.Cleanup(func() { conn.Close(context.Background()) })
+
+	for _, channel := range []string{"starknet_blocks_insert", "starknet_blocks_revert", "starknet_blocks_finalize"} {
+		if _, err := conn.Exec(context.Background(), "LISTEN "+channel); err != nil {
+			t.Fatalf("Failed to listen on %s: %v", channel, err)
+		}
+	}
+	return &blockNotifications{t: t, conn: conn}
+}
+
+// expect waits for a notification of blockNumber on channel
+func (n *blockNotifications) expect(channel string, blockNumber uint64) {
+	n.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	notification, err := n.conn.WaitForNotification(ctx)
+	if err != nil {
+		n.t.Fatalf("Expected %s notification for block %d, got %v", channel, blockNumber, err)
+	}
+	if notification.Channel != channel || notification.Payload != strconv.FormatUint(blockNumber, 10) {
+		n.t.Errorf("Expected %s %d, got %s %s", channel, blockNumber, notification.Channel, notification.Payload)
+	}
+}
+
+// expectNone fails if any notification arrives shortly
+func (n *blockNotifications) expectNone() {
+	n.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	notification, err := n.conn.WaitForNotification(ctx)
+	if err == nil {
+		n.t.Errorf("Expected no notification, got %s %s", notification.Channel, notification.Payload)
+	} else if !errors.Is(err, context.DeadlineExceeded) {
+		n.t.Fatalf("Error waiting for notification: %v", err)
+	}
+}
+
+func insertTestBlock(t *testing.T, dbClient *db.DB, blockNumber uint64) *models.StarknetBlocks {
+	t.Helper()
+	block := &models.StarknetBlocks{
+		BlockNumber: blockNumber,
+		BlockHash:   fmt.Sprintf("0x%x", 0x1000+blockNumber),
+		ParentHash:  fmt.Sprintf("0x%x", 0x1000+blockNumber-1),
+		Timestamp:   blockNumber,
+	}
+	dbClient.BeginTx(context.Background())
+	if err := dbClient.InsertBlock(block); err != nil {
+		dbClient.RollbackTx()
+		t.Fatalf("Failed to insert block %d: %v", blockNumber, err)
+	}
+	dbClient.CommitTx()
+	return block
+}
+
+func setBlockStatus(dbClient *db.DB, blockNumber uint64, status models.BlockStatus) error {
+	_, err := dbClient.Pool.Exec(context.Background(), "UPDATE starknet_blocks SET status = $1 WHERE block_number = $2", status, blockNumber)
+	return err
+}
+
+func TestBlockStatusLifecycle(t *testing.T) {
+	dbClient, dbURL := dbtest.New(t)
+	notifications := listenBlockNotifications(t, dbURL)
+
+	mined := insertTestBlock(t, dbClient, 1)
+	notifications.expect("starknet_blocks_insert", 1)
+	reverted := insertTestBlock(t, dbClient, 2)
+	notifications.expect("starknet_blocks_insert", 2)
+
+	stored, err := dbClient.GetBlock(mined.BlockHash)
+	if err != nil || stored == nil {
+		t.Fatalf("Failed to read block: %v", err)
+	}
+	if stored.Status != models.BlockStatusMined {
+		t.Errorf("Expected status %s, got %s", models.BlockStatusMined, stored.Status)
+	}
+
+	dbClient.BeginTx(context.Background())
+	if err := dbClient.RevertBlock(reverted.BlockNumber, reverted.BlockHash); err != nil {
+		dbClient.RollbackTx()
+		t.Fatalf("Failed to revert block: %v", err)
+	}
+	dbClient.CommitTx()
+	notifications.expect("starknet_blocks_revert", 2)
+
+	// Only MINED blocks are finalized, the reverted block is left alone
+	dbClient.BeginTx(context.Background())
+	finalized, err := dbClient.FinalizeBlocks(2)
+	if err != nil {
+		dbClient.RollbackTx()
+		t.Fatalf("Failed to finalize blocks: %v", err)
+	}
+	dbClient.CommitTx()
+	if finalized != 1 {
+		t.Errorf("Expected 1 finalized block, got %d", finalized)
+	}
+	notifications.expect("starknet_blocks_finalize", 1)
+	notifications.expectNone()
+
+	head, err := dbClient.GetLastBlock()
+	if err != nil || head == nil {
+		t.Fatalf("Failed to read head: %v", err)
+	}
+	if head.BlockNumber != 1 || head.Status != models.BlockStatusFinalized {
+		t.Errorf("Expected head 1 FINALIZED, got %d %s", head.BlockNumber, head.Status)
+	}
+}
+
+func TestBlockStatusTransitions(t *testing.T) {
+	dbClient, dbURL := dbtest.New(t)
+	notifications := listenBlockNotifications(t, dbURL)
+
+	statuses := []models.BlockStatus{models.BlockStatusMined, models.BlockStatusReverted, models.BlockStatusFinalized}
+	blockNumber := uint64(100)
+	for _, from := range statuses {
+		for _, to := range statuses {
+			t.Run(fmt.Sprintf("%s to %s", from, to), func(t *testing.T) {
+				blockNumber++
+				notifications.t = t
+				insertTestBlock(t, dbClient, blockNumber)
+				notifications.expect("starknet_blocks_insert", blockNumber)
+				if from != models.BlockStatusMined {
+					if err := setBlockStatus(dbClient, blockNumber, from); err != nil {
+						t.Fatalf("Failed to set up status %s: %v", from, err)
+					}
+					if from == models.BlockStatusReverted {
+						notifications.expect("starknet_blocks_revert", blockNumber)
+					} else {
+						notifications.expect("starknet_blocks_finalize", blockNumber)
+					}
+				}
+
+				err := setBlockStatus(dbClient, blockNumber, to)
+				allowed := from.CanTransitionTo(to)
+				if allowed && err != nil {
+					t.Fatalf("Expected transition to be accepted, got %v", err)
+				}
+				if !allowed && err == nil {
+					t.Fatalf("Expected transition to be rejected")
+				}
+
+				switch {
+				case !allowed || from == to:
+					notifications.expectNone()
+				case to == models.BlockStatusReverted:
+					notifications.expect("starknet_blocks_revert", blockNumber)
+				case to == models.BlockStatusFinalized:
+					notifications.expect("starknet_blocks_finalize", blockNumber)
+				}
+			})
+		}
+	}
+}
+
+func TestBlockStatusRejectsUnknownValues(t *testing.T) {
+	dbClient, _ := dbtest.New(t)
+	insertTestBlock(t, dbClient, 1)
+
+	if err := setBlockStatus(dbClient, 1, models.BlockStatus("revert")); err == nil {
+		t.Errorf("Expected the block_status enum to reject %q", "revert")
+	}
+}
+
+func TestBlockReplacedAfterRevert(t *testing.T) {
+	dbClient, _ := dbtest.New(t)
+	insertTestBlock(t, dbClient, 1)
+	reverted := insertTestBlock(t, dbClient, 2)
+
+	insert := func(block *models.StarknetBlocks) error {
+		dbClient.BeginTx(context.Background())
+		if err := dbClient.InsertBlock(block); err != nil {
+			dbClient.RollbackTx()
+			return err
+		}
+		dbClient.CommitTx()
+		return nil
+	}
+	replacement := &models.StarknetBlocks{BlockNumber: 2, BlockHash: "0x2002", ParentHash: reverted.ParentHash, Timestamp: 2}
+
+	// Two blocks that are not reverted cannot share a number
+	if err := insert(replacement); err == nil {
+		t.Fatal("Expected a second MINED block 2 to be rejected")
+	}
+
+	dbClient.BeginTx(context.Background())
+	if err := dbClient.RevertBlock(reverted.BlockNumber, reverted.BlockHash); err != nil {
+		dbClient.RollbackTx()
+		t.Fatalf("Failed to revert block: %v", err)
+	}
+	dbClient.CommitTx()
+
+	// The block of the new branch takes the reverted block's number
+	if err := insert(replacement); err != nil {
+		t.Fatalf("Failed to insert the replacement of block 2: %v", err)
+	}
+	blocks, err := dbClient.GetBlocksInRange(1, 2)
+	if err != nil {
+		t.Fatalf("Failed to get blocks: %v", err)
+	}
+	if len(blocks) != 2 || blocks[1].BlockHash != replacement.BlockHash {
+		t.Errorf("Expected blocks 1 and the replacement of 2, got %+v", blocks)
+	}
+	stored, err := dbClient.GetBlock(reverted.BlockHash)
+	if err != nil || stored == nil || stored.Status != models.BlockStatusReverted {
+		t.Errorf("Expected the reverted block to be kept, got %+v, %v", stored, err)
+	}
+}
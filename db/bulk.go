@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"junoplugin/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// InsertBlocks writes blocks with a single COPY, for catchup ranges. Each row still fires the
+// starknet_blocks_insert trigger. Blocks are stored as MINED through the column default.
+func (db *DB) InsertBlocks(blocks []*models.StarknetBlocks) (int64, error) {
+	if db.tx == nil {
+		return 0, errors.New("No transaction found")
+	}
+	if len(blocks) == 0 {
+		return 0, nil
+	}
+
+	rows := pgx.CopyFromSlice(len(blocks), func(i int) ([]any, error) {
+		block := blocks[i]
+		return []any{block.BlockNumber, block.BlockHash, block.ParentHash, block.Timestamp}, nil
+	})
+	count, err := db.tx.CopyFrom(
+		context.Background(),
+		pgx.Identifier{"starknet_blocks"},
+		[]string{"block_number", "block_hash", "parent_hash", "timestamp"},
+		rows,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to copy blocks: %w", err)
+	}
+	return count, nil
+}
+
+// StoreEvents writes events with a single COPY, for catchup ranges. Nonces continue each vault's
+// sequence in slice order, as consecutive StoreEvent calls would number them.
+func (db *DB) StoreEvents(events []*models.Event) (int64, error) {
+	if db.tx == nil {
+		return 0, errors.New("No transaction found")
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	nonces, err := db.eventCounts(events)
+	if err != nil {
+		return 0, err
+	}
+	for _, event := range events {
+		nonces[event.VaultAddress]++
+		event.EventNonce = int(nonces[event.VaultAddress])
+	}
+
+	rows := pgx.CopyFromSlice(len(events), func(i int) ([]any, error) {
+		event := events[i]
+		return []any{
+			int64(event.EventNonce),
+			event.BlockNumber,
+			event.BlockHash,
+			event.VaultAddress,
+			event.EventName,
+			event.EventKeys,
+			event.EventData,
+			event.DecodedData,
+			event.TransactionHash,
+		}, nil
+	})
+	count, err := db.tx.CopyFrom(
+		context.Background(),
+		pgx.Identifier{"events"},
+		[]string{"event_nonce", "block_number", "block_hash", "vault_address", "event_name", "event_keys", "event_data", "decoded_data", "transaction_hash"},
+		rows,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to copy events: %w", err)
+	}
+	return count, nil
+}
+
+// eventCounts returns the number of stored events of each vault in events, in one query
+func (db *DB) eventCounts(events []*models.Event) (map[string]int64, error) {
+	counts := make(map[string]int64)
+	var addresses []string
+	for _, event := range events {
+		if _, ok := counts[event.VaultAddress]; !ok {
+			counts[event.VaultAddress] = 0
+			addresses = append(addresses, event.VaultAddress)
+		}
+	}
+
+	query := `
+	SELECT vault_address, COUNT(*)
+	FROM events
+	WHERE vault_address = ANY($1)
+	GROUP BY vault_address`
+	rows, err := db.tx.Query(context.Background(), query, addresses)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count events: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var address string
+		var count int64
+		if err := rows.Scan(&address, &count); err != nil {
+			return nil, err
+		}
+		counts[address] = count
+	}
+	return counts, rows.Err()
+}
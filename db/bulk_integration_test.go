@@ -0,0 +1,278 @@
+//go:build integration
+
+package db_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"junoplugin/db"
+	"junoplugin/db/dbtest"
+	"junoplugin/models"
+	"testing"
+)
+
+func testBlocks(from, count uint64) []*models.StarknetBlocks {
+	blocks := make([]*models.StarknetBlocks, 0, count)
+	for number := from; number < from+count; number++ {
+		blocks = append(blocks, &models.StarknetBlocks{
+			BlockNumber: number,
+			BlockHash:   fmt.Sprintf("0x%x", 0x1000+number),
+			ParentHash:  fmt.Sprintf("0x%x", 0x1000+number-1),
+			Timestamp:   number,
+		})
+	}
+	return blocks
+}
+
+// testEvents spreads count events over vaults, ten per block
+func testEvents(count int, vaults ...string) []*models.Event {
+	events := make([]*models.Event, 0, count)
+	for i := 0; i < count; i++ {
+		blockNumber := uint64(i / 10)
+		events = append(events, &models.Event{
+			TransactionHash: fmt.Sprintf("0x%x", 0x2000+i),
+			BlockNumber:     blockNumber,
+			BlockHash:       fmt.Sprintf("0x%x", 0x1000+blockNumber),
+			VaultAddress:    vaults[i%len(vaults)],
+			EventName:       "Deposit",
+			EventKeys:       []string{"0x1"},
+			EventData:       []string{"0x2", "0x3"},
+		})
+	}
+	return events
+}
+
+func TestInsertBlocks(t *testing.T) {
+	dbClient, dbURL := dbtest.New(t)
+	notifications := listenBlockNotifications(t, dbURL)
+
+	dbClient.BeginTx(context.Background())
+	count, err := dbClient.InsertBlocks(testBlocks(1, 3))
+	if err != nil {
+		dbClient.RollbackTx()
+		t.Fatalf("Failed to insert blocks: %v", err)
+	}
+	dbClient.CommitTx()
+	if count != 3 {
+		t.Errorf("Expected 3 blocks copied, got %d", count)
+	}
+
+	// COPY fires the row triggers like single inserts
+	for number := uint64(1); number <= 3; number++ {
+		notifications.expect("starknet_blocks_insert", number)
+	}
+
+	blocks, err := dbClient.GetBlocksInRange(1, 3)
+	if err != nil {
+		t.Fatalf("Failed to read blocks: %v", err)
+	}
+	if len(blocks) != 3 {
+		t.Fatalf("Expected 3 blocks, got %d", len(blocks))
+	}
+	head, err := dbClient.GetLastBlock()
+	if err != nil || head == nil {
+		t.Fatalf("Failed to read head: %v", err)
+	}
+	if head.BlockNumber != 3 || head.Status != models.BlockStatusMined {
+		t.Errorf("Expected head 3 MINED, got %d %s", head.BlockNumber, head.Status)
+	}
+}
+
+func TestStoreEventsAssignsNonces(t *testing.T) {
+	dbClient, _ := dbtest.New(t)
+
+	dbClient.BeginTx(context.Background())
+	if err := dbClient.StoreEvent("0x1", "0xa", 1, "0x1001", "Deposit", []string{"0x1"}, []string{}, nil); err != nil {
+		dbClient.RollbackTx()
+		t.Fatalf("Failed to store event: %v", err)
+	}
+	events := testEvents(5, "0xa", "0xb")
+	if _, err := dbClient.StoreEvents(events); err != nil {
+		dbClient.RollbackTx()
+		t.Fatalf("Failed to store events: %v", err)
+	}
+	dbClient.CommitTx()
+
+	// 0xa already has one event, so its batch continues at 2
+	expected := []int{2, 1, 3, 2, 4}
+	for i, event := range events {
+		if event.EventNonce != expected[i] {
+			t.Errorf("Expected event %d to get nonce %d, got %d", i, expected[i], event.EventNonce)
+		}
+	}
+
+	rows, err := dbClient.Pool.Query(context.Background(), "SELECT vault_address, event_nonce FROM events ORDER BY vault_address, event_nonce")
+	if err != nil {
+		t.Fatalf("Failed to read events: %v", err)
+	}
+	defer rows.Close()
+	var stored []string
+	for rows.Next() {
+		var address string
+		var nonce int64
+		if err := rows.Scan(&address, &nonce); err != nil {
+			t.Fatalf("Failed to scan event: %v", err)
+		}
+		stored = append(stored, fmt.Sprintf("%s/%d", address, nonce))
+	}
+	if fmt.Sprint(stored) != "[0xa/1 0xa/2 0xa/3 0xa/4 0xb/1 0xb/2]" {
+		t.Errorf("Expected contiguous nonces per vault, got %v", stored)
+	}
+}
+
+// BenchmarkStoreEvents writes a 10k event catchup range row by row and with COPY. Each run is
+// rolled back so the nonce counts start from the same table.
+func BenchmarkStoreEvents(b *testing.B) {
+	dbClient, _ := dbtest.New(b)
+	events := testEvents(10_000, "0xa", "0xb", "0xc")
+
+	benchmarks := []struct {
+		name  string
+		store func(tx *db.DB) error
+	}{
+		{"row by row", func(tx *db.DB) error {
+			for _, event := range events {
+				if err := tx.StoreEvent(event.TransactionHash, event.VaultAddress, event.BlockNumber, event.BlockHash, event.EventName, event.EventKeys, event.EventData, event.DecodedData); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"copy", func(tx *db.DB) error {
+			_, err := tx.StoreEvents(events)
+			return err
+		}},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for b.Loop() {
+				tx, err := dbClient.Begin(context.Background())
+				if err != nil {
+					b.Fatalf("Failed to begin: %v", err)
+				}
+				if err := bm.store(tx); err != nil {
+					tx.Rollback()
+					b.Fatalf("Failed to store events: %v", err)
+				}
+				tx.Rollback()
+			}
+			b.ReportMetric(float64(len(events)*b.N)/b.Elapsed().Seconds(), "events/s")
+		})
+	}
+}
+
+// BenchmarkInsertBlocks writes a 10k block catchup range row by row and with COPY
+func BenchmarkInsertBlocks(b *testing.B) {
+	dbClient, _ := dbtest.New(b)
+	blocks := testBlocks(1, 10_000)
+
+	benchmarks := []struct {
+		name   string
+		insert func(tx *db.DB) error
+	}{
+		{"row by row", func(tx *db.DB) error {
+			for _, block := range blocks {
+				if err := tx.InsertBlock(block); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+		{"copy", func(tx *db.DB) error {
+			_, err := tx.InsertBlocks(blocks)
+			return err
+		}},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for b.Loop() {
+				tx, err := dbClient.Begin(context.Background())
+				if err != nil {
+					b.Fatalf("Failed to begin: %v", err)
+				}
+				if err := bm.insert(tx); err != nil {
+					tx.Rollback()
+					b.Fatalf("Failed to insert blocks: %v", err)
+				}
+				tx.Rollback()
+			}
+			b.ReportMetric(float64(len(blocks)*b.N)/b.Elapsed().Seconds(), "blocks/s")
+		})
+	}
+}
+
+func TestStoreEventsDecodedData(t *testing.T) {
+	dbClient, _ := dbtest.New(t)
+
+	events := testEvents(2, "0xa")
+	events[0].DecodedData = json.RawMessage(`{"amount": "5", "account": "0x1"}`)
+	dbClient.BeginTx(context.Background())
+	if err := dbClient.StoreEvent("0x1", "0xb", 1, "0x1001", "Deposit", []string{"0x1"}, []string{}, json.RawMessage(`{"amount": "7"}`)); err != nil {
+		dbClient.RollbackTx()
+		t.Fatalf("Failed to store event: %v", err)
+	}
+	if _, err := dbClient.StoreEvents(events); err != nil {
+		dbClient.RollbackTx()
+		t.Fatalf("Failed to store events: %v", err)
+	}
+	dbClient.CommitTx()
+
+	rows, err := dbClient.Pool.Query(context.Background(), "SELECT decoded_data->>'amount' FROM events ORDER BY vault_address, event_nonce")
+	if err != nil {
+		t.Fatalf("Failed to read events: %v", err)
+	}
+	defer rows.Close()
+	var amounts []string
+	for rows.Next() {
+		var amount *string
+		if err := rows.Scan(&amount); err != nil {
+			t.Fatalf("Failed to scan event: %v", err)
+		}
+		if amount == nil {
+			amounts = append(amounts, "NULL")
+			continue
+		}
+		amounts = append(amounts, *amount)
+	}
+	if fmt.Sprint(amounts) != "[5 NULL 7]" {
+		t.Errorf("Expected the decoded amounts of both write paths, got %v", amounts)
+	}
+}
+
+func TestGetVaultEventsInRange(t *testing.T) {
+	dbClient, _ := dbtest.New(t)
+
+	// Blocks 0 to 3 with five events of each vault
+	dbClient.BeginTx(context.Background())
+	if _, err := dbClient.StoreEvents(testEvents(40, "0xa", "0xb")); err != nil {
+		dbClient.RollbackTx()
+		t.Fatalf("Failed to store events: %v", err)
+	}
+	dbClient.CommitTx()
+
+	var pages [][]int
+	for afterNonce := 0; ; {
+		events, err := dbClient.GetVaultEventsInRange("0xa", 1, 2, afterNonce, 4)
+		if err != nil {
+			t.Fatalf("Failed to get events: %v", err)
+		}
+		if len(events) == 0 {
+			break
+		}
+		var nonces []int
+		for _, event := range events {
+			if event.VaultAddress != "0xa" || event.BlockNumber < 1 || event.BlockNumber > 2 {
+				t.Errorf("Expected events of 0xa in blocks 1-2, got %+v", event)
+			}
+			nonces = append(nonces, event.EventNonce)
+		}
+		pages = append(pages, nonces)
+		afterNonce = nonces[len(nonces)-1]
+	}
+	if fmt.Sprint(pages) != "[[6 7 8 9] [10 11 12 13] [14 15]]" {
+		t.Errorf("Expected the nonces of blocks 1-2 in pages of 4, got %v", pages)
+	}
+}
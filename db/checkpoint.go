@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"junoplugin/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetVaultCheckpoint returns the vault's partly committed catchup window, nil when there is none
+func (db *DB) GetVaultCheckpoint(address string) (*models.VaultCheckpoint, error) {
+	query := `
+	SELECT vault_address, block_number, window_end, continuation_token, target_block, events_stored, updated_at
+	FROM vault_catchup_checkpoints
+	WHERE vault_address = $1`
+	var checkpoint models.VaultCheckpoint
+	err := db.Pool.QueryRow(context.Background(), query, address).Scan(
+		&checkpoint.VaultAddress,
+		&checkpoint.BlockNumber,
+		&checkpoint.WindowEnd,
+		&checkpoint.ContinuationToken,
+		&checkpoint.TargetBlock,
+		&checkpoint.EventsStored,
+		&checkpoint.UpdatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// SaveVaultCheckpoint records the progress of a catchup window, in the transaction that stored its pages
+func (db *DB) SaveVaultCheckpoint(checkpoint *models.VaultCheckpoint) error {
+	if db.tx == nil {
+		return errors.New("No transaction found")
+	}
+	query := `
+	INSERT INTO vault_catchup_checkpoints
+	(vault_address, block_number, window_end, continuation_token, target_block, events_stored, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, NOW())
+	ON CONFLICT (vault_address) DO UPDATE SET
+		block_number = EXCLUDED.block_number,
+		window_end = EXCLUDED.window_end,
+		continuation_token = EXCLUDED.continuation_token,
+		target_block = EXCLUDED.target_block,
+		events_stored = EXCLUDED.events_stored,
+		updated_at = EXCLUDED.updated_at`
+	_, err := db.tx.Exec(
+		context.Background(),
+		query,
+		checkpoint.VaultAddress,
+		checkpoint.BlockNumber,
+		checkpoint.WindowEnd,
+		checkpoint.ContinuationToken,
+		checkpoint.TargetBlock,
+		checkpoint.EventsStored,
+	)
+	return err
+}
+
+// DeleteVaultCheckpoint removes the vault's checkpoint once its window is committed or abandoned
+func (db *DB) DeleteVaultCheckpoint(address string) error {
+	if db.tx == nil {
+		return errors.New("No transaction found")
+	}
+	_, err := db.tx.Exec(context.Background(), `DELETE FROM vault_catchup_checkpoints WHERE vault_address = $1`, address)
+	return err
+}
@@ -0,0 +1,102 @@
+//go:build integration
+
+package db_test
+
+import (
+	"context"
+	"junoplugin/db/dbtest"
+	"junoplugin/models"
+	"testing"
+)
+
+func TestVaultCheckpoint(t *testing.T) {
+	dbClient, _ := dbtest.New(t)
+	const address = "0xabc"
+
+	tx, err := dbClient.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	if err := tx.InsertVault(&models.VaultRegistry{Address: address, DeployedAt: "0x1"}); err != nil {
+		tx.Rollback()
+		t.Fatalf("Failed to insert vault: %v", err)
+	}
+	for _, token := range []string{"page-2", "page-3"} {
+		if err := tx.SaveVaultCheckpoint(&models.VaultCheckpoint{
+			VaultAddress:      address,
+			BlockNumber:       100,
+			WindowEnd:         199,
+			ContinuationToken: token,
+			TargetBlock:       500,
+			EventsStored:      42,
+		}); err != nil {
+			tx.Rollback()
+			t.Fatalf("Failed to save checkpoint: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	checkpoint, err := dbClient.GetVaultCheckpoint(address)
+	if err != nil || checkpoint == nil {
+		t.Fatalf("Failed to read checkpoint: %v", err)
+	}
+	if checkpoint.BlockNumber != 100 || checkpoint.WindowEnd != 199 || checkpoint.ContinuationToken != "page-3" ||
+		checkpoint.TargetBlock != 500 || checkpoint.EventsStored != 42 {
+		t.Errorf("Expected the latest checkpoint, got %+v", checkpoint)
+	}
+
+	// Resetting the vault's cursor drops the checkpoint with it
+	tx, err = dbClient.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	if err := tx.ResetVaultRegistry(address); err != nil {
+		tx.Rollback()
+		t.Fatalf("Failed to reset vault: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	checkpoint, err = dbClient.GetVaultCheckpoint(address)
+	if err != nil {
+		t.Fatalf("Failed to read checkpoint: %v", err)
+	}
+	if checkpoint != nil {
+		t.Errorf("Expected no checkpoint after reset, got %+v", checkpoint)
+	}
+}
+
+func TestVaultCheckpointDeletedWithVault(t *testing.T) {
+	dbClient, _ := dbtest.New(t)
+	const address = "0xabc"
+
+	tx, err := dbClient.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	if err := tx.InsertVault(&models.VaultRegistry{Address: address, DeployedAt: "0x1"}); err != nil {
+		tx.Rollback()
+		t.Fatalf("Failed to insert vault: %v", err)
+	}
+	if err := tx.SaveVaultCheckpoint(&models.VaultCheckpoint{VaultAddress: address, BlockNumber: 1, WindowEnd: 10, ContinuationToken: "page-2", TargetBlock: 10}); err != nil {
+		tx.Rollback()
+		t.Fatalf("Failed to save checkpoint: %v", err)
+	}
+	if _, err := tx.DeleteVault(address, false); err != nil {
+		tx.Rollback()
+		t.Fatalf("Failed to delete vault: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	checkpoint, err := dbClient.GetVaultCheckpoint(address)
+	if err != nil {
+		t.Fatalf("Failed to read checkpoint: %v", err)
+	}
+	if checkpoint != nil {
+		t.Errorf("Expected the checkpoint to be deleted with the vault, got %+v", checkpoint)
+	}
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"junoplugin/models"
+)
+
+// StoreVaultClass records the class a vault has from a block on, replacing a row stored for that block
+func (db *DB) StoreVaultClass(class *models.VaultClass) error {
+	if db.tx == nil {
+		return errors.New("No transaction found")
+	}
+	query := `
+	INSERT INTO vault_class_history (vault_address, block_number, block_hash, class_hash)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (vault_address, block_number) DO UPDATE SET
+		block_hash = EXCLUDED.block_hash,
+		class_hash = EXCLUDED.class_hash`
+	_, err := db.tx.Exec(context.Background(), query, class.VaultAddress, class.BlockNumber, class.BlockHash, class.ClassHash)
+	return err
+}
+
+// GetVaultClassHistory returns a vault's classes in block order
+func (db *DB) GetVaultClassHistory(address string) ([]*models.VaultClass, error) {
+	query := `
+	SELECT vault_address, block_number, block_hash, class_hash
+	FROM vault_class_history
+	WHERE vault_address = $1
+	ORDER BY block_number`
+	rows, err := db.Pool.Query(context.Background(), query, address)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []*models.VaultClass
+	for rows.Next() {
+		var class models.VaultClass
+		if err := rows.Scan(&class.VaultAddress, &class.BlockNumber, &class.BlockHash, &class.ClassHash); err != nil {
+			return nil, err
+		}
+		history = append(history, &class)
+	}
+	return history, rows.Err()
+}
+
+// RevertVaultClasses deletes the class changes recorded in a reverted block
+func (db *DB) RevertVaultClasses(blockNumber uint64, blockHash string) (int64, error) {
+	if db.tx == nil {
+		return 0, errors.New("No transaction found")
+	}
+	res, err := db.tx.Exec(context.Background(), `DELETE FROM vault_class_history WHERE block_number = $1 AND block_hash = $2`, blockNumber, blockHash)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// StoreVaultUpgradedEvent stores a VaultUpgraded driver event for the block a vault's class changed in
+func (db *DB) StoreVaultUpgradedEvent(vaultAddress string, blockHash string) error {
+	if db.tx == nil {
+		return errors.New("No transaction found")
+	}
+
+	// Store event in database with sequence index (triggers NOTIFY automatically)
+	query := `
+	INSERT INTO driver_events
+	(sequence_index, type, vault_address, block_hash, timestamp)
+	VALUES (nextval('driver_events_sequence'), $1, $2, $3, NOW())`
+	_, err := db.tx.Exec(context.Background(), query, "VaultUpgraded", vaultAddress, blockHash)
+	return err
+}
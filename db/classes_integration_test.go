@@ -0,0 +1,85 @@
+//go:build integration
+
+package db_test
+
+import (
+	"context"
+	"junoplugin/db/dbtest"
+	"junoplugin/models"
+	"testing"
+)
+
+func TestVaultClassHistory(t *testing.T) {
+	dbClient, _ := dbtest.New(t)
+	const vault = "0xabc"
+
+	tx, err := dbClient.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	for _, class := range []*models.VaultClass{
+		{VaultAddress: vault, BlockNumber: 20, BlockHash: "0xa20", ClassHash: "0x2"},
+		{VaultAddress: vault, BlockNumber: 10, BlockHash: "0xa10", ClassHash: "0x1"},
+		{VaultAddress: "0xdef", BlockNumber: 20, BlockHash: "0xa20", ClassHash: "0x1"},
+	} {
+		if err := tx.StoreVaultClass(class); err != nil {
+			tx.Rollback()
+			t.Fatalf("Failed to store vault class: %v", err)
+		}
+	}
+	if err := tx.StoreVaultUpgradedEvent(vault, "0xa20"); err != nil {
+		tx.Rollback()
+		t.Fatalf("Failed to store upgraded event: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	history, err := dbClient.GetVaultClassHistory(vault)
+	if err != nil {
+		t.Fatalf("Failed to read class history: %v", err)
+	}
+	if len(history) != 2 || history[0].ClassHash != "0x1" || history[1].ClassHash != "0x2" {
+		t.Fatalf("Expected classes 0x1 then 0x2, got %+v", history)
+	}
+
+	var upgrades int
+	err = dbClient.Pool.QueryRow(context.Background(),
+		`SELECT count(*) FROM driver_events WHERE type = 'VaultUpgraded' AND vault_address = $1 AND block_hash = $2`,
+		vault, "0xa20").Scan(&upgrades)
+	if err != nil {
+		t.Fatalf("Failed to count driver events: %v", err)
+	}
+	if upgrades != 1 {
+		t.Errorf("Expected 1 VaultUpgraded event, got %d", upgrades)
+	}
+
+	tx, err = dbClient.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	// A revert of another block with the same number leaves the rows alone
+	if deleted, err := tx.RevertVaultClasses(20, "0xb20"); err != nil || deleted != 0 {
+		tx.Rollback()
+		t.Fatalf("Expected no rows reverted for another hash, got %d: %v", deleted, err)
+	}
+	deleted, err := tx.RevertVaultClasses(20, "0xa20")
+	if err != nil {
+		tx.Rollback()
+		t.Fatalf("Failed to revert vault classes: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 rows reverted, got %d", deleted)
+	}
+
+	history, err = dbClient.GetVaultClassHistory(vault)
+	if err != nil {
+		t.Fatalf("Failed to read class history: %v", err)
+	}
+	if len(history) != 1 || history[0].ClassHash != "0x1" {
+		t.Errorf("Expected only class 0x1 after the revert, got %+v", history)
+	}
+}
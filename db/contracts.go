@@ -0,0 +1,143 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"junoplugin/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// GetTrackedContracts returns the tracked contracts of the tracked_contracts table by address
+func (db *DB) GetTrackedContracts() ([]*models.TrackedContract, error) {
+	query := `
+	SELECT address, kind, start_block, COALESCE(abi, '')
+	FROM tracked_contracts
+	ORDER BY address`
+	rows, err := db.Pool.Query(context.Background(), query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contracts []*models.TrackedContract
+	for rows.Next() {
+		var contract models.TrackedContract
+		if err := rows.Scan(&contract.Address, &contract.Kind, &contract.StartBlock, &contract.ABI); err != nil {
+			return nil, err
+		}
+		contracts = append(contracts, &contract)
+	}
+	return contracts, rows.Err()
+}
+
+// UpsertTrackedContract adds a contract to tracked_contracts, replacing the kind, start block and ABI
+// of one already tracked
+func (db *DB) UpsertTrackedContract(contract *models.TrackedContract) error {
+	if db.tx == nil {
+		return errors.New("No transaction found")
+	}
+	query := `
+	INSERT INTO tracked_contracts (address, kind, start_block, abi)
+	VALUES ($1, $2, $3, NULLIF($4, ''))
+	ON CONFLICT (address) DO UPDATE SET
+		kind = EXCLUDED.kind,
+		start_block = EXCLUDED.start_block,
+		abi = EXCLUDED.abi`
+	_, err := db.tx.Exec(context.Background(), query, contract.Address, contract.Kind, contract.StartBlock, contract.ABI)
+	return err
+}
+
+// DeleteTrackedContract removes a contract from tracked_contracts, optionally purging its indexed events
+func (db *DB) DeleteTrackedContract(address string, purgeEvents bool) (bool, error) {
+	if db.tx == nil {
+		return false, errors.New("No transaction found")
+	}
+	res, err := db.tx.Exec(context.Background(), `DELETE FROM tracked_contracts WHERE address = $1`, address)
+	if err != nil {
+		return false, err
+	}
+	if res.RowsAffected() == 0 {
+		return false, nil
+	}
+	if purgeEvents {
+		if _, err := db.tx.Exec(context.Background(), `DELETE FROM contract_events WHERE contract_address = $1`, address); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// contractEventColumns are the columns of contract_events in the order contractEventRow returns them
+var contractEventColumns = []string{
+	"contract_address", "kind", "block_number", "block_hash", "transaction_hash", "event_name",
+	"event_keys", "event_data", "decoded_data", "subscription", "vault_address",
+}
+
+// contractEventRow returns the values of an event's contract_events row, empty strings as NULL
+func contractEventRow(event *models.ContractEvent) []any {
+	return []any{
+		event.ContractAddress, event.Kind, event.BlockNumber, event.BlockHash, event.TransactionHash, event.EventName,
+		event.EventKeys, event.EventData, event.DecodedData, nullIfEmpty(event.Subscription), nullIfEmpty(event.VaultAddress),
+	}
+}
+
+// nullIfEmpty maps an empty string to NULL
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// StoreContractEvent stores an event of a tracked contract or subscription
+func (db *DB) StoreContractEvent(event *models.ContractEvent) error {
+	if db.tx == nil {
+		return errors.New("No transaction found")
+	}
+	query := `
+	INSERT INTO contract_events
+	(contract_address, kind, block_number, block_hash, transaction_hash, event_name, event_keys, event_data, decoded_data, subscription, vault_address)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	_, err := db.tx.Exec(context.Background(), query, contractEventRow(event)...)
+	return err
+}
+
+// ReplaceVaultSubscriptionEvents replaces the events the subscriptions named matched for a vault in
+// [fromBlock, toBlock] with events, so catching up a range again does not duplicate them
+func (db *DB) ReplaceVaultSubscriptionEvents(vaultAddress string, fromBlock, toBlock uint64, subscriptions []string, events []*models.ContractEvent) (int64, error) {
+	if db.tx == nil {
+		return 0, errors.New("No transaction found")
+	}
+	query := `
+	DELETE FROM contract_events
+	WHERE vault_address = $1 AND block_number BETWEEN $2 AND $3 AND subscription = ANY($4)`
+	if _, err := db.tx.Exec(context.Background(), query, vaultAddress, fromBlock, toBlock, subscriptions); err != nil {
+		return 0, err
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	rows := pgx.CopyFromSlice(len(events), func(i int) ([]any, error) {
+		return contractEventRow(events[i]), nil
+	})
+	count, err := db.tx.CopyFrom(context.Background(), pgx.Identifier{"contract_events"}, contractEventColumns, rows)
+	if err != nil {
+		return 0, fmt.Errorf("failed to copy subscription events: %w", err)
+	}
+	return count, nil
+}
+
+// RevertContractEvents deletes the tracked contract events of a reverted block
+func (db *DB) RevertContractEvents(blockNumber uint64, blockHash string) (int64, error) {
+	if db.tx == nil {
+		return 0, errors.New("No transaction found")
+	}
+	res, err := db.tx.Exec(context.Background(), `DELETE FROM contract_events WHERE block_number = $1 AND block_hash = $2`, blockNumber, blockHash)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
@@ -0,0 +1,158 @@
+//go:build integration
+
+package db_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"junoplugin/db/dbtest"
+	"junoplugin/models"
+	"reflect"
+	"testing"
+)
+
+func TestTrackedContracts(t *testing.T) {
+	dbClient, _ := dbtest.New(t)
+
+	tx, err := dbClient.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	for _, contract := range []*models.TrackedContract{
+		{Address: "0x49d", Kind: models.ContractKindERC20, StartBlock: 10},
+		{Address: "0xf05", Kind: models.ContractKindOracle, StartBlock: 20, ABI: "fossil.json"},
+		// Re-adding a contract replaces its settings
+		{Address: "0x49d", Kind: models.ContractKindERC20, StartBlock: 15},
+	} {
+		if err := tx.UpsertTrackedContract(contract); err != nil {
+			tx.Rollback()
+			t.Fatalf("Failed to upsert tracked contract: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	contracts, err := dbClient.GetTrackedContracts()
+	if err != nil {
+		t.Fatalf("Failed to read tracked contracts: %v", err)
+	}
+	if len(contracts) != 2 ||
+		*contracts[0] != (models.TrackedContract{Address: "0x49d", Kind: models.ContractKindERC20, StartBlock: 15}) ||
+		*contracts[1] != (models.TrackedContract{Address: "0xf05", Kind: models.ContractKindOracle, StartBlock: 20, ABI: "fossil.json"}) {
+		t.Fatalf("Expected the 2 contracts as last upserted, got %+v", contracts)
+	}
+
+	tx, err = dbClient.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	for _, event := range []*models.ContractEvent{
+		{ContractAddress: "0x49d", Kind: models.ContractKindERC20, BlockNumber: 20, BlockHash: "0xa20", TransactionHash: "0x1", EventName: "Transfer", EventKeys: []string{"0x99"}, EventData: []string{}, DecodedData: json.RawMessage(`{"value":"5"}`)},
+		{ContractAddress: "0x49d", Kind: models.ContractKindERC20, BlockNumber: 21, BlockHash: "0xa21", TransactionHash: "0x2", EventName: "Transfer", EventKeys: []string{"0x99"}, EventData: []string{}},
+		{ContractAddress: "0xf05", Kind: models.ContractKindOracle, BlockNumber: 21, BlockHash: "0xa21", TransactionHash: "0x3", EventName: "Unknown", EventKeys: []string{"0x98"}, EventData: []string{"0x1"}},
+	} {
+		if err := tx.StoreContractEvent(event); err != nil {
+			tx.Rollback()
+			t.Fatalf("Failed to store contract event: %v", err)
+		}
+	}
+	// A revert of another block with the same number leaves the rows alone
+	if deleted, err := tx.RevertContractEvents(21, "0xb21"); err != nil || deleted != 0 {
+		tx.Rollback()
+		t.Fatalf("Expected no rows reverted for another hash, got %d: %v", deleted, err)
+	}
+	deleted, err := tx.RevertContractEvents(21, "0xa21")
+	if err != nil {
+		tx.Rollback()
+		t.Fatalf("Failed to revert contract events: %v", err)
+	}
+	if deleted != 2 {
+		tx.Rollback()
+		t.Fatalf("Expected 2 rows reverted, got %d", deleted)
+	}
+	if removed, err := tx.DeleteTrackedContract("0x49d", true); err != nil || !removed {
+		tx.Rollback()
+		t.Fatalf("Expected the contract removed, got %v: %v", removed, err)
+	}
+	if removed, err := tx.DeleteTrackedContract("0x49d", true); err != nil || removed {
+		tx.Rollback()
+		t.Fatalf("Expected no contract left to remove, got %v: %v", removed, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	var events int
+	if err := dbClient.Pool.QueryRow(context.Background(), `SELECT count(*) FROM contract_events`).Scan(&events); err != nil {
+		t.Fatalf("Failed to count contract events: %v", err)
+	}
+	if events != 0 {
+		t.Errorf("Expected the purged contract's events deleted, got %d events", events)
+	}
+	contracts, err = dbClient.GetTrackedContracts()
+	if err != nil {
+		t.Fatalf("Failed to read tracked contracts: %v", err)
+	}
+	if len(contracts) != 1 || contracts[0].Address != "0xf05" {
+		t.Errorf("Expected only 0xf05 left, got %+v", contracts)
+	}
+}
+
+func TestReplaceVaultSubscriptionEvents(t *testing.T) {
+	dbClient, _ := dbtest.New(t)
+
+	match := func(subscription, vault string, blockNumber uint64, txHash string) *models.ContractEvent {
+		return &models.ContractEvent{ContractAddress: "0x49d", Kind: models.ContractKindSubscription, BlockNumber: blockNumber, BlockHash: "0xa", TransactionHash: txHash, EventName: "Transfer", EventKeys: []string{"0x99", "0x1", vault}, EventData: []string{}, Subscription: subscription, VaultAddress: vault}
+	}
+	tx, err := dbClient.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	for _, event := range []*models.ContractEvent{
+		match("transfers_in", "0xbeef", 5, "0x1"),
+		match("transfers_in", "0xbeef", 6, "0x2"),
+		// Subscriptions not backfilled and other vaults keep their rows
+		match("by_data", "0xbeef", 5, "0x1"),
+		match("transfers_in", "0xcafe", 5, "0x3"),
+	} {
+		if err := tx.StoreContractEvent(event); err != nil {
+			tx.Rollback()
+			t.Fatalf("Failed to store contract event: %v", err)
+		}
+	}
+	stored, err := tx.ReplaceVaultSubscriptionEvents("0xbeef", 5, 10, []string{"transfers_in"}, []*models.ContractEvent{match("transfers_in", "0xbeef", 6, "0x2")})
+	if err != nil {
+		tx.Rollback()
+		t.Fatalf("Failed to replace subscription events: %v", err)
+	}
+	if stored != 1 {
+		tx.Rollback()
+		t.Fatalf("Expected 1 event stored, got %d", stored)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	rows, err := dbClient.Pool.Query(context.Background(), `
+	SELECT subscription, vault_address, block_number FROM contract_events
+	ORDER BY subscription, vault_address, block_number`)
+	if err != nil {
+		t.Fatalf("Failed to read contract events: %v", err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var subscription, vault string
+		var blockNumber uint64
+		if err := rows.Scan(&subscription, &vault, &blockNumber); err != nil {
+			t.Fatalf("Failed to scan contract event: %v", err)
+		}
+		got = append(got, fmt.Sprintf("%s/%s/%d", subscription, vault, blockNumber))
+	}
+	expected := []string{"by_data/0xbeef/5", "transfers_in/0xbeef/6", "transfers_in/0xcafe/5"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
@@ -2,9 +2,9 @@ package db
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"junoplugin/models"
-	"log"
 
 	"github.com/jackc/pgx/v5"
 )
@@ -16,7 +16,8 @@ func (db *DB) GetVaultRegistry() ([]*models.VaultRegistry, error) {
 		vault_address,
 		deployed_at,
 		last_block_indexed,
-		last_block_processed
+		last_block_processed,
+		paused
 	FROM vault_registry`
 	rows, err := db.Pool.Query(context.Background(), query)
 	if err != nil {
@@ -29,7 +30,7 @@ func (db *DB) GetVaultRegistry() ([]*models.VaultRegistry, error) {
 
 	for rows.Next() {
 		var vault models.VaultRegistry
-		if err := rows.Scan(&vault.Address, &vault.DeployedAt, &vault.LastBlockIndexed, &vault.LastBlockProcessed); err != nil {
+		if err := rows.Scan(&vault.Address, &vault.DeployedAt, &vault.LastBlockIndexed, &vault.LastBlockProcessed, &vault.Paused); err != nil {
 			return nil, err
 		}
 		vaultRegistry = append(vaultRegistry, &vault)
@@ -50,23 +51,37 @@ func (db *DB) InsertBlock(block *models.StarknetBlocks) error {
 	parent_hash,
 	timestamp,
 	status)
-	VALUES ($1, $2, $3, $4, 'MINED')
+	VALUES ($1, $2, $3, $4, $5)
 	`
-	res, err := db.tx.Exec(context.Background(), query, block.BlockNumber, hash, parentHash, block.Timestamp)
-
-	log.Printf("STORAGE RESULT %v %v", res, err)
+	_, err := db.tx.Exec(context.Background(), query, block.BlockNumber, hash, parentHash, block.Timestamp, models.BlockStatusMined)
 	return err
 }
 
 func (db *DB) RevertBlock(blockNumber uint64, blockHash string) error {
 	query := `
 	UPDATE starknet_blocks
-	SET status = 'REVERTED'
+	SET status = $3
 	WHERE block_number = $1 and block_hash = $2`
-	_, err := db.tx.Exec(context.Background(), query, blockNumber, blockHash)
+	_, err := db.tx.Exec(context.Background(), query, blockNumber, blockHash, models.BlockStatusReverted)
 	return err
 }
 
+// FinalizeBlocks marks the MINED blocks up to and including blockNumber as FINALIZED
+func (db *DB) FinalizeBlocks(blockNumber uint64) (int64, error) {
+	if db.tx == nil {
+		return 0, errors.New("No transaction found")
+	}
+	query := `
+	UPDATE starknet_blocks
+	SET status = $2
+	WHERE block_number <= $1 AND status = $3`
+	res, err := db.tx.Exec(context.Background(), query, blockNumber, models.BlockStatusFinalized, models.BlockStatusMined)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
 func (db *DB) GetVaultRegistryByAddress(address string) (models.VaultRegistry, error) {
 	var vaultRegistry models.VaultRegistry
 	query := `
@@ -74,7 +89,8 @@ func (db *DB) GetVaultRegistryByAddress(address string) (models.VaultRegistry, e
 		vault_address,
 		deployed_at,
 		last_block_indexed,
-		last_block_processed
+		last_block_processed,
+		paused
 	FROM vault_registry
 	WHERE vault_address = $1`
 
@@ -83,6 +99,7 @@ func (db *DB) GetVaultRegistryByAddress(address string) (models.VaultRegistry, e
 		&vaultRegistry.DeployedAt,
 		&vaultRegistry.LastBlockIndexed,
 		&vaultRegistry.LastBlockProcessed,
+		&vaultRegistry.Paused,
 	)
 	return vaultRegistry, err
 }
@@ -90,10 +107,9 @@ func (db *DB) GetVaultRegistryByAddress(address string) (models.VaultRegistry, e
 func (db *DB) GetNextBlock(hash string) (*models.StarknetBlocks, error) {
 	var block models.StarknetBlocks
 
-	log.Printf("Getting next block: %v", hash)
 	query := `
 	SELECT block_number, block_hash, parent_hash, timestamp, status FROM starknet_blocks
-	WHERE parent_hash = $1`
+	WHERE parent_hash = $1 AND status <> 'REVERTED'`
 	err := db.Pool.QueryRow(context.Background(), query, hash).Scan(&block.BlockNumber, &block.BlockHash, &block.ParentHash, &block.Timestamp, &block.Status)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -106,9 +122,9 @@ func (db *DB) GetNextBlock(hash string) (*models.StarknetBlocks, error) {
 func (db *DB) GetBlock(hash string) (*models.StarknetBlocks, error) {
 	var block models.StarknetBlocks
 	query := `
-	SELECT * FROM starknet_blocks
+	SELECT block_number, block_hash, parent_hash, timestamp, status FROM starknet_blocks
 	WHERE block_hash = $1`
-	err := db.Pool.QueryRow(context.Background(), query, hash).Scan(&block)
+	err := db.Pool.QueryRow(context.Background(), query, hash).Scan(&block.BlockNumber, &block.BlockHash, &block.ParentHash, &block.Timestamp, &block.Status)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, nil
@@ -128,12 +144,12 @@ func (db *DB) GetLastIndexedBlockVault(address string) (uint64, error) {
 func (db *DB) GetLastBlock() (*models.StarknetBlocks, error) {
 	var lastBlock models.StarknetBlocks
 	query := `
-	SELECT block_number, block_hash, parent_hash, timestamp FROM starknet_blocks
-	WHERE STATUS = 'MINED'
+	SELECT block_number, block_hash, parent_hash, timestamp, status FROM starknet_blocks
+	WHERE status <> 'REVERTED'
 	ORDER BY block_number DESC
 	LIMIT 1`
 	if db.tx == nil {
-		err := db.Pool.QueryRow(context.Background(), query).Scan(&lastBlock.BlockNumber, &lastBlock.BlockHash, &lastBlock.ParentHash, &lastBlock.Timestamp)
+		err := db.Pool.QueryRow(context.Background(), query).Scan(&lastBlock.BlockNumber, &lastBlock.BlockHash, &lastBlock.ParentHash, &lastBlock.Timestamp, &lastBlock.Status)
 		if err != nil {
 			if err == pgx.ErrNoRows {
 				return nil, nil
@@ -141,7 +157,7 @@ func (db *DB) GetLastBlock() (*models.StarknetBlocks, error) {
 			return nil, err
 		}
 	} else {
-		err := db.Pool.QueryRow(context.Background(), query).Scan(&lastBlock.BlockNumber, &lastBlock.BlockHash, &lastBlock.ParentHash, &lastBlock.Timestamp)
+		err := db.Pool.QueryRow(context.Background(), query).Scan(&lastBlock.BlockNumber, &lastBlock.BlockHash, &lastBlock.ParentHash, &lastBlock.Timestamp, &lastBlock.Status)
 		if err != nil {
 			if err == pgx.ErrNoRows {
 				return nil, nil
@@ -152,24 +168,19 @@ func (db *DB) GetLastBlock() (*models.StarknetBlocks, error) {
 	return &lastBlock, nil
 }
 
-func (db *DB) StoreEvent(txHash, vaultAddress string, blockNumber uint64, blockHash string, eventName string, eventKeys []string, eventData []string) error {
+func (db *DB) StoreEvent(txHash, vaultAddress string, blockNumber uint64, blockHash string, eventName string, eventKeys []string, eventData []string, decodedData json.RawMessage) error {
 
 	if db.tx == nil {
 		return errors.New("No transaction found")
 	}
-	log.Printf("Storing event %s %s %d %s %v %v", txHash, vaultAddress, blockNumber, eventName, eventKeys, eventData)
 	query := `
 	INSERT INTO events
-	(transaction_hash, vault_address, block_number, block_hash, event_name, event_keys, event_data, event_nonce)
-	VALUES ($1, $2::varchar, $3, $4::varchar, $5, $6, $7,
+	(transaction_hash, vault_address, block_number, block_hash, event_name, event_keys, event_data, decoded_data, event_nonce)
+	VALUES ($1, $2::varchar, $3, $4::varchar, $5, $6, $7, $8,
 		(SELECT COUNT(*) + 1
 		 FROM events
 		 WHERE vault_address = $2::varchar))`
-	_, err := db.tx.Exec(context.Background(), query, txHash, vaultAddress, blockNumber, blockHash, eventName, eventKeys, eventData)
-	if err != nil {
-		log.Printf("WTHELLY")
-		log.Printf("%v", err)
-	}
+	_, err := db.tx.Exec(context.Background(), query, txHash, vaultAddress, blockNumber, blockHash, eventName, eventKeys, eventData, decodedData)
 	return err
 }
 
@@ -208,6 +219,15 @@ func (db *DB) StoreDriverEvent(eventType string, blockHash string) error {
 
 // StoreVaultCatchupEvent stores a vault catchup event and triggers PostgreSQL NOTIFY
 func (db *DB) StoreVaultCatchupEvent(vaultAddress string, startBlockHash, endBlockHash string) error {
+	return db.storeVaultRangeEvent("CatchupVault", vaultAddress, startBlockHash, endBlockHash)
+}
+
+// StoreVaultReindexEvent stores a vault reindex event and triggers PostgreSQL NOTIFY
+func (db *DB) StoreVaultReindexEvent(vaultAddress string, startBlockHash, endBlockHash string) error {
+	return db.storeVaultRangeEvent("ReindexVault", vaultAddress, startBlockHash, endBlockHash)
+}
+
+func (db *DB) storeVaultRangeEvent(eventType string, vaultAddress string, startBlockHash, endBlockHash string) error {
 	if db.tx == nil {
 		return errors.New("No transaction found")
 	}
@@ -217,6 +237,256 @@ func (db *DB) StoreVaultCatchupEvent(vaultAddress string, startBlockHash, endBlo
 	INSERT INTO driver_events
 	(sequence_index, type, vault_address, start_block_hash, end_block_hash, timestamp)
 	VALUES (nextval('driver_events_sequence'), $1, $2, $3, $4, NOW())`
-	_, err := db.tx.Exec(context.Background(), query, "CatchupVault", vaultAddress, startBlockHash, endBlockHash)
+	_, err := db.tx.Exec(context.Background(), query, eventType, vaultAddress, startBlockHash, endBlockHash)
+	return err
+}
+
+// SetVaultPaused pauses or resumes live indexing of a vault, the registry trigger notifies the plugin
+func (db *DB) SetVaultPaused(address string, paused bool) (bool, error) {
+	query := `
+	UPDATE vault_registry
+	SET paused = $1
+	WHERE vault_address = $2`
+	res, err := db.tx.Exec(context.Background(), query, paused, address)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+// DeleteVault removes a vault from the registry, optionally purging its indexed events, storage diffs, class history
+// and subscription matches
+func (db *DB) DeleteVault(address string, purgeEvents bool) (bool, error) {
+	query := `
+	DELETE FROM vault_registry
+	WHERE vault_address = $1`
+	res, err := db.tx.Exec(context.Background(), query, address)
+	if err != nil {
+		return false, err
+	}
+	if res.RowsAffected() == 0 {
+		return false, nil
+	}
+	if purgeEvents {
+		if _, err := db.tx.Exec(context.Background(), `DELETE FROM events WHERE vault_address = $1`, address); err != nil {
+			return false, err
+		}
+		if _, err := db.tx.Exec(context.Background(), `DELETE FROM vault_storage_diffs WHERE vault_address = $1`, address); err != nil {
+			return false, err
+		}
+		if _, err := db.tx.Exec(context.Background(), `DELETE FROM vault_class_history WHERE vault_address = $1`, address); err != nil {
+			return false, err
+		}
+		if _, err := db.tx.Exec(context.Background(), `DELETE FROM contract_events WHERE vault_address = $1`, address); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// DeleteVaultEventsInRange removes a vault's events in [fromBlock, toBlock] so the range can be re-indexed
+func (db *DB) DeleteVaultEventsInRange(address string, fromBlock, toBlock uint64) (int64, error) {
+	if db.tx == nil {
+		return 0, errors.New("No transaction found")
+	}
+	query := `
+	DELETE FROM events
+	WHERE vault_address = $1 AND block_number BETWEEN $2 AND $3`
+	res, err := db.tx.Exec(context.Background(), query, address, fromBlock, toBlock)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// GetVaultEventsInRange returns up to limit of a vault's events in [fromBlock, toBlock] with a nonce
+// above afterNonce, in nonce order, so a range can be read back a page at a time
+func (db *DB) GetVaultEventsInRange(address string, fromBlock, toBlock uint64, afterNonce, limit int) ([]*models.Event, error) {
+	query := `
+	SELECT event_nonce, block_number, block_hash, vault_address, event_name, event_keys, event_data, decoded_data, transaction_hash
+	FROM events
+	WHERE vault_address = $1 AND block_number BETWEEN $2 AND $3 AND event_nonce > $4
+	ORDER BY event_nonce
+	LIMIT $5`
+	rows, err := db.Pool.Query(context.Background(), query, address, fromBlock, toBlock, afterNonce, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.Event
+	for rows.Next() {
+		var event models.Event
+		if err := rows.Scan(
+			&event.EventNonce,
+			&event.BlockNumber,
+			&event.BlockHash,
+			&event.VaultAddress,
+			&event.EventName,
+			&event.EventKeys,
+			&event.EventData,
+			&event.DecodedData,
+			&event.TransactionHash,
+		); err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, rows.Err()
+}
+
+// GetVaultStatuses returns the indexing position of every registered vault
+func (db *DB) GetVaultStatuses() ([]*models.VaultStatus, error) {
+	query := `
+	SELECT
+		v.vault_address,
+		v.deployed_at,
+		v.paused,
+		v.last_block_indexed,
+		b.block_number,
+		(SELECT COUNT(*) FROM events e WHERE e.vault_address = v.vault_address)
+	FROM vault_registry v
+	LEFT JOIN starknet_blocks b ON b.block_hash = v.last_block_indexed
+	ORDER BY v.id`
+	rows, err := db.Pool.Query(context.Background(), query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var statuses []*models.VaultStatus
+	for rows.Next() {
+		var status models.VaultStatus
+		if err := rows.Scan(
+			&status.Address,
+			&status.DeployedAt,
+			&status.Paused,
+			&status.LastBlockIndexed,
+			&status.LastBlockNumber,
+			&status.EventCount,
+		); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, &status)
+	}
+	return statuses, rows.Err()
+}
+
+// GetDriverEvents returns the most recent driver events, newest first, optionally filtered by type and vault
+func (db *DB) GetDriverEvents(eventType, vaultAddress string, limit int) ([]*models.DriverEvent, error) {
+	query := `
+	SELECT
+		id,
+		sequence_index,
+		type,
+		timestamp,
+		COALESCE(is_processed, FALSE),
+		COALESCE(block_hash, ''),
+		COALESCE(vault_address, ''),
+		COALESCE(start_block_hash, ''),
+		COALESCE(end_block_hash, '')
+	FROM driver_events
+	WHERE ($1 = '' OR type = $1)
+	AND ($2 = '' OR vault_address = $2)
+	ORDER BY sequence_index DESC
+	LIMIT $3`
+	rows, err := db.Pool.Query(context.Background(), query, eventType, vaultAddress, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.DriverEvent
+	for rows.Next() {
+		var event models.DriverEvent
+		if err := rows.Scan(
+			&event.ID,
+			&event.SequenceIndex,
+			&event.Type,
+			&event.Timestamp,
+			&event.IsProcessed,
+			&event.BlockHash,
+			&event.VaultAddress,
+			&event.StartBlockHash,
+			&event.EndBlockHash,
+		); err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, rows.Err()
+}
+
+// GetBlocksInRange returns the canonical (MINED or FINALIZED) blocks in [fromBlock, toBlock] ordered by block number
+func (db *DB) GetBlocksInRange(fromBlock, toBlock uint64) ([]*models.StarknetBlocks, error) {
+	query := `
+	SELECT block_number, block_hash, parent_hash, timestamp, status FROM starknet_blocks
+	WHERE status <> 'REVERTED' AND block_number BETWEEN $1 AND $2
+	ORDER BY block_number`
+	rows, err := db.Pool.Query(context.Background(), query, fromBlock, toBlock)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []*models.StarknetBlocks
+	for rows.Next() {
+		var block models.StarknetBlocks
+		if err := rows.Scan(&block.BlockNumber, &block.BlockHash, &block.ParentHash, &block.Timestamp, &block.Status); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, &block)
+	}
+	return blocks, rows.Err()
+}
+
+// RenumberVaultEventNonces rewrites a vault's event nonces so they follow block order again
+func (db *DB) RenumberVaultEventNonces(address string) error {
+	if db.tx == nil {
+		return errors.New("No transaction found")
+	}
+	query := `
+	UPDATE events e
+	SET event_nonce = r.nonce
+	FROM (
+		SELECT ctid AS row_id, ROW_NUMBER() OVER (ORDER BY block_number, event_nonce) AS nonce
+		FROM events
+		WHERE vault_address = $1
+	) r
+	WHERE e.ctid = r.row_id`
+	_, err := db.tx.Exec(context.Background(), query, address)
+	return err
+}
+
+// DeleteVaultEvents removes all of a vault's events, used before a reindex replays them
+func (db *DB) DeleteVaultEvents(address string) error {
+	if db.tx == nil {
+		return errors.New("No transaction found")
+	}
+	_, err := db.tx.Exec(context.Background(), `DELETE FROM events WHERE vault_address = $1`, address)
 	return err
 }
+
+// DeleteVaultEventsAfter removes a vault's events above blockNumber
+func (db *DB) DeleteVaultEventsAfter(address string, blockNumber uint64) error {
+	if db.tx == nil {
+		return errors.New("No transaction found")
+	}
+	_, err := db.tx.Exec(context.Background(), `DELETE FROM events WHERE vault_address = $1 AND block_number > $2`, address, blockNumber)
+	return err
+}
+
+// ResetVaultRegistry moves a vault's cursor back to its deployment block and drops its catchup checkpoint
+func (db *DB) ResetVaultRegistry(address string) error {
+	if db.tx == nil {
+		return errors.New("No transaction found")
+	}
+	query := `
+	UPDATE vault_registry
+	SET last_block_indexed = deployed_at
+	WHERE vault_address = $1`
+	if _, err := db.tx.Exec(context.Background(), query, address); err != nil {
+		return err
+	}
+	return db.DeleteVaultCheckpoint(address)
+}
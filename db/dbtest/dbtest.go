@@ -0,0 +1,94 @@
+// Package dbtest provides the databases of the integration tests of packages built on db
+package dbtest
+
+import (
+	"context"
+	"errors"
+	"junoplugin/db"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// New migrates a fresh database on the server of TEST_DB_URL and returns a client and its URL. The
+// test is skipped when TEST_DB_URL is not set, and the database is dropped when it ends.
+func New(t testing.TB) (*db.DB, string) {
+	t.Helper()
+	baseURL := os.Getenv("TEST_DB_URL")
+	if baseURL == "" {
+		t.Skip("TEST_DB_URL is not set")
+	}
+
+	name, dbURL, err := db.CreateScratchDatabase(context.Background(), baseURL, "test")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := db.DropScratchDatabase(baseURL, name); err != nil {
+			t.Logf("Failed to drop test database: %v", err)
+		}
+	})
+
+	dbClient, err := db.Init(dbURL)
+	if err != nil {
+		t.Fatalf("Failed to initialize database: %v", err)
+	}
+	t.Cleanup(dbClient.Shutdown)
+
+	if _, err := dbClient.Migrate(db.MigrateOptions{Logger: slog.New(slog.DiscardHandler)}); err != nil {
+		t.Fatalf("Failed to migrate: %v", err)
+	}
+	return dbClient, dbURL
+}
+
+// Notifications receives the NOTIFY payloads of a set of channels
+type Notifications struct {
+	t    testing.TB
+	conn *pgx.Conn
+}
+
+// Listen listens on channels over a connection of its own to dbURL, closed when the test ends
+func Listen(t testing.TB, dbURL string, channels ...string) *Notifications {
+	t.Helper()
+	conn, err := pgx.Connect(context.Background(), dbURL)
+	if err != nil {
+		t.Fatalf("Failed to connect listener: %v", err)
+	}
+	t.Cleanup(func() { conn.Close(context.Background()) })
+
+	for _, channel := range channels {
+		if _, err := conn.Exec(context.Background(), "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			t.Fatalf("Failed to listen on %s: %v", channel, err)
+		}
+	}
+	return &Notifications{t: t, conn: conn}
+}
+
+// Next waits up to timeout for the next notification
+func (n *Notifications) Next(timeout time.Duration) *pgconn.Notification {
+	n.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	notification, err := n.conn.WaitForNotification(ctx)
+	if err != nil {
+		n.t.Fatalf("Expected a notification, got %v", err)
+	}
+	return notification
+}
+
+// ExpectNone fails the test if a notification arrives within timeout
+func (n *Notifications) ExpectNone(timeout time.Duration) {
+	n.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	notification, err := n.conn.WaitForNotification(ctx)
+	if err == nil {
+		n.t.Errorf("Expected no notification, got %s %s", notification.Channel, notification.Payload)
+	} else if !errors.Is(err, context.DeadlineExceeded) {
+		n.t.Fatalf("Error waiting for notification: %v", err)
+	}
+}
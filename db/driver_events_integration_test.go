@@ -0,0 +1,108 @@
+//go:build integration
+
+package db_test
+
+import (
+	"context"
+	"encoding/json"
+	"junoplugin/db/dbtest"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// driverEventPayload is a driver_events notification as built by notify_driver_event
+type driverEventPayload struct {
+	ID             int     `json:"id"`
+	SequenceIndex  int64   `json:"sequence_index"`
+	Type           string  `json:"type"`
+	IsProcessed    bool    `json:"is_processed"`
+	BlockHash      *string `json:"block_hash"`
+	StartBlockHash *string `json:"start_block_hash"`
+	EndBlockHash   *string `json:"end_block_hash"`
+	VaultAddress   *string `json:"vault_address"`
+}
+
+func nextDriverEvent(t *testing.T, conn *pgx.Conn) *driverEventPayload {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	notification, err := conn.WaitForNotification(ctx)
+	if err != nil {
+		t.Fatalf("Expected a driver event notification, got %v", err)
+	}
+	if notification.Channel != "driver_events" {
+		t.Fatalf("Expected a driver_events notification, got %s", notification.Channel)
+	}
+	var payload driverEventPayload
+	if err := json.Unmarshal([]byte(notification.Payload), &payload); err != nil {
+		t.Fatalf("Failed to parse driver event %s: %v", notification.Payload, err)
+	}
+	return &payload
+}
+
+func TestDriverEvents(t *testing.T) {
+	dbClient, dbURL := dbtest.New(t)
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, dbURL)
+	if err != nil {
+		t.Fatalf("Failed to connect listener: %v", err)
+	}
+	defer conn.Close(ctx)
+	if _, err := conn.Exec(ctx, "LISTEN driver_events"); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	if err := dbClient.StoreDriverEvent("StartBlock", "0x1"); err == nil {
+		t.Error("Expected an error storing a driver event outside a transaction")
+	}
+
+	// A rolled back event is neither stored nor notified
+	dbClient.BeginTx(ctx)
+	if err := dbClient.StoreDriverEvent("StartBlock", "0xdead"); err != nil {
+		t.Fatalf("Failed to store driver event: %v", err)
+	}
+	dbClient.RollbackTx()
+
+	dbClient.BeginTx(ctx)
+	if err := dbClient.StoreDriverEvent("StartBlock", "0x1"); err != nil {
+		t.Fatalf("Failed to store driver event: %v", err)
+	}
+	if err := dbClient.StoreVaultCatchupEvent("0xbeef", "0x1", "0x5"); err != nil {
+		t.Fatalf("Failed to store catchup event: %v", err)
+	}
+	dbClient.CommitTx()
+
+	start := nextDriverEvent(t, conn)
+	if start.Type != "StartBlock" || start.BlockHash == nil || *start.BlockHash != "0x1" || start.VaultAddress != nil || start.IsProcessed {
+		t.Errorf("Expected an unprocessed StartBlock of 0x1, got %+v", start)
+	}
+	catchup := nextDriverEvent(t, conn)
+	if catchup.Type != "CatchupVault" || catchup.BlockHash != nil ||
+		catchup.VaultAddress == nil || *catchup.VaultAddress != "0xbeef" ||
+		catchup.StartBlockHash == nil || *catchup.StartBlockHash != "0x1" ||
+		catchup.EndBlockHash == nil || *catchup.EndBlockHash != "0x5" {
+		t.Errorf("Expected a CatchupVault of 0xbeef from 0x1 to 0x5, got %+v", catchup)
+	}
+	if catchup.SequenceIndex <= start.SequenceIndex {
+		t.Errorf("Expected sequence indexes to increase, got %d then %d", start.SequenceIndex, catchup.SequenceIndex)
+	}
+
+	events, err := dbClient.GetDriverEvents("", "", 10)
+	if err != nil {
+		t.Fatalf("Failed to get driver events: %v", err)
+	}
+	if len(events) != 2 || events[0].Type != "CatchupVault" || events[1].Type != "StartBlock" {
+		t.Fatalf("Expected the committed events newest first, got %+v", events)
+	}
+	if events[0].ID != catchup.ID || events[0].SequenceIndex != catchup.SequenceIndex {
+		t.Errorf("Expected the stored event to match its notification, got %+v and %+v", events[0], catchup)
+	}
+	if events, err := dbClient.GetDriverEvents("CatchupVault", "0xbeef", 10); err != nil || len(events) != 1 {
+		t.Errorf("Expected 1 CatchupVault event of 0xbeef, got %d, %v", len(events), err)
+	}
+	if events, err := dbClient.GetDriverEvents("", "0xcafe", 10); err != nil || len(events) != 0 {
+		t.Errorf("Expected no event of 0xcafe, got %d, %v", len(events), err)
+	}
+}
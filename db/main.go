@@ -3,17 +3,24 @@ package db
 import (
 	"context"
 	"fmt"
+	"junoplugin/tracing"
 	"log"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type DB struct {
 	Pool *pgxpool.Pool
 	tx   pgx.Tx
+	// span traces tx from begin to commit or rollback
+	span trace.Span
 	ctx  context.Context
 	url  string
+	// onRollback runs if tx does not commit, see OnRollback
+	onRollback []func()
 }
 
 func Init(dbUrl string) (*DB, error) {
@@ -27,20 +34,7 @@ func Init(dbUrl string) (*DB, error) {
 		return nil, fmt.Errorf("unable to create connection pool: %w", err)
 	}
 
-	// m, err := migrate.New(
-	// 	"file://db/migrations",
-	// 	dbUrl)
-	// if err != nil {
-	// 	log.Printf("FAIlED HERE 1")
-	// 	return nil, err
-	// }
-	// if err := m.Up(); err != nil {
-	// 	if err != migrate.ErrNoChange {
-	// 		return nil, err
-	// 	}
-
-	// }
-	// m.Close()
+	// Migrations are embedded and applied with Migrate, see migrate.go
 
 	return &DB{
 		Pool: pool,
@@ -54,21 +48,83 @@ func (db *DB) Shutdown() {
 	db.Pool.Close()
 }
 
-func (db *DB) BeginTx() {
+// BeginTx starts the transaction of db, traced as a child of ctx's span
+func (db *DB) BeginTx(ctx context.Context) {
+	_, span := startTxSpan(ctx)
 	tx, err := db.Pool.Begin(context.TODO())
 	if err != nil {
-		log.Printf("WTHELLY TX WAALA")
-		log.Fatal(err)
+		tracing.End(span, err)
+		log.Fatalf("unable to begin transaction: %v", err)
 	}
-	db.tx = tx
+	db.tx, db.span = tx, span
 }
 
 func (db *DB) CommitTx() {
-	db.tx.Commit(db.ctx)
-	db.tx = nil
+	err := db.tx.Commit(db.ctx)
+	db.endTx(err, false)
 }
 
 func (db *DB) RollbackTx() {
-	db.tx.Rollback(db.ctx)
+	err := db.tx.Rollback(db.ctx)
+	db.endTx(err, true)
+}
+
+// Begin starts a transaction on a copy of db that shares its pool, traced as a child of ctx's
+// span. Work that runs alongside block processing (vault catchup, reindex) uses it instead of
+// BeginTx so it never touches the block processor's transaction.
+func (db *DB) Begin(ctx context.Context) (*DB, error) {
+	_, span := startTxSpan(ctx)
+	tx, err := db.Pool.Begin(db.ctx)
+	if err != nil {
+		tracing.End(span, err)
+		return nil, fmt.Errorf("unable to begin transaction: %w", err)
+	}
+	return &DB{
+		Pool: db.Pool,
+		tx:   tx,
+		span: span,
+		ctx:  db.ctx,
+		url:  db.url,
+	}, nil
+}
+
+// Commit commits a transaction started with Begin
+func (db *DB) Commit() error {
+	err := db.tx.Commit(db.ctx)
+	db.endTx(err, false)
+	return err
+}
+
+// Rollback rolls back a transaction started with Begin
+func (db *DB) Rollback() error {
+	err := db.tx.Rollback(db.ctx)
+	db.endTx(err, true)
+	return err
+}
+
+// OnRollback registers fn to run once the open transaction is rolled back or fails to commit,
+// so state kept in memory alongside it can be discarded with the rows
+func (db *DB) OnRollback(fn func()) {
+	db.onRollback = append(db.onRollback, fn)
+}
+
+func startTxSpan(ctx context.Context) (context.Context, trace.Span) {
+	return tracing.Start(ctx, "db.Transaction", attribute.String("db.system", "postgresql"))
+}
+
+// endTx ends the transaction's span, err being the commit or rollback error
+func (db *DB) endTx(err error, rolledBack bool) {
 	db.tx = nil
+	hooks := db.onRollback
+	db.onRollback = nil
+	if rolledBack || err != nil {
+		for _, fn := range hooks {
+			fn()
+		}
+	}
+	if db.span != nil {
+		db.span.SetAttributes(attribute.Bool("db.rolled_back", rolledBack))
+		tracing.End(db.span, err)
+		db.span = nil
+	}
 }
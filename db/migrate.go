@@ -0,0 +1,249 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migrationLockKey is the pg_advisory_lock key held while migrating, so plugins starting
+// against the same database apply migrations one at a time
+const migrationLockKey int64 = 0x706c6d6967726174 // "plmigrat"
+
+// Migration modes accepted by MigrateOptions.Mode
+const (
+	MigrateAuto   = "auto"    // apply pending migrations
+	MigrateDryRun = "dry-run" // report pending migrations and fail if there are any
+)
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is one numbered schema change embedded in the binary
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// ErrPendingMigrations is returned by Migrate in dry-run mode when the schema is behind
+var ErrPendingMigrations = errors.New("database has pending migrations")
+
+// LoadMigrations returns the embedded migrations ordered by version
+func LoadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint64]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+		contents, err := migrationsFS.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version}
+			byVersion[version] = migration
+		}
+		if match[3] == "up" {
+			migration.Name = match[2]
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %06d has no up file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrateOptions controls Migrate
+type MigrateOptions struct {
+	Mode string
+	// Logger receives one record per pending or applied migration, slog's default logger when nil
+	Logger *slog.Logger
+}
+
+// MigrationStatus describes the schema relative to the embedded migrations
+type MigrationStatus struct {
+	CurrentVersion uint64      `json:"current_version"`
+	LatestVersion  uint64      `json:"latest_version"`
+	Dirty          bool        `json:"dirty"`
+	Pending        []Migration `json:"-"`
+	PendingNames   []string    `json:"pending"`
+}
+
+// Migrate brings the schema up to the embedded migrations under an advisory lock. It refuses to
+// run against a dirty schema or one newer than the binary knows about.
+func (db *DB) Migrate(opts MigrateOptions) (*MigrationStatus, error) {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	switch opts.Mode {
+	case "":
+		opts.Mode = MigrateAuto
+	case MigrateAuto, MigrateDryRun:
+	default:
+		return nil, fmt.Errorf("unknown migration mode %q", opts.Mode)
+	}
+
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	ctx := context.Background()
+	conn, err := db.Pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	status, err := migrationStatus(ctx, conn.Conn(), migrations)
+	if err != nil {
+		return nil, err
+	}
+	if status.Dirty {
+		return status, fmt.Errorf("database schema version %d is dirty, fix it manually before starting", status.CurrentVersion)
+	}
+	if status.CurrentVersion > status.LatestVersion {
+		return status, fmt.Errorf("database schema version %d is newer than the latest known migration %d, refusing to start", status.CurrentVersion, status.LatestVersion)
+	}
+
+	for _, migration := range status.Pending {
+		opts.Logger.Info("Pending migration", "version", migration.Version, "name", migration.Name)
+	}
+	if len(status.Pending) == 0 {
+		return status, nil
+	}
+	if opts.Mode == MigrateDryRun {
+		return status, fmt.Errorf("%w: schema is at version %d, latest is %d", ErrPendingMigrations, status.CurrentVersion, status.LatestVersion)
+	}
+
+	for _, migration := range status.Pending {
+		if err := applyMigration(ctx, conn.Conn(), migration); err != nil {
+			return status, err
+		}
+		opts.Logger.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+		status.CurrentVersion = migration.Version
+	}
+	status.Pending = nil
+	status.PendingNames = []string{}
+	return status, nil
+}
+
+// migrationStatus reads the schema version, creating the version table for databases that were
+// migrated by hand before migrations were embedded
+func migrationStatus(ctx context.Context, conn *pgx.Conn, migrations []Migration) (*MigrationStatus, error) {
+	var exists bool
+	if err := conn.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		version, err := detectLegacyVersion(ctx, conn)
+		if err != nil {
+			return nil, err
+		}
+		_, err = conn.Exec(ctx, `
+		CREATE TABLE schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL);
+		INSERT INTO schema_migrations (version, dirty) SELECT `+strconv.FormatUint(version, 10)+`, FALSE;`)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create schema_migrations: %w", err)
+		}
+	}
+
+	status := &MigrationStatus{PendingNames: []string{}}
+	if len(migrations) > 0 {
+		status.LatestVersion = migrations[len(migrations)-1].Version
+	}
+	err := conn.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&status.CurrentVersion, &status.Dirty)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	for _, migration := range migrations {
+		if migration.Version > status.CurrentVersion {
+			status.Pending = append(status.Pending, migration)
+			status.PendingNames = append(status.PendingNames, fmt.Sprintf("%06d_%s", migration.Version, migration.Name))
+		}
+	}
+	return status, nil
+}
+
+// detectLegacyVersion infers the version of a schema created with make migrate-up, which applies
+// migrations up to 000004 but keeps no version table
+func detectLegacyVersion(ctx context.Context, conn *pgx.Conn) (uint64, error) {
+	checks := []struct {
+		version uint64
+		query   string
+	}{
+		{1, "SELECT to_regclass('events') IS NOT NULL"},
+		{2, "SELECT to_regclass('starknet_blocks') IS NOT NULL"},
+		{3, "SELECT to_regclass('vault_registry') IS NOT NULL"},
+		{4, "SELECT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'vault_registry' AND column_name = 'paused')"},
+	}
+
+	var version uint64
+	for _, check := range checks {
+		var applied bool
+		if err := conn.QueryRow(ctx, check.query).Scan(&applied); err != nil {
+			return 0, err
+		}
+		if !applied {
+			break
+		}
+		version = check.version
+	}
+	return version, nil
+}
+
+// applyMigration runs one up migration and records its version in the same transaction
+func applyMigration(ctx context.Context, conn *pgx.Conn, migration Migration) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, migration.Up); err != nil {
+		return fmt.Errorf("migration %06d_%s failed: %w", migration.Version, migration.Name, err)
+	}
+	if _, err := tx.Exec(ctx, "UPDATE schema_migrations SET version = $1, dirty = FALSE", migration.Version); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,28 @@
+package db
+
+import "testing"
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("Expected embedded migrations")
+	}
+
+	for i, migration := range migrations {
+		if migration.Version != uint64(i+1) {
+			t.Errorf("Expected version %d, got %d", i+1, migration.Version)
+		}
+		if migration.Name == "" {
+			t.Errorf("Migration %d has no name", migration.Version)
+		}
+		if migration.Up == "" {
+			t.Errorf("Migration %d has no up script", migration.Version)
+		}
+		if migration.Down == "" {
+			t.Errorf("Migration %d has no down script", migration.Version)
+		}
+	}
+}
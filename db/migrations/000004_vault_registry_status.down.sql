@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS delete_vault_registry_trigger ON "vault_registry";
+DROP TRIGGER IF EXISTS update_vault_registry_trigger ON "vault_registry";
+DROP FUNCTION IF EXISTS notify_delete_registry();
+DROP FUNCTION IF EXISTS notify_update_registry();
+DROP INDEX IF EXISTS idx_vault_registry_vault_address;
+ALTER TABLE "vault_registry" DROP COLUMN IF EXISTS "paused";
@@ -0,0 +1,31 @@
+ALTER TABLE "vault_registry" ADD COLUMN "paused" BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE UNIQUE INDEX idx_vault_registry_vault_address ON "vault_registry" (vault_address);
+
+CREATE OR REPLACE FUNCTION notify_update_registry()
+    RETURNS trigger AS $$
+    BEGIN
+        PERFORM pg_notify('vault_update', row_to_json(NEW)::text);
+        RETURN NEW;
+    END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION notify_delete_registry()
+    RETURNS trigger AS $$
+    BEGIN
+        PERFORM pg_notify('vault_delete', row_to_json(OLD)::text);
+        RETURN OLD;
+    END;
+$$ LANGUAGE plpgsql;
+
+-- Only pause/resume is interesting to the plugin, cursor updates are not broadcast
+CREATE TRIGGER update_vault_registry_trigger
+AFTER UPDATE OF "paused" ON "vault_registry"
+FOR EACH ROW
+WHEN (OLD.paused IS DISTINCT FROM NEW.paused)
+EXECUTE FUNCTION notify_update_registry();
+
+CREATE TRIGGER delete_vault_registry_trigger
+AFTER DELETE ON "vault_registry"
+FOR EACH ROW
+EXECUTE FUNCTION notify_delete_registry();
@@ -0,0 +1,16 @@
+DROP TRIGGER IF EXISTS trigger_notify_finalize_starknet_blocks ON "starknet_blocks";
+DROP TRIGGER IF EXISTS trigger_notify_revert_starknet_blocks ON "starknet_blocks";
+DROP TRIGGER IF EXISTS trigger_check_starknet_blocks_status ON "starknet_blocks";
+DROP FUNCTION IF EXISTS notify_finalize_starknet_blocks();
+DROP FUNCTION IF EXISTS check_starknet_blocks_status();
+
+ALTER TABLE "starknet_blocks"
+    ALTER COLUMN status TYPE varchar(255) USING status::text;
+
+DROP TYPE IF EXISTS block_status;
+
+CREATE TRIGGER trigger_notify_revert_starknet_blocks
+AFTER UPDATE ON "starknet_blocks"
+FOR EACH ROW
+WHEN (NEW.status = 'REVERTED')
+EXECUTE FUNCTION notify_revert_starknet_blocks();
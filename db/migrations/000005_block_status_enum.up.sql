@@ -0,0 +1,45 @@
+-- Block status values, kept in sync with models.BlockStatus
+CREATE TYPE block_status AS ENUM ('MINED', 'REVERTED', 'FINALIZED');
+
+-- The revert trigger's WHEN clause references status, so it has to go before the column type changes
+DROP TRIGGER IF EXISTS trigger_notify_revert_starknet_blocks ON "starknet_blocks";
+
+ALTER TABLE "starknet_blocks"
+    ALTER COLUMN status TYPE block_status USING upper(status)::block_status;
+
+-- Blocks are inserted as MINED and move at most once, to REVERTED or FINALIZED
+CREATE OR REPLACE FUNCTION check_starknet_blocks_status()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF OLD.status <> 'MINED' THEN
+        RAISE EXCEPTION 'block % is % and cannot become %', OLD.block_number, OLD.status, NEW.status;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION notify_finalize_starknet_blocks()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_notify('starknet_blocks_finalize', NEW.block_number::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trigger_check_starknet_blocks_status
+BEFORE UPDATE OF status ON "starknet_blocks"
+FOR EACH ROW
+WHEN (OLD.status IS DISTINCT FROM NEW.status)
+EXECUTE FUNCTION check_starknet_blocks_status();
+
+CREATE TRIGGER trigger_notify_revert_starknet_blocks
+AFTER UPDATE OF status ON "starknet_blocks"
+FOR EACH ROW
+WHEN (OLD.status IS DISTINCT FROM NEW.status AND NEW.status = 'REVERTED')
+EXECUTE FUNCTION notify_revert_starknet_blocks();
+
+CREATE TRIGGER trigger_notify_finalize_starknet_blocks
+AFTER UPDATE OF status ON "starknet_blocks"
+FOR EACH ROW
+WHEN (OLD.status IS DISTINCT FROM NEW.status AND NEW.status = 'FINALIZED')
+EXECUTE FUNCTION notify_finalize_starknet_blocks();
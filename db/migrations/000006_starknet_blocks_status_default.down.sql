@@ -0,0 +1,2 @@
+ALTER TABLE "starknet_blocks"
+    ALTER COLUMN status DROP DEFAULT;
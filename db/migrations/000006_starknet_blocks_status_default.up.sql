@@ -0,0 +1,3 @@
+-- Blocks are always inserted as MINED, the default lets bulk inserts (COPY) leave status out
+ALTER TABLE "starknet_blocks"
+    ALTER COLUMN status SET DEFAULT 'MINED';
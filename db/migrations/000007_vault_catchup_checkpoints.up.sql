@@ -0,0 +1,13 @@
+-- Progress of a vault catchup window that is partly committed. The window [block_number, window_end]
+-- is fetched page by page, continuation_token resumes after the last committed page. The row is
+-- removed once the window is done and vault_registry.last_block_indexed has moved past it.
+CREATE TABLE "vault_catchup_checkpoints"
+(
+    "vault_address" VARCHAR(66) PRIMARY KEY REFERENCES "vault_registry" (vault_address) ON DELETE CASCADE,
+    "block_number" numeric(78,0) NOT NULL,
+    "window_end" numeric(78,0) NOT NULL,
+    "continuation_token" TEXT NOT NULL,
+    "target_block" numeric(78,0) NOT NULL,
+    "events_stored" BIGINT NOT NULL DEFAULT 0,
+    "updated_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
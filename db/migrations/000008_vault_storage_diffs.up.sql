@@ -0,0 +1,14 @@
+-- Storage writes of tracked vaults, one row per changed key and block, taken from the state update
+-- Juno passes with each block. A key's value at block N is its row with the highest block_number <= N.
+-- Rows of a reverted block are deleted using the reverse state diff of the revert.
+CREATE TABLE "vault_storage_diffs"
+(
+    "vault_address" VARCHAR(66) NOT NULL,
+    "storage_key" VARCHAR(66) NOT NULL,
+    "block_number" numeric(78,0) NOT NULL,
+    "block_hash" VARCHAR(66) NOT NULL,
+    "storage_value" VARCHAR(66) NOT NULL,
+    PRIMARY KEY ("vault_address", "storage_key", "block_number")
+);
+
+CREATE INDEX idx_vault_storage_diffs_block_number ON "vault_storage_diffs" (block_number);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS "vault_class_history";
@@ -0,0 +1,12 @@
+-- Class hash of each tracked vault over time, a row per deployment or upgrade (replace_class). The
+-- class active at block N is the row with the highest block_number <= N, events are decoded with it.
+CREATE TABLE "vault_class_history"
+(
+    "vault_address" VARCHAR(66) NOT NULL,
+    "block_number" numeric(78,0) NOT NULL,
+    "block_hash" VARCHAR(66) NOT NULL,
+    "class_hash" VARCHAR(66) NOT NULL,
+    PRIMARY KEY ("vault_address", "block_number")
+);
+
+CREATE INDEX idx_vault_class_history_block_number ON "vault_class_history" (block_number);
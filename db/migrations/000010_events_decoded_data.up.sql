@@ -0,0 +1,2 @@
+-- Event keys and data decoded with the ABI of the vault's class, NULL when no ABI layout is known
+ALTER TABLE "events" ADD COLUMN "decoded_data" jsonb;
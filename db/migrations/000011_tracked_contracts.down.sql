@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "contract_events";
+DROP TABLE IF EXISTS "tracked_contracts";
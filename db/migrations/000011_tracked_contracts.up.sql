@@ -0,0 +1,31 @@
+-- Contracts other than vaults whose events are indexed, e.g. the ERC-20 tokens vaults hold and the
+-- Fossil oracle. Rows are managed with pitchlakectl contract and merged with tracked_contracts from
+-- the plugin configuration at startup.
+CREATE TABLE "tracked_contracts"
+(
+    "address" VARCHAR(66) PRIMARY KEY,
+    "kind" VARCHAR(32) NOT NULL,
+    "start_block" numeric(78,0) NOT NULL DEFAULT 0,
+    -- Path of an ABI file to decode the contract's events with, NULL for the kind's default
+    "abi" TEXT,
+    "created_at" TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- Events of tracked contracts. Vault events stay in events, ERC-20 events are kept when a tracked
+-- vault is one of their parties.
+CREATE TABLE "contract_events"
+(
+    "contract_address" VARCHAR(66) NOT NULL,
+    "kind" VARCHAR(32) NOT NULL,
+    "block_number" numeric(78,0) NOT NULL,
+    "block_hash" VARCHAR(66) NOT NULL,
+    "transaction_hash" VARCHAR(66) NOT NULL,
+    "event_name" VARCHAR(255) NOT NULL,
+    "event_keys" VARCHAR(256)[] NOT NULL,
+    "event_data" VARCHAR(256)[] NOT NULL,
+    "decoded_data" jsonb
+);
+
+CREATE INDEX idx_contract_events_block_number ON "contract_events" (block_number);
+CREATE INDEX idx_contract_events_contract_address ON "contract_events" (contract_address);
+CREATE INDEX idx_contract_events_event_name ON "contract_events" (event_name);
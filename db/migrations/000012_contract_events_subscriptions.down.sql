@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_contract_events_vault_address;
+ALTER TABLE "contract_events" DROP COLUMN IF EXISTS "vault_address";
+ALTER TABLE "contract_events" DROP COLUMN IF EXISTS "subscription";
@@ -0,0 +1,6 @@
+-- Events matched by a configured subscription rather than by their emitter. vault_address is the
+-- tracked vault the subscription's $vault matcher bound, so catchup can replace a vault's matches.
+ALTER TABLE "contract_events" ADD COLUMN "subscription" VARCHAR(255);
+ALTER TABLE "contract_events" ADD COLUMN "vault_address" VARCHAR(66);
+
+CREATE INDEX idx_contract_events_vault_address ON "contract_events" (vault_address);
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS outbox_driver_events_trigger ON "driver_events";
+DROP TRIGGER IF EXISTS outbox_events_trigger ON "events";
+DROP FUNCTION IF EXISTS outbox_event();
+DROP TABLE IF EXISTS "outbox";
@@ -0,0 +1,34 @@
+-- Transactional outbox of events and driver_events. The triggers add a row in the transaction that
+-- stores the event, so the outbox relay only sees committed rows and deletes them once its sink has
+-- accepted them. vault_address orders the messages of a vault, it is NULL for block driver events.
+-- The triggers are enabled at startup only when an outbox sink is configured.
+CREATE TABLE "outbox"
+(
+    "id" BIGSERIAL PRIMARY KEY,
+    "kind" VARCHAR(32) NOT NULL, -- "event" or "driver_event"
+    "vault_address" VARCHAR(66),
+    "payload" jsonb NOT NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE FUNCTION outbox_event()
+    RETURNS trigger AS $$
+    BEGIN
+        INSERT INTO outbox (kind, vault_address, payload)
+        VALUES (TG_ARGV[0], NEW.vault_address, to_jsonb(NEW));
+        RETURN NEW;
+    END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER outbox_events_trigger
+AFTER INSERT ON "events"
+FOR EACH ROW
+EXECUTE FUNCTION outbox_event('event');
+
+CREATE TRIGGER outbox_driver_events_trigger
+AFTER INSERT ON "driver_events"
+FOR EACH ROW
+EXECUTE FUNCTION outbox_event('driver_event');
+
+ALTER TABLE "events" DISABLE TRIGGER outbox_events_trigger;
+ALTER TABLE "driver_events" DISABLE TRIGGER outbox_driver_events_trigger;
@@ -0,0 +1,44 @@
+-- Webhook subscriptions. An empty vault_addresses or event_names matches every vault or event name.
+CREATE TABLE "webhook_subscriptions"
+(
+    "id" BIGSERIAL PRIMARY KEY,
+    "url" TEXT NOT NULL,
+    "secret" TEXT NOT NULL, -- HMAC-SHA256 key of the signature header
+    "vault_addresses" VARCHAR(66)[] NOT NULL DEFAULT '{}',
+    "event_names" VARCHAR(255)[] NOT NULL DEFAULT '{}',
+    "enabled" BOOLEAN NOT NULL DEFAULT TRUE,
+    "created_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Delivery log, one row per attempt. status_code is NULL when no response was received.
+CREATE TABLE "webhook_deliveries"
+(
+    "id" BIGSERIAL PRIMARY KEY,
+    "subscription_id" BIGINT NOT NULL REFERENCES "webhook_subscriptions" (id) ON DELETE CASCADE,
+    "delivery_id" VARCHAR(64) NOT NULL,
+    "event_name" VARCHAR(255) NOT NULL,
+    "vault_address" VARCHAR(66) NOT NULL,
+    "block_number" BIGINT NOT NULL,
+    "attempt" INTEGER NOT NULL,
+    "status_code" INTEGER,
+    "error" TEXT,
+    "duration_ms" BIGINT NOT NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_webhook_deliveries_subscription ON "webhook_deliveries" (subscription_id, id);
+
+-- Deliveries given up on, with the body to send them again
+CREATE TABLE "webhook_dead_letters"
+(
+    "id" BIGSERIAL PRIMARY KEY,
+    "subscription_id" BIGINT NOT NULL REFERENCES "webhook_subscriptions" (id) ON DELETE CASCADE,
+    "delivery_id" VARCHAR(64) NOT NULL,
+    "event_name" VARCHAR(255) NOT NULL,
+    "payload" jsonb NOT NULL,
+    "attempts" INTEGER NOT NULL,
+    "error" TEXT NOT NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_webhook_dead_letters_subscription ON "webhook_dead_letters" (subscription_id, id);
@@ -0,0 +1,13 @@
+ALTER TABLE "events" DISABLE TRIGGER outbox_events_trigger;
+ALTER TABLE "driver_events" DISABLE TRIGGER outbox_driver_events_trigger;
+
+CREATE OR REPLACE FUNCTION outbox_event()
+    RETURNS trigger AS $$
+    BEGIN
+        INSERT INTO outbox (kind, vault_address, payload)
+        VALUES (TG_ARGV[0], NEW.vault_address, to_jsonb(NEW));
+        RETURN NEW;
+    END;
+$$ LANGUAGE plpgsql;
+
+DROP TABLE IF EXISTS "outbox_settings";
@@ -0,0 +1,24 @@
+-- The outbox triggers stay enabled and check this row instead, so turning the outbox on or off at
+-- startup is an UPDATE rather than an ALTER TABLE taking an exclusive lock on events and
+-- driver_events. The single row is only set to enabled when an outbox sink is configured.
+CREATE TABLE "outbox_settings"
+(
+    "id" BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK ("id"),
+    "enabled" BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+INSERT INTO "outbox_settings" ("enabled") VALUES (FALSE);
+
+CREATE OR REPLACE FUNCTION outbox_event()
+    RETURNS trigger AS $$
+    BEGIN
+        IF (SELECT enabled FROM outbox_settings) THEN
+            INSERT INTO outbox (kind, vault_address, payload)
+            VALUES (TG_ARGV[0], NEW.vault_address, to_jsonb(NEW));
+        END IF;
+        RETURN NEW;
+    END;
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE "events" ENABLE TRIGGER outbox_events_trigger;
+ALTER TABLE "driver_events" ENABLE TRIGGER outbox_driver_events_trigger;
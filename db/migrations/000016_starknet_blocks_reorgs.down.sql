@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS idx_starknet_blocks_canonical_number;
+
+-- Reverted blocks sharing their number with another block do not fit the number key
+DELETE FROM "starknet_blocks" b
+WHERE b.status = 'REVERTED' AND EXISTS (
+    SELECT 1 FROM "starknet_blocks" o
+    WHERE o.block_number = b.block_number AND o.block_hash <> b.block_hash
+);
+
+ALTER TABLE "starknet_blocks" DROP CONSTRAINT "starknet_blocks_pkey";
+ALTER TABLE "starknet_blocks" ADD PRIMARY KEY ("block_number");
@@ -0,0 +1,7 @@
+-- A block replacing a reverted one has the same number, so blocks are keyed by hash and only the
+-- blocks that are not REVERTED need distinct numbers
+ALTER TABLE "starknet_blocks" DROP CONSTRAINT "starknet_blocks_pkey";
+ALTER TABLE "starknet_blocks" ADD PRIMARY KEY ("block_hash");
+
+CREATE UNIQUE INDEX idx_starknet_blocks_canonical_number ON "starknet_blocks" (block_number)
+WHERE status <> 'REVERTED';
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"junoplugin/models"
+)
+
+// SetOutboxEnabled sets whether the triggers add the inserted events and driver_events rows to the
+// outbox. It is only enabled when a relay publishes the outbox, so it does not grow without one.
+func (db *DB) SetOutboxEnabled(enabled bool) error {
+	if _, err := db.Pool.Exec(context.Background(), `UPDATE outbox_settings SET enabled = $1`, enabled); err != nil {
+		return fmt.Errorf("failed to set outbox enabled: %w", err)
+	}
+	return nil
+}
+
+// GetPendingOutbox returns up to limit outbox messages in insertion order
+func (db *DB) GetPendingOutbox(limit int) ([]*models.OutboxMessage, error) {
+	query := `
+	SELECT id, kind, COALESCE(vault_address, ''), payload, created_at
+	FROM outbox
+	ORDER BY id
+	LIMIT $1`
+	rows, err := db.Pool.Query(context.Background(), query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*models.OutboxMessage
+	for rows.Next() {
+		var message models.OutboxMessage
+		if err := rows.Scan(&message.ID, &message.Kind, &message.VaultAddress, &message.Payload, &message.CreatedAt); err != nil {
+			return nil, err
+		}
+		messages = append(messages, &message)
+	}
+	return messages, rows.Err()
+}
+
+// DeleteOutboxMessages removes published messages from the outbox
+func (db *DB) DeleteOutboxMessages(ids []int64) error {
+	_, err := db.Pool.Exec(context.Background(), `DELETE FROM outbox WHERE id = ANY($1)`, ids)
+	return err
+}
+
+// CountPendingOutbox returns the number of messages waiting in the outbox
+func (db *DB) CountPendingOutbox() (int64, error) {
+	var count int64
+	err := db.Pool.QueryRow(context.Background(), `SELECT count(*) FROM outbox`).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,50 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateScratchDatabase creates an empty database named <prefix>_<unix nanos> on the server of baseURL
+// and returns its name with a URL connecting to it. Tests and replays migrate a database of their
+// own rather than a schema of a shared one, since migrations create functions in public and a
+// database may already hold the indexer.
+func CreateScratchDatabase(ctx context.Context, baseURL, prefix string) (string, string, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid database URL: %w", err)
+	}
+	name := fmt.Sprintf("%s_%d", prefix, time.Now().UnixNano())
+
+	conn, err := pgx.Connect(ctx, baseURL)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close(ctx)
+	if _, err := conn.Exec(ctx, "CREATE DATABASE "+pgx.Identifier{name}.Sanitize()); err != nil {
+		return "", "", fmt.Errorf("failed to create database %s: %w", name, err)
+	}
+
+	parsed.Path = "/" + name
+	return name, parsed.String(), nil
+}
+
+// DropScratchDatabase drops a database made by CreateScratchDatabase, closing the connections left
+// to it. It uses a fresh connection so it runs even once the caller's context is done.
+func DropScratchDatabase(baseURL, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	conn, err := pgx.Connect(ctx, baseURL)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer conn.Close(ctx)
+	if _, err := conn.Exec(ctx, "DROP DATABASE IF EXISTS "+pgx.Identifier{name}.Sanitize()+" WITH (FORCE)"); err != nil {
+		return fmt.Errorf("failed to drop database %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Snapshot is the content of the plugin's tables, each row as a JSON object, compared against a
+// golden snapshot by replays. Columns filled by now() or a sequence differ from run to run and are
+// left out, as is schema_migrations.
+type Snapshot struct {
+	Tables map[string][]json.RawMessage `json:"tables"`
+}
+
+// Snapshot reads every table of the current schema, rows sorted so equal contents compare equal
+func (db *DB) Snapshot(ctx context.Context) (*Snapshot, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT c.table_name, array_agg(c.column_name::text ORDER BY c.column_name)
+			FILTER (WHERE c.column_default ILIKE '%now()%'
+				OR c.column_default ILIKE '%current_timestamp%'
+				OR c.column_default ILIKE 'nextval(%')
+		FROM information_schema.columns c
+		JOIN information_schema.tables t
+			ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE c.table_schema = current_schema()
+			AND t.table_type = 'BASE TABLE'
+			AND c.table_name <> 'schema_migrations'
+		GROUP BY c.table_name
+		ORDER BY c.table_name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	excluded := make(map[string][]string)
+	var tables []string
+	for rows.Next() {
+		var table string
+		var columns []*string
+		if err := rows.Scan(&table, &columns); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		tables = append(tables, table)
+		for _, column := range columns {
+			if column != nil {
+				excluded[table] = append(excluded[table], *column)
+			}
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	snapshot := &Snapshot{Tables: make(map[string][]json.RawMessage, len(tables))}
+	for _, table := range tables {
+		// jsonb orders keys itself, so the text of equal rows is equal
+		rows, err := db.Pool.Query(ctx, fmt.Sprintf(`
+			SELECT (to_jsonb(t) - $1::text[])::text AS row FROM %s t ORDER BY row`,
+			pgx.Identifier{table}.Sanitize()), excluded[table])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read table %s: %w", table, err)
+		}
+		contents := []json.RawMessage{}
+		for rows.Next() {
+			var row string
+			if err := rows.Scan(&row); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan row of %s: %w", table, err)
+			}
+			contents = append(contents, json.RawMessage(row))
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read table %s: %w", table, err)
+		}
+		snapshot.Tables[table] = contents
+	}
+	return snapshot, nil
+}
+
+// Diff lists the rows of s missing from golden and the rows of golden missing from s, by table.
+// It is empty when both snapshots hold the same rows.
+func (s *Snapshot) Diff(golden *Snapshot) []string {
+	names := make(map[string]struct{}, len(s.Tables))
+	for table := range s.Tables {
+		names[table] = struct{}{}
+	}
+	for table := range golden.Tables {
+		names[table] = struct{}{}
+	}
+	tables := make([]string, 0, len(names))
+	for table := range names {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	var diff []string
+	for _, table := range tables {
+		got, gotOK := s.Tables[table]
+		expected, expectedOK := golden.Tables[table]
+		switch {
+		case !expectedOK:
+			diff = append(diff, fmt.Sprintf("%s: unexpected table", table))
+			continue
+		case !gotOK:
+			diff = append(diff, fmt.Sprintf("%s: missing table", table))
+			continue
+		}
+		// Rows are compared as a multiset, a row stored twice has to be expected twice
+		counts := make(map[string]int, len(expected))
+		for _, row := range expected {
+			counts[compactJSON(row)]++
+		}
+		for _, row := range got {
+			key := compactJSON(row)
+			if counts[key] > 0 {
+				counts[key]--
+				continue
+			}
+			diff = append(diff, fmt.Sprintf("%s: unexpected row %s", table, key))
+		}
+		for _, row := range expected {
+			key := compactJSON(row)
+			if counts[key] > 0 {
+				counts[key]--
+				diff = append(diff, fmt.Sprintf("%s: missing row %s", table, key))
+			}
+		}
+	}
+	return diff
+}
+
+// compactJSON normalizes a row so golden files can be indented. Numbers are kept as written,
+// numeric(78,0) columns do not fit a float64.
+func compactJSON(row json.RawMessage) string {
+	decoder := json.NewDecoder(bytes.NewReader(row))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return string(row)
+	}
+	compacted, err := json.Marshal(value)
+	if err != nil {
+		return string(row)
+	}
+	return string(compacted)
+}
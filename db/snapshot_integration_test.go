@@ -0,0 +1,61 @@
+//go:build integration
+
+package db_test
+
+import (
+	"context"
+	"encoding/json"
+	"junoplugin/db/dbtest"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	dbClient, _ := dbtest.New(t)
+	insertTestBlock(t, dbClient, 1)
+	dbClient.BeginTx(context.Background())
+	if err := dbClient.StoreDriverEvent("StartBlock", "0x1001"); err != nil {
+		dbClient.RollbackTx()
+		t.Fatalf("Failed to store driver event: %v", err)
+	}
+	dbClient.CommitTx()
+
+	snapshot, err := dbClient.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to snapshot: %v", err)
+	}
+	if _, ok := snapshot.Tables["schema_migrations"]; ok {
+		t.Errorf("Expected schema_migrations to be left out")
+	}
+	if rows, ok := snapshot.Tables["events"]; !ok || len(rows) != 0 {
+		t.Errorf("Expected an empty events table, got %v", rows)
+	}
+	if rows := snapshot.Tables["starknet_blocks"]; len(rows) != 1 {
+		t.Fatalf("Expected 1 block, got %d", len(rows))
+	}
+
+	// Sequence and now() columns change between runs
+	rows := snapshot.Tables["driver_events"]
+	if len(rows) != 1 {
+		t.Fatalf("Expected 1 driver event, got %d", len(rows))
+	}
+	var driverEvent map[string]any
+	if err := json.Unmarshal(rows[0], &driverEvent); err != nil {
+		t.Fatalf("Failed to parse driver event: %v", err)
+	}
+	for _, column := range []string{"id", "timestamp"} {
+		if _, ok := driverEvent[column]; ok {
+			t.Errorf("Expected column %s to be left out, got %v", column, driverEvent)
+		}
+	}
+	if driverEvent["type"] != "StartBlock" {
+		t.Errorf("Expected a StartBlock driver event, got %v", driverEvent)
+	}
+
+	again, err := dbClient.Snapshot(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to snapshot: %v", err)
+	}
+	if diff := again.Diff(snapshot); len(diff) != 0 {
+		t.Errorf("Expected equal snapshots, got %v", diff)
+	}
+}
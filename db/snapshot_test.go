@@ -0,0 +1,67 @@
+package db
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	snapshot := func(tables map[string][]string) *Snapshot {
+		s := &Snapshot{Tables: make(map[string][]json.RawMessage)}
+		for table, rows := range tables {
+			s.Tables[table] = []json.RawMessage{}
+			for _, row := range rows {
+				s.Tables[table] = append(s.Tables[table], json.RawMessage(row))
+			}
+		}
+		return s
+	}
+	golden := snapshot(map[string][]string{
+		"events":          {`{"event_nonce": 1, "block_number": 100000000000000000000000000001}`, `{"event_nonce": 2}`},
+		"starknet_blocks": {`{"block_number": 7}`},
+	})
+
+	tests := []struct {
+		name     string
+		got      *Snapshot
+		expected []string
+	}{
+		{
+			name: "same rows formatted differently",
+			got: snapshot(map[string][]string{
+				"events":          {`{"event_nonce":2}`, `{"block_number":100000000000000000000000000001,"event_nonce":1}`},
+				"starknet_blocks": {`{"block_number":7}`},
+			}),
+		},
+		{
+			name: "changed and duplicated rows",
+			got: snapshot(map[string][]string{
+				"events":          {`{"event_nonce": 1, "block_number": 100000000000000000000000000002}`, `{"event_nonce": 2}`, `{"event_nonce": 2}`},
+				"starknet_blocks": {`{"block_number": 7}`},
+			}),
+			expected: []string{
+				`events: unexpected row {"block_number":100000000000000000000000000002,"event_nonce":1}`,
+				`events: unexpected row {"event_nonce":2}`,
+				`events: missing row {"block_number":100000000000000000000000000001,"event_nonce":1}`,
+			},
+		},
+		{
+			name: "missing and unexpected tables",
+			got: snapshot(map[string][]string{
+				"events":    {`{"event_nonce": 1, "block_number": 100000000000000000000000000001}`, `{"event_nonce": 2}`},
+				"new_table": {},
+			}),
+			expected: []string{"new_table: unexpected table", "starknet_blocks: missing table"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := tt.got.Diff(golden)
+			if !reflect.DeepEqual(diff, tt.expected) {
+				t.Errorf("Expected diff %q, got %q", tt.expected, diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"junoplugin/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// StoreVaultStorageDiffs writes the storage keys vaults changed in a block with a single insert.
+// Storing a block again overwrites its rows.
+func (db *DB) StoreVaultStorageDiffs(diffs []*models.VaultStorageDiff) (int64, error) {
+	if db.tx == nil {
+		return 0, errors.New("No transaction found")
+	}
+	if len(diffs) == 0 {
+		return 0, nil
+	}
+
+	addresses, keys, numbers, hashes, values := make([]string, len(diffs)), make([]string, len(diffs)), make([]uint64, len(diffs)), make([]string, len(diffs)), make([]string, len(diffs))
+	for i, diff := range diffs {
+		addresses[i], keys[i], numbers[i], hashes[i], values[i] = diff.VaultAddress, diff.StorageKey, diff.BlockNumber, diff.BlockHash, diff.StorageValue
+	}
+	query := `
+	INSERT INTO vault_storage_diffs (vault_address, storage_key, block_number, block_hash, storage_value)
+	SELECT * FROM unnest($1::varchar[], $2::varchar[], $3::numeric[], $4::varchar[], $5::varchar[])
+	ON CONFLICT (vault_address, storage_key, block_number) DO UPDATE SET
+		block_hash = EXCLUDED.block_hash,
+		storage_value = EXCLUDED.storage_value`
+	res, err := db.tx.Exec(context.Background(), query, addresses, keys, numbers, hashes, values)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store vault storage diffs: %w", err)
+	}
+	return res.RowsAffected(), nil
+}
+
+// RevertVaultStorageDiffs deletes the rows a reverted block wrote for the keys in reverseDiffs, the
+// vault part of the revert's reverse state diff
+func (db *DB) RevertVaultStorageDiffs(blockNumber uint64, blockHash string, reverseDiffs []*models.VaultStorageDiff) (int64, error) {
+	if db.tx == nil {
+		return 0, errors.New("No transaction found")
+	}
+	if len(reverseDiffs) == 0 {
+		return 0, nil
+	}
+
+	addresses, keys := make([]string, len(reverseDiffs)), make([]string, len(reverseDiffs))
+	for i, diff := range reverseDiffs {
+		addresses[i], keys[i] = diff.VaultAddress, diff.StorageKey
+	}
+	query := `
+	DELETE FROM vault_storage_diffs d
+	USING unnest($3::varchar[], $4::varchar[]) AS reverted(vault_address, storage_key)
+	WHERE d.block_number = $1 AND d.block_hash = $2
+		AND d.vault_address = reverted.vault_address AND d.storage_key = reverted.storage_key`
+	res, err := db.tx.Exec(context.Background(), query, blockNumber, blockHash, addresses, keys)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revert vault storage diffs: %w", err)
+	}
+	return res.RowsAffected(), nil
+}
+
+// GetVaultStorageAt returns the last write of a vault's storage key at or before blockNumber, nil
+// when the key was not written in the tracked blocks
+func (db *DB) GetVaultStorageAt(address, key string, blockNumber uint64) (*models.VaultStorageDiff, error) {
+	query := `
+	SELECT vault_address, storage_key, block_number, block_hash, storage_value
+	FROM vault_storage_diffs
+	WHERE vault_address = $1 AND storage_key = $2 AND block_number <= $3
+	ORDER BY block_number DESC
+	LIMIT 1`
+	var diff models.VaultStorageDiff
+	err := db.Pool.QueryRow(context.Background(), query, address, key, blockNumber).Scan(
+		&diff.VaultAddress,
+		&diff.StorageKey,
+		&diff.BlockNumber,
+		&diff.BlockHash,
+		&diff.StorageValue,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
@@ -0,0 +1,81 @@
+//go:build integration
+
+package db_test
+
+import (
+	"context"
+	"junoplugin/db/dbtest"
+	"junoplugin/models"
+	"testing"
+)
+
+func TestVaultStorageDiffs(t *testing.T) {
+	dbClient, _ := dbtest.New(t)
+	const vault, key = "0xabc", "0x5"
+	diff := func(blockNumber uint64, blockHash, value string) *models.VaultStorageDiff {
+		return &models.VaultStorageDiff{VaultAddress: vault, StorageKey: key, BlockNumber: blockNumber, BlockHash: blockHash, StorageValue: value}
+	}
+
+	tx, err := dbClient.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	// Block 12 is stored twice, the second write replaces the first
+	for _, diffs := range [][]*models.VaultStorageDiff{
+		{diff(10, "0xa10", "0x1"), {VaultAddress: vault, StorageKey: "0x6", BlockNumber: 10, BlockHash: "0xa10", StorageValue: "0x9"}},
+		{diff(12, "0xa12", "0x2")},
+		{diff(12, "0xa12", "0x3")},
+	} {
+		if _, err := tx.StoreVaultStorageDiffs(diffs); err != nil {
+			tx.Rollback()
+			t.Fatalf("Failed to store storage diffs: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	expectValue := func(blockNumber uint64, expected string) {
+		t.Helper()
+		stored, err := dbClient.GetVaultStorageAt(vault, key, blockNumber)
+		if err != nil {
+			t.Fatalf("Failed to read storage: %v", err)
+		}
+		value := ""
+		if stored != nil {
+			value = stored.StorageValue
+		}
+		if value != expected {
+			t.Errorf("Expected value %q at block %d, got %q", expected, blockNumber, value)
+		}
+	}
+	expectValue(9, "")
+	expectValue(11, "0x1")
+	expectValue(12, "0x3")
+
+	tx, err = dbClient.Begin(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	// A revert of another block with the same number leaves the rows alone
+	deleted, err := tx.RevertVaultStorageDiffs(12, "0xb12", []*models.VaultStorageDiff{diff(12, "0xb12", "0x1")})
+	if err != nil {
+		tx.Rollback()
+		t.Fatalf("Failed to revert storage diffs: %v", err)
+	}
+	if deleted != 0 {
+		t.Errorf("Expected no rows deleted for another block hash, got %d", deleted)
+	}
+	deleted, err = tx.RevertVaultStorageDiffs(12, "0xa12", []*models.VaultStorageDiff{diff(12, "0xa12", "0x1")})
+	if err != nil {
+		tx.Rollback()
+		t.Fatalf("Failed to revert storage diffs: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("Expected 1 row deleted, got %d", deleted)
+	}
+	expectValue(12, "0x1")
+}
@@ -0,0 +1,184 @@
+package db
+
+import (
+	"context"
+	"junoplugin/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// webhookSubscriptionColumns are the columns scanned by scanWebhookSubscription
+const webhookSubscriptionColumns = `id, url, secret, vault_addresses, event_names, enabled, created_at`
+
+func scanWebhookSubscription(row pgx.Row) (*models.WebhookSubscription, error) {
+	var subscription models.WebhookSubscription
+	err := row.Scan(&subscription.ID, &subscription.URL, &subscription.Secret, &subscription.VaultAddresses,
+		&subscription.EventNames, &subscription.Enabled, &subscription.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// InsertWebhookSubscription adds a webhook subscription, setting its ID and creation time
+func (db *DB) InsertWebhookSubscription(subscription *models.WebhookSubscription) error {
+	query := `
+	INSERT INTO webhook_subscriptions (url, secret, vault_addresses, event_names, enabled)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+	vaults, events := subscription.VaultAddresses, subscription.EventNames
+	if vaults == nil {
+		vaults = []string{}
+	}
+	if events == nil {
+		events = []string{}
+	}
+	return db.Pool.QueryRow(context.Background(), query, subscription.URL, subscription.Secret, vaults, events, subscription.Enabled).
+		Scan(&subscription.ID, &subscription.CreatedAt)
+}
+
+// GetWebhookSubscriptions returns every webhook subscription by ID, the disabled ones included
+func (db *DB) GetWebhookSubscriptions() ([]*models.WebhookSubscription, error) {
+	rows, err := db.Pool.Query(context.Background(), `SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscriptions []*models.WebhookSubscription
+	for rows.Next() {
+		subscription, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, rows.Err()
+}
+
+// SetWebhookSubscriptionEnabled enables or disables a webhook subscription, returning whether it exists
+func (db *DB) SetWebhookSubscriptionEnabled(id int64, enabled bool) (bool, error) {
+	res, err := db.Pool.Exec(context.Background(), `UPDATE webhook_subscriptions SET enabled = $2 WHERE id = $1`, id, enabled)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+// DeleteWebhookSubscription removes a webhook subscription with its delivery log and dead letters,
+// returning whether it existed
+func (db *DB) DeleteWebhookSubscription(id int64) (bool, error) {
+	res, err := db.Pool.Exec(context.Background(), `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+// InsertWebhookDelivery logs a delivery attempt, setting its ID and creation time
+func (db *DB) InsertWebhookDelivery(delivery *models.WebhookDelivery) error {
+	query := `
+	INSERT INTO webhook_deliveries
+	(subscription_id, delivery_id, event_name, vault_address, block_number, attempt, status_code, error, duration_ms)
+	VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0), NULLIF($8, ''), $9)
+	RETURNING id, created_at`
+	return db.Pool.QueryRow(context.Background(), query, delivery.SubscriptionID, delivery.DeliveryID, delivery.EventName,
+		delivery.VaultAddress, delivery.BlockNumber, delivery.Attempt, delivery.StatusCode, delivery.Error, delivery.DurationMs).
+		Scan(&delivery.ID, &delivery.CreatedAt)
+}
+
+// GetWebhookDeliveries returns the last limit delivery attempts of a subscription, newest first
+func (db *DB) GetWebhookDeliveries(subscriptionID int64, limit int) ([]*models.WebhookDelivery, error) {
+	query := `
+	SELECT id, subscription_id, delivery_id, event_name, vault_address, block_number, attempt,
+		COALESCE(status_code, 0), COALESCE(error, ''), duration_ms, created_at
+	FROM webhook_deliveries
+	WHERE subscription_id = $1
+	ORDER BY id DESC
+	LIMIT $2`
+	rows, err := db.Pool.Query(context.Background(), query, subscriptionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []*models.WebhookDelivery
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		if err := rows.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.DeliveryID, &delivery.EventName,
+			&delivery.VaultAddress, &delivery.BlockNumber, &delivery.Attempt, &delivery.StatusCode, &delivery.Error,
+			&delivery.DurationMs, &delivery.CreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+	return deliveries, rows.Err()
+}
+
+// InsertWebhookDeadLetter stores a delivery given up on, setting its ID and creation time
+func (db *DB) InsertWebhookDeadLetter(letter *models.WebhookDeadLetter) error {
+	query := `
+	INSERT INTO webhook_dead_letters (subscription_id, delivery_id, event_name, payload, attempts, error)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at`
+	return db.Pool.QueryRow(context.Background(), query, letter.SubscriptionID, letter.DeliveryID, letter.EventName,
+		letter.Payload, letter.Attempts, letter.Error).
+		Scan(&letter.ID, &letter.CreatedAt)
+}
+
+// GetWebhookDeadLetters returns the last limit dead letters of a subscription, or of every
+// subscription when subscriptionID is 0, newest first
+func (db *DB) GetWebhookDeadLetters(subscriptionID int64, limit int) ([]*models.WebhookDeadLetter, error) {
+	query := `
+	SELECT id, subscription_id, delivery_id, event_name, payload, attempts, error, created_at
+	FROM webhook_dead_letters
+	WHERE $1 = 0 OR subscription_id = $1
+	ORDER BY id DESC
+	LIMIT $2`
+	rows, err := db.Pool.Query(context.Background(), query, subscriptionID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var letters []*models.WebhookDeadLetter
+	for rows.Next() {
+		var letter models.WebhookDeadLetter
+		if err := rows.Scan(&letter.ID, &letter.SubscriptionID, &letter.DeliveryID, &letter.EventName, &letter.Payload,
+			&letter.Attempts, &letter.Error, &letter.CreatedAt); err != nil {
+			return nil, err
+		}
+		letters = append(letters, &letter)
+	}
+	return letters, rows.Err()
+}
+
+// GetWebhookDeadLetter returns a dead letter with its subscription, nil when either does not exist
+func (db *DB) GetWebhookDeadLetter(id int64) (*models.WebhookDeadLetter, *models.WebhookSubscription, error) {
+	var letter models.WebhookDeadLetter
+	query := `
+	SELECT id, subscription_id, delivery_id, event_name, payload, attempts, error, created_at
+	FROM webhook_dead_letters
+	WHERE id = $1`
+	err := db.Pool.QueryRow(context.Background(), query, id).Scan(&letter.ID, &letter.SubscriptionID, &letter.DeliveryID,
+		&letter.EventName, &letter.Payload, &letter.Attempts, &letter.Error, &letter.CreatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	row := db.Pool.QueryRow(context.Background(), `SELECT `+webhookSubscriptionColumns+` FROM webhook_subscriptions WHERE id = $1`, letter.SubscriptionID)
+	subscription, err := scanWebhookSubscription(row)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &letter, subscription, nil
+}
+
+// DeleteWebhookDeadLetter removes a dead letter once it has been delivered
+func (db *DB) DeleteWebhookDeadLetter(id int64) error {
+	_, err := db.Pool.Exec(context.Background(), `DELETE FROM webhook_dead_letters WHERE id = $1`, id)
+	return err
+}
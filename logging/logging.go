@@ -0,0 +1,76 @@
+// Package logging builds the plugin's structured logger. PluginCore creates one from the
+// configuration and hands it to each component, which tags its records with its name in the
+// component field. Records about a block or a vault carry the standard fields below.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Standard field keys
+const (
+	KeyComponent    = "component"
+	KeyBlockNumber  = "block_number"
+	KeyBlockHash    = "block_hash"
+	KeyVaultAddress = "vault_address"
+)
+
+// New creates a logger writing records at level and above to w in format, text when empty
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	parsed, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: parsed}
+	switch format {
+	case "", FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, expected %s or %s", format, FormatText, FormatJSON)
+}
+
+// ParseLevel parses debug, info, warn or error, info when empty
+func ParseLevel(level string) (slog.Level, error) {
+	var parsed slog.Level
+	if level == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := parsed.UnmarshalText([]byte(strings.ToLower(level))); err != nil {
+		return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn or error", level)
+	}
+	return parsed, nil
+}
+
+// Component returns logger tagged with a component's name, slog's default logger when logger is nil
+func Component(logger *slog.Logger, name string) *slog.Logger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger.With(KeyComponent, name)
+}
+
+// BlockNumber is the block_number field
+func BlockNumber(number uint64) slog.Attr {
+	return slog.Uint64(KeyBlockNumber, number)
+}
+
+// BlockHash is the block_hash field
+func BlockHash(hash string) slog.Attr {
+	return slog.String(KeyBlockHash, hash)
+}
+
+// VaultAddress is the vault_address field
+func VaultAddress(address string) slog.Attr {
+	return slog.String(KeyVaultAddress, address)
+}
@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		level   string
+		format  string
+		wantErr bool
+	}{
+		{name: "defaults"},
+		{name: "json debug", level: "debug", format: FormatJSON},
+		{name: "upper case level", level: "WARN", format: FormatText},
+		{name: "unknown level", level: "verbose", wantErr: true},
+		{name: "unknown format", format: "logfmt", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(&bytes.Buffer{}, tt.level, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestComponentFields(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := New(&out, "info", FormatJSON)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	vaults := Component(logger, "vault")
+	vaults.Debug("Dropped below the level")
+	vaults.Info("Caught up", BlockNumber(7), BlockHash("0xa"), VaultAddress("0xbeef"))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 record, got %d: %s", len(lines), out.String())
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("Failed to parse record: %v", err)
+	}
+	expected := map[string]any{
+		"msg":           "Caught up",
+		KeyComponent:    "vault",
+		KeyBlockNumber:  float64(7),
+		KeyBlockHash:    "0xa",
+		KeyVaultAddress: "0xbeef",
+	}
+	for key, value := range expected {
+		if record[key] != value {
+			t.Errorf("Expected %s %v, got %v", key, value, record[key])
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Package metrics holds the plugin's Prometheus metrics. They are registered with the default
+// registry, which Juno serves on its metrics endpoint.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "pitchlake"
+
+var (
+	// Ready is 1 once startup sync has completed and blocks are processed as they arrive
+	Ready = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ready",
+		Help:      "1 once startup sync has completed and blocks are processed as they arrive.",
+	})
+
+	// SyncPendingBlocks is the number of blocks buffered while startup sync runs
+	SyncPendingBlocks = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sync_pending_blocks",
+		Help:      "Blocks buffered until startup sync completes.",
+	})
+
+	// BlockCatchupHead is the last block committed by block catchup
+	BlockCatchupHead = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "block_catchup_head",
+		Help:      "Last block committed by block catchup.",
+	})
+
+	// BlockCatchupTarget is the block block catchup is working towards
+	BlockCatchupTarget = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "block_catchup_target",
+		Help:      "Block that block catchup is working towards.",
+	})
+
+	// VaultsCatchingUp is the number of vaults whose startup catchup has not handed over to live indexing
+	VaultsCatchingUp = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "vaults_catching_up",
+		Help:      "Vaults being caught up before they are indexed live.",
+	})
+
+	// VaultCatchupBlock is the last block fully indexed by a vault's catchup
+	VaultCatchupBlock = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "vault_catchup_block",
+		Help:      "Last block fully indexed by vault catchup.",
+	}, []string{"vault"})
+
+	// VaultCatchupTarget is the block a vault's catchup is working towards
+	VaultCatchupTarget = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "vault_catchup_target",
+		Help:      "Block that vault catchup is working towards.",
+	}, []string{"vault"})
+
+	// VaultCatchupEvents counts the events stored by vault catchup
+	VaultCatchupEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "vault_catchup_events_total",
+		Help:      "Events stored by vault catchup.",
+	}, []string{"vault"})
+
+	// VaultCatchupCheckpoints counts the checkpoints committed by vault catchup
+	VaultCatchupCheckpoints = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "vault_catchup_checkpoints_total",
+		Help:      "Pages and windows committed by vault catchup.",
+	}, []string{"vault"})
+
+	// VaultCatchupRestarts counts catchup windows fetched again because their continuation token was rejected
+	VaultCatchupRestarts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "vault_catchup_window_restarts_total",
+		Help:      "Catchup windows fetched again from their start after a continuation token was rejected.",
+	}, []string{"vault"})
+
+	// BusEventsDropped counts the events dropped because a bus subscriber's buffer was full
+	BusEventsDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bus_events_dropped_total",
+		Help:      "Events dropped because the buffer of an in-process subscriber was full.",
+	}, []string{"subscriber"})
+
+	// OutboxPublished counts the outbox messages the relay published and removed from the outbox
+	OutboxPublished = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_published_total",
+		Help:      "Outbox messages published to the sink.",
+	})
+
+	// OutboxPublishFailures counts the outbox batches that failed and are published again
+	OutboxPublishFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_publish_failures_total",
+		Help:      "Outbox batches the sink failed to publish, they are retried.",
+	})
+
+	// WebhookDeliveries counts the webhook requests sent, by result: success or failure
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook requests sent, by result.",
+	}, []string{"result"})
+
+	// WebhookDeadLetters counts the webhook deliveries given up on and stored as dead letters
+	WebhookDeadLetters = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_dead_letters_total",
+		Help:      "Webhook deliveries dead-lettered after failing for good.",
+	})
+)
@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"time"
@@ -59,7 +60,7 @@ func CoreToStarknetBlock(block core.Block) StarknetBlocks {
 		BlockHash:   block.Hash.String(),
 		ParentHash:  block.ParentHash.String(),
 		Timestamp:   block.Timestamp,
-		Status:      "MINED",
+		Status:      BlockStatusMined,
 	}
 	return starknetBlock
 }
@@ -70,7 +71,7 @@ func RPCBlockToStarknetBlock(rpcBlock *rpc.BlockTxHashes) *StarknetBlocks {
 		BlockHash:   rpcBlock.BlockHeader.Hash.String(),
 		ParentHash:  rpcBlock.BlockHeader.ParentHash.String(),
 		Timestamp:   rpcBlock.BlockHeader.Timestamp,
-		Status:      "MINED",
+		Status:      BlockStatusMined,
 	}
 }
 
@@ -78,20 +79,38 @@ type Event struct {
 	ID              uint     `json:"id"`
 	TransactionHash string   `json:"transaction_hash"`
 	BlockNumber     uint64   `json:"block_number"`
+	BlockHash       string   `json:"block_hash"`
 	VaultAddress    string   `json:"vault_address"`
 	Timestamp       uint64   `json:"timestamp"`
 	EventName       string   `json:"event_name"`
 	EventKeys       []string `json:"event_keys"`
 	EventData       []string `json:"event_data"`
-	EventNonce      int      `json:"event_nonce"`
+	// DecodedData is the event decoded with its ABI as a JSON object, nil when no ABI layout is known
+	DecodedData json.RawMessage `json:"decoded_data"`
+	EventNonce  int             `json:"event_nonce"`
+}
+
+// BlockStatus mirrors the block_status Postgres enum. Blocks are stored as MINED and move once,
+// to REVERTED on a reorg or to FINALIZED when they can no longer be reverted.
+type BlockStatus string
+
+const (
+	BlockStatusMined     BlockStatus = "MINED"
+	BlockStatusReverted  BlockStatus = "REVERTED"
+	BlockStatusFinalized BlockStatus = "FINALIZED"
+)
+
+// CanTransitionTo reports whether the starknet_blocks guard trigger accepts a change from s to next
+func (s BlockStatus) CanTransitionTo(next BlockStatus) bool {
+	return s == next || (s == BlockStatusMined && (next == BlockStatusReverted || next == BlockStatusFinalized))
 }
 
 type StarknetBlocks struct {
-	BlockNumber uint64 `json:"block_number"`
-	Timestamp   uint64 `json:"timestamp"`
-	BlockHash   string `json:"block_hash"`
-	ParentHash  string `json:"parent_hash"`
-	Status      string `json:"status"`
+	BlockNumber uint64      `json:"block_number"`
+	Timestamp   uint64      `json:"timestamp"`
+	BlockHash   string      `json:"block_hash"`
+	ParentHash  string      `json:"parent_hash"`
+	Status      BlockStatus `json:"status"`
 }
 
 type VaultRegistry struct {
@@ -100,13 +119,105 @@ type VaultRegistry struct {
 	DeployedAt         string  `json:"deployed_at"`
 	LastBlockIndexed   *string `json:"last_block_indexed"`
 	LastBlockProcessed *string `json:"last_block_processed"`
+	Paused             bool    `json:"paused"`
+}
+
+// VaultStatus is the indexing position of a registered vault
+type VaultStatus struct {
+	Address          string  `json:"address"`
+	DeployedAt       string  `json:"deployed_at"`
+	Paused           bool    `json:"paused"`
+	LastBlockIndexed *string `json:"last_block_indexed"`
+	LastBlockNumber  *uint64 `json:"last_block_number"`
+	EventCount       int64   `json:"event_count"`
+	HeadBlockNumber  *uint64 `json:"head_block_number"`
+	Lag              *uint64 `json:"lag"`
+}
+
+// VaultCheckpoint is a vault catchup window that is partly committed. Catchup resumes at
+// BlockNumber with ContinuationToken, over the same window so the token stays valid.
+type VaultCheckpoint struct {
+	VaultAddress      string    `json:"vault_address"`
+	BlockNumber       uint64    `json:"block_number"`
+	WindowEnd         uint64    `json:"window_end"`
+	ContinuationToken string    `json:"continuation_token"`
+	TargetBlock       uint64    `json:"target_block"`
+	EventsStored      int64     `json:"events_stored"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// VaultStorageDiff is a storage key of a vault written in a block, with the value it was set to
+type VaultStorageDiff struct {
+	VaultAddress string `json:"vault_address"`
+	StorageKey   string `json:"storage_key"`
+	BlockNumber  uint64 `json:"block_number"`
+	BlockHash    string `json:"block_hash"`
+	StorageValue string `json:"storage_value"`
+}
+
+// VaultClass is the class hash a vault has from BlockNumber on, set by its deployment or an upgrade
+type VaultClass struct {
+	VaultAddress string `json:"vault_address"`
+	BlockNumber  uint64 `json:"block_number"`
+	BlockHash    string `json:"block_hash"`
+	ClassHash    string `json:"class_hash"`
+}
+
+// ContractKind is the kind of a tracked contract, it decides which of the contract's events are
+// indexed and how they are decoded
+type ContractKind string
+
+const (
+	ContractKindVault  ContractKind = "vault"
+	ContractKindERC20  ContractKind = "erc20"
+	ContractKindOracle ContractKind = "oracle"
+	// ContractKindSubscription marks events matched by a subscription, whatever their emitter
+	ContractKindSubscription ContractKind = "subscription"
+)
+
+// Valid reports whether k is a known contract kind
+func (k ContractKind) Valid() bool {
+	switch k {
+	case ContractKindVault, ContractKindERC20, ContractKindOracle, ContractKindSubscription:
+		return true
+	}
+	return false
+}
+
+// TrackedContract is a contract whose events are indexed from StartBlock on. Vaults are tracked
+// through the vault registry, the other kinds through the tracked_contracts table and configuration.
+type TrackedContract struct {
+	Address    string       `json:"address"`
+	Kind       ContractKind `json:"kind"`
+	StartBlock uint64       `json:"start_block"`
+	// ABI is the path of an ABI file to decode the contract's events with, empty for the kind's default
+	ABI string `json:"abi,omitempty"`
+}
+
+// ContractEvent is an event of a tracked contract other than a vault, or an event matched by a
+// subscription
+type ContractEvent struct {
+	ContractAddress string       `json:"contract_address"`
+	Kind            ContractKind `json:"kind"`
+	BlockNumber     uint64       `json:"block_number"`
+	BlockHash       string       `json:"block_hash"`
+	TransactionHash string       `json:"transaction_hash"`
+	EventName       string       `json:"event_name"`
+	EventKeys       []string     `json:"event_keys"`
+	EventData       []string     `json:"event_data"`
+	// DecodedData is the event decoded with its ABI as a JSON object, nil when no ABI layout is known
+	DecodedData json.RawMessage `json:"decoded_data"`
+	// Subscription is the name of the subscription that matched the event, empty for tracked contracts
+	Subscription string `json:"subscription,omitempty"`
+	// VaultAddress is the tracked vault a subscription's $vault matcher matched, if any
+	VaultAddress string `json:"vault_address,omitempty"`
 }
 
 // DriverEvent represents a unified driver notification event
 type DriverEvent struct {
 	ID            int       `json:"id"`            // Database ID
 	SequenceIndex int64     `json:"sequence_index"` // Sequential counter for ordering
-	Type          string    `json:"type"`          // "StartBlock", "RevertBlock", or "CatchupVault"
+	Type          string    `json:"type"`          // "StartBlock", "RevertBlock", "CatchupVault", "ReindexVault" or "VaultUpgraded"
 	Timestamp     time.Time `json:"timestamp"`
 	IsProcessed   bool      `json:"is_processed"`
 	
@@ -119,4 +230,61 @@ type DriverEvent struct {
 	EndBlockHash   string   `json:"end_block_hash,omitempty"`   // Changed from EndBlock to EndBlockHash
 }
 
+// Kinds of outbox messages, the table the row was inserted into
+const (
+	OutboxKindEvent       = "event"
+	OutboxKindDriverEvent = "driver_event"
+)
 
+// OutboxMessage is a committed events or driver_events row waiting to be published
+type OutboxMessage struct {
+	ID   int64  `json:"id"`
+	Kind string `json:"kind"`
+	// VaultAddress orders the messages of a vault, empty for block driver events
+	VaultAddress string `json:"vault_address,omitempty"`
+	// Payload is the row as a JSON object
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// WebhookSubscription is an endpoint the vault events matching its filters are sent to
+type WebhookSubscription struct {
+	ID  int64  `json:"id"`
+	URL string `json:"url"`
+	// Secret signs the requests, it is never printed
+	Secret string `json:"-"`
+	// VaultAddresses and EventNames select the events sent, empty selects all of them
+	VaultAddresses []string  `json:"vault_addresses"`
+	EventNames     []string  `json:"event_names"`
+	Enabled        bool      `json:"enabled"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is an attempt to send an event to a webhook subscription
+type WebhookDelivery struct {
+	ID             int64 `json:"id"`
+	SubscriptionID int64 `json:"subscription_id"`
+	// DeliveryID identifies the event sent, it is the same across attempts
+	DeliveryID   string `json:"delivery_id"`
+	EventName    string `json:"event_name"`
+	VaultAddress string `json:"vault_address"`
+	BlockNumber  uint64 `json:"block_number"`
+	Attempt      int    `json:"attempt"`
+	// StatusCode is the response status, 0 when no response was received
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WebhookDeadLetter is a delivery given up on, Payload is the body to send again
+type WebhookDeadLetter struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscription_id"`
+	DeliveryID     string          `json:"delivery_id"`
+	EventName      string          `json:"event_name"`
+	Payload        json.RawMessage `json:"payload"`
+	Attempts       int             `json:"attempts"`
+	Error          string          `json:"error"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
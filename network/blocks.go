@@ -0,0 +1,198 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"junoplugin/models"
+	"math"
+	"net/http"
+	"sync"
+
+	"github.com/NethermindEth/starknet.go/client"
+	"github.com/NethermindEth/starknet.go/rpc"
+)
+
+// errBatchUnsupported means the endpoint answered a batch request as if it did not understand it
+var errBatchUnsupported = errors.New("JSON-RPC batches are not supported")
+
+// GetBlocks fetches the blocks fromBlock to toBlock inclusive, in order. The range is split into
+// chunks of BatchSize blocks, each fetched with one JSON-RPC batch request where the endpoint
+// supports them, with up to Concurrency chunks in flight. The first error cancels the rest.
+func (n *Network) GetBlocks(ctx context.Context, fromBlock uint64, toBlock uint64) ([]*models.StarknetBlocks, error) {
+	if toBlock < fromBlock {
+		return nil, fmt.Errorf("invalid block range %d to %d", fromBlock, toBlock)
+	}
+	if toBlock-fromBlock >= math.MaxInt32 {
+		return nil, fmt.Errorf("block range %d to %d is too large", fromBlock, toBlock)
+	}
+
+	numBlocks := toBlock - fromBlock + 1
+	blocks := make([]*models.StarknetBlocks, numBlocks)
+	chunkSize := uint64(n.opts.BatchSize)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, n.opts.Concurrency)
+	for start := uint64(0); start < numBlocks; start += chunkSize {
+		end := min(start+chunkSize, numBlocks)
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			// Each chunk writes its own part of blocks, which keeps the result in order
+			if err := n.fetchBlocks(ctx, fromBlock+start, blocks[start:end]); err != nil {
+				cancel(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := context.Cause(ctx); err != nil {
+		n.log.Error("Failed to get blocks", "from_block", fromBlock, "to_block", toBlock, "error", err)
+		return nil, err
+	}
+	return blocks, nil
+}
+
+// fetchBlocks fills blocks with the blocks starting at fromBlock, as a single retried call. A retry
+// resumes after the blocks already fetched.
+func (n *Network) fetchBlocks(ctx context.Context, fromBlock uint64, blocks []*models.StarknetBlocks) error {
+	fetched := 0
+	return n.call(ctx, "starknet_getBlockWithTxHashes", func(ctx context.Context, endpoint *endpoint) error {
+		if len(blocks)-fetched > 1 && endpoint.batchSupported() {
+			err := n.batchGetBlocks(ctx, endpoint, fromBlock+uint64(fetched), blocks[fetched:])
+			if !errors.Is(err, errBatchUnsupported) {
+				if err == nil {
+					fetched = len(blocks)
+				}
+				return err
+			}
+			if endpoint.disableBatch() {
+				n.log.Warn("RPC endpoint rejected a batch request, fetching blocks one at a time", "endpoint", endpoint.url)
+			}
+		}
+
+		for ; fetched < len(blocks); fetched++ {
+			blockNumber := fromBlock + uint64(fetched)
+			if fetched > 0 {
+				// The call took the token for the first request
+				if err := endpoint.limiter.Wait(ctx); err != nil {
+					return err
+				}
+			}
+
+			block, err := n.blockByNumber(ctx, endpoint, blockNumber)
+			if err != nil {
+				return err
+			}
+			blocks[fetched] = RPCBlockToStarknetBlock(block)
+		}
+		return nil
+	})
+}
+
+func (n *Network) blockByNumber(ctx context.Context, endpoint *endpoint, blockNumber uint64) (*rpc.BlockTxHashes, error) {
+	ctx, cancel := n.requestContext(ctx)
+	defer cancel()
+	block, err := endpoint.provider.BlockWithTxHashes(ctx, rpc.BlockID{Number: &blockNumber})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block %d: %w", blockNumber, err)
+	}
+	blockTxHashes, ok := block.(*rpc.BlockTxHashes)
+	if !ok {
+		return nil, fmt.Errorf("unexpected block type for block %v", blockNumber)
+	}
+	return blockTxHashes, nil
+}
+
+// batchGetBlocks requests the blocks starting at fromBlock in one JSON-RPC batch. It returns
+// errBatchUnsupported when the reply shows the endpoint does not handle batches.
+func (n *Network) batchGetBlocks(ctx context.Context, endpoint *endpoint, fromBlock uint64, blocks []*models.StarknetBlocks) error {
+	// Providers meter each call in a batch, the call took the token for the first one
+	for range len(blocks) - 1 {
+		if err := endpoint.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+
+	results := make([]rpc.BlockTxHashes, len(blocks))
+	batch := make([]client.BatchElem, len(blocks))
+	for i := range batch {
+		blockNumber := fromBlock + uint64(i)
+		batch[i] = client.BatchElem{
+			Method: "starknet_getBlockWithTxHashes",
+			Args:   []interface{}{rpc.BlockID{Number: &blockNumber}},
+			Result: &results[i],
+		}
+	}
+
+	requestCtx, cancel := n.requestContext(ctx)
+	defer cancel()
+	if err := endpoint.client.BatchCallContext(requestCtx, batch); err != nil {
+		if batchRejected(err, callStatusFrom(ctx)) {
+			return fmt.Errorf("%w: %v", errBatchUnsupported, err)
+		}
+		return fmt.Errorf("failed to get blocks %d to %d: %w", fromBlock, fromBlock+uint64(len(blocks))-1, err)
+	}
+
+	rejected := 0
+	var firstErr error
+	for i, elem := range batch {
+		blockNumber := fromBlock + uint64(i)
+		if elem.Error != nil {
+			if errors.Is(elem.Error, client.ErrMissingBatchResponse) {
+				rejected++
+			} else if code, ok := rpcErrorCode(elem.Error); ok && (code == rpc.InvalidRequest || code == rpc.MethodNotFound) {
+				rejected++
+			}
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to get block %d: %w", blockNumber, elem.Error)
+			}
+			continue
+		}
+		// A missing hash marks a pre-confirmed block, as in Provider.BlockWithTxHashes
+		if results[i].Hash == nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("unexpected block type for block %v", blockNumber)
+			}
+			continue
+		}
+		blocks[i] = RPCBlockToStarknetBlock(&results[i])
+	}
+	if rejected == len(batch) {
+		return fmt.Errorf("%w: %v", errBatchUnsupported, firstErr)
+	}
+	return firstErr
+}
+
+// batchRejected reports whether a failed batch request was refused for being a batch, such as a
+// single error object in place of the response array
+func batchRejected(err error, status *callStatus) bool {
+	statusCode, _, transportErr := status.get()
+	if transportErr != nil {
+		return false
+	}
+	switch statusCode {
+	case http.StatusBadRequest, http.StatusMethodNotAllowed, http.StatusRequestEntityTooLarge, http.StatusNotImplemented:
+		return true
+	case http.StatusOK:
+		var typeErr *json.UnmarshalTypeError
+		var syntaxErr *json.SyntaxError
+		return errors.As(err, &typeErr) || errors.As(err, &syntaxErr)
+	}
+	return false
+}
@@ -0,0 +1,158 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/starknet.go/rpc"
+)
+
+func TestGetBlocksOrder(t *testing.T) {
+	tests := []struct {
+		name             string
+		concurrency      int
+		batchSize        int
+		expectedRequests int
+	}{
+		{"serial", 1, 1, 38},
+		{"parallel", 4, 1, 38},
+		{"batched", 1, 5, 8},
+		{"parallel batched", 4, 5, 8},
+		{"uneven chunks", 3, 7, 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRPCServer(t)
+			server.latency = time.Millisecond
+			opts := testOptions
+			opts.Concurrency = tt.concurrency
+			opts.BatchSize = tt.batchSize
+			n := newTestNetwork(t, opts, server)
+
+			blocks, err := n.GetBlocks(context.Background(), 100, 137)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(blocks) != 38 {
+				t.Fatalf("Expected 38 blocks, got %d", len(blocks))
+			}
+			for i, block := range blocks {
+				number := uint64(100 + i)
+				if block.BlockNumber != number || block.BlockHash != fmt.Sprintf("0x%x", 0x1000+number) {
+					t.Errorf("Expected block %d at index %d, got %d %s", number, i, block.BlockNumber, block.BlockHash)
+				}
+			}
+			if requests := server.requestCount(); requests != tt.expectedRequests {
+				t.Errorf("Expected %d requests, got %d", tt.expectedRequests, requests)
+			}
+		})
+	}
+}
+
+func TestGetBlocksBatchFallback(t *testing.T) {
+	server := newRPCServer(t)
+	server.noBatch = true
+	opts := testOptions
+	opts.Concurrency = 2
+	opts.BatchSize = 5
+	n := newTestNetwork(t, opts, server)
+
+	blocks, err := n.GetBlocks(context.Background(), 1, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for i, block := range blocks {
+		if block.BlockNumber != uint64(i+1) {
+			t.Errorf("Expected block %d at index %d, got %d", i+1, i, block.BlockNumber)
+		}
+	}
+	if n.endpoints[0].batchSupported() {
+		t.Errorf("Expected batching to be disabled on the endpoint")
+	}
+
+	// Later calls go straight to single requests
+	if _, err := n.GetBlocks(context.Background(), 11, 20); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if calls := server.callCount("starknet_getBlockWithTxHashes"); calls != 20 {
+		t.Errorf("Expected 20 calls, got %d", calls)
+	}
+}
+
+func TestGetBlocksCancelsOnFirstError(t *testing.T) {
+	tests := []struct {
+		name      string
+		batchSize int
+	}{
+		{"single requests", 1},
+		{"batches", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRPCServer(t)
+			server.latency = 5 * time.Millisecond
+			server.blockErrors = map[uint64]int{6: rpc.InvalidParams}
+			opts := testOptions
+			opts.Concurrency = 2
+			opts.BatchSize = tt.batchSize
+			n := newTestNetwork(t, opts, server)
+
+			blocks, err := n.GetBlocks(context.Background(), 1, 400)
+			if err == nil || !strings.Contains(err.Error(), "block 6") {
+				t.Fatalf("Expected block 6 to fail, got %v", err)
+			}
+			if blocks != nil {
+				t.Errorf("Expected no blocks, got %d", len(blocks))
+			}
+			// Invalid params is permanent, so the remaining chunks are never requested
+			if calls := server.callCount("starknet_getBlockWithTxHashes"); calls > 20 {
+				t.Errorf("Expected the fetch to stop early, got %d calls", calls)
+			}
+		})
+	}
+}
+
+func TestGetBlocksInvalidRange(t *testing.T) {
+	n := newTestNetwork(t, testOptions, newRPCServer(t))
+	if _, err := n.GetBlocks(context.Background(), 5, 4); err == nil {
+		t.Errorf("Expected an error for a reversed range")
+	}
+}
+
+// BenchmarkGetBlocks compares block throughput against a node with 2ms of latency per request
+func BenchmarkGetBlocks(b *testing.B) {
+	const numBlocks = 200
+	benchmarks := []struct {
+		name        string
+		concurrency int
+		batchSize   int
+	}{
+		{"serial", 1, 1},
+		{"parallel", 8, 1},
+		{"batched", 1, 20},
+		{"parallel batched", 8, 20},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			server := newRPCServer(b)
+			server.latency = 2 * time.Millisecond
+			opts := testOptions
+			opts.Concurrency = bm.concurrency
+			opts.BatchSize = bm.batchSize
+			n := newTestNetwork(b, opts, server)
+
+			for b.Loop() {
+				if _, err := n.GetBlocks(context.Background(), 1, numBlocks); err != nil {
+					b.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			b.ReportMetric(float64(numBlocks*b.N)/b.Elapsed().Seconds(), "blocks/s")
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"junoplugin/utils"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/starknet.go/contracts"
+	"github.com/NethermindEth/starknet.go/rpc"
+)
+
+// ClassChange is a contract's class hash from BlockNumber on
+type ClassChange struct {
+	BlockNumber uint64
+	ClassHash   string
+}
+
+// ClassHashAt returns the class hash of the contract at address after blockNumber
+func (n *Network) ClassHashAt(ctx context.Context, blockNumber uint64, address string) (string, error) {
+	addressBytes, err := utils.HexStringToFelt(address)
+	if err != nil {
+		return "", err
+	}
+	addressFelt := felt.FromBytes(addressBytes)
+
+	var classHash *felt.Felt
+	err = n.call(ctx, "starknet_getClassHashAt", func(ctx context.Context, endpoint *endpoint) error {
+		ctx, cancel := n.requestContext(ctx)
+		defer cancel()
+		var err error
+		classHash, err = endpoint.provider.ClassHashAt(ctx, rpc.BlockID{Number: &blockNumber}, &addressFelt)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get class hash of %s at block %d: %w", address, blockNumber, err)
+	}
+	return classHash.String(), nil
+}
+
+// ClassABI returns the ABI JSON of a declared class
+func (n *Network) ClassABI(ctx context.Context, classHash string) ([]byte, error) {
+	hashBytes, err := utils.HexStringToFelt(classHash)
+	if err != nil {
+		return nil, err
+	}
+	hashFelt := felt.FromBytes(hashBytes)
+
+	var class rpc.ClassOutput
+	err = n.call(ctx, "starknet_getClass", func(ctx context.Context, endpoint *endpoint) error {
+		ctx, cancel := n.requestContext(ctx)
+		defer cancel()
+		var err error
+		class, err = endpoint.provider.Class(ctx, rpc.WithBlockTag(rpc.BlockTagLatest), &hashFelt)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get class %s: %w", classHash, err)
+	}
+	return classABI(class)
+}
+
+// ContractABI returns the ABI JSON of the class a contract currently runs
+func (n *Network) ContractABI(ctx context.Context, address string) ([]byte, error) {
+	addressBytes, err := utils.HexStringToFelt(address)
+	if err != nil {
+		return nil, err
+	}
+	addressFelt := felt.FromBytes(addressBytes)
+
+	var class rpc.ClassOutput
+	err = n.call(ctx, "starknet_getClassAt", func(ctx context.Context, endpoint *endpoint) error {
+		ctx, cancel := n.requestContext(ctx)
+		defer cancel()
+		var err error
+		class, err = endpoint.provider.ClassAt(ctx, rpc.WithBlockTag(rpc.BlockTagLatest), &addressFelt)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get class of %s: %w", address, err)
+	}
+	return classABI(class)
+}
+
+// classABI extracts the ABI of a Sierra or Cairo 0 class
+func classABI(class rpc.ClassOutput) ([]byte, error) {
+	switch class := class.(type) {
+	case *contracts.ContractClass:
+		return []byte(class.ABI), nil
+	case *contracts.DeprecatedContractClass:
+		return json.Marshal(class.ABI)
+	}
+	return nil, fmt.Errorf("unexpected class type %T", class)
+}
+
+// ClassChanges returns the blocks in [fromBlock, toBlock] where the class of the contract at address
+// changed, given its class hash before fromBlock. Each change is found by bisecting the range, so a
+// range without upgrades costs a single request. A contract upgraded and then moved back to its
+// earlier class within the range is not detected.
+func (n *Network) ClassChanges(ctx context.Context, address string, fromBlock, toBlock uint64, classHash string) ([]ClassChange, error) {
+	if toBlock < fromBlock {
+		return nil, fmt.Errorf("invalid block range %d-%d", fromBlock, toBlock)
+	}
+	current, err := n.ClassHashAt(ctx, toBlock, address)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []ClassChange
+	for current != classHash {
+		// The first block in [fromBlock, toBlock] whose class differs from classHash
+		low, high := fromBlock, toBlock
+		for low < high {
+			mid := low + (high-low)/2
+			midClass, err := n.ClassHashAt(ctx, mid, address)
+			if err != nil {
+				return nil, err
+			}
+			if midClass != classHash {
+				high = mid
+			} else {
+				low = mid + 1
+			}
+		}
+		if classHash, err = n.ClassHashAt(ctx, low, address); err != nil {
+			return nil, err
+		}
+		changes = append(changes, ClassChange{BlockNumber: low, ClassHash: classHash})
+		fromBlock = low + 1
+	}
+	return changes, nil
+}
@@ -0,0 +1,101 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestClassChanges(t *testing.T) {
+	server := newRPCServer(t)
+	server.classes = []ClassChange{{BlockNumber: 10, ClassHash: "0xc1"}, {BlockNumber: 437, ClassHash: "0xc2"}, {BlockNumber: 900, ClassHash: "0xc3"}}
+	n, err := NewNetwork([]string{server.URL}, testOptions)
+	if err != nil {
+		t.Fatalf("Failed to create network: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		fromBlock uint64
+		toBlock   uint64
+		classHash string
+		expected  []ClassChange
+	}{
+		{name: "no upgrade", fromBlock: 11, toBlock: 436, classHash: "0xc1"},
+		{name: "one upgrade", fromBlock: 11, toBlock: 899, classHash: "0xc1", expected: []ClassChange{{437, "0xc2"}}},
+		{name: "upgrade at the first block", fromBlock: 437, toBlock: 500, classHash: "0xc1", expected: []ClassChange{{437, "0xc2"}}},
+		{name: "upgrade at the last block", fromBlock: 400, toBlock: 437, classHash: "0xc1", expected: []ClassChange{{437, "0xc2"}}},
+		{name: "two upgrades", fromBlock: 11, toBlock: 1000, classHash: "0xc1", expected: []ClassChange{{437, "0xc2"}, {900, "0xc3"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changes, err := n.ClassChanges(context.Background(), "0x123", tt.fromBlock, tt.toBlock, tt.classHash)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(changes, tt.expected) {
+				t.Errorf("Expected changes %v, got %v", tt.expected, changes)
+			}
+		})
+	}
+
+	calls := server.callCount("starknet_getClassHashAt")
+	if _, err := n.ClassChanges(context.Background(), "0x123", 11, 436, "0xc1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := server.callCount("starknet_getClassHashAt") - calls; got != 1 {
+		t.Errorf("Expected a range without upgrades to cost 1 request, got %d", got)
+	}
+}
+
+func TestClassABI(t *testing.T) {
+	server := newRPCServer(t)
+	server.classABIs = map[string]string{"0xc1": `[{"type": "event", "name": "Deposit", "kind": "struct", "members": []}]`}
+	n, err := NewNetwork([]string{server.URL}, testOptions)
+	if err != nil {
+		t.Fatalf("Failed to create network: %v", err)
+	}
+
+	abi, err := n.ClassABI(context.Background(), "0xc1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var entries []map[string]any
+	if err := json.Unmarshal(abi, &entries); err != nil || len(entries) != 1 || entries[0]["name"] != "Deposit" {
+		t.Errorf("Expected the class's ABI, got %s (%v)", abi, err)
+	}
+
+	if _, err := n.ClassABI(context.Background(), "0xc2"); err == nil {
+		t.Errorf("Expected error but got none")
+	}
+}
+
+func TestContractABI(t *testing.T) {
+	server := newRPCServer(t)
+	server.classes = []ClassChange{{BlockNumber: 10, ClassHash: "0xc1"}, {BlockNumber: 20, ClassHash: "0xc2"}}
+	server.classABIs = map[string]string{
+		"0xc1": `[{"type": "event", "name": "Deposit", "kind": "struct", "members": []}]`,
+		"0xc2": `[{"type": "event", "name": "Withdrawal", "kind": "struct", "members": []}]`,
+	}
+	n, err := NewNetwork([]string{server.URL}, testOptions)
+	if err != nil {
+		t.Fatalf("Failed to create network: %v", err)
+	}
+
+	// The ABI of the contract's current class
+	abi, err := n.ContractABI(context.Background(), "0x123")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var entries []map[string]any
+	if err := json.Unmarshal(abi, &entries); err != nil || len(entries) != 1 || entries[0]["name"] != "Withdrawal" {
+		t.Errorf("Expected the current class's ABI, got %s (%v)", abi, err)
+	}
+
+	server.classes = nil
+	if _, err := n.ContractABI(context.Background(), "0x123"); err == nil {
+		t.Errorf("Expected error but got none")
+	}
+}
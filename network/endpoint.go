@@ -0,0 +1,192 @@
+package network
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/cookiejar"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/NethermindEth/starknet.go/client"
+	"github.com/NethermindEth/starknet.go/rpc"
+)
+
+// endpoint is one RPC node with its own rate limiter and health score
+type endpoint struct {
+	url      string
+	provider *rpc.Provider
+	// client sends the JSON-RPC batches the provider has no method for
+	client  *client.Client
+	limiter *tokenBucket
+	// noBatch is set once the endpoint rejects a batch request
+	noBatch atomic.Bool
+
+	mu sync.Mutex
+	// score tracks recent outcomes, from 0 (failing) to 1 (healthy)
+	score float64
+	// failures counts consecutive failed calls
+	failures int
+	// cooldown is the earliest time the endpoint should be used again
+	cooldown time.Time
+}
+
+func newEndpoint(url string, opts Options) (*endpoint, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	httpClient := &http.Client{Jar: jar, Transport: statusTransport{base: http.DefaultTransport}}
+	provider, err := rpc.NewProvider(url, client.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, err
+	}
+	rpcClient, err := client.DialOptions(context.Background(), url, client.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, err
+	}
+	return &endpoint{
+		url:      url,
+		provider: provider,
+		client:   rpcClient,
+		limiter:  newTokenBucket(opts.RateLimit, opts.Burst),
+		score:    1,
+	}, nil
+}
+
+func (e *endpoint) batchSupported() bool {
+	return !e.noBatch.Load()
+}
+
+// disableBatch reports whether batching was still enabled
+func (e *endpoint) disableBatch() bool {
+	return e.noBatch.CompareAndSwap(false, true)
+}
+
+func (e *endpoint) recordSuccess() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.score = 0.8*e.score + 0.2
+	e.failures = 0
+	e.cooldown = time.Time{}
+}
+
+// recordFailure lowers the score and benches the endpoint when it is rate limited or keeps failing
+func (e *endpoint) recordFailure(class errorClass, pause time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.score *= 0.5
+	e.failures++
+	if class == classRateLimited || e.failures >= 3 {
+		e.cooldown = time.Now().Add(pause)
+	}
+}
+
+// state returns the score and how long until the endpoint is usable
+func (e *endpoint) state(now time.Time) (float64, time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.score, e.cooldown.Sub(now)
+}
+
+// callStatus records the HTTP outcome of a call, which the RPC client only reports as a string
+type callStatus struct {
+	mu           sync.Mutex
+	statusCode   int
+	retryAfter   time.Duration
+	transportErr error
+}
+
+type callStatusKey struct{}
+
+func withCallStatus(ctx context.Context, status *callStatus) context.Context {
+	return context.WithValue(ctx, callStatusKey{}, status)
+}
+
+func callStatusFrom(ctx context.Context) *callStatus {
+	status, _ := ctx.Value(callStatusKey{}).(*callStatus)
+	return status
+}
+
+func (s *callStatus) get() (int, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statusCode, s.retryAfter, s.transportErr
+}
+
+// statusTransport fills in the callStatus carried by the request context
+type statusTransport struct {
+	base http.RoundTripper
+}
+
+func (t statusTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	status := callStatusFrom(req.Context())
+	if status == nil {
+		return resp, err
+	}
+
+	status.mu.Lock()
+	defer status.mu.Unlock()
+	status.transportErr = err
+	if resp != nil {
+		status.statusCode = resp.StatusCode
+		if seconds, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil && seconds > 0 {
+			status.retryAfter = time.Duration(seconds) * time.Second
+		}
+	}
+	return resp, err
+}
+
+// tokenBucket limits requests to rate per second with bursts of up to burst requests
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket returns nil, which never waits, when rate is not positive
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = int(math.Max(1, math.Ceil(rate)))
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait takes a token, sleeping until one is available or ctx is done
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	// Reserve the token even when the bucket is empty, so waiters are served in order
+	b.tokens--
+	deficit := -b.tokens
+	b.mu.Unlock()
+
+	if deficit <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(deficit / b.rate * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
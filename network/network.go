@@ -2,177 +2,374 @@ package network
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"junoplugin/logging"
 	"junoplugin/models"
+	"junoplugin/tracing"
 	"junoplugin/utils"
-	"log"
-	"os"
+	"log/slog"
+	"time"
 
 	"github.com/NethermindEth/juno/core/felt"
 	"github.com/NethermindEth/starknet.go/rpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Options tunes retries, failover and rate limiting, zero values use the defaults
+type Options struct {
+	// MaxAttempts is the number of tries per call across all endpoints
+	MaxAttempts int
+	// BaseDelay and MaxDelay bound the jittered exponential backoff between tries
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// RequestTimeout bounds a single RPC request, timeouts are retried
+	RequestTimeout time.Duration
+	// RateLimit is the requests per second allowed on each endpoint, 0 disables limiting
+	RateLimit float64
+	// Burst is the number of requests allowed at once, defaults to RateLimit rounded up
+	Burst int
+	// Concurrency bounds the requests GetBlocks has in flight
+	Concurrency int
+	// BatchSize is the number of blocks GetBlocks requests per JSON-RPC batch, 1 disables batching
+	BatchSize int
+	// Logger receives retries and failovers, slog's default logger when nil
+	Logger *slog.Logger
+}
+
+// DefaultOptions are used for unset Options fields
+var DefaultOptions = Options{
+	MaxAttempts:    5,
+	BaseDelay:      200 * time.Millisecond,
+	MaxDelay:       10 * time.Second,
+	RequestTimeout: 30 * time.Second,
+	Concurrency:    8,
+	BatchSize:      20,
+}
+
+func (o Options) withDefaults() Options {
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = DefaultOptions.MaxAttempts
+	}
+	if o.BaseDelay <= 0 {
+		o.BaseDelay = DefaultOptions.BaseDelay
+	}
+	if o.MaxDelay <= 0 {
+		o.MaxDelay = DefaultOptions.MaxDelay
+	}
+	if o.RequestTimeout <= 0 {
+		o.RequestTimeout = DefaultOptions.RequestTimeout
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultOptions.Concurrency
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = DefaultOptions.BatchSize
+	}
+	return o
+}
+
+// Network reads chain data over one or more RPC endpoints, failing over between them
 type Network struct {
-	provider *rpc.Provider
-	ctx      context.Context
+	endpoints []*endpoint
+	opts      Options
+	log       *slog.Logger
 }
 
-func NewNetwork() (*Network, error) {
-	provider, err := rpc.NewProvider(os.Getenv("RPC_URL"))
-	if err != nil {
-		return nil, err
+// NewNetwork creates a client over rpcURLs, the first being preferred while it is healthy
+func NewNetwork(rpcURLs []string, opts Options) (*Network, error) {
+	if len(rpcURLs) == 0 {
+		return nil, errors.New("at least one RPC URL is required")
+	}
+	opts = opts.withDefaults()
+
+	endpoints := make([]*endpoint, 0, len(rpcURLs))
+	for _, url := range rpcURLs {
+		endpoint, err := newEndpoint(url, opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create provider for %s: %w", url, err)
+		}
+		endpoints = append(endpoints, endpoint)
 	}
 	return &Network{
-		provider: provider,
-		ctx:      context.Background(),
+		endpoints: endpoints,
+		opts:      opts,
+		log:       logging.Component(opts.Logger, "network"),
 	}, nil
 }
 
-func (n *Network) GetBlockByHash(hash string) (*rpc.BlockTxHashes, error) {
-	feltString, err := utils.HexStringToFelt(hash)
-	if err != nil {
-		return nil, err
+// pickEndpoint returns the healthiest endpoint that is not cooling down, or the one that becomes
+// usable first along with how long to wait for it
+func (n *Network) pickEndpoint() (*endpoint, time.Duration) {
+	now := time.Now()
+	var best, soonest *endpoint
+	var bestScore float64
+	var soonestWait time.Duration
+	for _, endpoint := range n.endpoints {
+		score, wait := endpoint.state(now)
+		if wait <= 0 {
+			if best == nil || score > bestScore {
+				best, bestScore = endpoint, score
+			}
+			continue
+		}
+		if soonest == nil || wait < soonestWait {
+			soonest, soonestWait = endpoint, wait
+		}
 	}
-	hashFelt := felt.FromBytes(feltString)
-	block, err := n.provider.BlockWithTxHashes(n.ctx, rpc.BlockID{Hash: &hashFelt})
+	if best != nil {
+		return best, 0
+	}
+	return soonest, soonestWait
+}
+
+// call runs fn against the healthiest endpoint, retrying transient and rate limit errors with
+// backoff and failing over to the other endpoints, until ctx is done. fn bounds its requests with
+// requestContext. The call is traced as a span named after method, with an event per failed try.
+func (n *Network) call(ctx context.Context, method string, fn func(ctx context.Context, endpoint *endpoint) error) (err error) {
+	ctx, span := tracing.Start(ctx, method, attribute.String("rpc.system", "jsonrpc"), attribute.String("rpc.method", method))
+	attempts := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("rpc.attempts", attempts))
+		tracing.End(span, err)
+	}()
+
+	var lastErr error
+	endpoint, wait := n.pickEndpoint()
+	for attempt := 0; attempt < n.opts.MaxAttempts; attempt++ {
+		attempts = attempt + 1
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+		if err := endpoint.limiter.Wait(ctx); err != nil {
+			return err
+		}
+
+		status := &callStatus{}
+		err := fn(withCallStatus(ctx, status), endpoint)
+		if err == nil {
+			endpoint.recordSuccess()
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		class := classify(err, status)
+		if class == classPermanent {
+			return err
+		}
+		lastErr = fmt.Errorf("%s on %s: %w", method, endpoint.url, err)
+
+		delay := n.opts.backoff(attempt)
+		if _, retryAfter, _ := status.get(); retryAfter > delay {
+			delay = retryAfter
+		}
+		endpoint.recordFailure(class, delay)
+		span.AddEvent("retry", trace.WithAttributes(attribute.String("rpc.endpoint", endpoint.url), attribute.String("error.class", class.String()), attribute.String("error", err.Error())))
+		n.log.Warn("RPC call failed", "method", method, "class", class.String(), "attempt", attempt+1, "max_attempts", n.opts.MaxAttempts, "error", lastErr)
+
+		// Fail over right away when another endpoint is ready, otherwise back off
+		failed := endpoint
+		endpoint, wait = n.pickEndpoint()
+		if endpoint == failed && wait < delay {
+			wait = delay
+		}
+	}
+	return fmt.Errorf("%s failed after %d attempts: %w", method, n.opts.MaxAttempts, lastErr)
+}
+
+// requestContext bounds a single request of a call with RequestTimeout
+func (n *Network) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, n.opts.RequestTimeout)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// getBlock fetches a block by id, rejecting pre-confirmed blocks
+func (n *Network) getBlock(ctx context.Context, blockID rpc.BlockID, name any) (*rpc.BlockTxHashes, error) {
+	var block interface{}
+	err := n.call(ctx, "starknet_getBlockWithTxHashes", func(ctx context.Context, endpoint *endpoint) error {
+		ctx, cancel := n.requestContext(ctx)
+		defer cancel()
+		var err error
+		block, err = endpoint.provider.BlockWithTxHashes(ctx, blockID)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 	blockTxHashes, ok := block.(*rpc.BlockTxHashes)
 	if !ok {
-		return nil, fmt.Errorf("unexpected block type for block %v", hash)
+		return nil, fmt.Errorf("unexpected block type for block %v", name)
 	}
 	return blockTxHashes, nil
 }
 
-func (n *Network) GetEvents(fromBlock rpc.BlockID, toBlock rpc.BlockID, address *string) (*rpc.EventChunk, error) {
-
-	//Should be written bettern
-	var addressFelt felt.Felt
-	var addressBytes []byte
-	var err error
-	filter := rpc.EventFilter{
-		FromBlock: fromBlock,
-		ToBlock:   toBlock,
+func (n *Network) GetBlockByHash(ctx context.Context, hash string) (*rpc.BlockTxHashes, error) {
+	feltString, err := utils.HexStringToFelt(hash)
+	if err != nil {
+		return nil, err
 	}
-	if address != nil {
-		addressBytes, err = utils.HexStringToFelt(*address)
-		addressFelt = felt.FromBytes(addressBytes)
-		filter.Address = &addressFelt
+	hashFelt := felt.FromBytes(feltString)
+	return n.getBlock(ctx, rpc.BlockID{Hash: &hashFelt}, hash)
+}
 
+// BlockNumber returns the number of the latest block on the node, giving up as soon as ctx is done
+func (n *Network) BlockNumber(ctx context.Context) (uint64, error) {
+	var number uint64
+	err := n.call(ctx, "starknet_blockNumber", func(ctx context.Context, endpoint *endpoint) error {
+		ctx, cancel := n.requestContext(ctx)
+		defer cancel()
+		var err error
+		number, err = endpoint.provider.BlockNumber(ctx)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get block number: %w", err)
 	}
+	return number, nil
+}
+
+func (n *Network) GetEvents(ctx context.Context, fromBlock rpc.BlockID, toBlock rpc.BlockID, address *string) (*rpc.EventChunk, error) {
+	filter, err := eventFilter(fromBlock, toBlock, address)
 	if err != nil {
-		log.Printf("Error getting felt %f", err)
 		return nil, err
 	}
+	n.log.Debug("Getting events", "filter", filter)
+
+	return n.allEvents(ctx, filter, 10)
+}
 
-	log.Printf("Filter: %v", filter)
-	input := rpc.EventsInput{
-		EventFilter: filter,
-		ResultPageRequest: rpc.ResultPageRequest{
-			ChunkSize: 10,
-		},
+// GetEventsByKeys returns the events in [fromBlock, toBlock] whose keys match keys by position. Each
+// position lists the values it accepts, an empty one accepts any. address restricts the emitting
+// contract, empty for any.
+func (n *Network) GetEventsByKeys(ctx context.Context, fromBlock, toBlock uint64, address string, keys [][]string) (*rpc.EventChunk, error) {
+	var addressFilter *string
+	if address != "" {
+		addressFilter = &address
 	}
-	events, err := n.provider.Events(n.ctx, input)
+	filter, err := eventFilter(rpc.BlockID{Number: &fromBlock}, rpc.BlockID{Number: &toBlock}, addressFilter)
 	if err != nil {
-		log.Printf("Error getting events %f", err)
 		return nil, err
 	}
+	filter.Keys = make([][]*felt.Felt, len(keys))
+	for i, values := range keys {
+		filter.Keys[i] = make([]*felt.Felt, len(values))
+		for j, value := range values {
+			valueBytes, err := utils.HexStringToFelt(value)
+			if err != nil {
+				return nil, err
+			}
+			valueFelt := felt.FromBytes(valueBytes)
+			filter.Keys[i][j] = &valueFelt
+		}
+	}
+
+	events, err := n.allEvents(ctx, filter, EventsPageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events %d to %d: %w", fromBlock, toBlock, err)
+	}
 	return events, nil
 }
 
-func (n *Network) GetBlocks(fromBlock uint64, toBlock uint64) ([]*models.StarknetBlocks, error) {
+// allEvents returns every event matching filter, chunkSize events per request. Continuation tokens
+// are only valid on the node that issued them, so a retry starts the pagination over on whichever
+// endpoint it lands on.
+func (n *Network) allEvents(ctx context.Context, filter rpc.EventFilter, chunkSize int) (*rpc.EventChunk, error) {
+	var events *rpc.EventChunk
+	err := n.call(ctx, "starknet_getEvents", func(ctx context.Context, endpoint *endpoint) error {
+		input := rpc.EventsInput{
+			EventFilter: filter,
+			ResultPageRequest: rpc.ResultPageRequest{
+				ChunkSize: chunkSize,
+			},
+		}
+		// Follow continuation tokens so callers always see the whole range
+		events = &rpc.EventChunk{}
+		for {
+			pageCtx, cancel := n.requestContext(ctx)
+			chunk, err := endpoint.provider.Events(pageCtx, input)
+			cancel()
+			if err != nil {
+				return err
+			}
+			events.Events = append(events.Events, chunk.Events...)
+			if chunk.ContinuationToken == "" {
+				return nil
+			}
+			input.ContinuationToken = chunk.ContinuationToken
+		}
+	})
+	return events, err
+}
 
-	numBlocks := toBlock - fromBlock + 1
-	blocks := make([]*models.StarknetBlocks, 0, numBlocks)
+// GetEventsPage fetches the page of address's events in [fromBlock, toBlock] starting at
+// continuationToken, empty for the first page. The returned chunk's token is empty on the
+// last page. Tokens are only valid on the node that issued them, a rejected one is reported
+// by IsInvalidContinuationToken.
+func (n *Network) GetEventsPage(ctx context.Context, fromBlock, toBlock uint64, address string, continuationToken string) (*rpc.EventChunk, error) {
+	filter, err := eventFilter(rpc.BlockID{Number: &fromBlock}, rpc.BlockID{Number: &toBlock}, &address)
+	if err != nil {
+		return nil, err
+	}
 
-	for i := fromBlock; i <= toBlock; i++ {
-		log.Printf("Getting block %v", i)
+	var chunk *rpc.EventChunk
+	err = n.call(ctx, "starknet_getEvents", func(ctx context.Context, endpoint *endpoint) error {
+		ctx, cancel := n.requestContext(ctx)
+		defer cancel()
+		var err error
+		chunk, err = endpoint.provider.Events(ctx, rpc.EventsInput{
+			EventFilter: filter,
+			ResultPageRequest: rpc.ResultPageRequest{
+				ContinuationToken: continuationToken,
+				ChunkSize:         EventsPageSize,
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get events %d to %d: %w", fromBlock, toBlock, err)
+	}
+	return chunk, nil
+}
 
-		block, err := n.provider.BlockWithTxHashes(n.ctx, rpc.BlockID{Number: &i})
-		if err != nil {
-			log.Printf("Error getting block %v: %v", i, err)
-			return nil, fmt.Errorf("failed to get block %d: %w", i, err)
-		}
+// EventsPageSize is the number of events GetEventsPage requests per page
+const EventsPageSize = 1000
 
-		blockTxHashes, ok := block.(*rpc.BlockTxHashes)
-		if !ok {
-			return nil, fmt.Errorf("unexpected block type for block %v", i)
-		}
+// IsInvalidContinuationToken reports whether err is the node rejecting a continuation token
+func IsInvalidContinuationToken(err error) bool {
+	code, ok := rpcErrorCode(err)
+	return ok && code == rpc.ErrInvalidContinuationToken.Code
+}
 
-		blockHeader := blockTxHashes.BlockHeader
-		starknetBlock := &models.StarknetBlocks{
-			BlockNumber: i,
-			BlockHash:   blockHeader.Hash.String(),
-			ParentHash:  blockHeader.ParentHash.String(),
-			Timestamp:   blockHeader.Timestamp,
+func eventFilter(fromBlock rpc.BlockID, toBlock rpc.BlockID, address *string) (rpc.EventFilter, error) {
+	filter := rpc.EventFilter{
+		FromBlock: fromBlock,
+		ToBlock:   toBlock,
+	}
+	if address != nil {
+		addressBytes, err := utils.HexStringToFelt(*address)
+		if err != nil {
+			return filter, err
 		}
-
-		blocks = append(blocks, starknetBlock)
-		log.Printf("Processed block %v", i)
-	}
-
-	return blocks, nil
-
-	// Concurrent requests, debug further before using
-	// numBlocks := toBlock - fromBlock + 1
-	// blocks := make([]*models.StarknetBlocks, numBlocks)
-
-	// // Use a WaitGroup to wait for all goroutines to finish
-	// var wg sync.WaitGroup
-	// // Channel for errors
-	// errCh := make(chan error, numBlocks)
-	// // Semaphore to limit concurrency
-	// maxConcurrent := 10 // Adjust based on your needs
-	// sem := make(chan struct{}, maxConcurrent)
-
-	// for i := fromBlock; i <= toBlock; i++ {
-	// 	wg.Add(1)
-	// 	sem <- struct{}{} // Acquire semaphore
-
-	// 	go func(blockNum uint64, index uint64) {
-	// 		defer wg.Done()
-	// 		defer func() { <-sem }() // Release semaphore
-
-	// 		log.Printf("Getting block %v", blockNum)
-	// 		block, err := n.provider.BlockWithTxHashes(n.ctx, rpc.BlockID{Number: &blockNum})
-	// 		if err != nil {
-	// 			log.Printf("Error getting block %v: %v", blockNum, err)
-	// 			errCh <- err
-	// 			return
-	// 		}
-
-	// 		blockTxHashes, ok := block.(*rpc.BlockTxHashes)
-	// 		if !ok {
-	// 			errCh <- fmt.Errorf("unexpected block type for block %v", blockNum)
-	// 			return
-	// 		}
-
-	// 		blockHeader := blockTxHashes.BlockHeader
-	// 		starknetBlock := &models.StarknetBlocks{
-	// 			BlockNumber: blockNum,
-	// 			BlockHash:   blockHeader.Hash.String(),
-	// 			ParentHash:  blockHeader.ParentHash.String(),
-	// 			Timestamp:   blockHeader.Timestamp,
-	// 		}
-
-	// 		// Store in the correct position in the result slice
-	// 		blocks[index-fromBlock] = starknetBlock
-	// 		log.Printf("Processed block %v", blockNum)
-	// 	}(i, i)
-	// }
-
-	// // Wait for all goroutines to finish
-	// wg.Wait()
-	// close(errCh)
-
-	// // Check for any errors
-	// select {
-	// case err := <-errCh:
-	// 	return nil, err
-	// default:
-	// 	return blocks, nil
-	// }
+		addressFelt := felt.FromBytes(addressBytes)
+		filter.Address = &addressFelt
+	}
+	return filter, nil
 }
 
 func RPCBlockToStarknetBlock(rpcBlock *rpc.BlockTxHashes) *models.StarknetBlocks {
@@ -181,6 +378,6 @@ func RPCBlockToStarknetBlock(rpcBlock *rpc.BlockTxHashes) *models.StarknetBlocks
 		BlockHash:   rpcBlock.BlockHeader.Hash.String(),
 		ParentHash:  rpcBlock.BlockHeader.ParentHash.String(),
 		Timestamp:   rpcBlock.BlockHeader.Timestamp,
-		Status:      "MINED", // or get from rpcBlock.BlockHeader.Status if available
+		Status:      models.BlockStatusMined,
 	}
 }
@@ -0,0 +1,590 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"junoplugin/tracing"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/starknet.go/rpc"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// failure is a response injected by rpcServer instead of the real result
+type failure struct {
+	status     int
+	retryAfter string
+	rpcCode    int
+	delay      time.Duration
+}
+
+// rpcServer is a stand-in Starknet node serving blocks and two pages of events
+type rpcServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	calls    map[string]int
+	requests int
+	failures []failure
+	// failPages fails every getEvents request carrying a continuation token
+	failPages bool
+	// noBatch answers batch requests with a single invalid request error, as some nodes do
+	noBatch bool
+	// latency delays every HTTP request
+	latency time.Duration
+	// blockErrors answers getBlockWithTxHashes for these blocks with the given JSON-RPC error code
+	blockErrors map[uint64]int
+	// classes are the class changes getClassHashAt and getClassAt answer from, in block order
+	classes []ClassChange
+	// classABIs are the ABIs getClass answers with, by class hash
+	classABIs map[string]string
+	// eventFilters are the filters of the getEvents requests received
+	eventFilters []rpc.EventFilter
+}
+
+type rpcRequest struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+func newRPCServer(t testing.TB, failures ...failure) *rpcServer {
+	s := &rpcServer{calls: make(map[string]int), failures: failures}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *rpcServer) callCount(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+func (s *rpcServer) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *rpcServer) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	time.Sleep(s.latency)
+
+	var requests []rpcRequest
+	batch := len(body) > 0 && body[0] == '['
+	if batch {
+		err = json.Unmarshal(body, &requests)
+	} else {
+		requests = make([]rpcRequest, 1)
+		err = json.Unmarshal(body, &requests[0])
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if requests[0].Method == "starknet_specVersion" {
+		json.NewEncoder(w).Encode(rpcResult(requests[0].ID, "0.9.0"))
+		return
+	}
+	if batch && s.noBatch {
+		json.NewEncoder(w).Encode(rpcError(nil, rpc.InvalidRequest, "batch requests are not supported"))
+		return
+	}
+
+	var continuationToken string
+	var filter *rpc.EventFilter
+	if requests[0].Method == "starknet_getEvents" && len(requests[0].Params) > 0 {
+		var input rpc.EventsInput
+		json.Unmarshal(requests[0].Params[0], &input)
+		continuationToken = input.ContinuationToken
+		filter = &input.EventFilter
+	}
+
+	s.mu.Lock()
+	s.requests++
+	if filter != nil {
+		s.eventFilters = append(s.eventFilters, *filter)
+	}
+	for _, request := range requests {
+		s.calls[request.Method]++
+	}
+	var injected *failure
+	if len(s.failures) > 0 {
+		injected = &s.failures[0]
+		s.failures = s.failures[1:]
+	} else if s.failPages && continuationToken != "" {
+		injected = &failure{status: http.StatusServiceUnavailable}
+	}
+	s.mu.Unlock()
+
+	if injected != nil {
+		time.Sleep(injected.delay)
+		switch {
+		case injected.rpcCode != 0:
+			json.NewEncoder(w).Encode(rpcError(requests[0].ID, injected.rpcCode, "Invalid params"))
+			return
+		case injected.status != 0:
+			if injected.retryAfter != "" {
+				w.Header().Set("Retry-After", injected.retryAfter)
+			}
+			http.Error(w, http.StatusText(injected.status), injected.status)
+			return
+		}
+	}
+
+	responses := make([]map[string]any, 0, len(requests))
+	for _, request := range requests {
+		responses = append(responses, s.respond(request, continuationToken))
+	}
+	if batch {
+		json.NewEncoder(w).Encode(responses)
+	} else {
+		json.NewEncoder(w).Encode(responses[0])
+	}
+}
+
+func (s *rpcServer) respond(request rpcRequest, continuationToken string) map[string]any {
+	switch request.Method {
+	case "starknet_getBlockWithTxHashes":
+		var blockID struct {
+			BlockNumber uint64 `json:"block_number"`
+		}
+		json.Unmarshal(request.Params[0], &blockID)
+		if code, ok := s.blockErrors[blockID.BlockNumber]; ok {
+			return rpcError(request.ID, code, "Invalid params")
+		}
+		return rpcResult(request.ID, testBlock(blockID.BlockNumber))
+	case "starknet_blockNumber":
+		return rpcResult(request.ID, 42)
+	case "starknet_getEvents":
+		switch continuationToken {
+		case "":
+			return rpcResult(request.ID, map[string]any{"events": []any{testEvent(1)}, "continuation_token": "page-2"})
+		case "page-2":
+			return rpcResult(request.ID, map[string]any{"events": []any{testEvent(2)}})
+		}
+		return rpcError(request.ID, rpc.ErrInvalidContinuationToken.Code, rpc.ErrInvalidContinuationToken.Message)
+	case "starknet_getClassHashAt":
+		var blockID struct {
+			BlockNumber uint64 `json:"block_number"`
+		}
+		json.Unmarshal(request.Params[0], &blockID)
+		classHash := ""
+		for _, change := range s.classes {
+			if change.BlockNumber <= blockID.BlockNumber {
+				classHash = change.ClassHash
+			}
+		}
+		if classHash == "" {
+			return rpcError(request.ID, rpc.ErrContractNotFound.Code, rpc.ErrContractNotFound.Message)
+		}
+		return rpcResult(request.ID, classHash)
+	case "starknet_getClass":
+		var classHash string
+		json.Unmarshal(request.Params[1], &classHash)
+		abi, ok := s.classABIs[classHash]
+		if !ok {
+			return rpcError(request.ID, rpc.ErrClassHashNotFound.Code, rpc.ErrClassHashNotFound.Message)
+		}
+		return rpcResult(request.ID, sierraClass(abi))
+	case "starknet_getClassAt":
+		if len(s.classes) == 0 {
+			return rpcError(request.ID, rpc.ErrContractNotFound.Code, rpc.ErrContractNotFound.Message)
+		}
+		return rpcResult(request.ID, sierraClass(s.classABIs[s.classes[len(s.classes)-1].ClassHash]))
+	}
+	return rpcError(request.ID, rpc.MethodNotFound, "Method not found")
+}
+
+// sierraClass is a contract class with abi
+func sierraClass(abi string) map[string]any {
+	return map[string]any{
+		"sierra_program":         []string{"0x1"},
+		"contract_class_version": "0.1.0",
+		"entry_points_by_type":   map[string]any{"CONSTRUCTOR": []any{}, "EXTERNAL": []any{}, "L1_HANDLER": []any{}},
+		"abi":                    abi,
+	}
+}
+
+func rpcResult(id json.RawMessage, result any) map[string]any {
+	return map[string]any{"jsonrpc": "2.0", "id": id, "result": result}
+}
+
+func rpcError(id json.RawMessage, code int, message string) map[string]any {
+	return map[string]any{"jsonrpc": "2.0", "id": id, "error": map[string]any{"code": code, "message": message}}
+}
+
+func testBlock(number uint64) map[string]any {
+	price := map[string]string{"price_in_fri": "0x1", "price_in_wei": "0x1"}
+	return map[string]any{
+		"block_hash":        fmt.Sprintf("0x%x", 0x1000+number),
+		"parent_hash":       fmt.Sprintf("0x%x", 0x1000+number-1),
+		"block_number":      number,
+		"new_root":          "0x1",
+		"timestamp":         number,
+		"sequencer_address": "0x1",
+		"l1_gas_price":      price,
+		"l2_gas_price":      price,
+		"l1_data_gas_price": price,
+		"l1_da_mode":        "BLOB",
+		"starknet_version":  "0.14.0",
+		"status":            "ACCEPTED_ON_L2",
+		"transactions":      []string{},
+	}
+}
+
+func testEvent(blockNumber uint64) map[string]any {
+	return map[string]any{
+		"from_address":     "0x123",
+		"keys":             []string{"0x1"},
+		"data":             []string{},
+		"block_hash":       fmt.Sprintf("0x%x", 0x1000+blockNumber),
+		"block_number":     blockNumber,
+		"transaction_hash": fmt.Sprintf("0x%x", 0x2000+blockNumber),
+	}
+}
+
+// testOptions fetch one block per request, so calls map to attempts
+var testOptions = Options{
+	MaxAttempts:    4,
+	BaseDelay:      time.Millisecond,
+	MaxDelay:       5 * time.Millisecond,
+	RequestTimeout: 200 * time.Millisecond,
+	Concurrency:    1,
+	BatchSize:      1,
+}
+
+func newTestNetwork(t testing.TB, opts Options, servers ...*rpcServer) *Network {
+	urls := make([]string, 0, len(servers))
+	for _, server := range servers {
+		urls = append(urls, server.URL)
+	}
+	n, err := NewNetwork(urls, opts)
+	if err != nil {
+		t.Fatalf("Failed to create network: %v", err)
+	}
+	return n
+}
+
+func TestGetBlocksRetries(t *testing.T) {
+	tests := []struct {
+		name          string
+		failures      []failure
+		expectError   bool
+		expectedCalls int
+	}{
+		{
+			name:          "no failures",
+			expectedCalls: 3,
+		},
+		{
+			name:          "service unavailable is retried",
+			failures:      []failure{{status: http.StatusServiceUnavailable}, {status: http.StatusBadGateway}},
+			expectedCalls: 5,
+		},
+		{
+			name:          "timeout is retried",
+			failures:      []failure{{delay: 300 * time.Millisecond}},
+			expectedCalls: 4,
+		},
+		{
+			name:          "rate limit is retried",
+			failures:      []failure{{status: http.StatusTooManyRequests}},
+			expectedCalls: 4,
+		},
+		{
+			name:          "invalid params is not retried",
+			failures:      []failure{{rpcCode: rpc.InvalidParams}},
+			expectError:   true,
+			expectedCalls: 1,
+		},
+		{
+			name: "gives up after max attempts",
+			failures: []failure{
+				{status: http.StatusInternalServerError},
+				{status: http.StatusInternalServerError},
+				{status: http.StatusInternalServerError},
+				{status: http.StatusInternalServerError},
+			},
+			expectError:   true,
+			expectedCalls: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newRPCServer(t, tt.failures...)
+			n := newTestNetwork(t, testOptions, server)
+
+			blocks, err := n.GetBlocks(context.Background(), 10, 12)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if len(blocks) != 3 || blocks[0].BlockNumber != 10 || blocks[2].BlockNumber != 12 {
+					t.Errorf("Expected blocks 10-12, got %v", blocks)
+				}
+			}
+
+			if calls := server.callCount("starknet_getBlockWithTxHashes"); calls != tt.expectedCalls {
+				t.Errorf("Expected %d calls, got %d", tt.expectedCalls, calls)
+			}
+		})
+	}
+}
+
+func TestFailover(t *testing.T) {
+	t.Run("unhealthy primary", func(t *testing.T) {
+		primary := newRPCServer(t, failure{status: http.StatusInternalServerError}, failure{status: http.StatusInternalServerError})
+		fallback := newRPCServer(t)
+		n := newTestNetwork(t, testOptions, primary, fallback)
+
+		if _, err := n.GetBlocks(context.Background(), 1, 1); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if calls := primary.callCount("starknet_getBlockWithTxHashes"); calls != 1 {
+			t.Errorf("Expected 1 call to the primary, got %d", calls)
+		}
+
+		// The fallback now scores higher, so it keeps serving
+		if _, err := n.GetBlocks(context.Background(), 2, 3); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if calls := fallback.callCount("starknet_getBlockWithTxHashes"); calls != 3 {
+			t.Errorf("Expected 3 calls to the fallback, got %d", calls)
+		}
+	})
+
+	t.Run("rate limited primary is benched", func(t *testing.T) {
+		primary := newRPCServer(t, failure{status: http.StatusTooManyRequests, retryAfter: "5"})
+		fallback := newRPCServer(t)
+		n := newTestNetwork(t, testOptions, primary, fallback)
+
+		start := time.Now()
+		if _, err := n.GetBlocks(context.Background(), 1, 3); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Expected immediate failover, took %v", elapsed)
+		}
+		if calls := primary.callCount("starknet_getBlockWithTxHashes"); calls != 1 {
+			t.Errorf("Expected 1 call to the primary, got %d", calls)
+		}
+	})
+
+	t.Run("event pagination restarts on failover", func(t *testing.T) {
+		primary := newRPCServer(t)
+		primary.failPages = true
+		fallback := newRPCServer(t)
+		n := newTestNetwork(t, testOptions, primary, fallback)
+
+		from, to := uint64(1), uint64(2)
+		events, err := n.GetEvents(context.Background(), rpc.BlockID{Number: &from}, rpc.BlockID{Number: &to}, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(events.Events) != 2 || events.Events[0].BlockNumber != 1 || events.Events[1].BlockNumber != 2 {
+			t.Errorf("Expected one event per block, got %+v", events.Events)
+		}
+	})
+}
+
+func TestGetEventsPage(t *testing.T) {
+	server := newRPCServer(t)
+	n := newTestNetwork(t, testOptions, server)
+
+	first, err := n.GetEventsPage(context.Background(), 1, 2, "0x123", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(first.Events) != 1 || first.ContinuationToken != "page-2" {
+		t.Errorf("Expected one event and a token, got %d events and %q", len(first.Events), first.ContinuationToken)
+	}
+
+	last, err := n.GetEventsPage(context.Background(), 1, 2, "0x123", first.ContinuationToken)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(last.Events) != 1 || last.Events[0].BlockNumber != 2 || last.ContinuationToken != "" {
+		t.Errorf("Expected the last page, got %+v", last)
+	}
+
+	// A token from another node is rejected without retrying
+	_, err = n.GetEventsPage(context.Background(), 1, 2, "0x123", "issued-elsewhere")
+	if !IsInvalidContinuationToken(err) {
+		t.Errorf("Expected an invalid continuation token error, got %v", err)
+	}
+	if calls := server.callCount("starknet_getEvents"); calls != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls)
+	}
+}
+
+func TestGetEventsByKeys(t *testing.T) {
+	server := newRPCServer(t)
+	n := newTestNetwork(t, testOptions, server)
+
+	events, err := n.GetEventsByKeys(context.Background(), 1, 2, "", [][]string{{"0x99"}, {}, {"0xa", "0xb"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(events.Events) != 2 {
+		t.Errorf("Expected the events of both pages, got %+v", events.Events)
+	}
+
+	server.mu.Lock()
+	filter := server.eventFilters[0]
+	server.mu.Unlock()
+	if filter.Address != nil {
+		t.Errorf("Expected no address filter, got %v", filter.Address)
+	}
+	if len(filter.Keys) != 3 || len(filter.Keys[0]) != 1 || filter.Keys[0][0].String() != "0x99" ||
+		len(filter.Keys[1]) != 0 || len(filter.Keys[2]) != 2 || filter.Keys[2][1].String() != "0xb" {
+		t.Errorf("Expected keys [[0x99] [] [0xa 0xb]], got %v", filter.Keys)
+	}
+
+	if _, err := n.GetEventsByKeys(context.Background(), 1, 2, "", [][]string{{"0xzz"}}); err == nil {
+		t.Errorf("Expected error but got none")
+	}
+}
+
+func TestBlockNumber(t *testing.T) {
+	server := newRPCServer(t)
+	n := newTestNetwork(t, testOptions, server)
+
+	number, err := n.BlockNumber(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if number != 42 {
+		t.Errorf("Expected block 42, got %d", number)
+	}
+
+	// A done context gives up without retrying
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := n.BlockNumber(ctx); err == nil {
+		t.Errorf("Expected error but got none")
+	}
+	if calls := server.callCount("starknet_blockNumber"); calls > 2 {
+		t.Errorf("Expected at most 2 calls, got %d", calls)
+	}
+}
+
+func TestCallSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracing.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { tracing.SetTracerProvider(noop.NewTracerProvider()) })
+
+	server := newRPCServer(t, failure{status: http.StatusServiceUnavailable})
+	n := newTestNetwork(t, testOptions, server)
+	ctx, parent := tracing.Start(context.Background(), "NewBlock")
+	if _, err := n.BlockNumber(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 || spans[0].Name() != "starknet_blockNumber" {
+		t.Fatalf("Expected a starknet_blockNumber span, got %d spans", len(spans))
+	}
+	span := spans[0]
+	if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("Expected the call's span to be a child of the caller's")
+	}
+	if len(span.Events()) != 1 || span.Events()[0].Name != "retry" {
+		t.Errorf("Expected one retry event, got %+v", span.Events())
+	}
+	for _, attr := range span.Attributes() {
+		if attr.Key == "rpc.attempts" && attr.Value.AsInt64() != 2 {
+			t.Errorf("Expected 2 attempts, got %d", attr.Value.AsInt64())
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		statusCode   int
+		transportErr error
+		expected     errorClass
+	}{
+		{"too many requests", rpc.Err(rpc.InternalError, nil), 429, nil, classRateLimited},
+		{"service unavailable", rpc.Err(rpc.InternalError, nil), 503, nil, classTransient},
+		{"connection refused", rpc.Err(rpc.InternalError, nil), 0, errors.New("connection refused"), classTransient},
+		{"unauthorized", rpc.Err(rpc.InternalError, nil), 401, nil, classTransient},
+		{"invalid params", rpc.Err(rpc.InvalidParams, nil), 200, nil, classPermanent},
+		{"method not found", rpc.Err(rpc.MethodNotFound, nil), 200, nil, classPermanent},
+		{"block not found", rpc.ErrBlockNotFound, 200, nil, classPermanent},
+		{"node internal error", rpc.Err(rpc.InternalError, nil), 200, nil, classTransient},
+		{"provider rate limit", rpc.Err(-32005, rpc.StringErrData("daily request count exceeded")), 200, nil, classRateLimited},
+		{"not an rpc error", errors.New("unexpected block type"), 0, nil, classPermanent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := &callStatus{statusCode: tt.statusCode, transportErr: tt.transportErr}
+			if class := classify(tt.err, status); class != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, class)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	opts := Options{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, ceiling := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		ceiling *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			if delay := opts.backoff(attempt); delay < ceiling/2 || delay > ceiling {
+				t.Errorf("Attempt %d: expected delay in [%v, %v], got %v", attempt, ceiling/2, ceiling, delay)
+			}
+		}
+	}
+	if delay := opts.backoff(80); delay > time.Second {
+		t.Errorf("Expected large attempts to be capped, got %v", delay)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	if newTokenBucket(0, 0) != nil {
+		t.Errorf("Expected no limiter without a rate")
+	}
+
+	// Two requests go through on the burst, the next three wait 1/50s each
+	bucket := newTokenBucket(50, 2)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := bucket.Wait(t.Context()); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 55*time.Millisecond {
+		t.Errorf("Expected rate limiting to take at least 55ms, took %v", elapsed)
+	}
+}
+
+func TestNewNetworkRequiresURL(t *testing.T) {
+	if _, err := NewNetwork(nil, Options{}); err == nil || !strings.Contains(err.Error(), "RPC URL") {
+		t.Errorf("Expected missing URL error, got %v", err)
+	}
+}
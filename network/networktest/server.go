@@ -0,0 +1,353 @@
+// Package networktest provides a fake Starknet node for the tests of packages built on network. The
+// node serves a chain of empty blocks up to a head, the events and class hashes a test adds to it,
+// and counts the calls it receives.
+package networktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"junoplugin/network"
+	"junoplugin/utils"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/juno/core/felt"
+	"github.com/NethermindEth/starknet.go/rpc"
+)
+
+// hashOffset separates block hashes from block numbers, so a number passed as a hash is not found
+const hashOffset = 0x1000
+
+// BlockHash returns the hash of the block at number on every fake node
+func BlockHash(number uint64) string {
+	return fmt.Sprintf("0x%x", hashOffset+number)
+}
+
+// TransactionHash returns the hash events of the block at number get when added without one
+func TransactionHash(number uint64) string {
+	return fmt.Sprintf("0x%x", 2*hashOffset+number)
+}
+
+// Event is an event emitted in a block of the fake chain
+type Event struct {
+	BlockNumber     uint64
+	From            string
+	Keys            []string
+	Data            []string
+	TransactionHash string
+}
+
+// ContractDeployed returns the event the UDC at udcAddress emits when it deploys address with
+// classHash at blockNumber
+func ContractDeployed(udcAddress, address, classHash string, blockNumber uint64) Event {
+	return Event{
+		BlockNumber: blockNumber,
+		From:        udcAddress,
+		Keys:        []string{utils.Keccak256("ContractDeployed")},
+		// address, deployer, unique, class hash, calldata length, salt
+		Data: []string{address, "0x1", "0x0", classHash, "0x0", "0x1"},
+	}
+}
+
+// Server is a fake Starknet node serving JSON-RPC over HTTP
+type Server struct {
+	*httptest.Server
+	mu     sync.Mutex
+	head   uint64
+	events []Event
+	// classes are the class changes of each contract, by address, in block order
+	classes map[string][]network.ClassChange
+	calls   map[string]int
+}
+
+type request struct {
+	ID     json.RawMessage   `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// NewServer starts a fake node whose chain ends at head, closed when the test ends
+func NewServer(t testing.TB, head uint64) *Server {
+	s := &Server{head: head, classes: make(map[string][]network.ClassChange), calls: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Network returns a client of the node that does not wait between attempts
+func (s *Server) Network(t testing.TB) *network.Network {
+	t.Helper()
+	n, err := network.NewNetwork([]string{s.URL}, network.Options{
+		MaxAttempts: 2,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    time.Millisecond,
+		Logger:      slog.New(slog.DiscardHandler),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create network: %v", err)
+	}
+	return n
+}
+
+// SetHead moves the head of the chain
+func (s *Server) SetHead(number uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.head = number
+}
+
+// AddEvents adds events to the chain, after the events already in their blocks
+func (s *Server) AddEvents(events ...Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, event := range events {
+		if event.TransactionHash == "" {
+			event.TransactionHash = TransactionHash(event.BlockNumber)
+		}
+		s.events = append(s.events, event)
+	}
+	sort.SliceStable(s.events, func(i, j int) bool { return s.events[i].BlockNumber < s.events[j].BlockNumber })
+}
+
+// SetClass makes classHash the class of the contract at address from blockNumber on. A contract
+// without a class is not found.
+func (s *Server) SetClass(address string, blockNumber uint64, classHash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := normalize(address)
+	s.classes[key] = append(s.classes[key], network.ClassChange{BlockNumber: blockNumber, ClassHash: classHash})
+	slices.SortStableFunc(s.classes[key], func(a, b network.ClassChange) int {
+		return int(a.BlockNumber) - int(b.BlockNumber)
+	})
+}
+
+// Calls returns the number of calls of a JSON-RPC method received, batched ones included
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var requests []request
+	batch := len(body) > 0 && body[0] == '['
+	if batch {
+		err = json.Unmarshal(body, &requests)
+	} else {
+		requests = make([]request, 1)
+		err = json.Unmarshal(body, &requests[0])
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	responses := make([]map[string]any, 0, len(requests))
+	for _, request := range requests {
+		s.calls[request.Method]++
+		responses = append(responses, s.respond(request))
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if batch {
+		json.NewEncoder(w).Encode(responses)
+	} else {
+		json.NewEncoder(w).Encode(responses[0])
+	}
+}
+
+// respond answers a request, with s.mu held
+func (s *Server) respond(request request) map[string]any {
+	switch request.Method {
+	case "starknet_specVersion":
+		return result(request.ID, "0.9.0")
+	case "starknet_blockNumber":
+		return result(request.ID, s.head)
+	case "starknet_getBlockWithTxHashes":
+		var blockID rpc.BlockID
+		if len(request.Params) < 1 || json.Unmarshal(request.Params[0], &blockID) != nil {
+			return rpcError(request.ID, rpc.InvalidParams, "Invalid params")
+		}
+		number, ok := s.blockNumber(blockID)
+		if !ok {
+			return rpcError(request.ID, rpc.ErrBlockNotFound.Code, rpc.ErrBlockNotFound.Message)
+		}
+		return result(request.ID, block(number))
+	case "starknet_getEvents":
+		var input rpc.EventsInput
+		if len(request.Params) < 1 || json.Unmarshal(request.Params[0], &input) != nil {
+			return rpcError(request.ID, rpc.InvalidParams, "Invalid params")
+		}
+		return s.getEvents(request.ID, input)
+	case "starknet_getClassHashAt":
+		var blockID rpc.BlockID
+		var address string
+		if len(request.Params) < 2 || json.Unmarshal(request.Params[0], &blockID) != nil || json.Unmarshal(request.Params[1], &address) != nil {
+			return rpcError(request.ID, rpc.InvalidParams, "Invalid params")
+		}
+		number, ok := s.blockNumber(blockID)
+		if !ok {
+			return rpcError(request.ID, rpc.ErrBlockNotFound.Code, rpc.ErrBlockNotFound.Message)
+		}
+		classHash := ""
+		for _, change := range s.classes[normalize(address)] {
+			if change.BlockNumber <= number {
+				classHash = change.ClassHash
+			}
+		}
+		if classHash == "" {
+			return rpcError(request.ID, rpc.ErrContractNotFound.Code, rpc.ErrContractNotFound.Message)
+		}
+		return result(request.ID, classHash)
+	}
+	return rpcError(request.ID, rpc.MethodNotFound, "Method not found")
+}
+
+// blockNumber resolves a block id on the chain
+func (s *Server) blockNumber(blockID rpc.BlockID) (uint64, bool) {
+	switch {
+	case blockID.Number != nil:
+		return *blockID.Number, *blockID.Number <= s.head
+	case blockID.Hash != nil:
+		value, err := strconv.ParseUint(strings.TrimPrefix(blockID.Hash.String(), "0x"), 16, 64)
+		if err != nil || value < hashOffset || value-hashOffset > s.head {
+			return 0, false
+		}
+		return value - hashOffset, true
+	case blockID.Tag == rpc.BlockTagLatest:
+		return s.head, true
+	}
+	return 0, false
+}
+
+// getEvents answers a page of the events matching the filter, continuation tokens are offsets
+func (s *Server) getEvents(id json.RawMessage, input rpc.EventsInput) map[string]any {
+	from, fromOK := s.blockNumber(input.FromBlock)
+	to, toOK := s.blockNumber(input.ToBlock)
+	if !fromOK || !toOK {
+		return rpcError(id, rpc.ErrBlockNotFound.Code, rpc.ErrBlockNotFound.Message)
+	}
+	offset := 0
+	if input.ContinuationToken != "" {
+		var err error
+		if offset, err = strconv.Atoi(input.ContinuationToken); err != nil {
+			return rpcError(id, rpc.ErrInvalidContinuationToken.Code, rpc.ErrInvalidContinuationToken.Message)
+		}
+	}
+
+	var matched []Event
+	for _, event := range s.events {
+		if event.BlockNumber < from || event.BlockNumber > to {
+			continue
+		}
+		if input.Address != nil && normalize(event.From) != input.Address.String() {
+			continue
+		}
+		if !matchKeys(event.Keys, input.Keys) {
+			continue
+		}
+		matched = append(matched, event)
+	}
+
+	end := len(matched)
+	token := ""
+	if input.ChunkSize > 0 && offset+input.ChunkSize < end {
+		end = offset + input.ChunkSize
+		token = strconv.Itoa(end)
+	}
+	page := make([]map[string]any, 0, max(end-offset, 0))
+	for _, event := range matched[min(offset, end):end] {
+		page = append(page, map[string]any{
+			"from_address":     event.From,
+			"keys":             nonNil(event.Keys),
+			"data":             nonNil(event.Data),
+			"block_hash":       BlockHash(event.BlockNumber),
+			"block_number":     event.BlockNumber,
+			"transaction_hash": event.TransactionHash,
+		})
+	}
+	chunk := map[string]any{"events": page}
+	if token != "" {
+		chunk["continuation_token"] = token
+	}
+	return result(id, chunk)
+}
+
+// matchKeys reports whether keys match a filter by position, an empty position accepts any key
+func matchKeys(keys []string, filter [][]*felt.Felt) bool {
+	for i, accepted := range filter {
+		if len(accepted) == 0 {
+			continue
+		}
+		if i >= len(keys) {
+			return false
+		}
+		if !slices.ContainsFunc(accepted, func(value *felt.Felt) bool { return value.String() == normalize(keys[i]) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalize returns a felt as the node compares it, without leading zeros
+func normalize(value string) string {
+	parsed, err := new(felt.Felt).SetString(value)
+	if err != nil {
+		return value
+	}
+	return parsed.String()
+}
+
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func block(number uint64) map[string]any {
+	price := map[string]string{"price_in_fri": "0x1", "price_in_wei": "0x1"}
+	parentHash := "0x0"
+	if number > 0 {
+		parentHash = BlockHash(number - 1)
+	}
+	return map[string]any{
+		"block_hash":        BlockHash(number),
+		"parent_hash":       parentHash,
+		"block_number":      number,
+		"new_root":          "0x1",
+		"timestamp":         number,
+		"sequencer_address": "0x1",
+		"l1_gas_price":      price,
+		"l2_gas_price":      price,
+		"l1_data_gas_price": price,
+		"l1_da_mode":        "BLOB",
+		"starknet_version":  "0.14.0",
+		"status":            "ACCEPTED_ON_L2",
+		"transactions":      []string{},
+	}
+}
+
+func result(id json.RawMessage, value any) map[string]any {
+	return map[string]any{"jsonrpc": "2.0", "id": id, "result": value}
+}
+
+func rpcError(id json.RawMessage, code int, message string) map[string]any {
+	return map[string]any{"jsonrpc": "2.0", "id": id, "error": map[string]any{"code": code, "message": message}}
+}
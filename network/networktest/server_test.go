@@ -0,0 +1,104 @@
+package networktest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/NethermindEth/starknet.go/rpc"
+)
+
+func TestServer(t *testing.T) {
+	server := NewServer(t, 20)
+	server.AddEvents(
+		Event{BlockNumber: 12, From: "0xbeef", Keys: []string{"0x1"}},
+		Event{BlockNumber: 5, From: "0x0beef", Keys: []string{"0x2"}},
+		Event{BlockNumber: 12, From: "0xcafe", Keys: []string{"0x1"}},
+	)
+	server.SetClass("0xbeef", 10, "0xc2")
+	server.SetClass("0xbeef", 3, "0xc1")
+	n := server.Network(t)
+	ctx := context.Background()
+
+	blocks, err := n.GetBlocks(ctx, 18, 20)
+	if err != nil {
+		t.Fatalf("Failed to get blocks: %v", err)
+	}
+	if len(blocks) != 3 || blocks[0].BlockHash != BlockHash(18) || blocks[2].ParentHash != BlockHash(19) {
+		t.Errorf("Expected blocks 18 to 20 chained by hash, got %+v", blocks)
+	}
+	if _, err := n.GetBlocks(ctx, 21, 21); err == nil {
+		t.Error("Expected an error for a block past the head")
+	}
+	block, err := n.GetBlockByHash(ctx, BlockHash(7))
+	if err != nil || block.BlockHeader.Number != 7 {
+		t.Errorf("Expected block 7 by hash, got %v, %v", block, err)
+	}
+
+	page, err := n.GetEventsPage(ctx, 0, 20, "0xbeef", "")
+	if err != nil {
+		t.Fatalf("Failed to get events: %v", err)
+	}
+	if len(page.Events) != 2 || page.Events[0].BlockNumber != 5 || page.Events[1].BlockNumber != 12 {
+		t.Errorf("Expected the events of 0xbeef in block order, got %+v", page.Events)
+	}
+	if page.Events[1].TransactionHash.String() != TransactionHash(12) {
+		t.Errorf("Expected transaction hash %s, got %s", TransactionHash(12), page.Events[1].TransactionHash)
+	}
+
+	byKeys, err := n.GetEventsByKeys(ctx, 10, 20, "", [][]string{{"0x1"}})
+	if err != nil {
+		t.Fatalf("Failed to get events by keys: %v", err)
+	}
+	if len(byKeys.Events) != 2 {
+		t.Errorf("Expected 2 events with key 0x1, got %d", len(byKeys.Events))
+	}
+
+	for block, expected := range map[uint64]string{3: "0xc1", 9: "0xc1", 15: "0xc2"} {
+		classHash, err := n.ClassHashAt(ctx, block, "0xbeef")
+		if err != nil || classHash != expected {
+			t.Errorf("Expected class %s at block %d, got %q, %v", expected, block, classHash, err)
+		}
+	}
+	if _, err := n.ClassHashAt(ctx, 2, "0xbeef"); err == nil {
+		t.Error("Expected an error before the contract has a class")
+	}
+
+	if calls := server.Calls("starknet_getClassHashAt"); calls != 4 {
+		t.Errorf("Expected 4 getClassHashAt calls, got %d", calls)
+	}
+}
+
+func TestServerPagination(t *testing.T) {
+	server := NewServer(t, 10)
+	for block := uint64(1); block <= 5; block++ {
+		server.AddEvents(Event{BlockNumber: block, From: "0xbeef"})
+	}
+
+	var blocks []uint64
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("Expected pagination to end")
+		}
+		page := server.getEvents(nil, rpc.EventsInput{
+			EventFilter:       rpc.EventFilter{FromBlock: blockID(0), ToBlock: blockID(10)},
+			ResultPageRequest: rpc.ResultPageRequest{ChunkSize: 2, ContinuationToken: token},
+		})
+		chunk := page["result"].(map[string]any)
+		for _, event := range chunk["events"].([]map[string]any) {
+			blocks = append(blocks, event["block_number"].(uint64))
+		}
+		next, ok := chunk["continuation_token"].(string)
+		if !ok {
+			break
+		}
+		token = next
+	}
+	if len(blocks) != 5 || blocks[0] != 1 || blocks[4] != 5 {
+		t.Errorf("Expected blocks 1 to 5 over three pages, got %v", blocks)
+	}
+}
+
+func blockID(number uint64) rpc.BlockID {
+	return rpc.BlockID{Number: &number}
+}
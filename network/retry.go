@@ -0,0 +1,100 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/NethermindEth/starknet.go/client"
+	"github.com/NethermindEth/starknet.go/rpc"
+)
+
+// errorClass decides whether a failed call is retried
+type errorClass int
+
+const (
+	// classPermanent errors fail the same way on every endpoint, such as invalid params
+	classPermanent errorClass = iota
+	// classTransient errors are retried on the next healthiest endpoint
+	classTransient
+	// classRateLimited errors bench the endpoint until its Retry-After or backoff elapses
+	classRateLimited
+)
+
+func (c errorClass) String() string {
+	switch c {
+	case classTransient:
+		return "transient"
+	case classRateLimited:
+		return "rate limited"
+	}
+	return "permanent"
+}
+
+// classify inspects the HTTP outcome first, then the JSON-RPC error code
+func classify(err error, status *callStatus) errorClass {
+	if errors.Is(err, context.Canceled) {
+		return classPermanent
+	}
+
+	statusCode, _, transportErr := status.get()
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return classRateLimited
+	case transportErr != nil, statusCode == http.StatusRequestTimeout, statusCode >= http.StatusInternalServerError:
+		return classTransient
+	case statusCode != 0 && statusCode != http.StatusOK:
+		// Auth or routing failures are specific to the endpoint, another one may serve the call
+		return classTransient
+	}
+
+	code, ok := rpcErrorCode(err)
+	if !ok {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return classTransient
+		}
+		return classPermanent
+	}
+	switch code {
+	case rpc.InvalidJSON, rpc.InvalidRequest, rpc.MethodNotFound, rpc.InvalidParams:
+		return classPermanent
+	}
+	if code > 0 {
+		// Starknet spec errors, such as BLOCK_NOT_FOUND, are answers rather than failures
+		return classPermanent
+	}
+	// Some providers report rate limits as JSON-RPC errors (-32005) in a 200 response
+	message := strings.ToLower(err.Error())
+	if code == -32005 || strings.Contains(message, "-32005") || strings.Contains(message, "rate limit") || strings.Contains(message, "too many requests") {
+		return classRateLimited
+	}
+	return classTransient
+}
+
+// rpcErrorCode returns the JSON-RPC error code of a provider error or a raw batch element error
+func rpcErrorCode(err error) (int, bool) {
+	var rpcErr *rpc.RPCError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Code, true
+	}
+	var clientErr client.Error
+	if errors.As(err, &clientErr) {
+		return clientErr.ErrorCode(), true
+	}
+	return 0, false
+}
+
+// backoff returns the jittered exponential delay before retry attempt (0 based)
+func (o Options) backoff(attempt int) time.Duration {
+	delay := o.MaxDelay
+	if attempt < 32 {
+		if d := o.BaseDelay << attempt; d > 0 && d < o.MaxDelay {
+			delay = d
+		}
+	}
+	// Half fixed, half random, so concurrent callers spread out without retrying immediately
+	return delay/2 + rand.N(delay/2+1)
+}
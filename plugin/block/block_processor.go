@@ -1,12 +1,20 @@
 package block
 
 import (
+	"context"
+	"fmt"
 	"junoplugin/db"
+	"junoplugin/logging"
+	"junoplugin/metrics"
 	"junoplugin/models"
 	"junoplugin/network"
+	"junoplugin/plugin/bus"
+	"junoplugin/plugin/contract"
 	"junoplugin/plugin/vault"
-	"log"
+	"junoplugin/utils"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 
 	"github.com/NethermindEth/juno/core"
 	"github.com/NethermindEth/juno/core/felt"
@@ -18,10 +26,20 @@ type Processor struct {
 	db           *db.DB
 	network      *network.Network
 	vaultManager *vault.Manager
-	lastBlockDB  *models.StarknetBlocks
-	cursor       uint64
-	mu           sync.Mutex
-	log          *log.Logger
+	contracts    *contract.Tracker
+	// lastBlockDB is written with mu held and read without it by GetLastBlock
+	lastBlockDB atomic.Pointer[models.StarknetBlocks]
+	cursor      uint64
+	// catchupWindow is the number of blocks CatchupBlocks commits at a time
+	catchupWindow uint64
+	// finalityDepth is the number of blocks behind a new block past which blocks are finalized
+	finalityDepth uint64
+	// trackStorageDiffs stores the storage writes of tracked vaults from each block's state update
+	trackStorageDiffs bool
+	// bus receives the committed blocks, reverts and vault events, when set
+	bus *bus.Bus
+	mu  sync.Mutex
+	log *slog.Logger
 }
 
 // NewProcessor creates a new block processor
@@ -29,21 +47,32 @@ func NewProcessor(
 	db *db.DB,
 	network *network.Network,
 	vaultManager *vault.Manager,
+	contracts *contract.Tracker,
 	lastBlockDB *models.StarknetBlocks,
 	cursor uint64,
+	catchupWindow uint64,
+	finalityDepth uint64,
+	trackStorageDiffs bool,
+	logger *slog.Logger,
 ) *Processor {
-	return &Processor{
-		db:           db,
-		network:      network,
-		vaultManager: vaultManager,
-		lastBlockDB:  lastBlockDB,
-		cursor:       cursor,
-		log:          log.Default(),
+	bp := &Processor{
+		db:                db,
+		network:           network,
+		vaultManager:      vaultManager,
+		contracts:         contracts,
+		cursor:            cursor,
+		catchupWindow:     max(catchupWindow, 1),
+		finalityDepth:     finalityDepth,
+		trackStorageDiffs: trackStorageDiffs,
+		log:               logging.Component(logger, "block"),
 	}
+	bp.lastBlockDB.Store(lastBlockDB)
+	return bp
 }
 
 // ProcessNewBlock processes a new block
 func (bp *Processor) ProcessNewBlock(
+	ctx context.Context,
 	block *core.Block,
 	stateUpdate *core.StateUpdate,
 	newClasses map[felt.Felt]core.Class,
@@ -56,14 +85,28 @@ func (bp *Processor) ProcessNewBlock(
 	defer bp.mu.Unlock()
 	// Check if we need to catch up
 
-	bp.db.BeginTx()
-	bp.log.Println("Processing new block", block.Number)
+	bp.db.BeginTx(ctx)
+	log := bp.log.With(logging.BlockNumber(block.Number), logging.BlockHash(block.Hash.String()))
+	log.Debug("Processing new block")
+
+	// Upgrades take effect before the block's events are decoded
+	if err := bp.recordUpgrades(block, stateUpdate); err != nil {
+		bp.db.RollbackTx()
+		log.Error("Failed to record vault upgrades", "error", err)
+		return err
+	}
 
 	// Process events in the block
-	err := bp.processBlockEvents(block)
+	vaultEvents, err := bp.processBlockEvents(ctx, block)
 	if err != nil {
 		bp.db.RollbackTx()
-		bp.log.Println("Error processing block events", err)
+		log.Error("Failed to process block events", "error", err)
+		return err
+	}
+
+	if err := bp.storeStorageDiffs(block, stateUpdate); err != nil {
+		bp.db.RollbackTx()
+		log.Error("Failed to store vault storage diffs", "error", err)
 		return err
 	}
 
@@ -73,33 +116,83 @@ func (bp *Processor) ProcessNewBlock(
 	err = bp.db.InsertBlock(&starknetBlock)
 	if err != nil {
 		bp.db.RollbackTx()
-		bp.log.Println("Error inserting block", err)
+		log.Error("Failed to insert block", "error", err)
 		return err
 	}
 
-	bp.lastBlockDB = &starknetBlock
+	// Blocks finalityDepth behind the new one can no longer be reverted
+	if block.Number >= bp.finalityDepth {
+		finalized, err := bp.db.FinalizeBlocks(block.Number - bp.finalityDepth)
+		if err != nil {
+			bp.db.RollbackTx()
+			log.Error("Failed to finalize blocks", "error", err)
+			return err
+		}
+		if finalized > 0 {
+			log.Debug("Finalized blocks", "up_to_block", block.Number-bp.finalityDepth, "blocks", finalized)
+		}
+	}
+
+	bp.lastBlockDB.Store(&starknetBlock)
 
 	// Send StartBlock event right before commit
 	bp.sendDriverEvent("StartBlock", block.Hash.String())
 	bp.db.CommitTx()
 
+	bp.publishBlock(&starknetBlock, vaultEvents)
 	return nil
 }
 
 // RevertBlock reverts a block
 func (bp *Processor) RevertBlock(
+	ctx context.Context,
 	from,
 	to *junoplugin.BlockAndStateUpdate,
 	reverseStateDiff *core.StateDiff,
 ) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+
 	// FIXED: Add proper transaction handling for revert
-	bp.db.BeginTx()
+	bp.db.BeginTx(ctx)
+	log := bp.log.With(logging.BlockNumber(from.Block.Number), logging.BlockHash(from.Block.Hash.String()))
+	log.Info("Reverting block")
 
-	err := bp.db.RevertBlock(from.Block.Number, from.Block.Hash.String())
+	// A finalized block is out of reach of a revert, the reorg is deeper than the finality depth
+	stored, err := bp.db.GetBlock(from.Block.Hash.String())
 	if err != nil {
 		bp.db.RollbackTx()
 		return err
 	}
+	if stored != nil && !stored.Status.CanTransitionTo(models.BlockStatusReverted) {
+		bp.db.RollbackTx()
+		log.Error("Cannot revert block", "status", stored.Status)
+		return fmt.Errorf("block %d is %s and cannot be reverted, the reorg is deeper than the finality depth of %d blocks", from.Block.Number, stored.Status, bp.finalityDepth)
+	}
+
+	err = bp.db.RevertBlock(from.Block.Number, from.Block.Hash.String())
+	if err != nil {
+		bp.db.RollbackTx()
+		return err
+	}
+
+	if err := bp.vaultManager.RevertVaultUpgrades(from.Block.Number, utils.FeltToHexString(from.Block.Hash.Bytes())); err != nil {
+		bp.db.RollbackTx()
+		log.Error("Failed to revert vault upgrades", "error", err)
+		return err
+	}
+
+	if err := bp.revertStorageDiffs(from.Block, reverseStateDiff); err != nil {
+		bp.db.RollbackTx()
+		log.Error("Failed to revert vault storage diffs", "error", err)
+		return err
+	}
+
+	if err := bp.contracts.RevertEvents(from.Block.Number, utils.FeltToHexString(from.Block.Hash.Bytes())); err != nil {
+		bp.db.RollbackTx()
+		log.Error("Failed to revert tracked contract events", "error", err)
+		return err
+	}
 
 	// TODO: Implement vault event reversion if needed
 	// This was commented out in the original code
@@ -108,78 +201,126 @@ func (bp *Processor) RevertBlock(
 	bp.sendDriverEvent("RevertBlock", from.Block.Hash.String())
 	bp.db.CommitTx()
 
+	reverted := models.CoreToStarknetBlock(*from.Block)
+	reverted.Status = models.BlockStatusReverted
+	bp.bus.Publish(bus.BlockReverted{Block: &reverted})
 	return nil
 }
 
-func (bp *Processor) CatchupBlocks(latestBlock uint64) error {
+// CatchupBlocks stores the blocks up to latestBlock-1, committing catchupWindow blocks at a time.
+// It resumes after the last committed block, so an interrupted catchup picks up where it stopped.
+func (bp *Processor) CatchupBlocks(ctx context.Context, latestBlock uint64) error {
+	if latestBlock == 0 {
+		return nil
+	}
+	targetBlock := latestBlock - 1
 
 	//Leaving this as a potential usage,  we use this to decide how much block data we want to back fill (in case of a very edge case of clean starting block getting reorged)
 	backFillIndex := uint64(3)
-	startBlock := latestBlock - uint64(backFillIndex)
-	if bp.lastBlockDB != nil {
-		startBlock = bp.lastBlockDB.BlockNumber
+	startBlock := latestBlock - min(backFillIndex, latestBlock)
+	bp.mu.Lock()
+	if lastBlock := bp.lastBlockDB.Load(); lastBlock != nil {
+		startBlock = lastBlock.BlockNumber + 1
 	}
+	bp.mu.Unlock()
 
-	for startBlock < latestBlock-1 {
-		endBlock := startBlock + 1000
-		if endBlock >= latestBlock {
-			endBlock = latestBlock - 1
-		}
+	metrics.BlockCatchupTarget.Set(float64(targetBlock))
+	if startBlock > targetBlock {
+		return nil
+	}
+	caughtUp := bus.BlocksCaughtUp{FromBlock: startBlock, ToBlock: targetBlock}
+	for startBlock <= targetBlock {
+		endBlock := min(startBlock+bp.catchupWindow-1, targetBlock)
 
-		bp.log.Println("Catching up indexer from", startBlock, "to", endBlock)
-		blocks, err := bp.network.GetBlocks(startBlock, endBlock)
+		bp.log.Debug("Catching up blocks", "from_block", startBlock, "to_block", endBlock)
+		blocks, err := bp.network.GetBlocks(ctx, startBlock, endBlock)
 		if err != nil {
-			bp.log.Println("Error getting blocks", err)
+			return err
+		}
+		if err := bp.storeCatchupBlocks(ctx, blocks); err != nil {
 			return err
 		}
 
-		// Process all blocks in the batch with a single transaction
-		bp.db.BeginTx()
+		metrics.BlockCatchupHead.Set(float64(endBlock))
+		bp.log.Info("Caught up blocks", "to_block", endBlock, "target_block", targetBlock)
+		startBlock = endBlock + 1
+	}
+	bp.bus.Publish(caughtUp)
+	return nil
+}
 
-		for _, block := range blocks {
-			err := bp.db.InsertBlock(block)
-			if err != nil {
-				bp.db.RollbackTx()
-				bp.log.Println("Error inserting block", err)
-				return err
-			}
+// storeCatchupBlocks writes a window of blocks in one transaction and makes its last block the head
+func (bp *Processor) storeCatchupBlocks(ctx context.Context, blocks []*models.StarknetBlocks) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
 
-		}
+	// Write all blocks in the batch with a single COPY in one transaction
+	bp.db.BeginTx(ctx)
 
-		bp.db.CommitTx()
-		startBlock = endBlock
+	if _, err := bp.db.InsertBlocks(blocks); err != nil {
+		bp.db.RollbackTx()
+		bp.log.Error("Failed to insert blocks", "from_block", blocks[0].BlockNumber, "to_block", blocks[len(blocks)-1].BlockNumber, "error", err)
+		return err
 	}
+
+	bp.db.CommitTx()
+	bp.lastBlockDB.Store(blocks[len(blocks)-1])
 	return nil
 }
 
+// WithBlocksPaused runs fn while no block is being processed or reverted
+func (bp *Processor) WithBlocksPaused(fn func(head *models.StarknetBlocks) error) error {
+	bp.mu.Lock()
+	defer bp.mu.Unlock()
+	return fn(bp.lastBlockDB.Load())
+}
+
+// SetBus publishes the committed blocks, reverts and vault events on b
+func (bp *Processor) SetBus(b *bus.Bus) {
+	bp.bus = b
+}
+
 // GetLastBlock returns the last processed block
 func (bp *Processor) GetLastBlock() *models.StarknetBlocks {
-	return bp.lastBlockDB
+	return bp.lastBlockDB.Load()
 }
 
 // UpdateLastBlock updates the last processed block
 func (bp *Processor) UpdateLastBlock(block *models.StarknetBlocks) {
-	bp.lastBlockDB = block
+	bp.lastBlockDB.Store(block)
 }
 
-// processBlockEvents processes all events in a block
-func (bp *Processor) processBlockEvents(block *core.Block) error {
-	bp.log.Println("Processing block events for block", block.Number)
-
+// processBlockEvents processes the events of tracked contracts in a block, vaults included, and the
+// events subscriptions match whatever contract emitted them. It returns the stored vault events.
+func (bp *Processor) processBlockEvents(ctx context.Context, block *core.Block) ([]*models.Event, error) {
+	var vaultEvents []*models.Event
 	for _, receipt := range block.Receipts {
 		for _, event := range receipt.Events {
 			fromAddress := event.From.String()
-			if bp.vaultManager.IsVaultAddress(fromAddress) {
-				err := bp.vaultManager.ProcessVaultEvent(receipt.TransactionHash.String(), fromAddress, event, block.Number, *block.Hash)
+			if kind, _ := bp.contracts.Kind(fromAddress); kind == models.ContractKindVault {
+				vaultEvent, err := bp.vaultManager.ProcessVaultEvent(ctx, receipt.TransactionHash.String(), fromAddress, event, block.Number, *block.Hash)
 				if err != nil {
-					bp.log.Println("Error processing vault event", err)
-					return err
+					return nil, fmt.Errorf("failed to process event of vault %s: %w", fromAddress, err)
 				}
+				vaultEvents = append(vaultEvents, vaultEvent)
+			}
+			if err := bp.contracts.ProcessEvent(receipt.TransactionHash.String(), event, block.Number, *block.Hash); err != nil {
+				return nil, fmt.Errorf("failed to process event of contract %s: %w", fromAddress, err)
 			}
 		}
 	}
 
-	return nil
+	return vaultEvents, nil
+}
+
+// publishBlock publishes a committed block after its vault events
+func (bp *Processor) publishBlock(block *models.StarknetBlocks, vaultEvents []*models.Event) {
+	events := make([]bus.Event, 0, len(vaultEvents)+1)
+	for _, vaultEvent := range vaultEvents {
+		events = append(events, bus.VaultEvent{Event: vaultEvent})
+	}
+	events = append(events, bus.BlockCommitted{Block: block, VaultEvents: len(vaultEvents)})
+	bp.bus.Publish(events...)
 }
 
 // sendDriverEvent stores a driver event and triggers PostgreSQL NOTIFY
@@ -187,8 +328,8 @@ func (bp *Processor) sendDriverEvent(eventType string, blockHash string) {
 	// Store event (triggers NOTIFY automatically via database trigger)
 	err := bp.db.StoreDriverEvent(eventType, blockHash)
 	if err != nil {
-		bp.log.Printf("Error storing driver event: %v", err)
+		bp.log.Error("Failed to store driver event", "event", eventType, logging.BlockHash(blockHash), "error", err)
 	} else {
-		bp.log.Printf("Stored and notified driver event: %s for block %s", eventType, blockHash)
+		bp.log.Debug("Stored driver event", "event", eventType, logging.BlockHash(blockHash))
 	}
 }
@@ -0,0 +1,318 @@
+//go:build integration
+
+package block
+
+import (
+	"context"
+	"encoding/json"
+	"junoplugin/db"
+	"junoplugin/db/dbtest"
+	"junoplugin/models"
+	"junoplugin/network/networktest"
+	"junoplugin/plugin/bus"
+	"junoplugin/plugin/contract"
+	"junoplugin/plugin/vault"
+	"junoplugin/utils"
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	junoplugin "github.com/NethermindEth/juno/plugin"
+)
+
+const testVault = "0xbeef"
+
+// testFinalityDepth keeps the blocks of a test MINED unless it finalizes them on purpose
+const testFinalityDepth = 10
+
+func hexFelt(t *testing.T, value string) *felt.Felt {
+	t.Helper()
+	parsed, err := new(felt.Felt).SetString(value)
+	if err != nil {
+		t.Fatalf("Invalid felt %s: %v", value, err)
+	}
+	return parsed
+}
+
+// testBlock is the block at number on the fake node, with one receipt holding events
+func testBlock(t *testing.T, number uint64, events ...*core.Event) *core.Block {
+	t.Helper()
+	return &core.Block{
+		Header: &core.Header{
+			Number:     number,
+			Hash:       hexFelt(t, networktest.BlockHash(number)),
+			ParentHash: hexFelt(t, networktest.BlockHash(number-1)),
+			Timestamp:  number,
+		},
+		Receipts: []*core.TransactionReceipt{{
+			TransactionHash: hexFelt(t, networktest.TransactionHash(number)),
+			Events:          events,
+		}},
+	}
+}
+
+// newTestProcessor wires a block processor to a fresh database and a fake node at head, with
+// testVault registered and indexed up to indexedTo
+func newTestProcessor(t *testing.T, head, indexedTo uint64) (*Processor, *db.DB, string) {
+	t.Helper()
+	dbClient, dbURL := dbtest.New(t)
+	node := networktest.NewServer(t, head)
+	n := node.Network(t)
+	logger := slog.New(slog.DiscardHandler)
+	ctx := context.Background()
+
+	indexed := networktest.BlockHash(indexedTo)
+	dbClient.BeginTx(ctx)
+	if err := dbClient.InsertVault(&models.VaultRegistry{Address: testVault, DeployedAt: indexed, LastBlockIndexed: &indexed}); err != nil {
+		t.Fatalf("Failed to register vault: %v", err)
+	}
+	dbClient.CommitTx()
+
+	vm := vault.NewManager(dbClient, n, "0x4a", nil, 4, 1, false, logger)
+	t.Cleanup(vm.Stop)
+	contracts := contract.NewTracker(dbClient, n, vm, nil, nil, logger)
+	if err := contracts.Load(ctx); err != nil {
+		t.Fatalf("Failed to load tracked contracts: %v", err)
+	}
+	bp := NewProcessor(dbClient, n, vm, contracts, nil, 0, 4, testFinalityDepth, false, logger)
+	if err := vm.LoadVaultsFromRegistry(nil, bp); err != nil {
+		t.Fatalf("Failed to load vault registry: %v", err)
+	}
+	return bp, dbClient, dbURL
+}
+
+func expectNotification(t *testing.T, notifications *dbtest.Notifications, channel, payload string) {
+	t.Helper()
+	notification := notifications.Next(2 * time.Second)
+	if notification.Channel != channel || notification.Payload != payload {
+		t.Errorf("Expected %s %s, got %s %s", channel, payload, notification.Channel, notification.Payload)
+	}
+}
+
+func expectDriverEvent(t *testing.T, notifications *dbtest.Notifications, eventType, blockHash string) {
+	t.Helper()
+	notification := notifications.Next(2 * time.Second)
+	var event struct {
+		Type      string  `json:"type"`
+		BlockHash *string `json:"block_hash"`
+	}
+	if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+		t.Fatalf("Failed to parse driver event %s: %v", notification.Payload, err)
+	}
+	if event.Type != eventType || event.BlockHash == nil || *event.BlockHash != blockHash {
+		t.Errorf("Expected %s of %s, got %s", eventType, blockHash, notification.Payload)
+	}
+}
+
+// published returns the events buffered for subscription
+func published(subscription *bus.Subscription) []bus.Event {
+	var events []bus.Event
+	for {
+		select {
+		case event := <-subscription.Events():
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestProcessorCatchupAndBlocks(t *testing.T) {
+	bp, dbClient, dbURL := newTestProcessor(t, 20, 9)
+	ctx := context.Background()
+	blockNotifications := dbtest.Listen(t, dbURL, "starknet_blocks_insert", "starknet_blocks_revert")
+	driverEvents := dbtest.Listen(t, dbURL, "driver_events")
+	eventBus := bus.New(slog.New(slog.DiscardHandler))
+	bp.SetBus(eventBus)
+	subscription, err := eventBus.Subscribe(bus.Options{Name: "test"})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	// Without a stored block, catchup backfills the three blocks before the first live one
+	if err := bp.CatchupBlocks(ctx, 10); err != nil {
+		t.Fatalf("Failed to catch up blocks: %v", err)
+	}
+	blocks, err := dbClient.GetBlocksInRange(0, 20)
+	if err != nil {
+		t.Fatalf("Failed to get blocks: %v", err)
+	}
+	if len(blocks) != 3 || blocks[0].BlockNumber != 7 || blocks[2].BlockHash != networktest.BlockHash(9) {
+		t.Fatalf("Expected blocks 7 to 9 from the node, got %+v", blocks)
+	}
+	for number := 7; number <= 9; number++ {
+		expectNotification(t, blockNotifications, "starknet_blocks_insert", strconv.Itoa(number))
+	}
+	if head := bp.GetLastBlock(); head == nil || head.BlockNumber != 9 {
+		t.Errorf("Expected block 9 to be the head, got %+v", head)
+	}
+	if events := published(subscription); len(events) != 1 || events[0] != (bus.BlocksCaughtUp{FromBlock: 7, ToBlock: 9}) {
+		t.Errorf("Expected blocks 7 to 9 to be published as caught up, got %+v", events)
+	}
+
+	// A live block stores the events of tracked vaults and the vault's upgrade
+	deposit := &core.Event{
+		From: hexFelt(t, testVault),
+		Keys: []*felt.Felt{hexFelt(t, utils.Keccak256("Deposit"))},
+		Data: []*felt.Felt{hexFelt(t, "0x1")},
+	}
+	untracked := &core.Event{From: hexFelt(t, "0xcafe"), Keys: []*felt.Felt{hexFelt(t, "0x1")}}
+	block := testBlock(t, 10, deposit, untracked)
+	stateUpdate := &core.StateUpdate{StateDiff: &core.StateDiff{
+		ReplacedClasses: map[felt.Felt]*felt.Felt{*hexFelt(t, testVault): hexFelt(t, "0xc2")},
+	}}
+	if err := bp.ProcessNewBlock(ctx, block, stateUpdate, nil); err != nil {
+		t.Fatalf("Failed to process block: %v", err)
+	}
+	expectNotification(t, blockNotifications, "starknet_blocks_insert", "10")
+	expectDriverEvent(t, driverEvents, "VaultUpgraded", networktest.BlockHash(10))
+	expectDriverEvent(t, driverEvents, "StartBlock", networktest.BlockHash(10))
+
+	var name, txHash string
+	var count int
+	err = dbClient.Pool.QueryRow(ctx, `
+		SELECT count(*), min(event_name), min(transaction_hash) FROM events WHERE block_number = 10`).Scan(&count, &name, &txHash)
+	if err != nil {
+		t.Fatalf("Failed to query events: %v", err)
+	}
+	if count != 1 || name != "Deposit" || txHash != networktest.TransactionHash(10) {
+		t.Errorf("Expected only the vault's deposit to be stored, got %d events, %s in %s", count, name, txHash)
+	}
+	history, err := dbClient.GetVaultClassHistory(testVault)
+	if err != nil {
+		t.Fatalf("Failed to get class history: %v", err)
+	}
+	if len(history) != 1 || history[0].BlockNumber != 10 || history[0].ClassHash != "0xc2" {
+		t.Errorf("Expected the upgrade to 0xc2 at block 10, got %+v", history)
+	}
+	events := published(subscription)
+	if len(events) != 2 {
+		t.Fatalf("Expected the deposit and the block to be published, got %+v", events)
+	}
+	if vaultEvent, ok := events[0].(bus.VaultEvent); !ok || vaultEvent.Event.EventName != "Deposit" || vaultEvent.Event.VaultAddress != testVault || vaultEvent.Catchup {
+		t.Errorf("Expected the live deposit of %s, got %+v", testVault, events[0])
+	}
+	if committed, ok := events[1].(bus.BlockCommitted); !ok || committed.Block.BlockNumber != 10 || committed.VaultEvents != 1 {
+		t.Errorf("Expected block 10 with 1 vault event, got %+v", events[1])
+	}
+
+	// Reverting the block drops its upgrade and marks it reverted
+	if err := bp.RevertBlock(ctx,
+		&junoplugin.BlockAndStateUpdate{Block: block, StateUpdate: stateUpdate},
+		&junoplugin.BlockAndStateUpdate{Block: testBlock(t, 9)},
+		&core.StateDiff{},
+	); err != nil {
+		t.Fatalf("Failed to revert block: %v", err)
+	}
+	expectNotification(t, blockNotifications, "starknet_blocks_revert", "10")
+	expectDriverEvent(t, driverEvents, "RevertBlock", networktest.BlockHash(10))
+	if blocks, err := dbClient.GetBlocksInRange(10, 10); err != nil || len(blocks) != 0 {
+		t.Errorf("Expected block 10 to be reverted, got %+v, %v", blocks, err)
+	}
+	if history, err := dbClient.GetVaultClassHistory(testVault); err != nil || len(history) != 0 {
+		t.Errorf("Expected the reverted upgrade to be dropped, got %+v, %v", history, err)
+	}
+	driverEvents.ExpectNone(200 * time.Millisecond)
+	events = published(subscription)
+	if len(events) != 1 {
+		t.Fatalf("Expected the revert to be published, got %+v", events)
+	}
+	if reverted, ok := events[0].(bus.BlockReverted); !ok || reverted.Block.BlockNumber != 10 || reverted.Block.Status != models.BlockStatusReverted {
+		t.Errorf("Expected block 10 to be published as reverted, got %+v", events[0])
+	}
+}
+
+func TestProcessorFinalizesBlocksBehindHead(t *testing.T) {
+	bp, dbClient, dbURL := newTestProcessor(t, 20, 9)
+	bp.finalityDepth = 2
+	ctx := context.Background()
+	if err := bp.CatchupBlocks(ctx, 10); err != nil {
+		t.Fatalf("Failed to catch up blocks: %v", err)
+	}
+	finalizations := dbtest.Listen(t, dbURL, "starknet_blocks_finalize")
+
+	// Each new block finalizes the blocks two behind it
+	for number := uint64(10); number <= 11; number++ {
+		if err := bp.ProcessNewBlock(ctx, testBlock(t, number), nil, nil); err != nil {
+			t.Fatalf("Failed to process block %d: %v", number, err)
+		}
+	}
+	// One UPDATE finalizes several blocks, their notifications come in no particular order
+	notified := make(map[string]bool)
+	for range 3 {
+		notified[finalizations.Next(2*time.Second).Payload] = true
+	}
+	if !notified["7"] || !notified["8"] || !notified["9"] {
+		t.Errorf("Expected blocks 7 to 9 to be finalized, got %v", notified)
+	}
+	finalizations.ExpectNone(200 * time.Millisecond)
+
+	statuses := func() map[uint64]models.BlockStatus {
+		t.Helper()
+		rows, err := dbClient.Pool.Query(ctx, "SELECT block_number, status FROM starknet_blocks")
+		if err != nil {
+			t.Fatalf("Failed to query blocks: %v", err)
+		}
+		defer rows.Close()
+		statuses := make(map[uint64]models.BlockStatus)
+		for rows.Next() {
+			var number uint64
+			var status models.BlockStatus
+			if err := rows.Scan(&number, &status); err != nil {
+				t.Fatalf("Failed to scan block: %v", err)
+			}
+			statuses[number] = status
+		}
+		return statuses
+	}
+	expected := map[uint64]models.BlockStatus{
+		7:  models.BlockStatusFinalized,
+		8:  models.BlockStatusFinalized,
+		9:  models.BlockStatusFinalized,
+		10: models.BlockStatusMined,
+		11: models.BlockStatusMined,
+	}
+	for number, status := range expected {
+		if got := statuses()[number]; got != status {
+			t.Errorf("Expected block %d to be %s, got %q", number, status, got)
+		}
+	}
+
+	// A finalized block is refused a revert, a mined one still reverts
+	err := bp.RevertBlock(ctx,
+		&junoplugin.BlockAndStateUpdate{Block: testBlock(t, 9)},
+		&junoplugin.BlockAndStateUpdate{Block: testBlock(t, 8)},
+		&core.StateDiff{},
+	)
+	if err == nil {
+		t.Error("Expected the revert of finalized block 9 to fail")
+	}
+	if err := bp.RevertBlock(ctx,
+		&junoplugin.BlockAndStateUpdate{Block: testBlock(t, 11)},
+		&junoplugin.BlockAndStateUpdate{Block: testBlock(t, 10)},
+		&core.StateDiff{},
+	); err != nil {
+		t.Fatalf("Failed to revert block 11: %v", err)
+	}
+	after := statuses()
+	if after[9] != models.BlockStatusFinalized || after[11] != models.BlockStatusReverted {
+		t.Errorf("Expected block 9 finalized and block 11 reverted, got %s and %s", after[9], after[11])
+	}
+}
+
+func TestProcessorSkipsBlocksBeforeCursor(t *testing.T) {
+	dbClient, dbURL := dbtest.New(t)
+	bp := NewProcessor(dbClient, nil, nil, nil, nil, 15, 4, testFinalityDepth, false, slog.New(slog.DiscardHandler))
+	driverEvents := dbtest.Listen(t, dbURL, "driver_events")
+
+	if err := bp.ProcessNewBlock(context.Background(), testBlock(t, 10), nil, nil); err != nil {
+		t.Fatalf("Failed to process block: %v", err)
+	}
+	driverEvents.ExpectNone(200 * time.Millisecond)
+	if blocks, err := dbClient.GetBlocksInRange(0, 20); err != nil || len(blocks) != 0 {
+		t.Errorf("Expected no block before the cursor to be stored, got %+v, %v", blocks, err)
+	}
+}
@@ -0,0 +1,99 @@
+package block
+
+import (
+	"junoplugin/logging"
+	"junoplugin/models"
+	"junoplugin/utils"
+	"sort"
+
+	"github.com/NethermindEth/juno/core"
+)
+
+// recordUpgrades records the vault classes replaced in the block's state update, before the block's
+// events are decoded with them
+func (bp *Processor) recordUpgrades(block *core.Block, stateUpdate *core.StateUpdate) error {
+	if stateUpdate == nil || stateUpdate.StateDiff == nil {
+		return nil
+	}
+	blockHash := utils.FeltToHexString(block.Hash.Bytes())
+	var addresses []string
+	classHashes := make(map[string]string)
+	for address, classHash := range stateUpdate.StateDiff.ReplacedClasses {
+		vaultAddress := address.String()
+		if bp.vaultManager.IsTrackedVault(vaultAddress) {
+			addresses = append(addresses, vaultAddress)
+			classHashes[vaultAddress] = classHash.String()
+		}
+	}
+	sort.Strings(addresses)
+	for _, address := range addresses {
+		if err := bp.vaultManager.RecordVaultUpgrade(address, block.Number, blockHash, classHashes[address]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeStorageDiffs stores the storage writes of tracked vaults in the block's state update, within
+// the block's transaction
+func (bp *Processor) storeStorageDiffs(block *core.Block, stateUpdate *core.StateUpdate) error {
+	if !bp.trackStorageDiffs || stateUpdate == nil || stateUpdate.StateDiff == nil {
+		return nil
+	}
+	diffs := bp.vaultStorageDiffs(block, stateUpdate.StateDiff)
+	if len(diffs) == 0 {
+		return nil
+	}
+	if _, err := bp.db.StoreVaultStorageDiffs(diffs); err != nil {
+		return err
+	}
+	bp.log.Debug("Stored vault storage diffs", "count", len(diffs), logging.BlockNumber(block.Number))
+	return nil
+}
+
+// revertStorageDiffs deletes the storage writes of a reverted block. The reverse state diff lists
+// the keys the block wrote, with the values they are restored to.
+func (bp *Processor) revertStorageDiffs(block *core.Block, reverseStateDiff *core.StateDiff) error {
+	if !bp.trackStorageDiffs || reverseStateDiff == nil {
+		return nil
+	}
+	reverted := bp.vaultStorageDiffs(block, reverseStateDiff)
+	if len(reverted) == 0 {
+		return nil
+	}
+	deleted, err := bp.db.RevertVaultStorageDiffs(block.Number, utils.FeltToHexString(block.Hash.Bytes()), reverted)
+	if err != nil {
+		return err
+	}
+	bp.log.Info("Reverted vault storage diffs", "count", deleted, logging.BlockNumber(block.Number))
+	return nil
+}
+
+// vaultStorageDiffs returns the storage diffs of stateDiff that belong to tracked vaults, ordered by
+// vault and key
+func (bp *Processor) vaultStorageDiffs(block *core.Block, stateDiff *core.StateDiff) []*models.VaultStorageDiff {
+	blockHash := utils.FeltToHexString(block.Hash.Bytes())
+	var diffs []*models.VaultStorageDiff
+	for address, storage := range stateDiff.StorageDiffs {
+		vaultAddress := address.String()
+		if !bp.vaultManager.IsTrackedVault(vaultAddress) {
+			continue
+		}
+		for key, value := range storage {
+			diffs = append(diffs, &models.VaultStorageDiff{
+				VaultAddress: vaultAddress,
+				StorageKey:   key.String(),
+				BlockNumber:  block.Number,
+				BlockHash:    blockHash,
+				StorageValue: value.String(),
+			})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].VaultAddress != diffs[j].VaultAddress {
+			return diffs[i].VaultAddress < diffs[j].VaultAddress
+		}
+		return diffs[i].StorageKey < diffs[j].StorageKey
+	})
+	return diffs
+}
@@ -0,0 +1,303 @@
+// Package bus publishes what the plugin commits to subscribers running in the same process, as
+// typed Go events, so they do not have to read it back from Postgres. Events are published after
+// the transaction that stored them commits, in commit order for each publisher.
+//
+// Every subscription has a bounded buffer and a Policy for when it is full: drop the event being
+// published, drop the oldest buffered one, or hold up the publisher until the subscriber makes room.
+package bus
+
+import (
+	"errors"
+	"fmt"
+	"junoplugin/logging"
+	"junoplugin/metrics"
+	"junoplugin/utils"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+)
+
+// Policy is what publishing to a subscription with a full buffer does
+type Policy int
+
+const (
+	// DropNewest drops the event being published, the default
+	DropNewest Policy = iota
+	// DropOldest drops the oldest buffered event to make room
+	DropOldest
+	// Block waits for the subscriber to make room. Block processing and catchup wait with it, so a
+	// slow subscriber slows down indexing.
+	Block
+)
+
+// DefaultBuffer is the buffer of subscriptions that do not set one
+const DefaultBuffer = 256
+
+// ErrClosed is returned when subscribing to a closed bus
+var ErrClosed = errors.New("bus is closed")
+
+// Filter selects the events of a subscription. Empty fields select everything, Vaults and EventNames
+// only restrict the events they apply to: Vaults the events about a vault and EventNames the
+// VaultEvents.
+type Filter struct {
+	Kinds []Kind
+	// Vaults are vault addresses, compared once normalized
+	Vaults []string
+	// EventNames are decoded event names such as Deposit
+	EventNames []string
+	// Match is called on the events the other fields select, when set
+	Match func(Event) bool
+}
+
+// Options configures a subscription
+type Options struct {
+	// Name identifies the subscriber in logs and metrics
+	Name   string
+	Filter Filter
+	// Buffer is the number of events held for the subscriber, DefaultBuffer when 0
+	Buffer int
+	Policy Policy
+}
+
+// Bus delivers published events to the matching subscriptions
+type Bus struct {
+	mu            sync.Mutex
+	subscriptions map[*Subscription]struct{}
+	closed        bool
+	log           *slog.Logger
+}
+
+// New creates a bus without subscriptions
+func New(logger *slog.Logger) *Bus {
+	return &Bus{
+		subscriptions: make(map[*Subscription]struct{}),
+		log:           logging.Component(logger, "bus"),
+	}
+}
+
+// Subscribe registers a subscription receiving the events selected by opts.Filter from now on
+func (b *Bus) Subscribe(opts Options) (*Subscription, error) {
+	filter, err := newMatcher(opts.Filter)
+	if err != nil {
+		return nil, err
+	}
+	buffer := opts.Buffer
+	if buffer == 0 {
+		buffer = DefaultBuffer
+	}
+	if buffer < 0 {
+		return nil, fmt.Errorf("invalid buffer %d of subscription %s", buffer, opts.Name)
+	}
+	if opts.Policy < DropNewest || opts.Policy > Block {
+		return nil, fmt.Errorf("invalid policy %d of subscription %s", opts.Policy, opts.Name)
+	}
+
+	s := &Subscription{
+		bus:    b,
+		name:   opts.Name,
+		filter: filter,
+		policy: opts.Policy,
+		events: make(chan Event, buffer),
+		done:   make(chan struct{}),
+		log:    b.log.With("subscriber", opts.Name),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrClosed
+	}
+	b.subscriptions[s] = struct{}{}
+	b.log.Debug("Added subscription", "subscriber", opts.Name, "buffer", buffer)
+	return s, nil
+}
+
+// Publish hands events, in order, to the subscriptions they match. It returns once each of them
+// has buffered or dropped the events, waiting on the full Block subscriptions. Publishing on a nil
+// bus does nothing, so components can publish whether or not a bus is set.
+func (b *Bus) Publish(events ...Event) {
+	if b == nil || len(events) == 0 {
+		return
+	}
+	b.mu.Lock()
+	subscriptions := make([]*Subscription, 0, len(b.subscriptions))
+	for s := range b.subscriptions {
+		subscriptions = append(subscriptions, s)
+	}
+	b.mu.Unlock()
+
+	for _, s := range subscriptions {
+		for _, event := range events {
+			if s.filter.matches(event) {
+				s.deliver(event)
+			}
+		}
+	}
+}
+
+// Close closes every subscription, unblocking the publishers waiting on them
+func (b *Bus) Close() {
+	b.mu.Lock()
+	b.closed = true
+	subscriptions := make([]*Subscription, 0, len(b.subscriptions))
+	for s := range b.subscriptions {
+		subscriptions = append(subscriptions, s)
+	}
+	b.mu.Unlock()
+
+	for _, s := range subscriptions {
+		s.Close()
+	}
+}
+
+func (b *Bus) remove(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subscriptions, s)
+}
+
+// Subscription receives the events its filter selects on Events
+type Subscription struct {
+	bus    *Bus
+	name   string
+	filter *matcher
+	policy Policy
+	events chan Event
+	// done is closed by Close to release a publisher waiting on the buffer
+	done      chan struct{}
+	closeOnce sync.Once
+	// mu serializes deliveries and closing events
+	mu       sync.Mutex
+	closed   bool
+	dropping bool
+	dropped  atomic.Uint64
+	log      *slog.Logger
+}
+
+// Events returns the channel events are delivered on, closed by Close
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped returns the number of events dropped because the buffer was full
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close stops deliveries and closes Events. Buffered events can still be received.
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.bus.remove(s)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.closed = true
+		close(s.events)
+	})
+}
+
+// deliver buffers event according to the subscription's policy
+func (s *Subscription) deliver(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.events <- event:
+		s.dropping = false
+		return
+	default:
+	}
+
+	switch s.policy {
+	case Block:
+		select {
+		case s.events <- event:
+		case <-s.done:
+		}
+	case DropOldest:
+		for {
+			select {
+			case <-s.events:
+				s.drop()
+			default:
+			}
+			select {
+			case s.events <- event:
+				return
+			default:
+			}
+		}
+	default:
+		s.drop()
+	}
+}
+
+// drop counts a dropped event, warning when the subscription starts dropping
+func (s *Subscription) drop() {
+	s.dropped.Add(1)
+	metrics.BusEventsDropped.WithLabelValues(s.name).Inc()
+	if !s.dropping {
+		s.dropping = true
+		s.log.Warn("Subscriber buffer is full, dropping events", "dropped", s.dropped.Load())
+	}
+}
+
+// matcher is a Filter with its fields as sets
+type matcher struct {
+	kinds      map[Kind]struct{}
+	vaults     map[string]struct{}
+	eventNames map[string]struct{}
+	match      func(Event) bool
+}
+
+func newMatcher(filter Filter) (*matcher, error) {
+	m := &matcher{match: filter.Match}
+	if len(filter.Kinds) > 0 {
+		m.kinds = make(map[Kind]struct{}, len(filter.Kinds))
+		for _, kind := range filter.Kinds {
+			m.kinds[kind] = struct{}{}
+		}
+	}
+	if len(filter.Vaults) > 0 {
+		m.vaults = make(map[string]struct{}, len(filter.Vaults))
+		for _, address := range filter.Vaults {
+			normalized, err := utils.NormalizeHexAddress(address)
+			if err != nil {
+				return nil, fmt.Errorf("invalid vault address %s: %w", address, err)
+			}
+			m.vaults[normalized] = struct{}{}
+		}
+	}
+	if len(filter.EventNames) > 0 {
+		m.eventNames = make(map[string]struct{}, len(filter.EventNames))
+		for _, name := range filter.EventNames {
+			m.eventNames[name] = struct{}{}
+		}
+	}
+	return m, nil
+}
+
+func (m *matcher) matches(event Event) bool {
+	if m.kinds != nil {
+		if _, ok := m.kinds[event.Kind()]; !ok {
+			return false
+		}
+	}
+	if address := event.Vault(); m.vaults != nil && address != "" {
+		normalized, err := utils.NormalizeHexAddress(address)
+		if err != nil {
+			return false
+		}
+		if _, ok := m.vaults[normalized]; !ok {
+			return false
+		}
+	}
+	if vaultEvent, ok := event.(VaultEvent); ok && m.eventNames != nil {
+		if _, ok := m.eventNames[vaultEvent.Event.EventName]; !ok {
+			return false
+		}
+	}
+	return m.match == nil || m.match(event)
+}
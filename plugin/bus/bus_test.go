@@ -0,0 +1,218 @@
+package bus
+
+import (
+	"junoplugin/models"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestBus() *Bus {
+	return New(slog.New(slog.DiscardHandler))
+}
+
+func vaultEvent(address, name string, block uint64) VaultEvent {
+	return VaultEvent{Event: &models.Event{VaultAddress: address, EventName: name, BlockNumber: block}}
+}
+
+func blockCommitted(number uint64) BlockCommitted {
+	return BlockCommitted{Block: &models.StarknetBlocks{BlockNumber: number}}
+}
+
+// received drains the events buffered for s
+func received(s *Subscription) []Event {
+	var events []Event
+	for {
+		select {
+		case event := <-s.Events():
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	published := []Event{
+		vaultEvent("0xbeef", "Deposit", 1),
+		vaultEvent("0x0cafe", "Withdrawal", 1),
+		blockCommitted(1),
+		VaultCaughtUp{VaultAddress: "0x00beef", ToBlock: 5},
+		BlockReverted{Block: &models.StarknetBlocks{BlockNumber: 1}},
+	}
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected []int
+	}{
+		{"everything", Filter{}, []int{0, 1, 2, 3, 4}},
+		{"kinds", Filter{Kinds: []Kind{KindBlockCommitted, KindBlockReverted}}, []int{2, 4}},
+		{"normalized vaults", Filter{Vaults: []string{"0x000beef"}}, []int{0, 2, 3, 4}},
+		{"event names", Filter{EventNames: []string{"Withdrawal"}}, []int{1, 2, 3, 4}},
+		{"vault events of a vault", Filter{Kinds: []Kind{KindVaultEvent}, Vaults: []string{"0xcafe"}}, []int{1}},
+		{"match", Filter{Match: func(e Event) bool { return e.Vault() == "" }}, []int{2, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBus()
+			s, err := b.Subscribe(Options{Name: tt.name, Filter: tt.filter})
+			if err != nil {
+				t.Fatalf("Failed to subscribe: %v", err)
+			}
+			b.Publish(published...)
+
+			events := received(s)
+			if len(events) != len(tt.expected) {
+				t.Fatalf("Expected %d events, got %d: %+v", len(tt.expected), len(events), events)
+			}
+			for i, index := range tt.expected {
+				if events[i] != published[index] {
+					t.Errorf("Expected event %d to be %+v, got %+v", i, published[index], events[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSubscribeInvalidOptions(t *testing.T) {
+	b := newTestBus()
+	tests := []struct {
+		name    string
+		options Options
+	}{
+		{"invalid vault address", Options{Filter: Filter{Vaults: []string{"beef"}}}},
+		{"negative buffer", Options{Buffer: -1}},
+		{"unknown policy", Options{Policy: Block + 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := b.Subscribe(tt.options); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestDropPolicies(t *testing.T) {
+	tests := []struct {
+		policy   Policy
+		expected []uint64
+	}{
+		{DropNewest, []uint64{1, 2}},
+		{DropOldest, []uint64{3, 4}},
+	}
+
+	for _, tt := range tests {
+		b := newTestBus()
+		s, err := b.Subscribe(Options{Name: "slow", Buffer: 2, Policy: tt.policy})
+		if err != nil {
+			t.Fatalf("Failed to subscribe: %v", err)
+		}
+		b.Publish(blockCommitted(1), blockCommitted(2), blockCommitted(3), blockCommitted(4))
+
+		events := received(s)
+		if len(events) != len(tt.expected) {
+			t.Fatalf("Policy %d: expected %d events, got %d", tt.policy, len(tt.expected), len(events))
+		}
+		for i, number := range tt.expected {
+			if block := events[i].(BlockCommitted).Block.BlockNumber; block != number {
+				t.Errorf("Policy %d: expected block %d, got %d", tt.policy, number, block)
+			}
+		}
+		if s.Dropped() != 2 {
+			t.Errorf("Policy %d: expected 2 dropped events, got %d", tt.policy, s.Dropped())
+		}
+	}
+}
+
+func TestBlockPolicy(t *testing.T) {
+	b := newTestBus()
+	s, err := b.Subscribe(Options{Name: "slow", Buffer: 1, Policy: Block})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	other, err := b.Subscribe(Options{Name: "other", Buffer: 8})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	published := make(chan struct{})
+	go func() {
+		b.Publish(blockCommitted(1), blockCommitted(2), blockCommitted(3))
+		close(published)
+	}()
+
+	// The publisher waits for the subscriber to make room
+	select {
+	case <-published:
+		t.Fatal("Expected the publisher to wait for the full subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+	for number := uint64(1); number <= 3; number++ {
+		event := <-s.Events()
+		if block := event.(BlockCommitted).Block.BlockNumber; block != number {
+			t.Errorf("Expected block %d, got %d", number, block)
+		}
+	}
+	<-published
+	if s.Dropped() != 0 {
+		t.Errorf("Expected no dropped event, got %d", s.Dropped())
+	}
+	if events := received(other); len(events) != 3 {
+		t.Errorf("Expected the other subscriber to receive 3 events, got %d", len(events))
+	}
+}
+
+func TestCloseReleasesPublisher(t *testing.T) {
+	b := newTestBus()
+	s, err := b.Subscribe(Options{Name: "stuck", Buffer: 1, Policy: Block})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.Publish(blockCommitted(1), blockCommitted(2))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	s.Close()
+	wg.Wait()
+
+	// The buffered event can still be received, then the channel is closed
+	if event, ok := <-s.Events(); !ok || event.(BlockCommitted).Block.BlockNumber != 1 {
+		t.Errorf("Expected the buffered block 1, got %+v", event)
+	}
+	if _, ok := <-s.Events(); ok {
+		t.Error("Expected the events channel to be closed")
+	}
+
+	// Publishing after Close skips the subscription
+	b.Publish(blockCommitted(3))
+	s.Close()
+}
+
+func TestBusClose(t *testing.T) {
+	b := newTestBus()
+	s, err := b.Subscribe(Options{Name: "subscriber"})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	b.Close()
+
+	if _, ok := <-s.Events(); ok {
+		t.Error("Expected the events channel to be closed")
+	}
+	if _, err := b.Subscribe(Options{}); err != ErrClosed {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+
+	// A nil bus publishes nowhere
+	var unset *Bus
+	unset.Publish(blockCommitted(1))
+}
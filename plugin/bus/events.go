@@ -0,0 +1,94 @@
+package bus
+
+import "junoplugin/models"
+
+// Kind identifies the type of an Event
+type Kind string
+
+// Event kinds
+const (
+	KindVaultEvent     Kind = "vault_event"
+	KindBlockCommitted Kind = "block_committed"
+	KindBlockReverted  Kind = "block_reverted"
+	KindVaultCaughtUp  Kind = "vault_caught_up"
+	KindBlocksCaughtUp Kind = "blocks_caught_up"
+	KindVaultReindexed Kind = "vault_reindexed"
+)
+
+// Event is published on the bus once what it describes is committed. Subscribers switch on the
+// concrete type: VaultEvent, BlockCommitted, BlockReverted, VaultCaughtUp, BlocksCaughtUp or
+// VaultReindexed.
+type Event interface {
+	Kind() Kind
+	// Vault is the address of the vault the event is about, empty for block events
+	Vault() string
+}
+
+// VaultEvent is a decoded vault event stored by a live block, a vault's initialization, its
+// catchup or a replay of its events. Events of a block are published before its BlockCommitted.
+type VaultEvent struct {
+	Event *models.Event
+	// Catchup is set for events indexed from the node rather than from a live block
+	Catchup bool
+}
+
+func (VaultEvent) Kind() Kind { return KindVaultEvent }
+
+func (e VaultEvent) Vault() string { return e.Event.VaultAddress }
+
+// BlockCommitted is a live block committed with the events of the tracked vaults
+type BlockCommitted struct {
+	Block *models.StarknetBlocks
+	// VaultEvents is the number of VaultEvents published for the block
+	VaultEvents int
+}
+
+func (BlockCommitted) Kind() Kind { return KindBlockCommitted }
+
+func (BlockCommitted) Vault() string { return "" }
+
+// BlockReverted is a block marked reverted with the upgrades and tracked contract events it held
+type BlockReverted struct {
+	Block *models.StarknetBlocks
+}
+
+func (BlockReverted) Kind() Kind { return KindBlockReverted }
+
+func (BlockReverted) Vault() string { return "" }
+
+// VaultCaughtUp is a vault catchup that indexed the vault up to ToBlock
+type VaultCaughtUp struct {
+	VaultAddress string
+	FromBlock    uint64
+	ToBlock      uint64
+	// BlockHash is the hash of ToBlock, the vault's last indexed block
+	BlockHash string
+}
+
+func (VaultCaughtUp) Kind() Kind { return KindVaultCaughtUp }
+
+func (e VaultCaughtUp) Vault() string { return e.VaultAddress }
+
+// BlocksCaughtUp is a block catchup that stored the blocks up to ToBlock
+type BlocksCaughtUp struct {
+	FromBlock uint64
+	ToBlock   uint64
+}
+
+func (BlocksCaughtUp) Kind() Kind { return KindBlocksCaughtUp }
+
+func (BlocksCaughtUp) Vault() string { return "" }
+
+// VaultReindexed is a reindex or recatchup that replaced a vault's events in [FromBlock, ToBlock].
+// The replayed events follow it, so subscribers drop what they hold of the range.
+type VaultReindexed struct {
+	VaultAddress string
+	FromBlock    uint64
+	ToBlock      uint64
+	// BlockHash is the hash of ToBlock
+	BlockHash string
+}
+
+func (VaultReindexed) Kind() Kind { return KindVaultReindexed }
+
+func (e VaultReindexed) Vault() string { return e.VaultAddress }
@@ -1,58 +1,678 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"junoplugin/logging"
+	"junoplugin/tracing"
+	"junoplugin/utils"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Migration modes, see db.MigrateOptions
+const (
+	MigrationModeAuto   = "auto"
+	MigrationModeDryRun = "dry-run"
+)
+
+// Kinds of tracked contracts, vaults are tracked through the vault registry instead
+const (
+	ContractKindERC20  = "erc20"
+	ContractKindOracle = "oracle"
+)
+
+// Subscription matchers other than a felt
+const (
+	// MatchAny matches any value, and any emitter as a subscription address
+	MatchAny = "*"
+	// MatchVault matches the address of a tracked vault
+	MatchVault = "$vault"
+)
+
+// DefaultCatchupWindow is the number of blocks catchup commits at a time when none is configured
+const DefaultCatchupWindow = 1000
+
+// DefaultCatchupWorkers is the number of vaults caught up at once when none is configured
+const DefaultCatchupWorkers = 4
+
+// DefaultFinalityDepth is the number of blocks behind the head past which blocks are finalized when
+// none is configured
+const DefaultFinalityDepth = 10
+
+// Outbox sinks, the outbox is not published with none
+const (
+	OutboxSinkNone   = "none"
+	OutboxSinkNATS   = "nats"
+	OutboxSinkKafka  = "kafka"
+	OutboxSinkRedis  = "redis"
+	OutboxSinkFile   = "file"
+	OutboxSinkStdout = "stdout"
+)
+
+// DefaultOutboxTopic is the topic, subject prefix or stream outbox messages are published to when
+// none is configured
+const DefaultOutboxTopic = "pitchlake"
+
+// DefaultOutboxBatchSize is the number of outbox messages published at a time when none is configured
+const DefaultOutboxBatchSize = 500
+
+// Webhook delivery defaults
+const (
+	// DefaultWebhookMaxAttempts is the number of times a webhook is sent before it is dead-lettered
+	DefaultWebhookMaxAttempts = 8
+	// DefaultWebhookTimeout bounds each webhook request
+	DefaultWebhookTimeout = 10 * time.Second
 )
 
 // Config holds all configuration for the plugin
 type Config struct {
-	DatabaseURL string
-	RPCURL      string
-	UDCAddress  string
-	Cursor      uint64
+	// Network names the chain indexed, written to replay recordings
+	Network     string `yaml:"network"`
+	DatabaseURL string `yaml:"db_url"`
+	RPCURL      string `yaml:"rpc_url"`
+	// RPCFallbackURLs are failed over to when RPCURL is unhealthy or rate limited
+	RPCFallbackURLs []string `yaml:"rpc_fallback_urls"`
+	// RPCRateLimit caps requests per second on each RPC endpoint, 0 means unlimited
+	RPCRateLimit float64 `yaml:"rpc_rate_limit"`
+	// RPCMaxAttempts is the number of tries per RPC call, 0 uses the network default
+	RPCMaxAttempts int `yaml:"rpc_max_attempts"`
+	// RPCConcurrency bounds the block requests in flight during catchup, 0 uses the network default
+	RPCConcurrency int `yaml:"rpc_concurrency"`
+	// RPCBatchSize is the number of blocks per JSON-RPC batch, 1 disables batching, 0 uses the network default
+	RPCBatchSize     int      `yaml:"rpc_batch_size"`
+	UDCAddress       string   `yaml:"udc_address"`
+	VaultClassHashes []string `yaml:"vault_class_hashes"`
+	Cursor           uint64   `yaml:"cursor"`
+	// VaultDecoders maps vault class hashes to the decoder version or ABI file their events are decoded with
+	VaultDecoders map[string]string `yaml:"vault_decoders"`
+	// FetchVaultABIs decodes the events of vault classes missing from VaultDecoders with the class's ABI from the node
+	FetchVaultABIs bool `yaml:"fetch_vault_abis"`
+	// TrackedContracts are contracts other than vaults whose events are indexed, along with those
+	// added with pitchlakectl contract add
+	TrackedContracts []TrackedContract `yaml:"tracked_contracts"`
+	// Subscriptions select events of any contract by selector and key and data patterns, they are
+	// only read from the config file
+	Subscriptions []Subscription `yaml:"subscriptions"`
+	// CatchupWindow bounds the blocks block and vault catchup hold before committing
+	CatchupWindow uint64 `yaml:"catchup_window"`
+	// CatchupWorkers is the number of vaults caught up concurrently at startup
+	CatchupWorkers int `yaml:"catchup_workers"`
+	// FinalityDepth is the number of blocks behind the head past which blocks are marked FINALIZED
+	// and can no longer be reverted
+	FinalityDepth uint64 `yaml:"finality_depth"`
+	// TrackStorageDiffs stores the storage writes of tracked vaults from each block's state update
+	TrackStorageDiffs bool   `yaml:"track_storage_diffs"`
+	MigrationMode     string `yaml:"migration_mode"`
+	// LogLevel is debug, info, warn or error, per event records are logged at debug
+	LogLevel string `yaml:"log_level"`
+	// LogFormat is text or json
+	LogFormat string `yaml:"log_format"`
+	// HealthAddr is the address /healthz and /readyz are served on, empty disables them
+	HealthAddr string `yaml:"health_addr"`
+	// HealthMaxBlockAge is the age of the last processed block past which the plugin is not ready,
+	// 0 disables the check
+	HealthMaxBlockAge time.Duration `yaml:"health_max_block_age"`
+	// TraceExporter is none, otlp, stdout or file, spans are not recorded when empty or none
+	TraceExporter string `yaml:"trace_exporter"`
+	// TraceEndpoint is the OTLP/HTTP endpoint URL of the otlp exporter
+	TraceEndpoint string `yaml:"trace_endpoint"`
+	// TraceFile is the file the file exporter appends spans to
+	TraceFile string `yaml:"trace_file"`
+	// TraceSampleRatio is the share of traces recorded, between 0 and 1, all of them when 0
+	TraceSampleRatio float64 `yaml:"trace_sample_ratio"`
+	// RecordFile is the file the block calls Juno makes are recorded to for replay, empty disables it
+	RecordFile string `yaml:"record_file"`
+	// OutboxSink is none, nats, kafka, redis, file or stdout, the outbox is not published when empty or none
+	OutboxSink string `yaml:"outbox_sink"`
+	// OutboxURL is the broker URL of the nats, kafka and redis sinks
+	OutboxURL string `yaml:"outbox_url"`
+	// OutboxTopic is the Kafka topic, NATS subject prefix or Redis stream messages are published to
+	OutboxTopic string `yaml:"outbox_topic"`
+	// OutboxFile is the file the file sink appends messages to
+	OutboxFile string `yaml:"outbox_file"`
+	// OutboxBatchSize is the number of outbox messages published at a time
+	OutboxBatchSize int `yaml:"outbox_batch_size"`
+	// Webhooks sends the vault events to the webhook subscriptions of the database
+	Webhooks bool `yaml:"webhooks"`
+	// WebhookMaxAttempts is the number of times a webhook is sent before it is dead-lettered
+	WebhookMaxAttempts int `yaml:"webhook_max_attempts"`
+	// WebhookTimeout bounds each webhook request
+	WebhookTimeout time.Duration `yaml:"webhook_timeout"`
+}
+
+// TrackedContract is a contract other than a vault whose events are indexed
+type TrackedContract struct {
+	Address string `yaml:"address"`
+	// Kind is ContractKindERC20 or ContractKindOracle
+	Kind string `yaml:"kind"`
+	// StartBlock is the first block indexed, blocks before the plugin's head are not backfilled
+	StartBlock uint64 `yaml:"start_block"`
+	// ABI is the path of an ABI file to decode the contract's events with, empty for the kind's default
+	ABI string `yaml:"abi"`
 }
 
-// LoadConfig loads configuration from environment variables
+// Subscription selects events by emitter, selector and positional matchers. A matcher is a felt,
+// MatchAny or MatchVault.
+type Subscription struct {
+	// Name identifies the subscription's events in contract_events
+	Name string `yaml:"name"`
+	// Address is the emitting contract, empty or MatchAny for any
+	Address string `yaml:"address"`
+	// Event is the event's name or its 0x prefixed selector, the event's first key
+	Event string `yaml:"event"`
+	// Keys match the event's keys after the selector by position, extra keys are not checked
+	Keys []string `yaml:"keys"`
+	// Data match the event's data by position, extra data is not checked
+	Data []string `yaml:"data"`
+}
+
+// LoadConfig loads and validates the configuration from the file named by CONFIG_FILE, if any,
+// and environment variables
 func LoadConfig() (*Config, error) {
+	config, err := Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Load builds the configuration without validating it. Environment variables override the YAML
+// file at path (skipped when empty).
+func Load(path string) (*Config, error) {
 	config := &Config{}
 
-	// Required environment variables
-	dbURL := os.Getenv("DB_URL")
-	if dbURL == "" {
-		return nil, fmt.Errorf("DB_URL environment variable is required")
+	if path != "" {
+		if err := config.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.loadEnv(); err != nil {
+		return nil, err
 	}
-	config.DatabaseURL = dbURL
 
-	rpcURL := os.Getenv("RPC_URL")
-	if rpcURL == "" {
-		return nil, fmt.Errorf("RPC_URL environment variable is required")
+	// "auto" applies pending migrations at startup, "dry-run" only lists them and refuses to start
+	if config.MigrationMode == "" {
+		config.MigrationMode = MigrationModeAuto
+	}
+	if config.CatchupWindow == 0 {
+		config.CatchupWindow = DefaultCatchupWindow
+	}
+	if config.CatchupWorkers == 0 {
+		config.CatchupWorkers = DefaultCatchupWorkers
+	}
+	if config.FinalityDepth == 0 {
+		config.FinalityDepth = DefaultFinalityDepth
+	}
+	if config.LogLevel == "" {
+		config.LogLevel = "info"
+	}
+	if config.LogFormat == "" {
+		config.LogFormat = logging.FormatText
+	}
+	if config.OutboxTopic == "" {
+		config.OutboxTopic = DefaultOutboxTopic
+	}
+	if config.OutboxBatchSize == 0 {
+		config.OutboxBatchSize = DefaultOutboxBatchSize
+	}
+	if config.WebhookMaxAttempts == 0 {
+		config.WebhookMaxAttempts = DefaultWebhookMaxAttempts
 	}
-	config.RPCURL = rpcURL
+	if config.WebhookTimeout == 0 {
+		config.WebhookTimeout = DefaultWebhookTimeout
+	}
+	return config, nil
+}
 
-	// Optional environment variables
-	config.UDCAddress = os.Getenv("UDC_ADDRESS")
+func (c *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	setString := func(name string, field *string) {
+		if value := os.Getenv(name); value != "" {
+			*field = value
+		}
+	}
+	setString("NETWORK", &c.Network)
+	setString("DB_URL", &c.DatabaseURL)
+	setString("RPC_URL", &c.RPCURL)
+	setString("UDC_ADDRESS", &c.UDCAddress)
+	setString("DB_MIGRATION_MODE", &c.MigrationMode)
+	setString("LOG_LEVEL", &c.LogLevel)
+	setString("LOG_FORMAT", &c.LogFormat)
+	setString("HEALTH_ADDR", &c.HealthAddr)
+	setString("TRACE_EXPORTER", &c.TraceExporter)
+	setString("TRACE_ENDPOINT", &c.TraceEndpoint)
+	setString("TRACE_FILE", &c.TraceFile)
+	setString("RECORD_FILE", &c.RecordFile)
+	setString("OUTBOX_SINK", &c.OutboxSink)
+	setString("OUTBOX_URL", &c.OutboxURL)
+	setString("OUTBOX_TOPIC", &c.OutboxTopic)
+	setString("OUTBOX_FILE", &c.OutboxFile)
 
-	cursor := os.Getenv("CURSOR")
-	if cursor != "" {
+	// Lists are comma separated
+	setList := func(name string, field *[]string) {
+		value := os.Getenv(name)
+		if value == "" {
+			return
+		}
+		*field = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*field = append(*field, item)
+			}
+		}
+	}
+	setList("VAULT_HASH", &c.VaultClassHashes)
+	setList("RPC_FALLBACK_URLS", &c.RPCFallbackURLs)
+
+	// VAULT_DECODERS is a comma separated list of class_hash=version
+	var decoders []string
+	setList("VAULT_DECODERS", &decoders)
+	if len(decoders) > 0 {
+		c.VaultDecoders = make(map[string]string, len(decoders))
+		for _, decoder := range decoders {
+			classHash, version, ok := strings.Cut(decoder, "=")
+			if !ok {
+				return fmt.Errorf("invalid VAULT_DECODERS entry %q, expected class_hash=version", decoder)
+			}
+			c.VaultDecoders[strings.TrimSpace(classHash)] = strings.TrimSpace(version)
+		}
+	}
+
+	// TRACKED_CONTRACTS is a comma separated list of kind:address[:start_block]
+	var contracts []string
+	setList("TRACKED_CONTRACTS", &contracts)
+	if len(contracts) > 0 {
+		c.TrackedContracts = make([]TrackedContract, 0, len(contracts))
+		for _, entry := range contracts {
+			parts := strings.Split(entry, ":")
+			if len(parts) < 2 || len(parts) > 3 {
+				return fmt.Errorf("invalid TRACKED_CONTRACTS entry %q, expected kind:address[:start_block]", entry)
+			}
+			contract := TrackedContract{Kind: strings.TrimSpace(parts[0]), Address: strings.TrimSpace(parts[1])}
+			if len(parts) == 3 {
+				var err error
+				contract.StartBlock, err = strconv.ParseUint(strings.TrimSpace(parts[2]), 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid TRACKED_CONTRACTS start block in %q: %w", entry, err)
+				}
+			}
+			c.TrackedContracts = append(c.TrackedContracts, contract)
+		}
+	}
+
+	if cursor := os.Getenv("CURSOR"); cursor != "" {
+		var err error
+		c.Cursor, err = strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid CURSOR value: %w", err)
+		}
+	}
+	if window := os.Getenv("CATCHUP_WINDOW"); window != "" {
+		var err error
+		c.CatchupWindow, err = strconv.ParseUint(window, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid CATCHUP_WINDOW value: %w", err)
+		}
+	}
+	if depth := os.Getenv("FINALITY_DEPTH"); depth != "" {
+		var err error
+		c.FinalityDepth, err = strconv.ParseUint(depth, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid FINALITY_DEPTH value: %w", err)
+		}
+	}
+	if track := os.Getenv("TRACK_STORAGE_DIFFS"); track != "" {
+		var err error
+		c.TrackStorageDiffs, err = strconv.ParseBool(track)
+		if err != nil {
+			return fmt.Errorf("invalid TRACK_STORAGE_DIFFS value: %w", err)
+		}
+	}
+	if fetch := os.Getenv("FETCH_VAULT_ABIS"); fetch != "" {
+		var err error
+		c.FetchVaultABIs, err = strconv.ParseBool(fetch)
+		if err != nil {
+			return fmt.Errorf("invalid FETCH_VAULT_ABIS value: %w", err)
+		}
+	}
+	if rateLimit := os.Getenv("RPC_RATE_LIMIT"); rateLimit != "" {
+		var err error
+		c.RPCRateLimit, err = strconv.ParseFloat(rateLimit, 64)
+		if err != nil {
+			return fmt.Errorf("invalid RPC_RATE_LIMIT value: %w", err)
+		}
+	}
+	if age := os.Getenv("HEALTH_MAX_BLOCK_AGE"); age != "" {
+		var err error
+		c.HealthMaxBlockAge, err = time.ParseDuration(age)
+		if err != nil {
+			return fmt.Errorf("invalid HEALTH_MAX_BLOCK_AGE value: %w", err)
+		}
+	}
+	if webhooks := os.Getenv("WEBHOOKS"); webhooks != "" {
+		var err error
+		c.Webhooks, err = strconv.ParseBool(webhooks)
+		if err != nil {
+			return fmt.Errorf("invalid WEBHOOKS value: %w", err)
+		}
+	}
+	if timeout := os.Getenv("WEBHOOK_TIMEOUT"); timeout != "" {
+		var err error
+		c.WebhookTimeout, err = time.ParseDuration(timeout)
+		if err != nil {
+			return fmt.Errorf("invalid WEBHOOK_TIMEOUT value: %w", err)
+		}
+	}
+	if ratio := os.Getenv("TRACE_SAMPLE_RATIO"); ratio != "" {
 		var err error
-		config.Cursor, err = strconv.ParseUint(cursor, 10, 64)
+		c.TraceSampleRatio, err = strconv.ParseFloat(ratio, 64)
+		if err != nil {
+			return fmt.Errorf("invalid TRACE_SAMPLE_RATIO value: %w", err)
+		}
+	}
+	setInt := func(name string, field *int) error {
+		value := os.Getenv(name)
+		if value == "" {
+			return nil
+		}
+		parsed, err := strconv.Atoi(value)
 		if err != nil {
-			return nil, fmt.Errorf("invalid CURSOR value: %w", err)
+			return fmt.Errorf("invalid %s value: %w", name, err)
 		}
+		*field = parsed
+		return nil
+	}
+	if err := setInt("RPC_MAX_ATTEMPTS", &c.RPCMaxAttempts); err != nil {
+		return err
 	}
+	if err := setInt("RPC_CONCURRENCY", &c.RPCConcurrency); err != nil {
+		return err
+	}
+	if err := setInt("RPC_BATCH_SIZE", &c.RPCBatchSize); err != nil {
+		return err
+	}
+	if err := setInt("CATCHUP_WORKERS", &c.CatchupWorkers); err != nil {
+		return err
+	}
+	if err := setInt("OUTBOX_BATCH_SIZE", &c.OutboxBatchSize); err != nil {
+		return err
+	}
+	if err := setInt("WEBHOOK_MAX_ATTEMPTS", &c.WebhookMaxAttempts); err != nil {
+		return err
+	}
+	return nil
+}
 
-	return config, nil
+// RPCURLs returns the primary RPC URL followed by the fallbacks
+func (c *Config) RPCURLs() []string {
+	return append([]string{c.RPCURL}, c.RPCFallbackURLs...)
 }
 
-// Validate validates the configuration
+// Validate validates the configuration and normalizes its hex values
 func (c *Config) Validate() error {
 	if c.DatabaseURL == "" {
 		return fmt.Errorf("database URL is required")
 	}
+	// Keyword/value connection strings are left to pgx to parse
+	if strings.Contains(c.DatabaseURL, "://") {
+		if err := validateURL(c.DatabaseURL, "postgres", "postgresql"); err != nil {
+			return fmt.Errorf("invalid database URL: %w", err)
+		}
+	}
 	if c.RPCURL == "" {
 		return fmt.Errorf("RPC URL is required")
 	}
+	for _, rpcURL := range c.RPCURLs() {
+		if err := validateURL(rpcURL, "http", "https", "ws", "wss"); err != nil {
+			return fmt.Errorf("invalid RPC URL %s: %w", rpcURL, err)
+		}
+	}
+	if c.RPCRateLimit < 0 {
+		return fmt.Errorf("RPC rate limit must not be negative, got %v", c.RPCRateLimit)
+	}
+	if c.RPCMaxAttempts < 0 {
+		return fmt.Errorf("RPC max attempts must not be negative, got %d", c.RPCMaxAttempts)
+	}
+	if c.RPCConcurrency < 0 {
+		return fmt.Errorf("RPC concurrency must not be negative, got %d", c.RPCConcurrency)
+	}
+	if c.RPCBatchSize < 0 {
+		return fmt.Errorf("RPC batch size must not be negative, got %d", c.RPCBatchSize)
+	}
+	if c.CatchupWorkers < 0 {
+		return fmt.Errorf("catchup workers must not be negative, got %d", c.CatchupWorkers)
+	}
+	if c.MigrationMode != "" && c.MigrationMode != MigrationModeAuto && c.MigrationMode != MigrationModeDryRun {
+		return fmt.Errorf("invalid migration mode %q, expected auto or dry-run", c.MigrationMode)
+	}
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		return err
+	}
+	if c.LogFormat != "" && c.LogFormat != logging.FormatText && c.LogFormat != logging.FormatJSON {
+		return fmt.Errorf("invalid log format %q, expected %s or %s", c.LogFormat, logging.FormatText, logging.FormatJSON)
+	}
+	if c.HealthAddr != "" {
+		if _, _, err := net.SplitHostPort(c.HealthAddr); err != nil {
+			return fmt.Errorf("invalid health address %q: %w", c.HealthAddr, err)
+		}
+	}
+	if c.HealthMaxBlockAge < 0 {
+		return fmt.Errorf("health max block age must not be negative, got %v", c.HealthMaxBlockAge)
+	}
+	switch c.TraceExporter {
+	case "", tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout:
+	case tracing.ExporterFile:
+		if c.TraceFile == "" {
+			return fmt.Errorf("trace file is required by the %s trace exporter", tracing.ExporterFile)
+		}
+	default:
+		return fmt.Errorf("invalid trace exporter %q, expected %s, %s, %s or %s", c.TraceExporter, tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout, tracing.ExporterFile)
+	}
+	if c.TraceEndpoint != "" {
+		if err := validateURL(c.TraceEndpoint, "http", "https"); err != nil {
+			return fmt.Errorf("invalid trace endpoint: %w", err)
+		}
+	}
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		return fmt.Errorf("trace sample ratio must be between 0 and 1, got %v", c.TraceSampleRatio)
+	}
+	if err := c.validateOutbox(); err != nil {
+		return err
+	}
+	if c.WebhookMaxAttempts < 0 {
+		return fmt.Errorf("webhook max attempts must not be negative, got %d", c.WebhookMaxAttempts)
+	}
+	if c.WebhookTimeout < 0 {
+		return fmt.Errorf("webhook timeout must not be negative, got %v", c.WebhookTimeout)
+	}
+
+	if c.UDCAddress != "" {
+		normalized, err := utils.ValidateFeltHex(c.UDCAddress)
+		if err != nil {
+			return fmt.Errorf("invalid UDC address: %w", err)
+		}
+		c.UDCAddress = normalized
+	}
+	for i, hash := range c.VaultClassHashes {
+		normalized, err := utils.ValidateFeltHex(hash)
+		if err != nil {
+			return fmt.Errorf("invalid vault class hash: %w", err)
+		}
+		c.VaultClassHashes[i] = normalized
+	}
+	if len(c.VaultDecoders) > 0 {
+		decoders := make(map[string]string, len(c.VaultDecoders))
+		for hash, version := range c.VaultDecoders {
+			normalized, err := utils.ValidateFeltHex(hash)
+			if err != nil {
+				return fmt.Errorf("invalid vault decoder class hash: %w", err)
+			}
+			if version == "" {
+				return fmt.Errorf("missing decoder version for vault class %s", hash)
+			}
+			decoders[normalized] = version
+		}
+		c.VaultDecoders = decoders
+	}
+	seen := make(map[string]bool, len(c.TrackedContracts))
+	for i := range c.TrackedContracts {
+		contract := &c.TrackedContracts[i]
+		if contract.Kind != ContractKindERC20 && contract.Kind != ContractKindOracle {
+			return fmt.Errorf("invalid kind %q of tracked contract %s, expected %s or %s", contract.Kind, contract.Address, ContractKindERC20, ContractKindOracle)
+		}
+		normalized, err := utils.ValidateFeltHex(contract.Address)
+		if err != nil {
+			return fmt.Errorf("invalid tracked contract address: %w", err)
+		}
+		if seen[normalized] {
+			return fmt.Errorf("tracked contract %s is listed more than once", normalized)
+		}
+		seen[normalized] = true
+		contract.Address = normalized
+	}
+	names := make(map[string]bool, len(c.Subscriptions))
+	for i := range c.Subscriptions {
+		if err := c.Subscriptions[i].validate(); err != nil {
+			return err
+		}
+		if names[c.Subscriptions[i].Name] {
+			return fmt.Errorf("subscription %s is defined more than once", c.Subscriptions[i].Name)
+		}
+		names[c.Subscriptions[i].Name] = true
+	}
 	return nil
 }
+
+// OutboxEnabled reports whether an outbox sink is configured
+func (c *Config) OutboxEnabled() bool {
+	return c.OutboxSink != "" && c.OutboxSink != OutboxSinkNone
+}
+
+// KafkaBrokers returns the host:port addresses of a kafka://host:port[,host:port...] outbox URL
+func (c *Config) KafkaBrokers() ([]string, error) {
+	hosts, ok := strings.CutPrefix(c.OutboxURL, OutboxSinkKafka+"://")
+	if !ok {
+		return nil, fmt.Errorf("unsupported scheme, expected %s://host:port[,host:port...]", OutboxSinkKafka)
+	}
+	var brokers []string
+	for _, host := range strings.Split(hosts, ",") {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			return nil, fmt.Errorf("invalid broker %q: %w", host, err)
+		}
+		brokers = append(brokers, host)
+	}
+	return brokers, nil
+}
+
+// validateOutbox checks that the outbox sink has what it needs
+func (c *Config) validateOutbox() error {
+	switch c.OutboxSink {
+	case "", OutboxSinkNone, OutboxSinkStdout:
+	case OutboxSinkFile:
+		if c.OutboxFile == "" {
+			return fmt.Errorf("outbox file is required by the %s outbox sink", OutboxSinkFile)
+		}
+	case OutboxSinkNATS, OutboxSinkRedis:
+		if c.OutboxURL == "" {
+			return fmt.Errorf("outbox URL is required by the %s outbox sink", c.OutboxSink)
+		}
+		if err := validateURL(c.OutboxURL, c.OutboxSink); err != nil {
+			return fmt.Errorf("invalid outbox URL: %w", err)
+		}
+	case OutboxSinkKafka:
+		if c.OutboxURL == "" {
+			return fmt.Errorf("outbox URL is required by the %s outbox sink", c.OutboxSink)
+		}
+		if _, err := c.KafkaBrokers(); err != nil {
+			return fmt.Errorf("invalid outbox URL: %w", err)
+		}
+	default:
+		return fmt.Errorf("invalid outbox sink %q, expected %s, %s, %s, %s, %s or %s", c.OutboxSink,
+			OutboxSinkNone, OutboxSinkNATS, OutboxSinkKafka, OutboxSinkRedis, OutboxSinkFile, OutboxSinkStdout)
+	}
+	if c.OutboxBatchSize < 0 {
+		return fmt.Errorf("outbox batch size must not be negative, got %d", c.OutboxBatchSize)
+	}
+	return nil
+}
+
+// validate checks a subscription and normalizes its hex values
+func (s *Subscription) validate() error {
+	if s.Name == "" {
+		return errors.New("subscription name is required")
+	}
+	if s.Event == "" {
+		return fmt.Errorf("missing event of subscription %s", s.Name)
+	}
+	if strings.HasPrefix(s.Event, "0x") {
+		normalized, err := utils.ValidateFeltHex(s.Event)
+		if err != nil {
+			return fmt.Errorf("invalid selector of subscription %s: %w", s.Name, err)
+		}
+		s.Event = normalized
+	}
+	if s.Address == MatchAny {
+		s.Address = ""
+	}
+	if s.Address != "" {
+		normalized, err := utils.ValidateFeltHex(s.Address)
+		if err != nil {
+			return fmt.Errorf("invalid address of subscription %s: %w", s.Name, err)
+		}
+		s.Address = normalized
+	}
+	for _, matchers := range [][]string{s.Keys, s.Data} {
+		for i, matcher := range matchers {
+			if matcher == MatchAny || matcher == MatchVault {
+				continue
+			}
+			normalized, err := utils.ValidateFeltHex(matcher)
+			if err != nil {
+				return fmt.Errorf("invalid matcher of subscription %s, expected a felt, %s or %s: %w", s.Name, MatchAny, MatchVault, err)
+			}
+			matchers[i] = normalized
+		}
+	}
+	return nil
+}
+
+// validateURL checks that raw is an absolute URL with one of the given schemes
+func validateURL(raw string, schemes ...string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if parsed.Host == "" {
+		return errors.New("missing host")
+	}
+	for _, scheme := range schemes {
+		if parsed.Scheme == scheme {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported scheme %q, expected %s", parsed.Scheme, strings.Join(schemes, ", "))
+}
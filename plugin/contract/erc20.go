@@ -0,0 +1,64 @@
+package contract
+
+import (
+	"junoplugin/abi"
+)
+
+// erc20ABI holds the Transfer and Approval events of OpenZeppelin's Cairo 2 ERC-20, which emits the
+// parties of an event as keys
+const erc20ABI = `[
+	{"type": "event", "name": "openzeppelin::token::erc20::erc20::ERC20Component::Transfer", "kind": "struct", "members": [
+		{"name": "from", "type": "core::starknet::contract_address::ContractAddress", "kind": "key"},
+		{"name": "to", "type": "core::starknet::contract_address::ContractAddress", "kind": "key"},
+		{"name": "value", "type": "core::integer::u256", "kind": "data"}
+	]},
+	{"type": "event", "name": "openzeppelin::token::erc20::erc20::ERC20Component::Approval", "kind": "struct", "members": [
+		{"name": "owner", "type": "core::starknet::contract_address::ContractAddress", "kind": "key"},
+		{"name": "spender", "type": "core::starknet::contract_address::ContractAddress", "kind": "key"},
+		{"name": "value", "type": "core::integer::u256", "kind": "data"}
+	]},
+	{"type": "event", "name": "openzeppelin::token::erc20::erc20::ERC20Component::Event", "kind": "enum", "variants": [
+		{"name": "Transfer", "type": "openzeppelin::token::erc20::erc20::ERC20Component::Transfer", "kind": "nested"},
+		{"name": "Approval", "type": "openzeppelin::token::erc20::erc20::ERC20Component::Approval", "kind": "nested"}
+	]}
+]`
+
+// legacyERC20ABI holds the same events in the Cairo 0 layout, with the parties in the data. StarkGate's
+// ETH token still emits this layout.
+const legacyERC20ABI = `[
+	{"type": "event", "name": "Transfer", "keys": [], "data": [
+		{"name": "from", "type": "felt"}, {"name": "to", "type": "felt"}, {"name": "value", "type": "Uint256"}
+	]},
+	{"type": "event", "name": "Approval", "keys": [], "data": [
+		{"name": "owner", "type": "felt"}, {"name": "spender", "type": "felt"}, {"name": "value", "type": "Uint256"}
+	]}
+]`
+
+// The ABIs are constant, their tests cover that they parse
+var (
+	erc20Events, _       = abi.Parse([]byte(erc20ABI))
+	legacyERC20Events, _ = abi.Parse([]byte(legacyERC20ABI))
+)
+
+// erc20Decoder decodes the Transfer and Approval events of an ERC-20 in either layout
+type erc20Decoder struct{}
+
+// DecodeEvent implements abi.EventDecoder
+func (erc20Decoder) DecodeEvent(keys, data []string) (*abi.DecodedEvent, bool) {
+	if len(keys) == 1 {
+		return legacyERC20Events.DecodeEvent(keys, data)
+	}
+	return erc20Events.DecodeEvent(keys, data)
+}
+
+// erc20Parties returns the two accounts of a Transfer or Approval event, the sender and receiver or
+// the owner and spender
+func erc20Parties(keys, data []string) ([]string, bool) {
+	switch {
+	case len(keys) == 3:
+		return keys[1:3], true
+	case len(keys) == 1 && len(data) >= 2:
+		return data[0:2], true
+	}
+	return nil, false
+}
@@ -0,0 +1,73 @@
+package contract
+
+import (
+	"junoplugin/utils"
+	"reflect"
+	"testing"
+)
+
+func TestERC20Decoder(t *testing.T) {
+	transfer, approval := utils.Keccak256("Transfer"), utils.Keccak256("Approval")
+	tests := []struct {
+		name     string
+		keys     []string
+		data     []string
+		expected string
+		payload  string
+		parties  []string
+	}{
+		{
+			name:     "transfer",
+			keys:     []string{transfer, "0xa", "0xb"},
+			data:     []string{"0x5", "0x0"},
+			expected: "Transfer",
+			payload:  `{"from":"0xa","to":"0xb","value":"5"}`,
+			parties:  []string{"0xa", "0xb"},
+		},
+		{
+			name:     "approval",
+			keys:     []string{approval, "0xa", "0xc"},
+			data:     []string{"0x0", "0x1"},
+			expected: "Approval",
+			payload:  `{"owner":"0xa","spender":"0xc","value":"340282366920938463463374607431768211456"}`,
+			parties:  []string{"0xa", "0xc"},
+		},
+		{
+			name:     "legacy transfer",
+			keys:     []string{transfer},
+			data:     []string{"0xa", "0xb", "0x5", "0x0"},
+			expected: "Transfer",
+			payload:  `{"from":"0xa","to":"0xb","value":"5"}`,
+			parties:  []string{"0xa", "0xb"},
+		},
+		{
+			name:    "other event",
+			keys:    []string{utils.Keccak256("OwnershipTransferred"), "0xa", "0xb"},
+			parties: []string{"0xa", "0xb"},
+		},
+		{
+			// Recognised, but without a payload or parties to match vaults against
+			name:     "malformed transfer",
+			keys:     []string{transfer, "0xa"},
+			expected: "Transfer",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, ok := erc20Decoder{}.DecodeEvent(tt.keys, tt.data)
+			if tt.expected == "" {
+				if ok {
+					t.Errorf("Expected no event, got %+v", decoded)
+				}
+			} else if !ok || decoded.Name != tt.expected || string(decoded.Payload) != tt.payload {
+				t.Errorf("Expected %s %s, got %+v", tt.expected, tt.payload, decoded)
+			}
+
+			parties, _ := erc20Parties(tt.keys, tt.data)
+			if !reflect.DeepEqual(parties, tt.parties) {
+				t.Errorf("Expected parties %v, got %v", tt.parties, parties)
+			}
+		})
+	}
+}
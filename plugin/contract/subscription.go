@@ -0,0 +1,126 @@
+package contract
+
+import (
+	"junoplugin/models"
+	"junoplugin/plugin/config"
+	"junoplugin/utils"
+	"strings"
+)
+
+// subscription is a config.Subscription compiled for matching
+type subscription struct {
+	name string
+	// event is the name the subscription's events are stored under, the selector when configured by one
+	event    string
+	selector string
+	// address is the emitting contract, empty for any
+	address string
+	keys    []matcher
+	data    []matcher
+}
+
+// matcher matches one felt. It matches any value when neither value nor vault is set.
+type matcher struct {
+	value string
+	vault bool
+}
+
+// subscriptionIndex holds the subscriptions in configuration order and by selector, so an event is
+// matched with one map lookup on its first key before any of its felts are compared
+type subscriptionIndex struct {
+	all        []*subscription
+	bySelector map[string][]*subscription
+}
+
+// newSubscriptionIndex compiles validated subscriptions
+func newSubscriptionIndex(configured []config.Subscription) *subscriptionIndex {
+	index := &subscriptionIndex{bySelector: make(map[string][]*subscription, len(configured))}
+	for _, c := range configured {
+		s := &subscription{name: c.Name, event: c.Event, selector: c.Event, address: c.Address}
+		if !strings.HasPrefix(c.Event, "0x") {
+			s.selector = utils.Keccak256(c.Event)
+		}
+		s.keys = compileMatchers(c.Keys)
+		s.data = compileMatchers(c.Data)
+		index.all = append(index.all, s)
+		index.bySelector[s.selector] = append(index.bySelector[s.selector], s)
+	}
+	return index
+}
+
+func compileMatchers(patterns []string) []matcher {
+	matchers := make([]matcher, len(patterns))
+	for i, pattern := range patterns {
+		switch pattern {
+		case config.MatchAny:
+		case config.MatchVault:
+			matchers[i].vault = true
+		default:
+			matchers[i].value = pattern
+		}
+	}
+	return matchers
+}
+
+// match reports whether an event matches the subscription, isVault telling tracked vaults apart.
+// vault is the value the first $vault matcher matched, empty without one.
+func (s *subscription) match(address string, keys, data []string, isVault func(string) bool) (vault string, ok bool) {
+	if s.address != "" && s.address != address {
+		return "", false
+	}
+	if len(keys) == 0 || keys[0] != s.selector {
+		return "", false
+	}
+	for _, in := range []struct {
+		matchers []matcher
+		values   []string
+	}{{s.keys, keys[1:]}, {s.data, data}} {
+		if len(in.values) < len(in.matchers) {
+			return "", false
+		}
+		for i, m := range in.matchers {
+			value := in.values[i]
+			switch {
+			case m.vault:
+				if !isVault(value) {
+					return "", false
+				}
+				if vault == "" {
+					vault = value
+				}
+			case m.value != "" && m.value != value:
+				return "", false
+			}
+		}
+	}
+	return vault, true
+}
+
+// contractEvent returns an emitted event as stored for the subscription, vault being the tracked
+// vault it matched
+func (s *subscription) contractEvent(emitted models.ContractEvent, vault string) *models.ContractEvent {
+	emitted.Kind, emitted.EventName = models.ContractKindSubscription, s.event
+	emitted.Subscription, emitted.VaultAddress = s.name, vault
+	return &emitted
+}
+
+// vaultKeyFilter returns the getEvents key filter of the subscription's events whose first $vault
+// matcher matches vault, and false when that matcher is not among its keys. Later $vault matchers
+// and data matchers cannot be filtered on by the node and are checked on the events returned.
+func (s *subscription) vaultKeyFilter(vault string) ([][]string, bool) {
+	filter := make([][]string, 0, len(s.keys)+1)
+	filter = append(filter, []string{s.selector})
+	keyed := false
+	for _, m := range s.keys {
+		switch {
+		case m.vault && !keyed:
+			filter = append(filter, []string{vault})
+			keyed = true
+		case m.value != "":
+			filter = append(filter, []string{m.value})
+		default:
+			filter = append(filter, []string{})
+		}
+	}
+	return filter, keyed
+}
@@ -0,0 +1,122 @@
+package contract
+
+import (
+	"junoplugin/plugin/config"
+	"junoplugin/utils"
+	"reflect"
+	"testing"
+)
+
+func TestSubscriptionMatch(t *testing.T) {
+	transfer := utils.Keccak256("Transfer")
+	index := newSubscriptionIndex([]config.Subscription{
+		{Name: "vault_transfers_in", Address: "0x49d", Event: "Transfer", Keys: []string{"*", "$vault"}},
+		{Name: "any_transfer_from_a", Event: "Transfer", Keys: []string{"0xa"}},
+		{Name: "selector", Event: "0x123", Data: []string{"$vault"}},
+	})
+	isVault := func(address string) bool { return address == "0xbeef" }
+
+	tests := []struct {
+		name     string
+		address  string
+		keys     []string
+		data     []string
+		expected map[string]string
+	}{
+		{
+			name:     "transfer to a vault",
+			address:  "0x49d",
+			keys:     []string{transfer, "0xa", "0xbeef"},
+			data:     []string{"0x5", "0x0"},
+			expected: map[string]string{"vault_transfers_in": "0xbeef", "any_transfer_from_a": ""},
+		},
+		{
+			name:     "transfer to another address",
+			address:  "0x49d",
+			keys:     []string{transfer, "0xb", "0xc"},
+			expected: map[string]string{},
+		},
+		{
+			name:     "transfer of another token",
+			address:  "0x4718",
+			keys:     []string{transfer, "0xa", "0xbeef"},
+			expected: map[string]string{"any_transfer_from_a": ""},
+		},
+		{
+			name:     "too few keys",
+			address:  "0x49d",
+			keys:     []string{transfer, "0xa"},
+			expected: map[string]string{"any_transfer_from_a": ""},
+		},
+		{
+			name:     "vault in data",
+			address:  "0x1",
+			keys:     []string{"0x123"},
+			data:     []string{"0xbeef"},
+			expected: map[string]string{"selector": "0xbeef"},
+		},
+		{
+			name:     "no data",
+			address:  "0x1",
+			keys:     []string{"0x123"},
+			expected: map[string]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched := make(map[string]string)
+			for _, s := range index.bySelector[tt.keys[0]] {
+				if vault, ok := s.match(tt.address, tt.keys, tt.data, isVault); ok {
+					matched[s.name] = vault
+				}
+			}
+			if !reflect.DeepEqual(matched, tt.expected) {
+				t.Errorf("Expected matches %v, got %v", tt.expected, matched)
+			}
+		})
+	}
+}
+
+func TestSubscriptionVaultKeyFilter(t *testing.T) {
+	transfer := utils.Keccak256("Transfer")
+	index := newSubscriptionIndex([]config.Subscription{
+		{Name: "vault_transfers_in", Address: "0x49d", Event: "Transfer", Keys: []string{"*", "$vault"}},
+		{Name: "between_vaults", Event: "Transfer", Keys: []string{"$vault", "$vault"}},
+		{Name: "by_data", Event: "Transfer", Keys: []string{"0xa"}, Data: []string{"$vault"}},
+	})
+
+	tests := []struct {
+		name     string
+		filter   [][]string
+		expected bool
+	}{
+		{
+			name:     "vault_transfers_in",
+			filter:   [][]string{{transfer}, {}, {"0xbeef"}},
+			expected: true,
+		},
+		{
+			name:     "between_vaults",
+			filter:   [][]string{{transfer}, {"0xbeef"}, {}},
+			expected: true,
+		},
+		{
+			name:     "by_data",
+			filter:   [][]string{{transfer}, {"0xa"}},
+			expected: false,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, ok := index.all[i].vaultKeyFilter("0xbeef")
+			if ok != tt.expected {
+				t.Errorf("Expected keyed %v, got %v", tt.expected, ok)
+			}
+			if !reflect.DeepEqual(filter, tt.filter) {
+				t.Errorf("Expected filter %v, got %v", tt.filter, filter)
+			}
+		})
+	}
+}
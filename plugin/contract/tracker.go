@@ -0,0 +1,270 @@
+// Package contract indexes the events of tracked contracts other than vaults, such as the ERC-20
+// tokens vaults hold and the Fossil oracle that settles their rounds, and the events of any contract
+// matched by a configured subscription.
+package contract
+
+import (
+	"context"
+	"fmt"
+	"junoplugin/abi"
+	"junoplugin/db"
+	"junoplugin/logging"
+	"junoplugin/models"
+	"junoplugin/network"
+	"junoplugin/plugin/config"
+	"junoplugin/utils"
+	"log/slog"
+	"sync"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+// Vaults reports which addresses are tracked vaults, it is implemented by vault.Manager
+type Vaults interface {
+	// IsVaultAddress reports whether the events of a vault are indexed live
+	IsVaultAddress(address string) bool
+	// IsTrackedVault reports whether a vault is tracked, including vaults still catching up
+	IsTrackedVault(address string) bool
+}
+
+// trackedContract is a tracked contract with the decoder of its events
+type trackedContract struct {
+	models.TrackedContract
+	decoder abi.EventDecoder
+}
+
+// Tracker indexes the events of tracked contracts. Contracts come from the tracked_contracts table
+// and configuration and are indexed live from their start block on, earlier blocks are not
+// backfilled. ERC-20 events are kept when a tracked vault is one of their parties, oracle events
+// are all kept.
+type Tracker struct {
+	db         *db.DB
+	network    *network.Network
+	vaults     Vaults
+	configured []config.TrackedContract
+	contracts  map[string]*trackedContract
+	// subscriptions match events by selector and key and data patterns, whatever their emitter
+	subscriptions *subscriptionIndex
+	mu            sync.RWMutex
+	log           *slog.Logger
+}
+
+// NewTracker creates a tracker of the configured contracts and subscriptions, Load adds the
+// tracked_contracts table's contracts
+func NewTracker(db *db.DB, network *network.Network, vaults Vaults, configured []config.TrackedContract, subscriptions []config.Subscription, logger *slog.Logger) *Tracker {
+	return &Tracker{
+		db:            db,
+		network:       network,
+		vaults:        vaults,
+		configured:    configured,
+		contracts:     make(map[string]*trackedContract),
+		subscriptions: newSubscriptionIndex(subscriptions),
+		log:           logging.Component(logger, "contract"),
+	}
+}
+
+// Load reads the tracked contracts and builds their decoders. A contract in both the table and
+// configuration is tracked as configured.
+func (t *Tracker) Load(ctx context.Context) error {
+	stored, err := t.db.GetTrackedContracts()
+	if err != nil {
+		return fmt.Errorf("failed to get tracked contracts: %w", err)
+	}
+	byAddress := make(map[string]models.TrackedContract, len(stored)+len(t.configured))
+	for _, contract := range stored {
+		byAddress[contract.Address] = *contract
+	}
+	for _, contract := range t.configured {
+		byAddress[contract.Address] = models.TrackedContract{
+			Address:    contract.Address,
+			Kind:       models.ContractKind(contract.Kind),
+			StartBlock: contract.StartBlock,
+			ABI:        contract.ABI,
+		}
+	}
+
+	contracts := make(map[string]*trackedContract, len(byAddress))
+	for address, contract := range byAddress {
+		decoder, err := t.decoderFor(ctx, &contract)
+		if err != nil {
+			return err
+		}
+		contracts[address] = &trackedContract{TrackedContract: contract, decoder: decoder}
+		t.log.Info("Tracking contract", "kind", contract.Kind, "address", address, "start_block", contract.StartBlock)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.contracts = contracts
+	return nil
+}
+
+// decoderFor builds the decoder of a contract's events: its ABI file when one is set, the standard
+// ERC-20 events for tokens and otherwise the ABI of the contract's class on the node
+func (t *Tracker) decoderFor(ctx context.Context, contract *models.TrackedContract) (abi.EventDecoder, error) {
+	switch {
+	case contract.ABI != "":
+		registry, err := abi.LoadFile(contract.ABI)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load ABI of contract %s: %w", contract.Address, err)
+		}
+		return registry, nil
+	case contract.Kind == models.ContractKindERC20:
+		return erc20Decoder{}, nil
+	case contract.Kind == models.ContractKindOracle:
+		classABI, err := t.network.ContractABI(ctx, contract.Address)
+		if err != nil {
+			return nil, err
+		}
+		registry, err := abi.Parse(classABI)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ABI of contract %s: %w", contract.Address, err)
+		}
+		return registry, nil
+	}
+	return nil, fmt.Errorf("unknown kind %q of contract %s", contract.Kind, contract.Address)
+}
+
+// Kind returns the kind of a tracked contract, vaults indexed live included
+func (t *Tracker) Kind(address string) (models.ContractKind, bool) {
+	if t.vaults.IsVaultAddress(address) {
+		return models.ContractKindVault, true
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	contract, ok := t.contracts[address]
+	if !ok {
+		return "", false
+	}
+	return contract.Kind, true
+}
+
+// ProcessEvent stores an event of a tracked contract other than a vault, and a copy per subscription
+// it matches, within the block processor's transaction. Events before the contract's start block
+// and ERC-20 events without a tracked vault among their parties are skipped. Subscriptions are
+// looked up by the event's selector first, so events no subscription selects cost one map lookup.
+func (t *Tracker) ProcessEvent(txHash string, event *core.Event, blockNumber uint64, blockHash felt.Felt) error {
+	address := event.From.String()
+	t.mu.RLock()
+	contract, tracked := t.contracts[address]
+	t.mu.RUnlock()
+	tracked = tracked && blockNumber >= contract.StartBlock
+	var subscriptions []*subscription
+	if len(t.subscriptions.all) > 0 && len(event.Keys) > 0 {
+		subscriptions = t.subscriptions.bySelector[event.Keys[0].String()]
+	}
+	if !tracked && len(subscriptions) == 0 {
+		return nil
+	}
+
+	keys, data := utils.EventToStringArrays(*event)
+	emitted := models.ContractEvent{
+		ContractAddress: address,
+		BlockNumber:     blockNumber,
+		BlockHash:       utils.FeltToHexString(blockHash.Bytes()),
+		TransactionHash: txHash,
+		EventKeys:       keys,
+		EventData:       data,
+	}
+	if tracked {
+		if err := t.storeContractEvent(contract, emitted); err != nil {
+			return err
+		}
+	}
+	for _, s := range subscriptions {
+		vault, ok := s.match(address, keys, data, t.vaults.IsTrackedVault)
+		if !ok {
+			continue
+		}
+		if err := t.db.StoreContractEvent(s.contractEvent(emitted, vault)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeContractEvent decodes and stores an event of a tracked contract
+func (t *Tracker) storeContractEvent(contract *trackedContract, event models.ContractEvent) error {
+	if contract.Kind == models.ContractKindERC20 && !t.involvesVault(event.EventKeys, event.EventData) {
+		return nil
+	}
+	event.Kind, event.EventName = contract.Kind, abi.UnknownEvent
+	if decoded, ok := contract.decoder.DecodeEvent(event.EventKeys, event.EventData); ok {
+		event.EventName, event.DecodedData = decoded.Name, decoded.Payload
+		if decoded.Err != nil {
+			t.log.Warn("Stored contract event without payload", "address", event.ContractAddress, logging.BlockNumber(event.BlockNumber), "error", decoded.Err)
+		}
+	} else if contract.Kind == models.ContractKindERC20 {
+		// Tokens emit more than transfers and approvals, only those are indexed
+		return nil
+	}
+	return t.db.StoreContractEvent(&event)
+}
+
+// VaultEvents fetches the events in [fromBlock, toBlock] whose first $vault key matcher matches a
+// vault, for the subscriptions with one. It returns the names of those subscriptions with their
+// events, so the caller can replace what live indexing stored for them. Subscriptions matching
+// vaults by data only are not backfilled, the node cannot filter on data.
+func (t *Tracker) VaultEvents(ctx context.Context, vaultAddress string, fromBlock, toBlock uint64) ([]string, []*models.ContractEvent, error) {
+	var names []string
+	var events []*models.ContractEvent
+	isVault := func(address string) bool {
+		return address == vaultAddress || t.vaults.IsTrackedVault(address)
+	}
+	for _, s := range t.subscriptions.all {
+		filter, ok := s.vaultKeyFilter(vaultAddress)
+		if !ok {
+			continue
+		}
+		names = append(names, s.name)
+		chunk, err := t.network.GetEventsByKeys(ctx, fromBlock, toBlock, s.address, filter)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get events of subscription %s: %w", s.name, err)
+		}
+		for _, emitted := range chunk.Events {
+			address := emitted.FromAddress.String()
+			keys, data := utils.FeltArrayToStringArrays(emitted.Keys), utils.FeltArrayToStringArrays(emitted.Data)
+			vault, ok := s.match(address, keys, data, isVault)
+			if !ok || vault != vaultAddress {
+				continue
+			}
+			events = append(events, s.contractEvent(models.ContractEvent{
+				ContractAddress: address,
+				BlockNumber:     emitted.BlockNumber,
+				BlockHash:       utils.FeltToHexString(emitted.BlockHash.Bytes()),
+				TransactionHash: emitted.TransactionHash.String(),
+				EventKeys:       keys,
+				EventData:       data,
+			}, vault))
+		}
+	}
+	return names, events, nil
+}
+
+// involvesVault reports whether a tracked vault is a party of an ERC-20 event
+func (t *Tracker) involvesVault(keys, data []string) bool {
+	parties, ok := erc20Parties(keys, data)
+	if !ok {
+		return false
+	}
+	for _, party := range parties {
+		if t.vaults.IsTrackedVault(party) {
+			return true
+		}
+	}
+	return false
+}
+
+// RevertEvents deletes the tracked contract events of a reverted block within the block processor's
+// transaction
+func (t *Tracker) RevertEvents(blockNumber uint64, blockHash string) error {
+	deleted, err := t.db.RevertContractEvents(blockNumber, blockHash)
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		t.log.Info("Reverted tracked contract events", "count", deleted, logging.BlockNumber(blockNumber), logging.BlockHash(blockHash))
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package core
+
+import (
+	"context"
+	"junoplugin/plugin/health"
+)
+
+// Status returns a snapshot of the plugin for the health endpoints
+func (pc *PluginCore) Status() health.Status {
+	state := pc.SyncState()
+	status := health.Status{
+		SyncState: state.String(),
+		Synced:    state == SyncStateReady,
+	}
+	if lastBlock := pc.blockProcessor.GetLastBlock(); lastBlock != nil {
+		status.LastBlock = &health.Block{
+			Number:    lastBlock.BlockNumber,
+			Hash:      lastBlock.BlockHash,
+			Timestamp: lastBlock.Timestamp,
+		}
+	}
+	for _, vault := range pc.vaultManager.TrackedVaults() {
+		status.Vaults = append(status.Vaults, health.Vault{
+			Address:          vault.Address,
+			Paused:           vault.Paused,
+			LastBlockIndexed: vault.LastBlockIndexed,
+			CatchingUp:       vault.CatchingUp,
+			CatchupBlock:     vault.CatchupBlock,
+			CatchupTarget:    vault.CatchupTarget,
+		})
+	}
+	return status
+}
+
+// PingDatabase checks that the database pool can serve a connection
+func (pc *PluginCore) PingDatabase(ctx context.Context) error {
+	return pc.db.Pool.Ping(ctx)
+}
+
+// RPCBlockNumber returns the latest block of the RPC node
+func (pc *PluginCore) RPCBlockNumber(ctx context.Context) (uint64, error) {
+	return pc.network.BlockNumber(ctx)
+}
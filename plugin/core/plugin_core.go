@@ -1,14 +1,22 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"junoplugin/db"
+	"junoplugin/logging"
 	"junoplugin/models"
 	"junoplugin/network"
 	"junoplugin/plugin/block"
+	"junoplugin/plugin/bus"
 	"junoplugin/plugin/config"
+	"junoplugin/plugin/contract"
 	"junoplugin/plugin/vault"
-	"log"
+	"junoplugin/tracing"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/NethermindEth/juno/core"
 	"github.com/NethermindEth/juno/core/felt"
@@ -21,9 +29,25 @@ type PluginCore struct {
 	db             *db.DB
 	network        *network.Network
 	vaultManager   *vault.Manager
+	contracts      *contract.Tracker
 	blockProcessor *block.Processor
-	log            *log.Logger
-	synced         bool
+	// bus publishes what is committed to in-process subscribers
+	bus *bus.Bus
+	// logger is the root logger components derive theirs from
+	logger *slog.Logger
+	log    *slog.Logger
+	// shutdownTracing flushes the spans still buffered
+	shutdownTracing func(context.Context) error
+
+	// mu guards the startup sync state and the blocks buffered until it is ready
+	mu      sync.Mutex
+	state   SyncState
+	pending []pendingBlock
+	// ready is closed once the state is SyncStateReady
+	ready   chan struct{}
+	syncing sync.WaitGroup
+	ctx     context.Context
+	cancel  context.CancelFunc
 }
 
 // NewPluginCore creates a new plugin core
@@ -39,12 +63,44 @@ func NewPluginCore() (*PluginCore, error) {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
+	// Components log to stderr like Juno, each tagged with its name
+	logger, err := logging.New(os.Stderr, cfg.LogLevel, cfg.LogFormat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid logging configuration: %w", err)
+	}
+
+	return NewPluginCoreFromConfig(cfg, logger)
+}
+
+// NewPluginCoreFromConfig creates a plugin core from a validated configuration, replays use it to
+// run against a throwaway database
+func NewPluginCoreFromConfig(cfg *config.Config, logger *slog.Logger) (_ *PluginCore, err error) {
 	// Initialize database
 	dbClient, err := db.Init(cfg.DatabaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
 
+	// What was started is released in reverse order if a later step fails
+	cleanups := []func(){dbClient.Shutdown}
+	defer func() {
+		if err != nil {
+			for i := len(cleanups) - 1; i >= 0; i-- {
+				cleanups[i]()
+			}
+		}
+	}()
+
+	// Bring the schema up to date before anything reads from it
+	if _, err := dbClient.Migrate(db.MigrateOptions{Mode: cfg.MigrationMode, Logger: logging.Component(logger, "db")}); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	// The outbox is only filled while a relay publishes it
+	if err := dbClient.SetOutboxEnabled(cfg.OutboxEnabled()); err != nil {
+		return nil, fmt.Errorf("failed to configure outbox: %w", err)
+	}
+
 	// Get last block from database
 	lastBlockDB, err := dbClient.GetLastBlock()
 	if err != nil {
@@ -52,31 +108,74 @@ func NewPluginCore() (*PluginCore, error) {
 	}
 
 	// Initialize network
-	networkClient, err := network.NewNetwork()
+	networkClient, err := network.NewNetwork(cfg.RPCURLs(), network.Options{
+		RateLimit:   cfg.RPCRateLimit,
+		MaxAttempts: cfg.RPCMaxAttempts,
+		Concurrency: cfg.RPCConcurrency,
+		BatchSize:   cfg.RPCBatchSize,
+		Logger:      logger,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize network: %w", err)
 	}
 
 	// Initialize vault manager
-	vaultManager := vault.NewManager(dbClient, networkClient, cfg.UDCAddress)
+	vaultManager := vault.NewManager(dbClient, networkClient, cfg.UDCAddress, cfg.VaultClassHashes, cfg.CatchupWindow, cfg.CatchupWorkers, cfg.FetchVaultABIs, logger)
+	cleanups = append(cleanups, vaultManager.Stop)
+	if err := vaultManager.RegisterDecoderVersions(cfg.VaultDecoders); err != nil {
+		return nil, fmt.Errorf("failed to register vault decoders: %w", err)
+	}
+
+	// Tracked contracts are loaded with the vault registry once the first block arrives
+	contracts := contract.NewTracker(dbClient, networkClient, vaultManager, cfg.TrackedContracts, cfg.Subscriptions, logger)
+	vaultManager.SetSubscriptionBackfill(contracts)
 
 	// Initialize block processor
 	blockProcessor := block.NewProcessor(
 		dbClient,
 		networkClient,
 		vaultManager,
+		contracts,
 		lastBlockDB,
 		cfg.Cursor,
+		cfg.CatchupWindow,
+		cfg.FinalityDepth,
+		cfg.TrackStorageDiffs,
+		logger,
 	)
 
+	// Components publish once their transactions commit
+	eventBus := bus.New(logger)
+	cleanups = append(cleanups, eventBus.Close)
+	vaultManager.SetBus(eventBus)
+	blockProcessor.SetBus(eventBus)
 
+	// Spans are exported from here on, Shutdown flushes them
+	shutdownTracing, err := tracing.Setup(tracing.Options{
+		Exporter:    cfg.TraceExporter,
+		Endpoint:    cfg.TraceEndpoint,
+		File:        cfg.TraceFile,
+		SampleRatio: cfg.TraceSampleRatio,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up tracing: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	return &PluginCore{
-		config:         cfg,
-		db:             dbClient,
-		network:        networkClient,
-		vaultManager:   vaultManager,
-		blockProcessor: blockProcessor,
-		log:            log.Default(),
+		config:          cfg,
+		db:              dbClient,
+		network:         networkClient,
+		vaultManager:    vaultManager,
+		contracts:       contracts,
+		blockProcessor:  blockProcessor,
+		bus:             eventBus,
+		logger:          logger,
+		log:             logging.Component(logger, "core"),
+		shutdownTracing: shutdownTracing,
+		ready:           make(chan struct{}),
+		ctx:             ctx,
+		cancel:          cancel,
 	}, nil
 }
 
@@ -87,28 +186,22 @@ func (pc *PluginCore) Initialize() error {
 
 // Shutdown shuts down the plugin
 func (pc *PluginCore) Shutdown() error {
-	pc.log.Println("Shutting down plugin core")
+	pc.log.Info("Shutting down plugin core")
+	pc.cancel()
+	pc.syncing.Wait()
+	pc.vaultManager.Stop()
+	pc.bus.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+	defer cancel()
+	if err := pc.shutdownTracing(ctx); err != nil {
+		pc.log.Error("Failed to flush spans", "error", err)
+	}
 	pc.db.Shutdown()
 	return nil
 }
 
-func (pc *PluginCore) CheckAndSync(block *models.StarknetBlocks) error {
-
-	if pc.synced == true {
-		return nil
-	}
-
-	log.Printf("Syncing vaults")
-	if err := pc.vaultManager.LoadVaultsFromRegistry(block); err != nil {
-		return fmt.Errorf("failed to initialize vaults: %w", err)
-	}
-
-	pc.log.Println("Plugin core initialized successfully")
-
-	//Only set this to true if no failures
-	pc.synced = true
-	return nil
-}
+// tracingShutdownTimeout bounds how long Shutdown waits for buffered spans to be exported
+const tracingShutdownTimeout = 5 * time.Second
 
 // NewBlock processes a new block
 func (pc *PluginCore) NewBlock(
@@ -117,10 +210,14 @@ func (pc *PluginCore) NewBlock(
 	newClasses map[felt.Felt]core.Class,
 ) error {
 	starknetBlock := models.CoreToStarknetBlock(*block)
-	if err := pc.CheckAndSync(&starknetBlock); err != nil {
-		return err
-	}
-	return pc.blockProcessor.ProcessNewBlock(block, stateUpdate, newClasses)
+	return pc.handleBlock(pendingBlock{
+		block:       &starknetBlock,
+		span:        "core.NewBlock",
+		description: fmt.Sprintf("processing block %d", block.Number),
+		apply: func(ctx context.Context) error {
+			return pc.blockProcessor.ProcessNewBlock(ctx, block, stateUpdate, newClasses)
+		},
+	})
 }
 
 // RevertBlock reverts a block
@@ -131,10 +228,24 @@ func (pc *PluginCore) RevertBlock(
 ) error {
 
 	starknetBlock := models.CoreToStarknetBlock(*from.Block)
-	if err := pc.CheckAndSync(&starknetBlock); err != nil {
-		return err
-	}
-	return pc.blockProcessor.RevertBlock(from, to, reverseStateDiff)
+	return pc.handleBlock(pendingBlock{
+		block:       &starknetBlock,
+		span:        "core.RevertBlock",
+		description: fmt.Sprintf("reverting block %d", from.Block.Number),
+		apply: func(ctx context.Context) error {
+			return pc.blockProcessor.RevertBlock(ctx, from, to, reverseStateDiff)
+		},
+	})
+}
+
+// ReindexVault rebuilds a vault's indexed data from its deployment block without stopping live indexing
+func (pc *PluginCore) ReindexVault(address string) error {
+	return pc.vaultManager.ReindexVault(pc.ctx, address, pc.blockProcessor)
+}
+
+// ReindexAllVaults rebuilds the indexed data of every registered vault
+func (pc *PluginCore) ReindexAllVaults() error {
+	return pc.vaultManager.ReindexAllVaults(pc.ctx, pc.blockProcessor)
 }
 
 // GetVaultManager returns the vault manager
@@ -142,6 +253,21 @@ func (pc *PluginCore) GetVaultManager() *vault.Manager {
 	return pc.vaultManager
 }
 
+// GetBus returns the bus committed vault events, blocks, reverts and catchups are published on
+func (pc *PluginCore) GetBus() *bus.Bus {
+	return pc.bus
+}
+
+// GetConfig returns the validated configuration
+func (pc *PluginCore) GetConfig() *config.Config {
+	return pc.config
+}
+
+// GetLogger returns the logger components derive theirs from
+func (pc *PluginCore) GetLogger() *slog.Logger {
+	return pc.logger
+}
+
 // GetDB returns the database instance
 func (pc *PluginCore) GetDB() *db.DB {
 	return pc.db
@@ -0,0 +1,169 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"junoplugin/logging"
+	"junoplugin/metrics"
+	"junoplugin/models"
+	"junoplugin/tracing"
+	"time"
+)
+
+// SyncState is the startup phase of the plugin
+type SyncState int32
+
+const (
+	// SyncStatePending is the state before the first block, nothing has been loaded yet
+	SyncStatePending SyncState = iota
+	// SyncStateSyncing is the state while the vault registry loads, blocks are buffered meanwhile
+	SyncStateSyncing
+	// SyncStateReady is the state once buffered blocks are applied and blocks are processed as they arrive
+	SyncStateReady
+)
+
+func (s SyncState) String() string {
+	switch s {
+	case SyncStatePending:
+		return "pending"
+	case SyncStateSyncing:
+		return "syncing"
+	case SyncStateReady:
+		return "ready"
+	}
+	return fmt.Sprintf("SyncState(%d)", int32(s))
+}
+
+// maxPendingBlocks bounds the blocks buffered during startup sync. Once reached, Juno's block calls
+// wait for the sync to finish rather than growing the buffer.
+const maxPendingBlocks = 1024
+
+// Retry delays of a failed startup sync or buffered block, doubling up to maxSyncRetryDelay
+const (
+	syncRetryDelay    = 5 * time.Second
+	maxSyncRetryDelay = time.Minute
+)
+
+// pendingBlock is a NewBlock or RevertBlock call, buffered when received before the plugin was ready
+type pendingBlock struct {
+	block *models.StarknetBlocks
+	// span names the span the call is traced in
+	span        string
+	description string
+	apply       func(ctx context.Context) error
+}
+
+// run applies the call in its span, started when the call is applied rather than when it was buffered
+func (p pendingBlock) run(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, p.span, tracing.BlockNumber(p.block.BlockNumber), tracing.BlockHash(p.block.BlockHash))
+	defer func() { tracing.End(span, err) }()
+	return p.apply(ctx)
+}
+
+// SyncState returns the plugin's startup phase
+func (pc *PluginCore) SyncState() SyncState {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.state
+}
+
+// Ready reports whether startup sync has completed and blocks are processed as they arrive
+func (pc *PluginCore) Ready() bool {
+	return pc.SyncState() == SyncStateReady
+}
+
+// handleBlock applies a block call once the plugin is ready. Before that the call is buffered and
+// the first one starts the startup sync with its block as the chain head, so Juno never waits on it.
+func (pc *PluginCore) handleBlock(pending pendingBlock) error {
+	pc.mu.Lock()
+	if pc.state == SyncStateReady {
+		pc.mu.Unlock()
+		return pending.run(pc.ctx)
+	}
+	if pc.state == SyncStatePending {
+		pc.state = SyncStateSyncing
+		pc.syncing.Add(1)
+		go pc.sync(pending.block)
+	}
+	if len(pc.pending) >= maxPendingBlocks {
+		pc.mu.Unlock()
+		pc.log.Warn("Block buffer full during startup sync, waiting for it to finish", "buffered", maxPendingBlocks)
+		select {
+		case <-pc.ready:
+		case <-pc.ctx.Done():
+			return fmt.Errorf("plugin shut down before startup sync finished")
+		}
+		return pending.run(pc.ctx)
+	}
+	pc.pending = append(pc.pending, pending)
+	metrics.SyncPendingBlocks.Set(float64(len(pc.pending)))
+	pc.mu.Unlock()
+	return nil
+}
+
+// sync stores the blocks missed since the last run, loads the tracked contracts and the vault
+// registry and then applies the buffered blocks in order, retrying failures until it succeeds or
+// the plugin shuts down
+func (pc *PluginCore) sync(head *models.StarknetBlocks) {
+	defer pc.syncing.Done()
+	pc.log.Info("Syncing vaults", logging.BlockNumber(head.BlockNumber), logging.BlockHash(head.BlockHash))
+	ctx, span := tracing.Start(pc.ctx, "core.Sync", tracing.BlockNumber(head.BlockNumber), tracing.BlockHash(head.BlockHash))
+	err := pc.retry("startup sync", func() error {
+		// Blocks up to the head's parent, so the first buffered block extends the stored chain
+		if err := pc.blockProcessor.CatchupBlocks(ctx, head.BlockNumber); err != nil {
+			return err
+		}
+		if err := pc.contracts.Load(ctx); err != nil {
+			return err
+		}
+		return pc.vaultManager.LoadVaultsFromRegistry(head, pc.blockProcessor)
+	})
+	tracing.End(span, err)
+	if err != nil {
+		return
+	}
+
+	for {
+		pc.mu.Lock()
+		if len(pc.pending) == 0 {
+			pc.state = SyncStateReady
+			pc.pending = nil
+			close(pc.ready)
+			pc.mu.Unlock()
+			break
+		}
+		next := pc.pending[0]
+		pc.mu.Unlock()
+
+		if err := pc.retry(next.description, func() error { return next.run(pc.ctx) }); err != nil {
+			return
+		}
+
+		pc.mu.Lock()
+		pc.pending = pc.pending[1:]
+		metrics.SyncPendingBlocks.Set(float64(len(pc.pending)))
+		pc.mu.Unlock()
+	}
+
+	metrics.Ready.Set(1)
+	pc.log.Info("Plugin core initialized successfully")
+}
+
+// retry runs fn until it succeeds, waiting a growing delay after each failure. It only fails when
+// the plugin shuts down first.
+func (pc *PluginCore) retry(description string, fn func() error) error {
+	delay := syncRetryDelay
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		pc.log.Error("Failed, retrying", "operation", description, "retry_in", delay, "error", err)
+		select {
+		case <-pc.ctx.Done():
+			return pc.ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxSyncRetryDelay)
+	}
+}
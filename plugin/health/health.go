@@ -0,0 +1,262 @@
+// Package health serves the plugin's liveness and readiness endpoints for orchestrators such as
+// Kubernetes and Compose. Both answer 200 when their checks pass and 503 otherwise, with a JSON
+// report of every check, the sync state, the last processed block and the tracked vaults.
+//
+// /healthz checks what a restart can fix: the database pool and the vault registry listener.
+// /readyz also requires startup sync to have completed, the RPC node to answer and, when a maximum
+// is configured, the last processed block to be recent. Vaults still catching up do not make the
+// plugin unready, they are reported with their progress.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"junoplugin/logging"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check names
+const (
+	CheckDatabase = "database"
+	CheckListener = "listener"
+	CheckRPC      = "rpc"
+	CheckSynced   = "synced"
+	CheckBlockAge = "block_age"
+)
+
+// Report statuses
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// checkTimeout bounds the database and RPC checks of a request
+const checkTimeout = 2 * time.Second
+
+// Indexer reports the plugin's state, it is implemented by core.PluginCore
+type Indexer interface {
+	// Status returns a snapshot of the sync state, the last processed block and the tracked vaults
+	Status() Status
+	// PingDatabase checks that the database pool can serve a connection
+	PingDatabase(ctx context.Context) error
+	// RPCBlockNumber returns the latest block of the RPC node
+	RPCBlockNumber(ctx context.Context) (uint64, error)
+}
+
+// Listener reports whether the vault registry listener receives notifications, it is implemented
+// by listener.Service
+type Listener interface {
+	Connected() bool
+}
+
+// Status is a snapshot of the plugin's indexing state
+type Status struct {
+	SyncState string
+	Synced    bool
+	// LastBlock is the last processed block, nil before the first
+	LastBlock *Block
+	Vaults    []Vault
+}
+
+// Block is a processed block
+type Block struct {
+	Number    uint64 `json:"number"`
+	Hash      string `json:"hash"`
+	Timestamp uint64 `json:"timestamp"`
+	// AgeSeconds is the time since the block's timestamp, set in reports
+	AgeSeconds int64 `json:"age_seconds"`
+}
+
+// Vault is the indexing state of a tracked vault
+type Vault struct {
+	Address          string  `json:"address"`
+	Paused           bool    `json:"paused"`
+	LastBlockIndexed *string `json:"last_block_indexed"`
+	// CatchingUp is set until the vault's startup catchup hands over to live indexing
+	CatchingUp    bool   `json:"catching_up"`
+	CatchupBlock  uint64 `json:"catchup_block,omitempty"`
+	CatchupTarget uint64 `json:"catchup_target,omitempty"`
+}
+
+// Check is the outcome of one check
+type Check struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the body of both endpoints
+type Report struct {
+	Status    string           `json:"status"`
+	Checks    map[string]Check `json:"checks"`
+	SyncState string           `json:"sync_state"`
+	Synced    bool             `json:"synced"`
+	LastBlock *Block           `json:"last_block"`
+	// RPCBlockNumber is the RPC node's latest block, reported by /readyz when the node answers
+	RPCBlockNumber *uint64 `json:"rpc_block_number,omitempty"`
+	Vaults         []Vault `json:"vaults"`
+}
+
+// Server serves /healthz and /readyz
+type Server struct {
+	indexer  Indexer
+	listener Listener
+	// maxBlockAge is the age of the last processed block past which the plugin is not ready, 0 disables the check
+	maxBlockAge time.Duration
+	server      *http.Server
+	log         *slog.Logger
+	now         func() time.Time
+}
+
+// NewServer creates a server of the endpoints on addr
+func NewServer(addr string, indexer Indexer, listener Listener, maxBlockAge time.Duration, logger *slog.Logger) *Server {
+	s := &Server{
+		indexer:     indexer,
+		listener:    listener,
+		maxBlockAge: maxBlockAge,
+		log:         logging.Component(logger, "health"),
+		now:         time.Now,
+	}
+	s.server = &http.Server{Addr: addr, Handler: s.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	return s
+}
+
+// Handler returns the handler of the endpoints
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		s.respond(w, s.Report(r.Context(), false))
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		s.respond(w, s.Report(r.Context(), true))
+	})
+	return mux
+}
+
+// Start listens on the server's address and serves in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.server.Addr, err)
+	}
+	s.log.Info("Serving health endpoints", "address", listener.Addr().String())
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Error("Health server stopped", "error", err)
+		}
+	}()
+	return nil
+}
+
+// Stop shuts the server down, waiting briefly for requests in flight
+func (s *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), checkTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.log.Error("Failed to shut down health server", "error", err)
+	}
+}
+
+// Report runs the liveness checks, and the readiness checks as well when ready is set
+func (s *Server) Report(ctx context.Context, ready bool) Report {
+	status := s.indexer.Status()
+	report := Report{
+		Status:    StatusOK,
+		Checks:    make(map[string]Check),
+		SyncState: status.SyncState,
+		Synced:    status.Synced,
+		LastBlock: status.LastBlock,
+		Vaults:    status.Vaults,
+	}
+	if report.Vaults == nil {
+		report.Vaults = []Vault{}
+	}
+	if report.LastBlock != nil {
+		lastBlock := *report.LastBlock
+		lastBlock.AgeSeconds = int64(s.now().Sub(time.Unix(int64(lastBlock.Timestamp), 0)).Seconds())
+		report.LastBlock = &lastBlock
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	var dbErr, rpcErr error
+	var rpcBlockNumber uint64
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		dbErr = s.indexer.PingDatabase(ctx)
+	}()
+	if ready {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rpcBlockNumber, rpcErr = s.indexer.RPCBlockNumber(ctx)
+		}()
+	}
+	wg.Wait()
+
+	report.set(CheckDatabase, dbErr)
+	var listenerErr error
+	if !s.listener.Connected() {
+		listenerErr = errors.New("not listening for vault registry notifications")
+	}
+	report.set(CheckListener, listenerErr)
+	if !ready {
+		return report
+	}
+
+	report.set(CheckRPC, rpcErr)
+	if rpcErr == nil {
+		report.RPCBlockNumber = &rpcBlockNumber
+	}
+	var syncErr error
+	if !status.Synced {
+		syncErr = fmt.Errorf("startup sync is %s", status.SyncState)
+	}
+	report.set(CheckSynced, syncErr)
+	report.set(CheckBlockAge, s.checkBlockAge(report.LastBlock))
+	return report
+}
+
+// checkBlockAge fails when the last processed block is older than maxBlockAge
+func (s *Server) checkBlockAge(lastBlock *Block) error {
+	if s.maxBlockAge <= 0 {
+		return nil
+	}
+	if lastBlock == nil {
+		return errors.New("no block processed yet")
+	}
+	if age := time.Duration(lastBlock.AgeSeconds) * time.Second; age > s.maxBlockAge {
+		return fmt.Errorf("last block %d is %v old, over %v", lastBlock.Number, age, s.maxBlockAge)
+	}
+	return nil
+}
+
+// set records a check's outcome, a failed check making the report unavailable
+func (r *Report) set(name string, err error) {
+	if err != nil {
+		r.Checks[name] = Check{Error: err.Error()}
+		r.Status = StatusUnavailable
+		return
+	}
+	r.Checks[name] = Check{OK: true}
+}
+
+func (s *Server) respond(w http.ResponseWriter, report Report) {
+	code := http.StatusOK
+	if report.Status != StatusOK {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		s.log.Debug("Failed to write health report", "error", err)
+	}
+}
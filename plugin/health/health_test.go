@@ -0,0 +1,180 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeIndexer is an Indexer with fixed answers
+type fakeIndexer struct {
+	status Status
+	dbErr  error
+	rpcErr error
+}
+
+func (f *fakeIndexer) Status() Status {
+	return f.status
+}
+
+func (f *fakeIndexer) PingDatabase(ctx context.Context) error {
+	return f.dbErr
+}
+
+func (f *fakeIndexer) RPCBlockNumber(ctx context.Context) (uint64, error) {
+	if f.rpcErr != nil {
+		return 0, f.rpcErr
+	}
+	return 120, nil
+}
+
+type fakeListener bool
+
+func (f fakeListener) Connected() bool {
+	return bool(f)
+}
+
+func TestEndpoints(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	synced := Status{
+		SyncState: "ready",
+		Synced:    true,
+		LastBlock: &Block{Number: 100, Hash: "0xa", Timestamp: uint64(now.Add(-30 * time.Second).Unix())},
+		Vaults:    []Vault{{Address: "0xbeef", CatchingUp: true, CatchupBlock: 50, CatchupTarget: 99}},
+	}
+	syncing := synced
+	syncing.SyncState, syncing.Synced = "syncing", false
+	stale := synced
+	stale.LastBlock = &Block{Number: 100, Timestamp: uint64(now.Add(-time.Hour).Unix())}
+
+	tests := []struct {
+		name            string
+		indexer         *fakeIndexer
+		listening       bool
+		expectedHealthz int
+		expectedReadyz  int
+		failed          []string
+	}{
+		{
+			name:            "synced",
+			indexer:         &fakeIndexer{status: synced},
+			listening:       true,
+			expectedHealthz: http.StatusOK,
+			expectedReadyz:  http.StatusOK,
+		},
+		{
+			name:            "database down",
+			indexer:         &fakeIndexer{status: synced, dbErr: errors.New("connection refused")},
+			listening:       true,
+			expectedHealthz: http.StatusServiceUnavailable,
+			expectedReadyz:  http.StatusServiceUnavailable,
+			failed:          []string{CheckDatabase},
+		},
+		{
+			name:            "listener dead",
+			indexer:         &fakeIndexer{status: synced},
+			expectedHealthz: http.StatusServiceUnavailable,
+			expectedReadyz:  http.StatusServiceUnavailable,
+			failed:          []string{CheckListener},
+		},
+		{
+			name:            "still syncing",
+			indexer:         &fakeIndexer{status: syncing},
+			listening:       true,
+			expectedHealthz: http.StatusOK,
+			expectedReadyz:  http.StatusServiceUnavailable,
+			failed:          []string{CheckSynced},
+		},
+		{
+			name:            "rpc unreachable",
+			indexer:         &fakeIndexer{status: synced, rpcErr: errors.New("timeout")},
+			listening:       true,
+			expectedHealthz: http.StatusOK,
+			expectedReadyz:  http.StatusServiceUnavailable,
+			failed:          []string{CheckRPC},
+		},
+		{
+			name:            "stale block",
+			indexer:         &fakeIndexer{status: stale},
+			listening:       true,
+			expectedHealthz: http.StatusOK,
+			expectedReadyz:  http.StatusServiceUnavailable,
+			failed:          []string{CheckBlockAge},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(":0", tt.indexer, fakeListener(tt.listening), 10*time.Minute, slog.New(slog.DiscardHandler))
+			s.now = func() time.Time { return now }
+			server := httptest.NewServer(s.Handler())
+			defer server.Close()
+
+			for path, expected := range map[string]int{"/healthz": tt.expectedHealthz, "/readyz": tt.expectedReadyz} {
+				response, err := http.Get(server.URL + path)
+				if err != nil {
+					t.Fatalf("Failed to get %s: %v", path, err)
+				}
+				var report Report
+				err = json.NewDecoder(response.Body).Decode(&report)
+				response.Body.Close()
+				if err != nil {
+					t.Fatalf("Failed to decode %s report: %v", path, err)
+				}
+				if response.StatusCode != expected {
+					t.Errorf("Expected %s to answer %d, got %d: %+v", path, expected, response.StatusCode, report)
+				}
+				for _, name := range tt.failed {
+					if check, ok := report.Checks[name]; ok && (check.OK || check.Error == "") {
+						t.Errorf("Expected %s check %s to fail, got %+v", path, name, check)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	indexer := &fakeIndexer{status: Status{
+		SyncState: "ready",
+		Synced:    true,
+		LastBlock: &Block{Number: 100, Hash: "0xa", Timestamp: uint64(now.Add(-30 * time.Second).Unix())},
+	}}
+	s := NewServer(":0", indexer, fakeListener(true), 0, slog.New(slog.DiscardHandler))
+	s.now = func() time.Time { return now }
+
+	live := s.Report(context.Background(), false)
+	if _, ok := live.Checks[CheckRPC]; ok {
+		t.Errorf("Expected liveness to skip the RPC check, got %+v", live.Checks)
+	}
+	if live.LastBlock.AgeSeconds != 30 {
+		t.Errorf("Expected a block age of 30s, got %d", live.LastBlock.AgeSeconds)
+	}
+	if indexer.status.LastBlock.AgeSeconds != 0 {
+		t.Errorf("Expected the indexer's status to be left as is")
+	}
+
+	ready := s.Report(context.Background(), true)
+	if ready.RPCBlockNumber == nil || *ready.RPCBlockNumber != 120 {
+		t.Errorf("Expected RPC block 120, got %v", ready.RPCBlockNumber)
+	}
+	if len(ready.Checks) != 5 || ready.Status != StatusOK {
+		t.Errorf("Expected 5 passing checks, got %s %+v", ready.Status, ready.Checks)
+	}
+	if ready.Vaults == nil {
+		t.Errorf("Expected an empty vault list rather than null")
+	}
+
+	// Without a processed block only a configured maximum age fails
+	indexer.status.LastBlock = nil
+	s.maxBlockAge = time.Minute
+	if report := s.Report(context.Background(), true); report.Checks[CheckBlockAge].OK {
+		t.Errorf("Expected the block age check to fail without a block, got %+v", report.Checks)
+	}
+}
@@ -3,37 +3,79 @@ package listener
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"junoplugin/logging"
 	"junoplugin/models"
 	"junoplugin/plugin/vault"
-	"log"
-	"os"
+	"log/slog"
+	"sync/atomic"
 
 	"github.com/jackc/pgx/v5"
 )
 
-// Service handles listening for new vault registrations
+// Registry notification channels, see the vault_registry triggers in db/migrations
+const (
+	channelVaultInsert = "vault_insert"
+	channelVaultUpdate = "vault_update"
+	channelVaultDelete = "vault_delete"
+	// channelVaultReindex carries a vault address, or ReindexAll, sent by pitchlakectl vault reindex
+	channelVaultReindex = "vault_reindex"
+)
+
+// ReindexAll is the vault_reindex payload requesting a reindex of every vault
+const ReindexAll = "*"
+
+// Reindexer rebuilds vaults on request, implemented by core.PluginCore
+type Reindexer interface {
+	ReindexVault(address string) error
+	ReindexAllVaults() error
+}
+
+// registryNotification is a vault_registry row as serialized by row_to_json
+type registryNotification struct {
+	Channel            string  `json:"-"`
+	Address            string  `json:"vault_address"`
+	DeployedAt         string  `json:"deployed_at"`
+	LastBlockIndexed   *string `json:"last_block_indexed"`
+	LastBlockProcessed *string `json:"last_block_processed"`
+	Paused             bool    `json:"paused"`
+}
+
+func (n *registryNotification) toVaultRegistry() models.VaultRegistry {
+	return models.VaultRegistry{
+		Address:            n.Address,
+		DeployedAt:         n.DeployedAt,
+		LastBlockIndexed:   n.LastBlockIndexed,
+		LastBlockProcessed: n.LastBlockProcessed,
+		Paused:             n.Paused,
+	}
+}
+
+// Service handles listening for vault registry changes
 type Service struct {
 	conn         *pgx.Conn
 	vaultManager *vault.Manager
-	channel      chan models.VaultRegistry
-	log          *log.Logger
-	ctx          context.Context
-	cancel       context.CancelFunc
+	reindexer    Reindexer
+	channel      chan registryNotification
+	// listening is set while the connection is listening on the registry channels
+	listening atomic.Bool
+	log       *slog.Logger
+	ctx       context.Context
+	cancel    context.CancelFunc
 }
 
 // NewService creates a new listener service
-func NewListenerService(vaultManager *vault.Manager) *Service {
+func NewListenerService(dbURL string, vaultManager *vault.Manager, reindexer Reindexer, logger *slog.Logger) *Service {
+	log := logging.Component(logger, "listener")
 	ctx, cancel := context.WithCancel(context.Background())
-	dbUrl := os.Getenv("DB_URL")
-	conn, err := pgx.Connect(ctx, dbUrl)
+	conn, err := pgx.Connect(ctx, dbURL)
 	if err != nil {
-		fmt.Errorf("unable to connect to database: %w", err)
+		log.Error("Unable to connect to database", "error", err)
 	}
 	return &Service{
 		vaultManager: vaultManager,
-		channel:      make(chan models.VaultRegistry),
-		log:          log.Default(),
+		reindexer:    reindexer,
+		channel:      make(chan registryNotification),
+		log:          log,
 		ctx:          ctx,
 		cancel:       cancel,
 		conn:         conn,
@@ -42,7 +84,7 @@ func NewListenerService(vaultManager *vault.Manager) *Service {
 
 // Start starts the listener service
 func (ls *Service) Start() error {
-	ls.log.Println("Starting vault registry listener")
+	ls.log.Info("Starting vault registry listener")
 	if ls.conn == nil {
 		return nil
 	}
@@ -52,59 +94,113 @@ func (ls *Service) Start() error {
 	return nil
 }
 
-// listen listens for new vault registrations
+// listen listens for vault registry notifications
 func (ls *Service) listen() {
-	ls.log.Println("Starting to listen for vault notifications...")
+	ls.log.Debug("Listening for vault notifications")
 
 	// Start the database listener in a goroutine
-	go ls.ListenerNewVault(ls.channel)
+	go ls.ListenerRegistry(ls.channel)
 
-	var err error
 	for {
 		select {
 		case <-ls.ctx.Done():
-			ls.log.Println("Listener context cancelled, shutting down")
+			ls.log.Info("Listener context cancelled, shutting down")
+			return
+		case notification := <-ls.channel:
+			ls.handleNotification(notification)
+		}
+	}
+}
+
+// handleNotification applies a registry change to the vault manager
+func (ls *Service) handleNotification(notification registryNotification) {
+	switch notification.Channel {
+	case channelVaultInsert:
+		ls.log.Info("Received new vault registration", logging.VaultAddress(notification.Address))
+		vault := notification.toVaultRegistry()
+		if err := ls.vaultManager.InitializeVault(ls.ctx, &vault); err != nil {
+			ls.log.Error("Failed to initialize vault", logging.VaultAddress(vault.Address), "error", err)
 			return
-		case vault := <-ls.channel:
-			ls.log.Printf("Received new vault registration: %s", vault.Address)
-			if err = ls.vaultManager.InitializeVault(&vault); err != nil {
-				ls.log.Printf("Error initializing vault %s: %v", vault.Address, err)
-				return
-			} else {
-				ls.log.Printf("Successfully initialized vault: %s", vault.Address)
-			}
 		}
+		ls.log.Info("Initialized vault", logging.VaultAddress(vault.Address))
+	case channelVaultUpdate:
+		ls.log.Info("Vault pause state changed", logging.VaultAddress(notification.Address), "paused", notification.Paused)
+		ls.vaultManager.SetVaultPaused(notification.Address, notification.Paused)
+	case channelVaultDelete:
+		ls.log.Info("Vault removed from registry", logging.VaultAddress(notification.Address))
+		ls.vaultManager.RemoveVault(notification.Address)
+	case channelVaultReindex:
+		// Reindexing replays the vault from its deployment block, keep it off the notification loop
+		go ls.reindex(notification.Address)
 	}
 }
 
+// reindex runs a reindex requested over vault_reindex
+func (ls *Service) reindex(address string) {
+	ls.log.Info("Received reindex request", logging.VaultAddress(address))
+	var err error
+	if address == ReindexAll {
+		err = ls.reindexer.ReindexAllVaults()
+	} else {
+		err = ls.reindexer.ReindexVault(address)
+	}
+	if err != nil {
+		ls.log.Error("Failed to reindex", logging.VaultAddress(address), "error", err)
+		return
+	}
+	ls.log.Info("Reindexed", logging.VaultAddress(address))
+}
+
+// Connected reports whether the listener is connected and listening for registry notifications. It
+// does not reconnect, a listener that lost its connection stays disconnected.
+func (ls *Service) Connected() bool {
+	return ls.listening.Load()
+}
+
 // Stop stops the listener service
 func (ls *Service) Stop() {
-	ls.log.Println("Stopping vault registry listener")
+	ls.log.Info("Stopping vault registry listener")
 	ls.cancel() // This will signal the context to cancel
-	close(ls.channel)
 }
 
-func (ls *Service) ListenerNewVault(channel chan<- models.VaultRegistry) {
-	_, err := ls.conn.Exec(context.Background(), "LISTEN vault_insert")
-	if err != nil {
-		log.Printf("Failed to start listening: %v", err)
-		return
+func (ls *Service) ListenerRegistry(channel chan<- registryNotification) {
+	for _, name := range []string{channelVaultInsert, channelVaultUpdate, channelVaultDelete, channelVaultReindex} {
+		if _, err := ls.conn.Exec(ls.ctx, "LISTEN "+name); err != nil {
+			ls.log.Error("Failed to start listening", "channel", name, "error", err)
+			return
+		}
 	}
+	ls.listening.Store(true)
+	defer ls.listening.Store(false)
 
 	for {
-		notification, err := ls.conn.WaitForNotification(context.Background())
+		notification, err := ls.conn.WaitForNotification(ls.ctx)
 		if err != nil {
-			log.Printf("Error waiting for notification: %v", err)
+			if ls.ctx.Err() != nil {
+				return
+			}
+			if ls.conn.IsClosed() {
+				ls.log.Error("Lost listener connection", "error", err)
+				return
+			}
+			ls.log.Error("Failed to wait for notification", "error", err)
 			continue
 		}
 
-		var vault models.VaultRegistry
-		if err := json.Unmarshal([]byte(notification.Payload), &vault); err != nil {
-			log.Printf("Error unmarshaling vault data: %v", err)
+		var payload registryNotification
+		if notification.Channel == channelVaultReindex {
+			payload.Address = notification.Payload
+		} else if err := json.Unmarshal([]byte(notification.Payload), &payload); err != nil {
+			ls.log.Error("Failed to unmarshal vault notification", "channel", notification.Channel, "error", err)
 			continue
 		}
+		payload.Channel = notification.Channel
 
-		log.Printf("Received vault notification: %s", vault.Address)
-		channel <- vault
+		ls.log.Debug("Received vault notification", "channel", payload.Channel, logging.VaultAddress(payload.Address))
+		select {
+		case channel <- payload:
+		case <-ls.ctx.Done():
+			return
+		}
 	}
 }
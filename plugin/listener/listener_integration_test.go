@@ -0,0 +1,150 @@
+//go:build integration
+
+package listener
+
+import (
+	"context"
+	"junoplugin/db"
+	"junoplugin/db/dbtest"
+	"junoplugin/models"
+	"junoplugin/network/networktest"
+	"junoplugin/plugin/vault"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testUDC   = "0x4a"
+	testVault = "0xbeef"
+)
+
+// fakeReindexer records the reindex requests it receives
+type fakeReindexer struct {
+	mu        sync.Mutex
+	addresses []string
+}
+
+func (r *fakeReindexer) ReindexVault(address string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.addresses = append(r.addresses, address)
+	return nil
+}
+
+func (r *fakeReindexer) ReindexAllVaults() error {
+	return r.ReindexVault(ReindexAll)
+}
+
+func (r *fakeReindexer) requested(address string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, requested := range r.addresses {
+		if requested == address {
+			return true
+		}
+	}
+	return false
+}
+
+// eventually waits up to 5 seconds for condition to hold
+func eventually(t *testing.T, description string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting until %s", description)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// inTx runs fn in a transaction of dbClient
+func inTx(t *testing.T, dbClient *db.DB, fn func() error) {
+	t.Helper()
+	dbClient.BeginTx(context.Background())
+	if err := fn(); err != nil {
+		dbClient.RollbackTx()
+		t.Fatalf("Failed to update vault registry: %v", err)
+	}
+	dbClient.CommitTx()
+}
+
+func TestListenerRegistryNotifications(t *testing.T) {
+	dbClient, dbURL := dbtest.New(t)
+	node := networktest.NewServer(t, 20)
+	node.AddEvents(networktest.ContractDeployed(testUDC, testVault, "0xc1", 5))
+	node.SetClass(testVault, 5, "0xc1")
+	logger := slog.New(slog.DiscardHandler)
+
+	vm := vault.NewManager(dbClient, node.Network(t), testUDC, nil, 4, 1, false, logger)
+	t.Cleanup(vm.Stop)
+	reindexer := &fakeReindexer{}
+	service := NewListenerService(dbURL, vm, reindexer, logger)
+	if err := service.Start(); err != nil {
+		t.Fatalf("Failed to start listener: %v", err)
+	}
+	t.Cleanup(service.Stop)
+	eventually(t, "the listener is connected", service.Connected)
+
+	// A registered vault is initialized from its deployment block and tracked
+	inTx(t, dbClient, func() error {
+		return dbClient.InsertVault(&models.VaultRegistry{Address: testVault, DeployedAt: networktest.BlockHash(5)})
+	})
+	eventually(t, "the registered vault is tracked", func() bool { return vm.IsTrackedVault(testVault) })
+	registered, err := dbClient.GetVaultRegistryByAddress(testVault)
+	if err != nil {
+		t.Fatalf("Failed to get vault: %v", err)
+	}
+	if registered.LastBlockIndexed == nil || *registered.LastBlockIndexed != networktest.BlockHash(5) {
+		t.Errorf("Expected the vault to be indexed up to its deployment block, got %v", registered.LastBlockIndexed)
+	}
+	var deployments int
+	if err := dbClient.Pool.QueryRow(context.Background(),
+		"SELECT count(*) FROM events WHERE vault_address = $1 AND event_name = 'ContractDeployed'", testVault).Scan(&deployments); err != nil {
+		t.Fatalf("Failed to query events: %v", err)
+	}
+	if deployments != 1 {
+		t.Errorf("Expected the deployment event to be stored, got %d", deployments)
+	}
+
+	// Pausing and resuming reach the vault manager
+	inTx(t, dbClient, func() error {
+		_, err := dbClient.SetVaultPaused(testVault, true)
+		return err
+	})
+	eventually(t, "the vault is paused", func() bool { return !vm.IsTrackedVault(testVault) })
+	inTx(t, dbClient, func() error {
+		_, err := dbClient.SetVaultPaused(testVault, false)
+		return err
+	})
+	eventually(t, "the vault is resumed", func() bool { return vm.IsTrackedVault(testVault) })
+
+	// Reindex requests are handed to the reindexer
+	if _, err := dbClient.Pool.Exec(context.Background(), "SELECT pg_notify('vault_reindex', $1)", testVault); err != nil {
+		t.Fatalf("Failed to request reindex: %v", err)
+	}
+	if _, err := dbClient.Pool.Exec(context.Background(), "SELECT pg_notify('vault_reindex', $1)", ReindexAll); err != nil {
+		t.Fatalf("Failed to request reindex: %v", err)
+	}
+	eventually(t, "the vault reindex is requested", func() bool { return reindexer.requested(testVault) })
+	eventually(t, "the full reindex is requested", func() bool { return reindexer.requested(ReindexAll) })
+
+	// A removed vault is no longer tracked
+	inTx(t, dbClient, func() error {
+		_, err := dbClient.DeleteVault(testVault, false)
+		return err
+	})
+	eventually(t, "the removed vault is untracked", func() bool {
+		for _, tracked := range vm.TrackedVaults() {
+			if tracked.Address == testVault {
+				return false
+			}
+		}
+		return true
+	})
+
+	service.Stop()
+	eventually(t, "the listener is disconnected", func() bool { return !service.Connected() })
+}
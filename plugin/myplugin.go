@@ -1,9 +1,14 @@
 package main
 
 import (
+	"junoplugin/logging"
 	pluginCore "junoplugin/plugin/core"
+	"junoplugin/plugin/health"
 	"junoplugin/plugin/listener"
-	"log"
+	"junoplugin/plugin/outbox"
+	"junoplugin/plugin/replay"
+	"junoplugin/plugin/webhook"
+	"log/slog"
 
 	"github.com/NethermindEth/juno/core"
 	"github.com/NethermindEth/juno/core/felt"
@@ -16,7 +21,15 @@ import (
 type pitchlakePlugin struct {
 	core     *pluginCore.PluginCore
 	listener *listener.Service
-	log      *log.Logger
+	// health serves /healthz and /readyz when a health address is configured
+	health *health.Server
+	// outbox publishes committed events to the configured sink
+	outbox *outbox.Relay
+	// webhooks sends committed vault events to the webhook subscriptions when enabled
+	webhooks *webhook.Dispatcher
+	// recorder records the block calls for replay when a record file is configured
+	recorder *replay.Recorder
+	log      *slog.Logger
 }
 
 // Important: "JunoPluginInstance" needs to be exported for Juno to load the plugin correctly
@@ -27,8 +40,9 @@ var _ junoplugin.JunoPlugin = (*pitchlakePlugin)(nil)
 
 // Init initializes the plugin
 func (p *pitchlakePlugin) Init() error {
-	p.log = log.Default()
-	p.log.Println("Initializing Pitchlake Plugin")
+	// The configured logger only exists once the plugin core has read the configuration
+	p.log = logging.Component(nil, "plugin")
+	p.log.Info("Initializing Pitchlake Plugin")
 
 	// Initialize the plugin core
 	pluginCoreInstance, err := pluginCore.NewPluginCore()
@@ -36,35 +50,94 @@ func (p *pitchlakePlugin) Init() error {
 		return err
 	}
 	p.core = pluginCoreInstance
+	p.log = logging.Component(p.core.GetLogger(), "plugin")
 
 	// Initialize the plugin
 	if err := p.core.Initialize(); err != nil {
 		return err
 	}
 
+	// Record block calls before they are processed, so failing ones can be replayed
+	if cfg := p.core.GetConfig(); cfg.RecordFile != "" {
+		p.recorder, err = replay.NewRecorder(cfg.RecordFile, cfg.Network)
+		if err != nil {
+			return err
+		}
+		p.log.Info("Recording block calls", "path", cfg.RecordFile)
+	}
+
+	// Send webhooks before the listener starts catching up vaults, so their events are sent too
+	if cfg := p.core.GetConfig(); cfg.Webhooks {
+		dispatcher := webhook.NewDispatcher(p.core.GetDB(), p.core.GetBus(), webhook.Options{
+			MaxAttempts: cfg.WebhookMaxAttempts,
+			Timeout:     cfg.WebhookTimeout,
+		}, p.core.GetLogger())
+		if err := dispatcher.Start(); err != nil {
+			return err
+		}
+		p.webhooks = dispatcher
+	}
+
 	// Start the vault registry listener
-	p.listener = listener.NewListenerService(p.core.GetVaultManager())
+	p.listener = listener.NewListenerService(p.core.GetConfig().DatabaseURL, p.core.GetVaultManager(), p.core, p.core.GetLogger())
 	if err := p.listener.Start(); err != nil {
 		return err
 	}
 
-	p.log.Println("Pitchlake Plugin initialized successfully")
+	// Serve the health endpoints
+	if cfg := p.core.GetConfig(); cfg.HealthAddr != "" {
+		p.health = health.NewServer(cfg.HealthAddr, p.core, p.listener, cfg.HealthMaxBlockAge, p.core.GetLogger())
+		if err := p.health.Start(); err != nil {
+			return err
+		}
+	}
+
+	// Publish the outbox
+	if cfg := p.core.GetConfig(); cfg.OutboxEnabled() {
+		sink, err := outbox.NewSink(cfg)
+		if err != nil {
+			return err
+		}
+		p.outbox = outbox.NewRelay(p.core.GetDB(), sink, outbox.Options{BatchSize: cfg.OutboxBatchSize}, p.core.GetLogger())
+		p.outbox.Start()
+	}
+
+	p.log.Info("Pitchlake Plugin initialized successfully")
 	return nil
 }
 
 // Shutdown shuts down the plugin
 func (p *pitchlakePlugin) Shutdown() error {
-	p.log.Println("Shutting down Pitchlake Plugin")
+	p.log.Info("Shutting down Pitchlake Plugin")
+
+	if p.health != nil {
+		p.health.Stop()
+	}
 
 	if p.listener != nil {
 		p.listener.Stop()
 	}
 
+	if p.outbox != nil {
+		p.outbox.Stop()
+	}
+
+	if p.webhooks != nil {
+		p.webhooks.Stop()
+	}
+
+	var err error
 	if p.core != nil {
-		return p.core.Shutdown()
+		err = p.core.Shutdown()
 	}
 
-	return nil
+	if p.recorder != nil {
+		if closeErr := p.recorder.Close(); closeErr != nil {
+			p.log.Error("Failed to close recording", "error", closeErr)
+		}
+	}
+
+	return err
 }
 
 // NewBlock processes a new block
@@ -73,6 +146,12 @@ func (p *pitchlakePlugin) NewBlock(
 	stateUpdate *core.StateUpdate,
 	newClasses map[felt.Felt]core.Class,
 ) error {
+	if p.recorder != nil {
+		// A recording failure must not stop indexing
+		if err := p.recorder.RecordNewBlock(block, stateUpdate); err != nil {
+			p.log.Error("Failed to record block", logging.BlockNumber(block.Number), "error", err)
+		}
+	}
 	return p.core.NewBlock(block, stateUpdate, newClasses)
 }
 
@@ -82,5 +161,10 @@ func (p *pitchlakePlugin) RevertBlock(
 	to *junoplugin.BlockAndStateUpdate,
 	reverseStateDiff *core.StateDiff,
 ) error {
+	if p.recorder != nil {
+		if err := p.recorder.RecordRevertBlock(from, to, reverseStateDiff); err != nil {
+			p.log.Error("Failed to record revert", logging.BlockNumber(from.Block.Number), "error", err)
+		}
+	}
 	return p.core.RevertBlock(from, to, reverseStateDiff)
 }
@@ -0,0 +1,75 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"junoplugin/models"
+	"strconv"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// KafkaSink produces each message to <topic>, keyed by vault address so the messages of a vault go to
+// the same partition in order. Keys are partitioned like the Java client does, with murmur2, and
+// the driver events without a vault all go to the partition of the empty key. Each record has the
+// headers kind and id.
+type KafkaSink struct {
+	client *kgo.Client
+}
+
+// NewKafkaSink creates a sink bootstrapping from brokers, as host:port. Brokers are connected to on
+// the first publish.
+func NewKafkaSink(brokers []string, topic string) (*KafkaSink, error) {
+	client, err := kgo.NewClient(
+		kgo.SeedBrokers(brokers...),
+		kgo.ClientID("pitchlake"),
+		kgo.DefaultProduceTopic(topic),
+		kgo.AllowAutoTopicCreation(),
+		// Every in-sync replica acknowledges a batch, so an accepted batch survives the leader
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka client: %w", err)
+	}
+	return &KafkaSink{client: client}, nil
+}
+
+// Publish produces messages and waits for every in-sync replica to acknowledge them
+func (s *KafkaSink) Publish(ctx context.Context, messages []*models.OutboxMessage) error {
+	records := make([]*kgo.Record, len(messages))
+	for i, message := range messages {
+		record, err := kafkaRecord(message)
+		if err != nil {
+			return err
+		}
+		records[i] = record
+	}
+	if err := s.client.ProduceSync(ctx, records...).FirstErr(); err != nil {
+		return fmt.Errorf("failed to publish to Kafka: %w", err)
+	}
+	return nil
+}
+
+// kafkaRecord returns the record of message for the default topic
+func kafkaRecord(message *models.OutboxMessage) (*kgo.Record, error) {
+	value, err := encode(message)
+	if err != nil {
+		return nil, err
+	}
+	return &kgo.Record{
+		// Not nil when empty, a nil key would spread the driver events over the partitions
+		Key:   []byte(message.VaultAddress),
+		Value: value,
+		Headers: []kgo.RecordHeader{
+			{Key: "kind", Value: []byte(message.Kind)},
+			{Key: "id", Value: []byte(strconv.FormatInt(message.ID, 10))},
+		},
+		Timestamp: message.CreatedAt,
+	}, nil
+}
+
+// Close closes the broker connections
+func (s *KafkaSink) Close() error {
+	s.client.Close()
+	return nil
+}
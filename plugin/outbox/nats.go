@@ -0,0 +1,131 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"junoplugin/models"
+	"net/url"
+	"strconv"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// NATSSink publishes each message on the subject <topic>.<kind>[.<vault address>]. Core NATS only
+// confirms the server received a message, with ?jetstream=true in the URL the sink waits for the
+// JetStream stream capturing the subjects to acknowledge storing each of them. JetStream messages
+// carry their id as Nats-Msg-Id, so the stream drops the duplicates of a batch published again.
+type NATSSink struct {
+	topic string
+	conn  *nats.Conn
+	// js is nil unless the URL selects JetStream
+	js jetstream.JetStream
+}
+
+// NewNATSSink creates a sink for the server at rawURL, nats://[user:password@|token@]host:port. The
+// connection is made in the background and remade whenever it drops.
+func NewNATSSink(rawURL, topic string) (*NATSSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse NATS URL: %w", err)
+	}
+	if u.Scheme != "nats" || u.Host == "" {
+		return nil, fmt.Errorf("invalid NATS URL %s", u.Redacted())
+	}
+	useJetStream := false
+	query := u.Query()
+	if value := query.Get("jetstream"); value != "" {
+		if useJetStream, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("invalid jetstream option %q of NATS URL", value)
+		}
+	}
+	query.Del("jetstream")
+	u.RawQuery = query.Encode()
+
+	conn, err := nats.Connect(u.String(), nats.Name("pitchlake"), nats.RetryOnFailedConnect(true), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	s := &NATSSink{topic: topic, conn: conn}
+	if useJetStream {
+		if s.js, err = jetstream.New(conn); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// Subject returns the subject message is published on
+func (s *NATSSink) Subject(message *models.OutboxMessage) string {
+	subject := s.topic + "." + message.Kind
+	if message.VaultAddress != "" {
+		subject += "." + message.VaultAddress
+	}
+	return subject
+}
+
+// Publish publishes messages and waits for the server, or JetStream, to confirm them
+func (s *NATSSink) Publish(ctx context.Context, messages []*models.OutboxMessage) error {
+	var err error
+	if s.js != nil {
+		err = s.publishJetStream(ctx, messages)
+	} else {
+		err = s.publish(ctx, messages)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to publish to NATS: %w", err)
+	}
+	return nil
+}
+
+func (s *NATSSink) publish(ctx context.Context, messages []*models.OutboxMessage) error {
+	for _, message := range messages {
+		msg, err := s.natsMsg(message)
+		if err != nil {
+			return err
+		}
+		if err := s.conn.PublishMsg(msg); err != nil {
+			return fmt.Errorf("message %d: %w", message.ID, err)
+		}
+	}
+	// The server answers the flush once it processed every message before it
+	return s.conn.FlushWithContext(ctx)
+}
+
+func (s *NATSSink) publishJetStream(ctx context.Context, messages []*models.OutboxMessage) error {
+	futures := make([]jetstream.PubAckFuture, len(messages))
+	for i, message := range messages {
+		msg, err := s.natsMsg(message)
+		if err != nil {
+			return err
+		}
+		if futures[i], err = s.js.PublishMsgAsync(msg, jetstream.WithMsgID(strconv.FormatInt(message.ID, 10))); err != nil {
+			return fmt.Errorf("message %d: %w", message.ID, err)
+		}
+	}
+	for i, future := range futures {
+		select {
+		case <-future.Ok():
+		case err := <-future.Err():
+			return fmt.Errorf("JetStream rejected message %d: %w", messages[i].ID, err)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (s *NATSSink) natsMsg(message *models.OutboxMessage) (*nats.Msg, error) {
+	data, err := encode(message)
+	if err != nil {
+		return nil, err
+	}
+	return &nats.Msg{Subject: s.Subject(message), Data: data}, nil
+}
+
+// Close closes the connection
+func (s *NATSSink) Close() error {
+	s.conn.Close()
+	return nil
+}
@@ -0,0 +1,85 @@
+// Package outboxtest provides an in-memory outbox sink, so the relay can be tested without running
+// NATS, Kafka or Redis.
+package outboxtest
+
+import (
+	"context"
+	"errors"
+	"junoplugin/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ErrInjected is the error of publishes failed on purpose
+var ErrInjected = errors.New("injected failure")
+
+// MemorySink is a Sink keeping the published messages in memory
+type MemorySink struct {
+	mu       sync.Mutex
+	messages []*models.OutboxMessage
+	failures int
+	closed   bool
+}
+
+// NewMemorySink creates an empty sink
+func NewMemorySink() *MemorySink {
+	return &MemorySink{}
+}
+
+// Publish keeps messages, unless a failure is pending
+func (s *MemorySink) Publish(ctx context.Context, messages []*models.OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return ErrInjected
+	}
+	s.messages = append(s.messages, messages...)
+	return nil
+}
+
+// FailNext makes the next n publishes fail with ErrInjected
+func (s *MemorySink) FailNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = n
+}
+
+// Messages returns the published messages in order
+func (s *MemorySink) Messages() []*models.OutboxMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*models.OutboxMessage(nil), s.messages...)
+}
+
+// Close marks the sink closed
+func (s *MemorySink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+// Closed reports whether Close was called
+func (s *MemorySink) Closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// WaitFor waits until the sink holds n messages, failing t after timeout
+func (s *MemorySink) WaitFor(t testing.TB, n int, timeout time.Duration) []*models.OutboxMessage {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		messages := s.Messages()
+		if len(messages) >= n {
+			return messages
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d published messages, got %d", n, len(messages))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
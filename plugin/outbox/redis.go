@@ -0,0 +1,93 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"junoplugin/models"
+	"net/url"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisSink appends each message to the stream <topic> with XADD, as the fields id, kind,
+// vault_address and message. Consumers read the stream with XREAD or a consumer group, which keeps
+// the order messages were published in. ?maxlen=N in the URL trims the stream to about N entries.
+type RedisSink struct {
+	client *redis.Client
+	stream string
+	maxLen int64
+}
+
+// NewRedisSink creates a sink for the server at rawURL, redis://[[user]:password@]host:port[/db][?maxlen=N]
+func NewRedisSink(rawURL, stream string) (*RedisSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+	}
+	if u.Scheme != "redis" || u.Host == "" {
+		return nil, fmt.Errorf("invalid Redis URL %s", u.Redacted())
+	}
+	s := &RedisSink{stream: stream}
+	query := u.Query()
+	if value := query.Get("maxlen"); value != "" {
+		if s.maxLen, err = strconv.ParseInt(value, 10, 64); err != nil || s.maxLen <= 0 {
+			return nil, fmt.Errorf("invalid maxlen option %q of Redis URL", value)
+		}
+	}
+	query.Del("maxlen")
+	u.RawQuery = query.Encode()
+
+	options, err := redis.ParseURL(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Redis URL: %w", err)
+	}
+	s.client = redis.NewClient(options)
+	return s, nil
+}
+
+// Publish appends messages to the stream in a single pipeline
+func (s *RedisSink) Publish(ctx context.Context, messages []*models.OutboxMessage) error {
+	pipe := s.client.Pipeline()
+	for _, message := range messages {
+		args, err := s.xAddArgs(message)
+		if err != nil {
+			return err
+		}
+		pipe.XAdd(ctx, args)
+	}
+	commands, err := pipe.Exec(ctx)
+	if err == nil {
+		return nil
+	}
+	for i, command := range commands {
+		if command.Err() != nil {
+			return fmt.Errorf("failed to publish to Redis: XADD of message %d: %w", messages[i].ID, command.Err())
+		}
+	}
+	return fmt.Errorf("failed to publish to Redis: %w", err)
+}
+
+// xAddArgs returns the XADD appending message to the stream
+func (s *RedisSink) xAddArgs(message *models.OutboxMessage) (*redis.XAddArgs, error) {
+	data, err := encode(message)
+	if err != nil {
+		return nil, err
+	}
+	return &redis.XAddArgs{
+		Stream: s.stream,
+		MaxLen: s.maxLen,
+		Approx: s.maxLen > 0,
+		Values: []any{
+			"id", strconv.FormatInt(message.ID, 10),
+			"kind", message.Kind,
+			"vault_address", message.VaultAddress,
+			"message", string(data),
+		},
+	}, nil
+}
+
+// Close closes the connection pool
+func (s *RedisSink) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,174 @@
+// Package outbox publishes the events and driver_events rows the plugin commits to a message broker.
+//
+// Triggers add every inserted row to the outbox table in the transaction that stores it, so only
+// committed rows are ever published. The relay reads the outbox in insertion order, hands a batch
+// to the configured Sink and deletes it once the sink has accepted it. A batch the sink fails or
+// the relay does not get to delete is published again: delivery is at least once and consumers
+// deduplicate by message id. The messages of a vault are published in the order they were stored,
+// the next batch is only read once the previous one is accepted.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"junoplugin/logging"
+	"junoplugin/metrics"
+	"junoplugin/models"
+	"junoplugin/plugin/config"
+	"log/slog"
+	"time"
+)
+
+// Sink publishes outbox messages to a broker
+type Sink interface {
+	// Publish publishes messages in order and returns once the broker has accepted all of them.
+	// When it fails any of them may have been published, the relay publishes them all again.
+	Publish(ctx context.Context, messages []*models.OutboxMessage) error
+	Close() error
+}
+
+// Store holds the outbox, it is implemented by db.DB
+type Store interface {
+	// GetPendingOutbox returns up to limit messages in insertion order
+	GetPendingOutbox(limit int) ([]*models.OutboxMessage, error)
+	// DeleteOutboxMessages removes published messages
+	DeleteOutboxMessages(ids []int64) error
+}
+
+// Relay defaults, see Options
+const (
+	DefaultPollInterval  = time.Second
+	DefaultRetryDelay    = time.Second
+	DefaultMaxRetryDelay = time.Minute
+	// publishTimeout bounds the publishing of a batch
+	publishTimeout = 30 * time.Second
+)
+
+// Options configures a relay, zero values select the defaults
+type Options struct {
+	// BatchSize is the number of messages published at a time
+	BatchSize int
+	// PollInterval is how long the relay waits for new messages once the outbox is empty
+	PollInterval time.Duration
+	// RetryDelay is the wait after a failed batch, doubling up to MaxRetryDelay while it keeps failing
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+}
+
+// Relay publishes the outbox to a sink in the background
+type Relay struct {
+	store   Store
+	sink    Sink
+	options Options
+	log     *slog.Logger
+	ctx     context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// NewRelay creates a relay publishing store's outbox to sink
+func NewRelay(store Store, sink Sink, options Options, logger *slog.Logger) *Relay {
+	if options.BatchSize <= 0 {
+		options.BatchSize = config.DefaultOutboxBatchSize
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = DefaultPollInterval
+	}
+	if options.RetryDelay <= 0 {
+		options.RetryDelay = DefaultRetryDelay
+	}
+	if options.MaxRetryDelay < options.RetryDelay {
+		options.MaxRetryDelay = max(DefaultMaxRetryDelay, options.RetryDelay)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Relay{
+		store:   store,
+		sink:    sink,
+		options: options,
+		log:     logging.Component(logger, "outbox"),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+}
+
+// Start publishes the outbox until Stop is called
+func (r *Relay) Start() {
+	r.log.Info("Starting outbox relay", "batch_size", r.options.BatchSize)
+	go r.run()
+}
+
+// Stop waits for the batch being published, then closes the sink
+func (r *Relay) Stop() {
+	r.cancel()
+	<-r.done
+	if err := r.sink.Close(); err != nil {
+		r.log.Error("Failed to close outbox sink", "error", err)
+	}
+}
+
+func (r *Relay) run() {
+	defer close(r.done)
+	retryDelay := r.options.RetryDelay
+	for {
+		published, err := r.publishBatch()
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if r.ctx.Err() != nil {
+				return
+			}
+			metrics.OutboxPublishFailures.Inc()
+			r.log.Error("Failed to publish outbox", "retry_in", retryDelay, "error", err)
+			wait = retryDelay
+			retryDelay = min(2*retryDelay, r.options.MaxRetryDelay)
+		case published == r.options.BatchSize:
+			// More messages are likely waiting
+			retryDelay = r.options.RetryDelay
+			if r.ctx.Err() != nil {
+				return
+			}
+			continue
+		default:
+			retryDelay = r.options.RetryDelay
+			wait = r.options.PollInterval
+		}
+
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// publishBatch publishes the oldest messages of the outbox and deletes them, returning how many
+func (r *Relay) publishBatch() (int, error) {
+	messages, err := r.store.GetPendingOutbox(r.options.BatchSize)
+	if err != nil || len(messages) == 0 {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(r.ctx, publishTimeout)
+	defer cancel()
+	if err := r.sink.Publish(ctx, messages); err != nil {
+		return 0, err
+	}
+
+	ids := make([]int64, len(messages))
+	for i, message := range messages {
+		ids[i] = message.ID
+	}
+	if err := r.store.DeleteOutboxMessages(ids); err != nil {
+		// The batch is published again, consumers see it twice
+		return 0, err
+	}
+	metrics.OutboxPublished.Add(float64(len(messages)))
+	r.log.Debug("Published outbox messages", "messages", len(messages), "first_id", ids[0], "last_id", ids[len(ids)-1])
+	return len(messages), nil
+}
+
+// encode is the JSON message sinks publish for an outbox message
+func encode(message *models.OutboxMessage) ([]byte, error) {
+	return json.Marshal(message)
+}
@@ -0,0 +1,113 @@
+//go:build integration
+
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"junoplugin/db"
+	"junoplugin/db/dbtest"
+	"junoplugin/models"
+	"junoplugin/plugin/outbox/outboxtest"
+	"testing"
+	"time"
+)
+
+func storeEvent(t *testing.T, dbClient *db.DB, vaultAddress, eventName string, blockNumber uint64) {
+	t.Helper()
+	err := dbClient.StoreEvent("0x1", vaultAddress, blockNumber, "0x1", eventName, []string{"0x2"}, []string{"0x3"}, nil)
+	if err != nil {
+		t.Fatalf("Failed to store event: %v", err)
+	}
+}
+
+func pendingOutbox(t *testing.T, dbClient *db.DB) int64 {
+	t.Helper()
+	count, err := dbClient.CountPendingOutbox()
+	if err != nil {
+		t.Fatalf("Failed to count outbox: %v", err)
+	}
+	return count
+}
+
+func TestRelayPublishesCommittedRows(t *testing.T) {
+	dbClient, _ := dbtest.New(t)
+	ctx := context.Background()
+
+	// The outbox is only filled once enabled
+	dbClient.BeginTx(ctx)
+	storeEvent(t, dbClient, "0xbeef", "Deposit", 1)
+	dbClient.CommitTx()
+	if count := pendingOutbox(t, dbClient); count != 0 {
+		t.Fatalf("Expected an empty outbox while disabled, got %d messages", count)
+	}
+	if err := dbClient.SetOutboxEnabled(true); err != nil {
+		t.Fatalf("Failed to enable outbox: %v", err)
+	}
+
+	// Rolled back rows never reach it
+	dbClient.BeginTx(ctx)
+	storeEvent(t, dbClient, "0xbeef", "Withdrawal", 2)
+	dbClient.RollbackTx()
+
+	dbClient.BeginTx(ctx)
+	if err := dbClient.StoreDriverEvent("StartBlock", "0x3"); err != nil {
+		t.Fatalf("Failed to store driver event: %v", err)
+	}
+	storeEvent(t, dbClient, "0xbeef", "Withdrawal", 3)
+	storeEvent(t, dbClient, "0xcafe", "Deposit", 3)
+	dbClient.CommitTx()
+	if count := pendingOutbox(t, dbClient); count != 3 {
+		t.Fatalf("Expected 3 messages in the outbox, got %d", count)
+	}
+
+	sink := outboxtest.NewMemorySink()
+	sink.FailNext(1)
+	relay := newTestRelay(dbClient, sink)
+	relay.Start()
+	messages := sink.WaitFor(t, 3, 5*time.Second)
+	relay.Stop()
+
+	expected := []struct {
+		kind         string
+		vaultAddress string
+		field        string
+		value        string
+	}{
+		{models.OutboxKindDriverEvent, "", "type", "StartBlock"},
+		{models.OutboxKindEvent, "0xbeef", "event_name", "Withdrawal"},
+		{models.OutboxKindEvent, "0xcafe", "event_name", "Deposit"},
+	}
+	if len(messages) != len(expected) {
+		t.Fatalf("Expected %d messages, got %d", len(expected), len(messages))
+	}
+	for i, message := range messages {
+		if message.Kind != expected[i].kind || message.VaultAddress != expected[i].vaultAddress {
+			t.Errorf("Expected a %s of vault %q, got a %s of vault %q", expected[i].kind, expected[i].vaultAddress, message.Kind, message.VaultAddress)
+		}
+		if i > 0 && message.ID <= messages[i-1].ID {
+			t.Errorf("Expected message %d after message %d", message.ID, messages[i-1].ID)
+		}
+		var row map[string]any
+		if err := json.Unmarshal(message.Payload, &row); err != nil {
+			t.Fatalf("Failed to decode payload %s: %v", message.Payload, err)
+		}
+		if row[expected[i].field] != expected[i].value {
+			t.Errorf("Expected %s %s in the payload, got %v", expected[i].field, expected[i].value, row[expected[i].field])
+		}
+	}
+	if count := pendingOutbox(t, dbClient); count != 0 {
+		t.Errorf("Expected the relay to empty the outbox, got %d messages", count)
+	}
+
+	// Disabling it stops filling it again
+	if err := dbClient.SetOutboxEnabled(false); err != nil {
+		t.Fatalf("Failed to disable outbox: %v", err)
+	}
+	dbClient.BeginTx(ctx)
+	storeEvent(t, dbClient, "0xcafe", "Withdrawal", 4)
+	dbClient.CommitTx()
+	if count := pendingOutbox(t, dbClient); count != 0 {
+		t.Errorf("Expected an empty outbox once disabled, got %d messages", count)
+	}
+}
@@ -0,0 +1,145 @@
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"junoplugin/models"
+	"junoplugin/plugin/outbox/outboxtest"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStore is an outbox in memory
+type fakeStore struct {
+	mu             sync.Mutex
+	messages       []*models.OutboxMessage
+	deleteFailures int
+}
+
+func (s *fakeStore) GetPendingOutbox(limit int) ([]*models.OutboxMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*models.OutboxMessage(nil), s.messages[:min(limit, len(s.messages))]...), nil
+}
+
+func (s *fakeStore) DeleteOutboxMessages(ids []int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.deleteFailures > 0 {
+		s.deleteFailures--
+		return errors.New("delete failed")
+	}
+	deleted := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		deleted[id] = true
+	}
+	pending := s.messages[:0]
+	for _, message := range s.messages {
+		if !deleted[message.ID] {
+			pending = append(pending, message)
+		}
+	}
+	s.messages = pending
+	return nil
+}
+
+func (s *fakeStore) pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.messages)
+}
+
+// testMessages returns n messages alternating between two vaults, with a driver event every third
+func testMessages(n int) []*models.OutboxMessage {
+	messages := make([]*models.OutboxMessage, n)
+	for i := range messages {
+		message := &models.OutboxMessage{
+			ID:        int64(i + 1),
+			Kind:      models.OutboxKindEvent,
+			Payload:   json.RawMessage(fmt.Sprintf(`{"block_number":%d}`, i+1)),
+			CreatedAt: time.UnixMilli(int64(1700000000000 + i)).UTC(),
+		}
+		switch i % 3 {
+		case 0:
+			message.VaultAddress = "0xbeef"
+		case 1:
+			message.VaultAddress = "0xcafe"
+		default:
+			message.Kind = models.OutboxKindDriverEvent
+		}
+		messages[i] = message
+	}
+	return messages
+}
+
+func newTestRelay(store Store, sink Sink) *Relay {
+	return NewRelay(store, sink, Options{
+		BatchSize:     2,
+		PollInterval:  5 * time.Millisecond,
+		RetryDelay:    time.Millisecond,
+		MaxRetryDelay: 5 * time.Millisecond,
+	}, slog.New(slog.DiscardHandler))
+}
+
+func expectIDs(t *testing.T, messages []*models.OutboxMessage, ids ...int64) {
+	t.Helper()
+	if len(messages) != len(ids) {
+		t.Fatalf("Expected %d messages, got %d", len(ids), len(messages))
+	}
+	for i, id := range ids {
+		if messages[i].ID != id {
+			t.Errorf("Expected message %d to be %d, got %d", i, id, messages[i].ID)
+		}
+	}
+}
+
+func TestRelayPublishesInOrder(t *testing.T) {
+	store := &fakeStore{messages: testMessages(5)}
+	sink := outboxtest.NewMemorySink()
+	relay := newTestRelay(store, sink)
+	relay.Start()
+
+	messages := sink.WaitFor(t, 5, time.Second)
+	relay.Stop()
+	expectIDs(t, messages, 1, 2, 3, 4, 5)
+	if store.pending() != 0 {
+		t.Errorf("Expected an empty outbox, got %d messages", store.pending())
+	}
+	if !sink.Closed() {
+		t.Error("Expected Stop to close the sink")
+	}
+}
+
+func TestRelayRetriesFailedBatches(t *testing.T) {
+	store := &fakeStore{messages: testMessages(3)}
+	sink := outboxtest.NewMemorySink()
+	sink.FailNext(3)
+	relay := newTestRelay(store, sink)
+	relay.Start()
+
+	messages := sink.WaitFor(t, 3, time.Second)
+	relay.Stop()
+	// Failed batches are not published, so each message is published once
+	expectIDs(t, messages, 1, 2, 3)
+	if store.pending() != 0 {
+		t.Errorf("Expected an empty outbox, got %d messages", store.pending())
+	}
+}
+
+func TestRelayRepublishesUndeletedBatches(t *testing.T) {
+	store := &fakeStore{messages: testMessages(3), deleteFailures: 1}
+	sink := outboxtest.NewMemorySink()
+	relay := newTestRelay(store, sink)
+	relay.Start()
+
+	messages := sink.WaitFor(t, 5, time.Second)
+	relay.Stop()
+	// The first batch is published again since the relay could not delete it
+	expectIDs(t, messages, 1, 2, 1, 2, 3)
+	if store.pending() != 0 {
+		t.Errorf("Expected an empty outbox, got %d messages", store.pending())
+	}
+}
@@ -0,0 +1,87 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"junoplugin/models"
+	"junoplugin/plugin/config"
+	"os"
+	"sync"
+)
+
+// NewSink creates the sink cfg selects, nil when the outbox is not published
+func NewSink(cfg *config.Config) (Sink, error) {
+	switch cfg.OutboxSink {
+	case "", config.OutboxSinkNone:
+		return nil, nil
+	case config.OutboxSinkNATS:
+		return NewNATSSink(cfg.OutboxURL, cfg.OutboxTopic)
+	case config.OutboxSinkRedis:
+		return NewRedisSink(cfg.OutboxURL, cfg.OutboxTopic)
+	case config.OutboxSinkKafka:
+		brokers, err := cfg.KafkaBrokers()
+		if err != nil {
+			return nil, err
+		}
+		return NewKafkaSink(brokers, cfg.OutboxTopic)
+	case config.OutboxSinkFile:
+		return NewFileSink(cfg.OutboxFile)
+	case config.OutboxSinkStdout:
+		return NewWriterSink(os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("unknown outbox sink %q", cfg.OutboxSink)
+	}
+}
+
+// WriterSink writes each message as a line of JSON, for local testing and piping into other tools
+type WriterSink struct {
+	mu     sync.Mutex
+	writer *bufio.Writer
+	closer io.Closer
+}
+
+// NewWriterSink creates a sink writing to w
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{writer: bufio.NewWriter(w)}
+}
+
+// NewFileSink creates a sink appending to the file at path
+func NewFileSink(path string) (*WriterSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open outbox file: %w", err)
+	}
+	sink := NewWriterSink(file)
+	sink.closer = file
+	return sink, nil
+}
+
+// Publish writes messages and flushes them
+func (s *WriterSink) Publish(ctx context.Context, messages []*models.OutboxMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, message := range messages {
+		line, err := encode(message)
+		if err != nil {
+			return err
+		}
+		s.writer.Write(line)
+		s.writer.WriteByte('\n')
+	}
+	return s.writer.Flush()
+}
+
+// Close flushes the sink and closes its file
+func (s *WriterSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.writer.Flush()
+	if s.closer != nil {
+		if closeErr := s.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,276 @@
+// Package replay records the block calls Juno makes to the plugin and replays them into a fresh
+// PluginCore against a throwaway database, so incidents can be reproduced and turned into regression
+// tests that compare the resulting tables with a golden snapshot.
+//
+// A recording is a sequence of frames, each a uvarint length followed by a record encoded with
+// Juno's CBOR encoder, the encoding Juno stores blocks and state updates with. The first frame is
+// the Header, every other one a Call. A frame cut short by a crash is dropped when the recording is
+// reopened, so recording resumes after a restart.
+package replay
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/encoder"
+	_ "github.com/NethermindEth/juno/encoder/registry" // registers the transaction types
+	junoplugin "github.com/NethermindEth/juno/plugin"
+)
+
+// Format and Version identify recordings written by this package
+const (
+	Format  = "pitchlake-recording"
+	Version = 1
+)
+
+// maxFrameSize bounds a frame read from a recording, larger lengths mean a corrupt file
+const maxFrameSize = 256 << 20
+
+// ErrTruncated is returned by Reader.Next when the recording ends within a frame
+var ErrTruncated = errors.New("recording is truncated")
+
+// Header is the first record of a recording
+type Header struct {
+	Format  string
+	Version int
+	// Network is the network the recording was made on
+	Network string
+	// CreatedAt is when the recording was started, in Unix seconds
+	CreatedAt int64
+}
+
+// CallKind is the plugin method a call was made to
+type CallKind string
+
+const (
+	CallNewBlock    CallKind = "NewBlock"
+	CallRevertBlock CallKind = "RevertBlock"
+)
+
+// Call is a NewBlock or RevertBlock call. The new classes NewBlock receives are not recorded, the
+// plugin does not read them.
+type Call struct {
+	Kind CallKind
+	// Block and StateUpdate are the block NewBlock adds or RevertBlock reverts
+	Block       *Block
+	StateUpdate *core.StateUpdate
+	// To and ToStateUpdate are the block RevertBlock reverts to
+	To            *Block
+	ToStateUpdate *core.StateUpdate
+	// ReverseStateDiff undoes the state diff of the reverted block
+	ReverseStateDiff *core.StateDiff
+}
+
+// Block is a core.Block stored the way Juno stores one, its header, transactions and receipts apart
+type Block struct {
+	Header       *core.Header
+	Transactions []core.Transaction
+	Receipts     []*core.TransactionReceipt
+}
+
+func newBlock(block *core.Block) *Block {
+	if block == nil {
+		return nil
+	}
+	return &Block{Header: block.Header, Transactions: block.Transactions, Receipts: block.Receipts}
+}
+
+// Core returns the block as Juno passes it to the plugin
+func (b *Block) Core() *core.Block {
+	if b == nil {
+		return nil
+	}
+	return &core.Block{Header: b.Header, Transactions: b.Transactions, Receipts: b.Receipts}
+}
+
+// Number returns the number of the call's block
+func (c *Call) Number() uint64 {
+	if c.Block == nil || c.Block.Header == nil {
+		return 0
+	}
+	return c.Block.Header.Number
+}
+
+// Recorder appends the block calls the plugin receives to a recording file
+type Recorder struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewRecorder opens the recording at path, creating it with a header for network when it does not
+// exist. An existing recording is appended to after its last complete frame.
+func NewRecorder(path string, network string) (*Recorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	end, err := lastFrameEnd(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Truncate(end); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to drop the truncated frame of the recording: %w", err)
+	}
+	if _, err := file.Seek(end, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek to the end of the recording: %w", err)
+	}
+
+	r := &Recorder{file: file}
+	if end == 0 {
+		header := &Header{Format: Format, Version: Version, Network: network, CreatedAt: time.Now().Unix()}
+		if err := r.write(header); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// lastFrameEnd returns the offset after the last complete frame of a recording
+func lastFrameEnd(file *os.File) (int64, error) {
+	reader := bufio.NewReader(file)
+	var end int64
+	for {
+		size, err := binary.ReadUvarint(reader)
+		if err != nil {
+			// io.EOF at a frame boundary, anything else is a partial length
+			return end, nil
+		}
+		if size > maxFrameSize {
+			return 0, fmt.Errorf("recording has a frame of %d bytes at offset %d, it is not a recording or is corrupt", size, end)
+		}
+		if _, err := reader.Discard(int(size)); err != nil {
+			return end, nil
+		}
+		end += int64(uvarintLen(size)) + int64(size)
+	}
+}
+
+func uvarintLen(value uint64) int {
+	var buf [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(buf[:], value)
+}
+
+// RecordNewBlock records a NewBlock call
+func (r *Recorder) RecordNewBlock(block *core.Block, stateUpdate *core.StateUpdate) error {
+	return r.write(&Call{Kind: CallNewBlock, Block: newBlock(block), StateUpdate: stateUpdate})
+}
+
+// RecordRevertBlock records a RevertBlock call
+func (r *Recorder) RecordRevertBlock(from, to *junoplugin.BlockAndStateUpdate, reverseStateDiff *core.StateDiff) error {
+	call := &Call{Kind: CallRevertBlock, ReverseStateDiff: reverseStateDiff}
+	if from != nil {
+		call.Block, call.StateUpdate = newBlock(from.Block), from.StateUpdate
+	}
+	if to != nil {
+		call.To, call.ToStateUpdate = newBlock(to.Block), to.StateUpdate
+	}
+	return r.write(call)
+}
+
+// write appends a frame holding record, in a single write so a crash leaves at most one partial frame
+func (r *Recorder) write(record any) error {
+	data, err := encoder.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+	frame := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(data)), uint64(len(data)))
+	frame = append(frame, data...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.file.Write(frame); err != nil {
+		return fmt.Errorf("failed to write recording: %w", err)
+	}
+	return nil
+}
+
+// Close closes the recording file
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+// Reader reads the calls of a recording in order
+type Reader struct {
+	file   *os.File
+	reader *bufio.Reader
+	header Header
+}
+
+// Open opens a recording and reads its header
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	r := &Reader{file: file, reader: bufio.NewReader(file)}
+	if err := r.read(&r.header); err != nil {
+		file.Close()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("recording %s is empty", path)
+		}
+		return nil, fmt.Errorf("failed to read recording header: %w", err)
+	}
+	if r.header.Format != Format {
+		file.Close()
+		return nil, fmt.Errorf("%s is not a recording", path)
+	}
+	if r.header.Version != Version {
+		file.Close()
+		return nil, fmt.Errorf("unsupported recording version %d, expected %d", r.header.Version, Version)
+	}
+	return r, nil
+}
+
+// Header returns the recording's header
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Next returns the next call, io.EOF after the last one and ErrTruncated when the recording ends
+// within a frame
+func (r *Reader) Next() (*Call, error) {
+	var call Call
+	if err := r.read(&call); err != nil {
+		return nil, err
+	}
+	return &call, nil
+}
+
+func (r *Reader) read(record any) error {
+	size, err := binary.ReadUvarint(r.reader)
+	if errors.Is(err, io.EOF) {
+		return io.EOF
+	}
+	if err != nil {
+		return ErrTruncated
+	}
+	if size > maxFrameSize {
+		return fmt.Errorf("frame of %d bytes exceeds the maximum of %d", size, maxFrameSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.reader, data); err != nil {
+		return ErrTruncated
+	}
+	if err := encoder.Unmarshal(data, record); err != nil {
+		return fmt.Errorf("failed to decode record: %w", err)
+	}
+	return nil
+}
+
+// Close closes the recording file
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,148 @@
+package replay
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	junoplugin "github.com/NethermindEth/juno/plugin"
+)
+
+func testBlock(number uint64) *core.Block {
+	return &core.Block{
+		Header: &core.Header{
+			Number:     number,
+			Hash:       new(felt.Felt).SetUint64(0x1000 + number),
+			ParentHash: new(felt.Felt).SetUint64(0x1000 + number - 1),
+			Timestamp:  1700000000 + number,
+		},
+	}
+}
+
+func readCalls(t *testing.T, path string) ([]*Call, error) {
+	t.Helper()
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open recording: %v", err)
+	}
+	defer reader.Close()
+	var calls []*Call
+	for {
+		call, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return calls, nil
+		}
+		if err != nil {
+			return calls, err
+		}
+		calls = append(calls, call)
+	}
+}
+
+func TestRecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks.rec")
+	recorder, err := NewRecorder(path, "sepolia")
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+	if err := recorder.RecordNewBlock(testBlock(10), &core.StateUpdate{}); err != nil {
+		t.Fatalf("Failed to record NewBlock: %v", err)
+	}
+	if err := recorder.RecordRevertBlock(
+		&junoplugin.BlockAndStateUpdate{Block: testBlock(10), StateUpdate: &core.StateUpdate{}},
+		&junoplugin.BlockAndStateUpdate{Block: testBlock(9), StateUpdate: &core.StateUpdate{}},
+		&core.StateDiff{},
+	); err != nil {
+		t.Fatalf("Failed to record RevertBlock: %v", err)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatalf("Failed to close recorder: %v", err)
+	}
+
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open recording: %v", err)
+	}
+	header := reader.Header()
+	reader.Close()
+	if header.Format != Format || header.Version != Version || header.Network != "sepolia" {
+		t.Errorf("Expected a %s v%d header for sepolia, got %+v", Format, Version, header)
+	}
+
+	calls, err := readCalls(t, path)
+	if err != nil {
+		t.Fatalf("Failed to read recording: %v", err)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 calls, got %d", len(calls))
+	}
+	if calls[0].Kind != CallNewBlock || calls[0].Number() != 10 {
+		t.Errorf("Expected NewBlock 10, got %s %d", calls[0].Kind, calls[0].Number())
+	}
+	if !calls[0].Block.Core().Hash.Equal(testBlock(10).Hash) {
+		t.Errorf("Expected hash %s, got %s", testBlock(10).Hash, calls[0].Block.Core().Hash)
+	}
+	if calls[1].Kind != CallRevertBlock || calls[1].Number() != 10 || calls[1].To.Core().Number != 9 {
+		t.Errorf("Expected RevertBlock from 10 to 9, got %s %d", calls[1].Kind, calls[1].Number())
+	}
+}
+
+func TestRecordingTruncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks.rec")
+	recorder, err := NewRecorder(path, "sepolia")
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+	if err := recorder.RecordNewBlock(testBlock(10), &core.StateUpdate{}); err != nil {
+		t.Fatalf("Failed to record NewBlock: %v", err)
+	}
+	recorder.Close()
+
+	// A crash within a write leaves the length of a frame without all of its bytes
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatalf("Failed to open recording: %v", err)
+	}
+	file.Write([]byte{0x20, 0x01, 0x02})
+	file.Close()
+
+	calls, err := readCalls(t, path)
+	if !errors.Is(err, ErrTruncated) {
+		t.Errorf("Expected ErrTruncated, got %v", err)
+	}
+	if len(calls) != 1 {
+		t.Errorf("Expected the call before the partial frame, got %d calls", len(calls))
+	}
+
+	// Reopening drops the partial frame and appends after the last complete one
+	recorder, err = NewRecorder(path, "sepolia")
+	if err != nil {
+		t.Fatalf("Failed to reopen recorder: %v", err)
+	}
+	if err := recorder.RecordNewBlock(testBlock(11), &core.StateUpdate{}); err != nil {
+		t.Fatalf("Failed to record NewBlock: %v", err)
+	}
+	recorder.Close()
+
+	calls, err = readCalls(t, path)
+	if err != nil {
+		t.Fatalf("Failed to read recording: %v", err)
+	}
+	if len(calls) != 2 || calls[0].Number() != 10 || calls[1].Number() != 11 {
+		t.Errorf("Expected blocks 10 and 11, got %d calls", len(calls))
+	}
+}
+
+func TestOpenNotARecording(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks.rec")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Error("Expected an error opening an empty file")
+	}
+}
@@ -0,0 +1,259 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"junoplugin/db"
+	"junoplugin/logging"
+	"junoplugin/plugin/config"
+	pluginCore "junoplugin/plugin/core"
+	"log/slog"
+	"os"
+	"time"
+
+	junoplugin "github.com/NethermindEth/juno/plugin"
+)
+
+// DefaultTimeout bounds the wait for startup sync and vault catchups once every call is fed
+const DefaultTimeout = time.Minute
+
+// settlePollInterval is how often a replay checks whether the plugin has settled
+const settlePollInterval = 50 * time.Millisecond
+
+// Options configures a replay
+type Options struct {
+	// Config is the plugin configuration the calls are replayed with. Its database URL points at the
+	// Postgres server the throwaway database is created on.
+	Config *config.Config
+	// Seed is SQL run after the migrations and before the first call, typically the vault registry
+	// and the parent of the first recorded block. Vaults indexed up to that parent are not caught
+	// up, so the replay makes no RPC call and is deterministic.
+	Seed string
+	// Timeout bounds the wait for startup sync and vault catchups, DefaultTimeout when 0
+	Timeout time.Duration
+	// Keep leaves the throwaway database in place for inspection
+	Keep bool
+	// Logger receives the plugin's logs, slog's default logger when nil
+	Logger *slog.Logger
+}
+
+// Result is the outcome of a replay, the golden snapshot of a regression test
+type Result struct {
+	// Database is the throwaway database the replay ran in
+	Database string `json:"-"`
+	// Calls is the number of calls replayed
+	Calls int `json:"calls"`
+	// Errors are the calls that failed, in order
+	Errors []CallError `json:"errors,omitempty"`
+	// Truncated is set when the recording ended within a call, the calls before it are replayed
+	Truncated bool `json:"truncated,omitempty"`
+	*db.Snapshot
+}
+
+// CallError is a replayed call that returned an error
+type CallError struct {
+	Call        int      `json:"call"`
+	Kind        CallKind `json:"kind"`
+	BlockNumber uint64   `json:"block_number"`
+	Error       string   `json:"error"`
+}
+
+// Replay feeds the calls of the recording at path into a fresh PluginCore running against a
+// throwaway database, waits for startup sync and vault catchups to finish and snapshots the tables
+func Replay(ctx context.Context, path string, opts Options) (*Result, error) {
+	if opts.Config == nil {
+		return nil, errors.New("replay needs a plugin configuration")
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	log := logging.Component(opts.Logger, "replay")
+
+	recording, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer recording.Close()
+	header := recording.Header()
+	if opts.Config.Network != "" && header.Network != "" && header.Network != opts.Config.Network {
+		log.Warn("Recording was made on another network", "recorded_network", header.Network, "network", opts.Config.Network)
+	}
+
+	// Migrations create functions in public, so the replay gets a database of its own rather than
+	// a schema next to the indexer's
+	database, databaseURL, err := db.CreateScratchDatabase(ctx, opts.Config.DatabaseURL, "replay")
+	if err != nil {
+		return nil, err
+	}
+	if !opts.Keep {
+		defer func() {
+			if err := db.DropScratchDatabase(opts.Config.DatabaseURL, database); err != nil {
+				log.Warn("Failed to drop replay database", "database", database, "error", err)
+			}
+		}()
+	}
+	if err := prepareDatabase(ctx, databaseURL, opts.Seed, opts.Logger); err != nil {
+		return nil, err
+	}
+
+	// The replay runs the plugin core alone, without the health server
+	cfg := *opts.Config
+	cfg.DatabaseURL = databaseURL
+	cfg.HealthAddr = ""
+	pc, err := pluginCore.NewPluginCoreFromConfig(&cfg, opts.Logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plugin core: %w", err)
+	}
+	defer pc.Shutdown()
+
+	result := &Result{Database: database}
+	log.Info("Replaying recording", "path", path, "network", header.Network, "database", database)
+	for {
+		call, err := recording.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, ErrTruncated) {
+			log.Warn("Recording ends within a call, replaying the calls before it", "calls", result.Calls)
+			result.Truncated = true
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result.Calls++
+		if err := apply(pc, call); err != nil {
+			log.Warn("Replayed call failed", "call", result.Calls, "kind", call.Kind, logging.BlockNumber(call.Number()), "error", err)
+			result.Errors = append(result.Errors, CallError{
+				Call:        result.Calls,
+				Kind:        call.Kind,
+				BlockNumber: call.Number(),
+				Error:       err.Error(),
+			})
+		}
+	}
+
+	if err := settle(ctx, pc, opts.Timeout); err != nil {
+		return nil, err
+	}
+	if result.Snapshot, err = pc.GetDB().Snapshot(ctx); err != nil {
+		return nil, err
+	}
+	log.Info("Replayed recording", "calls", result.Calls, "errors", len(result.Errors))
+	return result, nil
+}
+
+// apply makes a recorded call to the plugin core
+func apply(pc *pluginCore.PluginCore, call *Call) error {
+	switch call.Kind {
+	case CallNewBlock:
+		return pc.NewBlock(call.Block.Core(), call.StateUpdate, nil)
+	case CallRevertBlock:
+		return pc.RevertBlock(
+			&junoplugin.BlockAndStateUpdate{Block: call.Block.Core(), StateUpdate: call.StateUpdate},
+			&junoplugin.BlockAndStateUpdate{Block: call.To.Core(), StateUpdate: call.ToStateUpdate},
+			call.ReverseStateDiff,
+		)
+	}
+	return fmt.Errorf("unknown call kind %q", call.Kind)
+}
+
+// settle waits for startup sync to apply the buffered calls and for every vault catchup to hand over
+func settle(ctx context.Context, pc *pluginCore.PluginCore, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(settlePollInterval)
+	defer ticker.Stop()
+	for {
+		if pc.Ready() && !catchingUp(pc) {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("plugin did not finish syncing within %v, state %s: %w", timeout, pc.SyncState(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func catchingUp(pc *pluginCore.PluginCore) bool {
+	for _, vault := range pc.GetVaultManager().TrackedVaults() {
+		if vault.CatchingUp {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareDatabase migrates the database and runs the seed before the plugin core reads its last block
+func prepareDatabase(ctx context.Context, databaseURL, seed string, logger *slog.Logger) error {
+	dbClient, err := db.Init(databaseURL)
+	if err != nil {
+		return err
+	}
+	defer dbClient.Shutdown()
+	if _, err := dbClient.Migrate(db.MigrateOptions{Mode: db.MigrateAuto, Logger: logging.Component(logger, "db")}); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if seed != "" {
+		if _, err := dbClient.Pool.Exec(ctx, seed); err != nil {
+			return fmt.Errorf("failed to run seed: %w", err)
+		}
+	}
+	return nil
+}
+
+// Diff lists the differences between r and golden, empty when the replay matches it
+func (r *Result) Diff(golden *Result) []string {
+	var diff []string
+	if r.Calls != golden.Calls {
+		diff = append(diff, fmt.Sprintf("calls: expected %d, got %d", golden.Calls, r.Calls))
+	}
+	if r.Truncated != golden.Truncated {
+		diff = append(diff, fmt.Sprintf("truncated: expected %v, got %v", golden.Truncated, r.Truncated))
+	}
+	for i := 0; i < max(len(r.Errors), len(golden.Errors)); i++ {
+		switch {
+		case i >= len(golden.Errors):
+			diff = append(diff, fmt.Sprintf("errors: unexpected %+v", r.Errors[i]))
+		case i >= len(r.Errors):
+			diff = append(diff, fmt.Sprintf("errors: missing %+v", golden.Errors[i]))
+		case r.Errors[i] != golden.Errors[i]:
+			diff = append(diff, fmt.Sprintf("errors: expected %+v, got %+v", golden.Errors[i], r.Errors[i]))
+		}
+	}
+	got, expected := r.Snapshot, golden.Snapshot
+	if got == nil {
+		got = &db.Snapshot{}
+	}
+	if expected == nil {
+		expected = &db.Snapshot{}
+	}
+	return append(diff, got.Diff(expected)...)
+}
+
+// ReadGolden reads a result written by WriteGolden
+func ReadGolden(path string) (*Result, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read golden snapshot: %w", err)
+	}
+	var golden Result
+	if err := json.Unmarshal(data, &golden); err != nil {
+		return nil, fmt.Errorf("invalid golden snapshot %s: %w", path, err)
+	}
+	return &golden, nil
+}
+
+// WriteGolden writes r to path as indented JSON
+func (r *Result) WriteGolden(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
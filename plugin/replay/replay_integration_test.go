@@ -0,0 +1,179 @@
+//go:build integration
+
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"junoplugin/models"
+	"junoplugin/plugin/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+	junoplugin "github.com/NethermindEth/juno/plugin"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden snapshots of testdata/*.rec")
+
+// integrationConfig returns a configuration against TEST_DB_URL whose RPC is never reached
+func integrationConfig(t *testing.T) *config.Config {
+	t.Helper()
+	baseURL := os.Getenv("TEST_DB_URL")
+	if baseURL == "" {
+		t.Skip("TEST_DB_URL is not set")
+	}
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("DB_URL", baseURL)
+	t.Setenv("RPC_URL", "http://127.0.0.1:1")
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	return cfg
+}
+
+// parentSeed inserts the parent of block number, so replaying from number needs no catchup
+func parentSeed(number uint64) string {
+	parent := testBlock(number - 1)
+	return fmt.Sprintf(
+		"INSERT INTO starknet_blocks (block_number, block_hash, parent_hash, timestamp, status) VALUES (%d, '%s', '%s', %d, '%s')",
+		parent.Number, parent.Hash, parent.ParentHash, parent.Timestamp, models.BlockStatusMined,
+	)
+}
+
+// forkBlock is the block at number on a branch forking off testBlock(number-1)
+func forkBlock(number uint64) *core.Block {
+	block := testBlock(number)
+	block.Hash = new(felt.Felt).SetUint64(0x2000 + number)
+	block.ParentHash = new(felt.Felt).SetUint64(0x2000 + number - 1)
+	if number == 12 {
+		block.ParentHash = testBlock(11).Hash
+	}
+	return block
+}
+
+func TestReplay(t *testing.T) {
+	cfg := integrationConfig(t)
+	path := filepath.Join(t.TempDir(), "blocks.rec")
+	recorder, err := NewRecorder(path, cfg.Network)
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+	for number := uint64(10); number <= 12; number++ {
+		if err := recorder.RecordNewBlock(testBlock(number), &core.StateUpdate{}); err != nil {
+			t.Fatalf("Failed to record NewBlock: %v", err)
+		}
+	}
+	if err := recorder.RecordRevertBlock(
+		&junoplugin.BlockAndStateUpdate{Block: testBlock(12), StateUpdate: &core.StateUpdate{}},
+		&junoplugin.BlockAndStateUpdate{Block: testBlock(11), StateUpdate: &core.StateUpdate{}},
+		&core.StateDiff{},
+	); err != nil {
+		t.Fatalf("Failed to record RevertBlock: %v", err)
+	}
+	// The new branch goes on from the block reverted to
+	for number := uint64(12); number <= 13; number++ {
+		if err := recorder.RecordNewBlock(forkBlock(number), &core.StateUpdate{}); err != nil {
+			t.Fatalf("Failed to record NewBlock: %v", err)
+		}
+	}
+	recorder.Close()
+
+	opts := Options{Config: cfg, Seed: parentSeed(10)}
+	first, err := Replay(context.Background(), path, opts)
+	if err != nil {
+		t.Fatalf("Failed to replay recording: %v", err)
+	}
+	if first.Calls != 6 || len(first.Errors) != 0 {
+		t.Fatalf("Expected 6 calls without errors, got %d calls and %+v", first.Calls, first.Errors)
+	}
+
+	type blockRow struct {
+		BlockNumber json.Number        `json:"block_number"`
+		BlockHash   string             `json:"block_hash"`
+		Status      models.BlockStatus `json:"status"`
+	}
+	blocks := make(map[string]string)
+	for _, row := range first.Tables["starknet_blocks"] {
+		var block blockRow
+		if err := json.Unmarshal(row, &block); err != nil {
+			t.Fatalf("Failed to parse block row %s: %v", row, err)
+		}
+		blocks[block.BlockHash] = fmt.Sprintf("%s %s", block.BlockNumber, block.Status)
+	}
+	// The reverted block 12 is kept next to the block that replaced it
+	expected := map[string]string{
+		testBlock(9).Hash.String():  "9 MINED",
+		testBlock(10).Hash.String(): "10 MINED",
+		testBlock(11).Hash.String(): "11 MINED",
+		testBlock(12).Hash.String(): "12 REVERTED",
+		forkBlock(12).Hash.String(): "12 MINED",
+		forkBlock(13).Hash.String(): "13 MINED",
+	}
+	if len(blocks) != len(expected) {
+		t.Errorf("Expected %d blocks, got %v", len(expected), blocks)
+	}
+	for hash, block := range expected {
+		if blocks[hash] != block {
+			t.Errorf("Expected block %s to be %s, got %q", hash, block, blocks[hash])
+		}
+	}
+
+	// A second replay of the same recording ends in the same tables
+	second, err := Replay(context.Background(), path, opts)
+	if err != nil {
+		t.Fatalf("Failed to replay recording again: %v", err)
+	}
+	if diff := second.Diff(first); len(diff) != 0 {
+		t.Errorf("Expected replays to match, got:\n%s", strings.Join(diff, "\n"))
+	}
+}
+
+// TestRecordings replays every testdata/*.rec, seeded by the .sql file next to it if any, and
+// compares the result with its .golden.json. Run with -update to rewrite the golden snapshots.
+func TestRecordings(t *testing.T) {
+	recordings, err := filepath.Glob(filepath.Join("testdata", "*.rec"))
+	if err != nil {
+		t.Fatalf("Failed to list recordings: %v", err)
+	}
+	if len(recordings) == 0 {
+		t.Skip("no recordings in testdata")
+	}
+	cfg := integrationConfig(t)
+
+	for _, path := range recordings {
+		name := strings.TrimSuffix(path, ".rec")
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			seed, err := os.ReadFile(name + ".sql")
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("Failed to read seed: %v", err)
+			}
+			result, err := Replay(context.Background(), path, Options{Config: cfg, Seed: string(seed)})
+			if err != nil {
+				t.Fatalf("Failed to replay recording: %v", err)
+			}
+
+			goldenPath := name + ".golden.json"
+			if *update {
+				if err := result.WriteGolden(goldenPath); err != nil {
+					t.Fatalf("Failed to write golden snapshot: %v", err)
+				}
+				return
+			}
+			golden, err := ReadGolden(goldenPath)
+			if err != nil {
+				t.Fatalf("Failed to read golden snapshot: %v", err)
+			}
+			if diff := result.Diff(golden); len(diff) != 0 {
+				t.Errorf("Replay differs from %s:\n%s", goldenPath, strings.Join(diff, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,2 @@
+-- The parent of the first recorded block, so startup sync has no blocks to fetch from the RPC
+INSERT INTO starknet_blocks (block_number, block_hash, parent_hash, timestamp, status) VALUES (9, '0x1009', '0x1008', 1700000009, 'MINED');
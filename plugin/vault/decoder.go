@@ -0,0 +1,324 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"junoplugin/abi"
+	"junoplugin/db"
+	"junoplugin/logging"
+	"junoplugin/models"
+	"junoplugin/utils"
+	"sort"
+	"strings"
+)
+
+// DefaultDecoder decodes the events of vault classes without a registered decoder, it knows the
+// events of the original vault class
+var DefaultDecoder abi.EventDecoder = abi.FromEventNames(utils.VaultEventNames...)
+
+// decoderVersions are the decoders configuration can assign to vault classes by name
+var decoderVersions = map[string]abi.EventDecoder{
+	"v1": DefaultDecoder,
+}
+
+// DecoderVersion returns the decoder registered under a version name
+func DecoderVersion(name string) (abi.EventDecoder, bool) {
+	decoder, ok := decoderVersions[name]
+	return decoder, ok
+}
+
+// DecoderVersions returns the names of the decoder versions in order
+func DecoderVersions() []string {
+	names := make([]string, 0, len(decoderVersions))
+	for name := range decoderVersions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RegisterDecoder decodes the events of vaults running classHash with decoder
+func (vm *Manager) RegisterDecoder(classHash string, decoder abi.EventDecoder) {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	vm.decoders[classHash] = decoder
+}
+
+// RegisterDecoderVersions registers a decoder for each class hash, either the decoder version named
+// or one built from the ABI in a .json file
+func (vm *Manager) RegisterDecoderVersions(classVersions map[string]string) error {
+	for classHash, version := range classVersions {
+		if strings.HasSuffix(version, ".json") {
+			registry, err := abi.LoadFile(version)
+			if err != nil {
+				return err
+			}
+			vm.log.Info("Loaded vault class ABI", "class_hash", classHash, "file", version, "events", registry.Len())
+			vm.RegisterDecoder(classHash, registry)
+			continue
+		}
+		decoder, ok := DecoderVersion(version)
+		if !ok {
+			return fmt.Errorf("unknown decoder version %q for class %s, expected one of %s or an ABI .json file", version, classHash, strings.Join(DecoderVersions(), ", "))
+		}
+		vm.RegisterDecoder(classHash, decoder)
+	}
+	return nil
+}
+
+// decodersAt returns the decoders to try for an event a vault emitted in blockNumber. Event layouts
+// can change between vault classes, so events are decoded with the class the vault had. In the block
+// a vault was upgraded in, events of transactions before the upgrade still have the old layout,
+// so the previous class's decoder is tried after the new one.
+func (vm *Manager) decodersAt(ctx context.Context, address string, blockNumber uint64) ([]abi.EventDecoder, error) {
+	history, err := vm.classHistory(address)
+	if err != nil {
+		return nil, err
+	}
+
+	active := -1
+	for i, class := range history {
+		if class.BlockNumber <= blockNumber {
+			active = i
+		}
+	}
+	if active < 0 {
+		return []abi.EventDecoder{DefaultDecoder}, nil
+	}
+	classHashes := []string{history[active].ClassHash}
+	if active > 0 && history[active].BlockNumber == blockNumber {
+		classHashes = append(classHashes, history[active-1].ClassHash)
+	}
+
+	decoders := make([]abi.EventDecoder, 0, len(classHashes))
+	for _, classHash := range classHashes {
+		decoder, err := vm.decoderFor(ctx, classHash)
+		if err != nil {
+			return nil, err
+		}
+		decoders = append(decoders, decoder)
+	}
+	return decoders, nil
+}
+
+// decoderFor returns the decoder of a class. Without a registered decoder, the class's ABI is
+// fetched from the node when fetchABIs is set and DefaultDecoder is used otherwise.
+func (vm *Manager) decoderFor(ctx context.Context, classHash string) (abi.EventDecoder, error) {
+	vm.mu.RLock()
+	decoder, ok := vm.decoders[classHash]
+	vm.mu.RUnlock()
+	if ok {
+		return decoder, nil
+	}
+	if !vm.fetchABIs {
+		return DefaultDecoder, nil
+	}
+
+	classABI, err := vm.network.ClassABI(ctx, classHash)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := abi.Parse(classABI)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ABI of class %s: %w", classHash, err)
+	}
+	vm.log.Info("Fetched vault class ABI", "class_hash", classHash, "events", registry.Len())
+	decoder = registry
+	vm.RegisterDecoder(classHash, decoder)
+	return decoder, nil
+}
+
+// classHistory returns a vault's class changes in block order, loading them on first use
+func (vm *Manager) classHistory(address string) ([]*models.VaultClass, error) {
+	vm.mu.RLock()
+	history, loaded := vm.classes[address]
+	vm.mu.RUnlock()
+	if loaded {
+		return history, nil
+	}
+
+	history, err := vm.db.GetVaultClassHistory(address)
+	if err != nil {
+		return nil, err
+	}
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	if loadedMeanwhile, ok := vm.classes[address]; ok {
+		return loadedMeanwhile, nil
+	}
+	vm.classes[address] = history
+	return history, nil
+}
+
+// classAt returns the class a vault had at blockNumber, empty when none is recorded
+func (vm *Manager) classAt(address string, blockNumber uint64) (string, error) {
+	history, err := vm.classHistory(address)
+	if err != nil {
+		return "", err
+	}
+	classHash := ""
+	for _, class := range history {
+		if class.BlockNumber <= blockNumber {
+			classHash = class.ClassHash
+		}
+	}
+	return classHash, nil
+}
+
+// recordClass stores a vault's class from a block on in tx and adds it to the vault's history.
+// Upgrades also store a VaultUpgraded driver event.
+func (vm *Manager) recordClass(tx *db.DB, class *models.VaultClass, upgrade bool) error {
+	// Load the stored history first so the new class is not mistaken for all of it
+	if _, err := vm.classHistory(class.VaultAddress); err != nil {
+		return err
+	}
+	if err := tx.StoreVaultClass(class); err != nil {
+		return err
+	}
+	if upgrade {
+		if err := tx.StoreVaultUpgradedEvent(class.VaultAddress, class.BlockHash); err != nil {
+			return err
+		}
+		vm.log.Info("Vault upgraded", logging.VaultAddress(class.VaultAddress), "class_hash", class.ClassHash, logging.BlockNumber(class.BlockNumber), logging.BlockHash(class.BlockHash))
+	}
+	replaced := vm.addClass(class)
+	// The history only keeps the class if tx commits it
+	tx.OnRollback(func() {
+		vm.removeClass(class)
+		if replaced != nil {
+			vm.addClass(replaced)
+		}
+	})
+	return nil
+}
+
+// RecordVaultUpgrade records a vault's class replaced in a live block, within the block processor's
+// transaction
+func (vm *Manager) RecordVaultUpgrade(address string, blockNumber uint64, blockHash string, classHash string) error {
+	return vm.recordClass(vm.db, &models.VaultClass{
+		VaultAddress: address,
+		BlockNumber:  blockNumber,
+		BlockHash:    blockHash,
+		ClassHash:    classHash,
+	}, true)
+}
+
+// RevertVaultUpgrades drops the class changes of a reverted block, within the block processor's
+// transaction
+func (vm *Manager) RevertVaultUpgrades(blockNumber uint64, blockHash string) error {
+	deleted, err := vm.db.RevertVaultClasses(blockNumber, blockHash)
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return nil
+	}
+
+	var reverted []*models.VaultClass
+	vm.mu.Lock()
+	for address, history := range vm.classes {
+		kept := make([]*models.VaultClass, 0, len(history))
+		for _, class := range history {
+			if class.BlockNumber != blockNumber || class.BlockHash != blockHash {
+				kept = append(kept, class)
+			} else {
+				reverted = append(reverted, class)
+			}
+		}
+		vm.classes[address] = kept
+	}
+	vm.mu.Unlock()
+	// The classes are back in the history if the revert does not commit
+	vm.db.OnRollback(func() {
+		for _, class := range reverted {
+			vm.addClass(class)
+		}
+	})
+	vm.log.Info("Reverted vault class changes", "count", deleted, logging.BlockNumber(blockNumber), logging.BlockHash(blockHash))
+	return nil
+}
+
+// detectUpgrades records the class changes of a vault in [fromBlock, toBlock] before its events
+// there are decoded. Live blocks carry upgrades in their state diff, catchup asks the node.
+func (vm *Manager) detectUpgrades(ctx context.Context, vault *models.VaultRegistry, fromBlock, toBlock uint64) error {
+	normalizedVaultAddress, err := utils.NormalizeHexAddress(vault.Address)
+	if err != nil {
+		return err
+	}
+	classHash, err := vm.classAt(normalizedVaultAddress, fromBlock-1)
+	if err != nil {
+		return err
+	}
+
+	var classes []*models.VaultClass
+	if classHash == "" {
+		// Vaults initialized before classes were tracked start their history at the block they resume from
+		if classHash, err = vm.network.ClassHashAt(ctx, fromBlock-1, vault.Address); err != nil {
+			return err
+		}
+		classes = append(classes, &models.VaultClass{VaultAddress: normalizedVaultAddress, BlockNumber: fromBlock - 1, BlockHash: *vault.LastBlockIndexed, ClassHash: classHash})
+	}
+	changes, err := vm.network.ClassChanges(ctx, vault.Address, fromBlock, toBlock, classHash)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		blockHash, err := vm.blockHash(ctx, change.BlockNumber)
+		if err != nil {
+			return err
+		}
+		classes = append(classes, &models.VaultClass{VaultAddress: normalizedVaultAddress, BlockNumber: change.BlockNumber, BlockHash: blockHash, ClassHash: change.ClassHash})
+	}
+	if len(classes) == 0 {
+		return nil
+	}
+
+	tx, err := vm.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	for i, class := range classes {
+		// Only the baseline of an untracked vault is not an upgrade
+		upgrade := i > 0 || len(changes) == len(classes)
+		if err := vm.recordClass(tx, class, upgrade); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// addClass inserts a class change into the in memory history, returning the one it replaced at
+// the same block if any
+func (vm *Manager) addClass(class *models.VaultClass) *models.VaultClass {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	history := vm.classes[class.VaultAddress]
+	updated := make([]*models.VaultClass, 0, len(history)+1)
+	var replaced *models.VaultClass
+	for _, existing := range history {
+		if existing.BlockNumber != class.BlockNumber {
+			updated = append(updated, existing)
+		} else {
+			replaced = existing
+		}
+	}
+	updated = append(updated, class)
+	sort.Slice(updated, func(i, j int) bool { return updated[i].BlockNumber < updated[j].BlockNumber })
+	vm.classes[class.VaultAddress] = updated
+	return replaced
+}
+
+// removeClass drops a class change added by addClass from the in memory history
+func (vm *Manager) removeClass(class *models.VaultClass) {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	history := vm.classes[class.VaultAddress]
+	kept := make([]*models.VaultClass, 0, len(history))
+	for _, existing := range history {
+		if existing != class {
+			kept = append(kept, existing)
+		}
+	}
+	vm.classes[class.VaultAddress] = kept
+}
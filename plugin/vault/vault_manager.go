@@ -1,95 +1,293 @@
 package vault
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"junoplugin/abi"
 	"junoplugin/db"
+	"junoplugin/logging"
+	"junoplugin/metrics"
 	"junoplugin/models"
 	"junoplugin/network"
+	"junoplugin/plugin/bus"
+	"junoplugin/plugin/config"
+	"junoplugin/tracing"
 	"junoplugin/utils"
-	"log"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/NethermindEth/juno/core"
 	"github.com/NethermindEth/juno/core/felt"
 	"github.com/NethermindEth/starknet.go/rpc"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// BlockBarrier pauses live block processing, the block processor implements it
+type BlockBarrier interface {
+	// WithBlocksPaused runs fn with no block being processed, passing the last processed block
+	WithBlocksPaused(fn func(head *models.StarknetBlocks) error) error
+}
+
+// SubscriptionBackfill fetches the events subscriptions match for a vault, contract.Tracker
+// implements it
+type SubscriptionBackfill interface {
+	// VaultEvents returns the subscriptions that can be backfilled with their events in
+	// [fromBlock, toBlock] matching the vault
+	VaultEvents(ctx context.Context, vaultAddress string, fromBlock, toBlock uint64) ([]string, []*models.ContractEvent, error)
+}
+
+// Retry delays of a failed startup catchup, doubling up to maxCatchupRetryDelay
+const (
+	catchupRetryDelay    = 10 * time.Second
+	maxCatchupRetryDelay = 5 * time.Minute
+)
+
+// replayedEventsPage is the number of events a replay reads back at a time to publish them
+const replayedEventsPage = 1000
+
 // Manager handles vault-related operations
 type Manager struct {
 	db               *db.DB
 	network          *network.Network
 	vaultRegistryMap map[string]*models.VaultRegistry
+	reindexing       map[string]struct{}
 	udcAddress       string
-	log              *log.Logger
+	vaultClassHashes map[string]struct{}
+	// catchupWindow is the number of blocks catchup and reindex handle at a time
+	catchupWindow uint64
+	// catchupWorkers is the number of vaults LoadVaultsFromRegistry catches up at once
+	catchupWorkers int
+	// catchingUp holds the tracked vaults left out of live indexing until their startup catchup
+	// hands over, with how far the catchup has got
+	catchingUp map[string]catchupProgress
+	// decoders are the event decoders registered by class hash, DefaultDecoder serves the others
+	decoders map[string]abi.EventDecoder
+	// fetchABIs builds the decoders of unregistered classes from their ABI on the node
+	fetchABIs bool
+	// classes caches the class history of vaults by address, loaded on first use
+	classes map[string][]*models.VaultClass
+	// subscriptions backfills subscription matches over the blocks vaults catch up, when set
+	subscriptions SubscriptionBackfill
+	// bus receives the vault events initialization, catchup and replays commit, when set
+	bus     *bus.Bus
+	mu      sync.RWMutex
+	log     *slog.Logger
+	ctx     context.Context
+	cancel  context.CancelFunc
+	workers sync.WaitGroup
 }
 
-// NewManager creates a new vault manager
-func NewManager(db *db.DB, network *network.Network, udcAddress string) *Manager {
+// NewManager creates a new vault manager. Deployments are checked against vaultClassHashes when
+// any are given. Catchup commits every catchupWindow blocks and runs for up to catchupWorkers
+// vaults at once at startup. With fetchABIs, events of vault classes without a registered decoder
+// are decoded with the class's ABI fetched from the node.
+func NewManager(db *db.DB, network *network.Network, udcAddress string, vaultClassHashes []string, catchupWindow uint64, catchupWorkers int, fetchABIs bool, logger *slog.Logger) *Manager {
+	classHashes := make(map[string]struct{}, len(vaultClassHashes))
+	for _, hash := range vaultClassHashes {
+		classHashes[hash] = struct{}{}
+	}
+	if catchupWindow == 0 {
+		catchupWindow = config.DefaultCatchupWindow
+	}
+	if catchupWorkers <= 0 {
+		catchupWorkers = config.DefaultCatchupWorkers
+	}
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Manager{
 		db:               db,
 		network:          network,
 		vaultRegistryMap: make(map[string]*models.VaultRegistry),
+		reindexing:       make(map[string]struct{}),
 		udcAddress:       udcAddress,
-		log:              log.Default(),
+		vaultClassHashes: classHashes,
+		catchupWindow:    catchupWindow,
+		catchupWorkers:   catchupWorkers,
+		catchingUp:       make(map[string]catchupProgress),
+		decoders:         make(map[string]abi.EventDecoder),
+		fetchABIs:        fetchABIs,
+		classes:          make(map[string][]*models.VaultClass),
+		log:              logging.Component(logger, "vault"),
+		ctx:              ctx,
+		cancel:           cancel,
 	}
 }
 
-// InitializeVaults initializes existing vaults from the database
-func (vm *Manager) LoadVaultsFromRegistry(latestBlock *models.StarknetBlocks) error {
+// Stop cancels the background vault catchups and waits for them to return. A running catchup
+// stops after its current page, which is committed with its checkpoint.
+func (vm *Manager) Stop() {
+	vm.cancel()
+	vm.workers.Wait()
+}
+
+// LoadVaultsFromRegistry tracks the registered vaults and catches up the ones behind latestBlock in
+// the background, catchupWorkers vaults at a time, each page in its own transaction. Vaults that are
+// caught up are indexed live right away, the others once their catchup has handed over.
+func (vm *Manager) LoadVaultsFromRegistry(latestBlock *models.StarknetBlocks, barrier BlockBarrier) error {
 	vaultRegistry, err := vm.db.GetVaultRegistry()
 	if err != nil {
 		return fmt.Errorf("failed to get vault registry: %w", err)
 	}
 
-	// Catchup vaults while loading in mem to avoid reiterating later with SyncVaults call
-	if len(vaultRegistry) > 0 {
-		for _, vault := range vaultRegistry {
-			if vault.LastBlockIndexed == nil {
-				vm.InitializeVault(vault)
-			}
+	var lagging []string
+	for _, vault := range vaultRegistry {
+		behind, err := vm.needsCatchup(vault, latestBlock)
+		if err != nil {
+			return fmt.Errorf("failed to check vault %s: %w", vault.Address, err)
+		}
 
-			//Do this before the lastBlock escape
-			vm.vaultRegistryMap[vault.Address] = vault
+		vm.mu.Lock()
+		vm.vaultRegistryMap[vault.Address] = vault
+		if behind {
+			vm.catchingUp[vault.Address] = catchupProgress{}
+		}
+		vm.mu.Unlock()
+		if behind {
+			lagging = append(lagging, vault.Address)
+		}
+	}
 
-			//Escape if we don't have the latest block, we shouldn't need this if used only after initialization
-			if latestBlock == nil {
-				return nil
-			}
+	vm.log.Info("Loaded vault registry", "vaults", len(vaultRegistry), "lagging", len(lagging))
 
-			lastBlockIndexed, err := vm.db.GetBlock(*vault.LastBlockIndexed)
-			if err != nil {
-				return err
-			}
+	// The latest block itself is indexed live once the vault hands over
+	var toBlock uint64
+	if latestBlock != nil && latestBlock.BlockNumber > 0 {
+		toBlock = latestBlock.BlockNumber - 1
+	}
+	vm.catchupVaults(lagging, toBlock, barrier)
+	return nil
+}
 
-			if lastBlockIndexed == nil || lastBlockIndexed.BlockNumber < latestBlock.BlockNumber-1 {
-				if err := vm.CatchupVault(*vault, latestBlock.BlockNumber); err != nil {
-					return fmt.Errorf("failed to catchup vault %s: %w", vault.Address, err)
-				}
+// needsCatchup reports whether a loaded vault has to be initialized or caught up before it is
+// indexed live. Paused vaults are not caught up until resumed.
+func (vm *Manager) needsCatchup(vault *models.VaultRegistry, latestBlock *models.StarknetBlocks) (bool, error) {
+	if vault.LastBlockIndexed == nil {
+		return true, nil
+	}
+	if vault.Paused || latestBlock == nil {
+		return false, nil
+	}
+	lastBlockIndexed, err := vm.db.GetBlock(*vault.LastBlockIndexed)
+	if err != nil {
+		return false, err
+	}
+	return lastBlockIndexed == nil || lastBlockIndexed.BlockNumber+1 < latestBlock.BlockNumber, nil
+}
+
+// catchupVaults starts up to catchupWorkers workers catching up the vaults at addresses to toBlock
+func (vm *Manager) catchupVaults(addresses []string, toBlock uint64, barrier BlockBarrier) {
+	if len(addresses) == 0 {
+		return
+	}
+	workers := min(vm.catchupWorkers, len(addresses))
+	vm.log.Info("Catching up vaults", "vaults", len(addresses), "to_block", toBlock, "workers", workers)
 
+	queue := make(chan string, len(addresses))
+	for _, address := range addresses {
+		queue <- address
+	}
+	close(queue)
+	metrics.VaultsCatchingUp.Add(float64(len(addresses)))
+
+	for range workers {
+		vm.workers.Add(1)
+		go func() {
+			defer vm.workers.Done()
+			for address := range queue {
+				vm.runVaultCatchup(address, toBlock, barrier)
 			}
+		}()
+	}
+}
+
+// runVaultCatchup catches up a vault until it hands over to live indexing, retrying failed attempts
+// with a growing delay until the vault is removed or the manager stops
+func (vm *Manager) runVaultCatchup(address string, toBlock uint64, barrier BlockBarrier) {
+	defer metrics.VaultsCatchingUp.Dec()
+	delay := catchupRetryDelay
+	for vm.ctx.Err() == nil {
+		err := vm.catchupToLive(vm.ctx, address, toBlock, barrier)
+		if err == nil {
+			return
+		}
+		vm.log.Error("Failed to catch up vault, retrying", logging.VaultAddress(address), "retry_in", delay, "error", err)
+		select {
+		case <-vm.ctx.Done():
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxCatchupRetryDelay)
+	}
+}
+
+// catchupToLive catches a vault up to toBlock while live blocks keep being processed. It then
+// catches up the blocks processed meanwhile with block processing paused and starts indexing the
+// vault live, so no block is skipped or indexed twice. Paused vaults are only initialized.
+func (vm *Manager) catchupToLive(ctx context.Context, address string, toBlock uint64, barrier BlockBarrier) error {
+	vault, tracked := vm.trackedVault(address)
+	if !tracked {
+		return nil
+	}
+	if vault.LastBlockIndexed == nil {
+		if err := vm.storeInitializedVault(ctx, &vault); err != nil {
+			return fmt.Errorf("failed to initialize vault %s: %w", address, err)
+		}
+		vm.setLastBlockIndexed(address, *vault.LastBlockIndexed)
+	}
+	if !vault.Paused {
+		if err := vm.CatchupVault(ctx, vault, toBlock); err != nil {
+			return fmt.Errorf("failed to catchup vault %s: %w", address, err)
 		}
 	}
 
-	vm.log.Printf("Vault addresses: %v", vm.vaultRegistryMap)
-	vm.log.Printf("Last block: %v", latestBlock)
+	return barrier.WithBlocksPaused(func(head *models.StarknetBlocks) error {
+		vault, tracked := vm.trackedVault(address)
+		if !tracked {
+			return nil
+		}
+		if head != nil && !vault.Paused {
+			if err := vm.CatchupVault(ctx, vault, head.BlockNumber); err != nil {
+				return fmt.Errorf("failed to catchup vault %s: %w", address, err)
+			}
+		}
+		vm.mu.Lock()
+		delete(vm.catchingUp, address)
+		vm.mu.Unlock()
+		vm.log.Info("Vault caught up, indexing it live", logging.VaultAddress(address))
+		return nil
+	})
+}
 
-	return nil
+// trackedVault returns a copy of a tracked vault
+func (vm *Manager) trackedVault(address string) (models.VaultRegistry, bool) {
+	vm.mu.RLock()
+	defer vm.mu.RUnlock()
+	vault, exists := vm.vaultRegistryMap[address]
+	if !exists {
+		return models.VaultRegistry{}, false
+	}
+	return *vault, true
 }
 
-func (vm *Manager) SyncVaults(head *models.StarknetBlocks) error {
-	vaultRegistry := &vm.vaultRegistryMap
-	// if err != nil {
-	// 	return fmt.Errorf("failed to get vault registry: %w", err)
-	// }
-	for _, vault := range *vaultRegistry {
+func (vm *Manager) SyncVaults(ctx context.Context, head *models.StarknetBlocks) error {
+	vm.mu.RLock()
+	vaultRegistry := make([]*models.VaultRegistry, 0, len(vm.vaultRegistryMap))
+	for _, vault := range vm.vaultRegistryMap {
+		vaultRegistry = append(vaultRegistry, vault)
+	}
+	vm.mu.RUnlock()
+
+	for _, vault := range vaultRegistry {
 		if vault.LastBlockIndexed == nil {
-			vm.InitializeVault(vault)
+			vm.InitializeVault(ctx, vault)
 		}
 		if head == nil {
-			log.Printf("No last block found, starting node to find current block")
+			vm.log.Info("No last block found, starting node to find current block")
 			return nil
 		}
 		if *vault.LastBlockIndexed != head.BlockHash {
-			if err := vm.CatchupVault(*vault, head.BlockNumber); err != nil {
+			if err := vm.CatchupVault(ctx, *vault, head.BlockNumber); err != nil {
 				return fmt.Errorf("failed to catchup vault %s: %w", vault.Address, err)
 			}
 		}
@@ -99,12 +297,46 @@ func (vm *Manager) SyncVaults(head *models.StarknetBlocks) error {
 }
 
 // InitializeVault initializes a new vault
-func (vm *Manager) InitializeVault(vault *models.VaultRegistry) error {
-	deployBlockHash, err := utils.HexStringToFelt(vault.DeployedAt)
+func (vm *Manager) InitializeVault(ctx context.Context, vault *models.VaultRegistry) (err error) {
+	ctx, span := tracing.Start(ctx, "vault.InitializeVault", tracing.VaultAddress(vault.Address))
+	defer func() { tracing.End(span, err) }()
+
+	if err := vm.storeInitializedVault(ctx, vault); err != nil {
+		return err
+	}
+
+	// Start tracking the vault for live blocks, covers vaults registered while the plugin runs
+	vm.mu.Lock()
+	vm.vaultRegistryMap[vault.Address] = vault
+	vm.mu.Unlock()
+	return nil
+}
+
+// storeInitializedVault initializes the vault in its own transaction
+func (vm *Manager) storeInitializedVault(ctx context.Context, vault *models.VaultRegistry) error {
+	tx, err := vm.db.Begin(ctx)
 	if err != nil {
-		vm.log.Println("Error getting felt", err)
 		return err
 	}
+	events, err := vm.initializeVault(ctx, tx, vault)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	vm.publishVaultEvents(events)
+	return nil
+}
+
+// initializeVault indexes the vault's deployment block within tx and moves its cursor there. It
+// returns the stored events.
+func (vm *Manager) initializeVault(ctx context.Context, tx *db.DB, vault *models.VaultRegistry) ([]*models.Event, error) {
+	deployBlockHash, err := utils.HexStringToFelt(vault.DeployedAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deployment block hash of vault %s: %w", vault.Address, err)
+	}
 
 	hash := felt.FromBytes(deployBlockHash)
 
@@ -112,144 +344,688 @@ func (vm *Manager) InitializeVault(vault *models.VaultRegistry) error {
 	deployBlock := rpc.BlockID{
 		Hash: &hash,
 	}
-	vm.log.Printf("Deploy block: %v", deployBlock)
-
-	events, err := vm.network.GetEvents(deployBlock, deployBlock, nil)
+	events, err := vm.network.GetEvents(ctx, deployBlock, deployBlock, nil)
 	if err != nil {
-		vm.log.Println("Error getting events", err)
-		return err
+		return nil, err
 	}
-	log.Printf("events list %v", len(events.Events))
+	vm.log.Debug("Fetched deployment block events", logging.VaultAddress(vault.Address), logging.BlockHash(vault.DeployedAt), "events", len(events.Events))
 
-	vm.db.BeginTx()
-	err = vm.processDeploymentBlockEvents(events, vault)
+	stored, err := vm.processDeploymentBlockEvents(ctx, tx, events, vault)
 	if err != nil {
-		vm.log.Println("Error processing deployment events", err)
-		vm.db.RollbackTx()
-		return err
+		return nil, fmt.Errorf("failed to process deployment events of vault %s: %w", vault.Address, err)
 	}
 
-	// Save the block as well in db if it doesn't exist
-	// block, err := vm.db.GetBlock(vault.DeployedAt)
-	// if err != nil {
-	// 	return err
-	// }
+	// The deployment block is fully indexed even when the UDC event was not matched
+	if vault.LastBlockIndexed == nil {
+		deployedAt := vault.DeployedAt
+		vault.LastBlockIndexed = &deployedAt
+	}
+	return stored, tx.UpdateVaultRegistry(vault.Address, *vault.LastBlockIndexed)
+}
 
-	// if block == nil {
-	// 	//get block from network
-	// 	networkBlock, err := vm.network.GetBlockByHash(vault.DeployedAt)
+// CatchupVault catches up a vault to a specific block. The range is indexed in windows of
+// catchupWindow blocks whose events are fetched page by page, and every page is committed with a
+// checkpoint, so a restarted plugin resumes after the last committed page.
+func (vm *Manager) CatchupVault(ctx context.Context, vault models.VaultRegistry, toBlock uint64) (err error) {
+	ctx, span := tracing.Start(ctx, "vault.CatchupVault", tracing.VaultAddress(vault.Address), attribute.Int64("to_block", int64(toBlock)))
+	defer func() { tracing.End(span, err) }()
 
-	// 	if err != nil {
-	// 		return nil
-	// 	}
+	fromBlock, err := vm.nextBlockToIndex(ctx, &vault)
+	if err != nil {
+		return err
+	}
+	if fromBlock > toBlock {
+		vm.log.Debug("Vault is up to date", logging.VaultAddress(vault.Address), "from_block", fromBlock, "to_block", toBlock)
+		return nil
+	}
 
-	// 	starknetBlock := models.RPCBlockToStarknetBlock(networkBlock)
+	checkpoint, err := vm.db.GetVaultCheckpoint(vault.Address)
+	if err != nil {
+		return fmt.Errorf("failed to get catchup checkpoint: %w", err)
+	}
+	if checkpoint != nil && checkpoint.BlockNumber != fromBlock {
+		// The window was committed or the vault reset since, the checkpoint is overwritten below
+		vm.log.Info("Ignoring stale catchup checkpoint", logging.VaultAddress(vault.Address), "checkpoint_block", checkpoint.BlockNumber, "from_block", fromBlock)
+		checkpoint = nil
+	}
 
-	// 	err = vm.db.InsertBlock(starknetBlock)
-	// 	if err != nil {
-	// 		vm.db.RollbackTx()
-	// 		vm.log.Println("Error inserting block", err)
-	// 		return err
-	// 	}
-	// }
-	vm.db.CommitTx()
+	span.SetAttributes(attribute.Int64("from_block", int64(fromBlock)))
+	metrics.VaultCatchupTarget.WithLabelValues(vault.Address).Set(float64(toBlock))
+	vm.setCatchupProgress(vault.Address, max(fromBlock, 1)-1, toBlock)
+	vm.log.Info("Catching up vault", logging.VaultAddress(vault.Address), "from_block", fromBlock, "to_block", toBlock)
+	caughtUp := bus.VaultCaughtUp{VaultAddress: vault.Address, FromBlock: fromBlock, ToBlock: toBlock}
+	for fromBlock <= toBlock {
+		windowEnd := min(fromBlock+vm.catchupWindow-1, toBlock)
+		if checkpoint != nil {
+			// The continuation token is only valid for the filter it was issued for
+			windowEnd = checkpoint.WindowEnd
+		}
+		if err := vm.detectUpgrades(ctx, &vault, fromBlock, windowEnd); err != nil {
+			return fmt.Errorf("failed to detect upgrades of vault %s: %w", vault.Address, err)
+		}
+		if err := vm.catchupVaultWindow(ctx, &vault, fromBlock, windowEnd, toBlock, checkpoint); err != nil {
+			return err
+		}
+		checkpoint = nil
+		vm.setLastBlockIndexed(vault.Address, *vault.LastBlockIndexed)
+		fromBlock = windowEnd + 1
+	}
+	caughtUp.BlockHash = *vault.LastBlockIndexed
+	vm.bus.Publish(caughtUp)
 	return nil
 }
 
-// CatchupVault catches up a vault to a specific block
-func (vm *Manager) CatchupVault(vault models.VaultRegistry, toBlock uint64) error {
-
-	var fromBlock *rpc.BlockID
-	vm.log.Printf("Vault registry: %v", vault.LastBlockIndexed)
-	vm.log.Printf("Last block indexed: %v", vault)
-	hash := *vault.LastBlockIndexed
-
-	nextBlock, err := vm.db.GetNextBlock(hash)
+// catchupVaultWindow indexes the vault's events in [fromBlock, windowEnd] one page per transaction,
+// resuming from checkpoint when given. The last page advances the vault's cursor to windowEnd and
+// stores a CatchupVault driver event for the window.
+func (vm *Manager) catchupVaultWindow(ctx context.Context, vault *models.VaultRegistry, fromBlock, windowEnd, target uint64, checkpoint *models.VaultCheckpoint) error {
+	normalizedVaultAddress, err := utils.NormalizeHexAddress(vault.Address)
 	if err != nil {
 		return err
 	}
 
-	if nextBlock == nil {
-		//get last block from db
-		lastBlock, err := vm.db.GetBlock(hash)
+	var token string
+	var stored int64
+	if checkpoint != nil {
+		token = checkpoint.ContinuationToken
+		stored = checkpoint.EventsStored
+		vm.log.Info("Resuming vault catchup", logging.VaultAddress(vault.Address), "from_block", fromBlock, "to_block", windowEnd, "events", stored)
+	}
+	// restart is set when the pages committed under a rejected token have to be replaced
+	restart := false
+
+	for {
+		// Stopping between pages leaves the last committed page's checkpoint to resume from
+		if err := vm.ctx.Err(); err != nil {
+			return err
+		}
+		page, err := vm.network.GetEventsPage(ctx, fromBlock, windowEnd, vault.Address, token)
+		if token != "" && network.IsInvalidContinuationToken(err) {
+			vm.log.Warn("Continuation token was rejected, fetching the window again", logging.VaultAddress(vault.Address), "from_block", fromBlock, "to_block", windowEnd)
+			metrics.VaultCatchupRestarts.WithLabelValues(vault.Address).Inc()
+			token, stored, restart = "", 0, true
+			continue
+		}
 		if err != nil {
 			return err
 		}
 
-		if lastBlock == nil {
-			lastBlockNetwork, err := vm.network.GetBlockByHash(hash)
-			if err != nil {
+		events, err := vm.decodeVaultEvents(ctx, vault, page.Events)
+		if err != nil {
+			return err
+		}
+		stored += int64(len(events))
+
+		// The window's end hash and subscription matches are fetched before the transaction to keep it short
+		var endBlockHash string
+		var backfill *subscriptionBackfill
+		if page.ContinuationToken == "" {
+			if endBlockHash, err = vm.blockHash(ctx, windowEnd); err != nil {
 				return err
 			}
-			nextBlocks, err := vm.network.GetBlocks(lastBlockNetwork.BlockHeader.Number+1, lastBlockNetwork.BlockHeader.Number+1)
-			if len(nextBlocks) == 0 {
-				vm.log.Printf("No blocks returned for block number: %d", lastBlockNetwork.BlockHeader.Number+1)
-				return fmt.Errorf("no block found at number %d", lastBlockNetwork.BlockHeader.Number+1)
+			if backfill, err = vm.fetchSubscriptionEvents(ctx, normalizedVaultAddress, fromBlock, windowEnd); err != nil {
+				return err
 			}
-			log.Printf("nextBlocks %v", nextBlocks)
-			nextBlock = nextBlocks[0]
-			//create new int
-			fromBlock = &rpc.BlockID{Number: &nextBlock.BlockNumber}
 		}
 
+		tx, err := vm.db.Begin(ctx)
+		if err != nil {
+			return err
+		}
+		if err := vm.storeCatchupPage(tx, vault, normalizedVaultAddress, events, restart, &models.VaultCheckpoint{
+			VaultAddress:      vault.Address,
+			BlockNumber:       fromBlock,
+			WindowEnd:         windowEnd,
+			ContinuationToken: page.ContinuationToken,
+			TargetBlock:       target,
+			EventsStored:      stored,
+		}, endBlockHash, backfill); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		restart = false
+		vm.publishVaultEvents(events)
+
+		metrics.VaultCatchupEvents.WithLabelValues(vault.Address).Add(float64(len(events)))
+		metrics.VaultCatchupCheckpoints.WithLabelValues(vault.Address).Inc()
+		if page.ContinuationToken != "" {
+			token = page.ContinuationToken
+			continue
+		}
+
+		vault.LastBlockIndexed = &endBlockHash
+		metrics.VaultCatchupBlock.WithLabelValues(vault.Address).Set(float64(windowEnd))
+		vm.setCatchupProgress(vault.Address, windowEnd, target)
+		vm.log.Info("Vault caught up window", logging.VaultAddress(vault.Address), "from_block", fromBlock, "to_block", windowEnd, "target_block", target, "events", stored)
+		return nil
+	}
+}
+
+// storeCatchupPage stores a page of a catchup window in tx with its checkpoint. For the last page,
+// the one without a continuation token, it moves the vault's cursor to endBlockHash instead and
+// stores the window's subscription matches.
+func (vm *Manager) storeCatchupPage(tx *db.DB, vault *models.VaultRegistry, normalizedVaultAddress string, events []*models.Event, restart bool, checkpoint *models.VaultCheckpoint, endBlockHash string, backfill *subscriptionBackfill) error {
+	if restart {
+		deleted, err := tx.DeleteVaultEventsInRange(normalizedVaultAddress, checkpoint.BlockNumber, checkpoint.WindowEnd)
+		if err != nil {
+			return err
+		}
+		vm.log.Info("Deleted events stored from rejected pages", logging.VaultAddress(vault.Address), "events", deleted)
+	}
+	if _, err := tx.StoreEvents(events); err != nil {
+		return fmt.Errorf("failed to store events of vault %s: %w", vault.Address, err)
+	}
+	if restart {
+		// The replaced events may not have been the vault's latest, restore nonce order by block
+		if err := tx.RenumberVaultEventNonces(normalizedVaultAddress); err != nil {
+			return err
+		}
+	}
+
+	if checkpoint.ContinuationToken != "" {
+		return tx.SaveVaultCheckpoint(checkpoint)
 	}
 
-	if *fromBlock.Number > toBlock {
-		vm.log.Println("From block is greater than to block, wait to catch up")
+	if err := vm.storeSubscriptionEvents(tx, normalizedVaultAddress, checkpoint.BlockNumber, checkpoint.WindowEnd, backfill); err != nil {
+		return err
+	}
+	startBlockHash := *vault.LastBlockIndexed // fromBlock parent hash
+	if err := tx.UpdateVaultRegistry(vault.Address, endBlockHash); err != nil {
+		return err
+	}
+	if err := tx.StoreVaultCatchupEvent(vault.Address, startBlockHash, endBlockHash); err != nil {
+		return fmt.Errorf("failed to store catchup event of vault %s: %w", vault.Address, err)
+	}
+	if err := tx.DeleteVaultCheckpoint(vault.Address); err != nil {
+		return err
+	}
+
+	// Send vault catchup event after successful catchup
+	vm.log.Debug("Stored vault catchup event", logging.VaultAddress(vault.Address), "start_block_hash", startBlockHash, "end_block_hash", endBlockHash)
+	return nil
+}
+
+// subscriptionBackfill is what subscriptions matched for a vault over a range of blocks
+type subscriptionBackfill struct {
+	subscriptions []string
+	events        []*models.ContractEvent
+}
+
+// fetchSubscriptionEvents fetches the subscription matches of a vault in [fromBlock, toBlock], nil
+// when no subscription can be backfilled
+func (vm *Manager) fetchSubscriptionEvents(ctx context.Context, normalizedVaultAddress string, fromBlock, toBlock uint64) (*subscriptionBackfill, error) {
+	if vm.subscriptions == nil {
+		return nil, nil
+	}
+	subscriptions, events, err := vm.subscriptions.VaultEvents(ctx, normalizedVaultAddress, fromBlock, toBlock)
+	if err != nil || len(subscriptions) == 0 {
+		return nil, err
+	}
+	return &subscriptionBackfill{subscriptions: subscriptions, events: events}, nil
+}
+
+// storeSubscriptionEvents replaces the subscription matches of a vault in [fromBlock, toBlock] with
+// the fetched ones in tx
+func (vm *Manager) storeSubscriptionEvents(tx *db.DB, normalizedVaultAddress string, fromBlock, toBlock uint64, backfill *subscriptionBackfill) error {
+	if backfill == nil {
 		return nil
 	}
+	stored, err := tx.ReplaceVaultSubscriptionEvents(normalizedVaultAddress, fromBlock, toBlock, backfill.subscriptions, backfill.events)
+	if err != nil {
+		return fmt.Errorf("failed to store subscription events of vault %s: %w", normalizedVaultAddress, err)
+	}
+	if stored > 0 {
+		vm.log.Info("Stored subscription events", logging.VaultAddress(normalizedVaultAddress), "from_block", fromBlock, "to_block", toBlock, "events", stored)
+	}
+	return nil
+}
 
-	events, err := vm.network.GetEvents(*fromBlock, rpc.BlockID{Number: &toBlock}, &vault.Address)
+// replayVaultEvents fetches the vault's events in [fromBlock, toBlock] from the network and stores
+// them in tx with its subscription matches, catchupWindow blocks at a time so only one window is
+// held in memory
+func (vm *Manager) replayVaultEvents(ctx context.Context, tx *db.DB, vault *models.VaultRegistry, fromBlock, toBlock uint64) (int, error) {
+	normalizedVaultAddress, err := utils.NormalizeHexAddress(vault.Address)
 	if err != nil {
-		vm.log.Println("Error getting events", err)
-		return err
+		return 0, err
 	}
+	replayed := 0
+	for windowStart := fromBlock; windowStart <= toBlock; {
+		windowEnd := min(windowStart+vm.catchupWindow-1, toBlock)
+		events, err := vm.network.GetEvents(ctx, rpc.BlockID{Number: &windowStart}, rpc.BlockID{Number: &windowEnd}, &vault.Address)
+		if err != nil {
+			return 0, err
+		}
 
-	vm.db.BeginTx()
-	for _, event := range events.Events {
+		// The window is written with one bulk insert rather than a round trip per event
+		decoded, err := vm.decodeVaultEvents(ctx, vault, events.Events)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.StoreEvents(decoded); err != nil {
+			return 0, fmt.Errorf("failed to store events of vault %s: %w", vault.Address, err)
+		}
+		backfill, err := vm.fetchSubscriptionEvents(ctx, normalizedVaultAddress, windowStart, windowEnd)
+		if err != nil {
+			return 0, err
+		}
+		if err := vm.storeSubscriptionEvents(tx, normalizedVaultAddress, windowStart, windowEnd, backfill); err != nil {
+			return 0, err
+		}
+		replayed += len(events.Events)
+		windowStart = windowEnd + 1
+	}
+	return replayed, nil
+}
+
+// decodeVaultEvents converts fetched vault events into their stored form
+func (vm *Manager) decodeVaultEvents(ctx context.Context, vault *models.VaultRegistry, events []rpc.EmittedEvent) ([]*models.Event, error) {
+	decoded := make([]*models.Event, 0, len(events))
+	for _, event := range events {
 		coreEvent := core.Event{
 			From: event.FromAddress,
 			Keys: event.Keys,
 			Data: event.Data,
 		}
-		err := vm.ProcessVaultEvent(event.TransactionHash.String(), vault.Address, &coreEvent, event.BlockNumber, *event.BlockHash)
+		vaultEvent, err := vm.decodeVaultEvent(ctx, event.TransactionHash.String(), vault.Address, &coreEvent, event.BlockNumber, *event.BlockHash)
 		if err != nil {
-			vm.log.Println("Error processing vault event", err)
-			vm.db.RollbackTx()
-			return err
-
+			return nil, err
 		}
+		decoded = append(decoded, vaultEvent)
 	}
+	return decoded, nil
+}
 
-	//Store block as well, nextBlock should never be null by the time we reach here
-	if err := vm.db.InsertBlock(nextBlock); err != nil {
-		vm.db.RollbackTx()
+// nextBlockToIndex returns the number of the block after the vault's last indexed block
+func (vm *Manager) nextBlockToIndex(ctx context.Context, vault *models.VaultRegistry) (uint64, error) {
+	if vault.LastBlockIndexed == nil {
+		return 0, fmt.Errorf("vault %s is not initialized", vault.Address)
+	}
+	hash := *vault.LastBlockIndexed
+
+	lastBlock, err := vm.db.GetBlock(hash)
+	if err != nil {
+		return 0, err
+	}
+	if lastBlock != nil {
+		return lastBlock.BlockNumber + 1, nil
+	}
+
+	lastBlockNetwork, err := vm.network.GetBlockByHash(ctx, hash)
+	if err != nil {
+		return 0, err
+	}
+	return lastBlockNetwork.BlockHeader.Number + 1, nil
+}
+
+// blockHash returns the hash of the block at number, from the network
+func (vm *Manager) blockHash(ctx context.Context, number uint64) (string, error) {
+	blocks, err := vm.network.GetBlocks(ctx, number, number)
+	if err != nil {
+		return "", err
+	}
+	if len(blocks) == 0 {
+		return "", fmt.Errorf("no block found at number %d", number)
+	}
+	return blocks[0].BlockHash, nil
+}
+
+// setLastBlockIndexed updates the cursor of a tracked vault after a committed catchup
+func (vm *Manager) setLastBlockIndexed(address string, blockHash string) {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	if vault, exists := vm.vaultRegistryMap[address]; exists {
+		vault.LastBlockIndexed = &blockHash
+	}
+}
+
+// catchupProgress is the last block a catching up vault has indexed and the block it works towards,
+// both zero until its catchup starts
+type catchupProgress struct {
+	block  uint64
+	target uint64
+}
+
+// setCatchupProgress records the progress of a vault that is catching up
+func (vm *Manager) setCatchupProgress(address string, block, target uint64) {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	if _, catchingUp := vm.catchingUp[address]; catchingUp {
+		vm.catchingUp[address] = catchupProgress{block: block, target: target}
+	}
+}
+
+// RecatchupVault re-indexes a vault over [fromBlock, toBlock], replacing the events already stored for that range
+func (vm *Manager) RecatchupVault(ctx context.Context, vault models.VaultRegistry, fromBlock, toBlock uint64) error {
+	if fromBlock > toBlock {
+		return fmt.Errorf("invalid block range %d-%d", fromBlock, toBlock)
+	}
+
+	// Boundary hashes for the CatchupVault driver event
+	startBlockHash, err := vm.blockHash(ctx, fromBlock)
+	if err != nil {
+		return err
+	}
+	endBlockHash, err := vm.blockHash(ctx, toBlock)
+	if err != nil {
 		return err
 	}
-	startBlockHash := hash              // fromBlock hash
-	endBlockHash := nextBlock.BlockHash // toBlock hash
 
-	err = vm.db.StoreVaultCatchupEvent(vault.Address, startBlockHash, endBlockHash)
+	normalizedVaultAddress, err := utils.NormalizeHexAddress(vault.Address)
 	if err != nil {
-		vm.log.Printf("Error storing vault catchup event: %v", err)
-		vm.db.RollbackTx()
 		return err
 	}
-	vm.db.CommitTx()
 
-	// Send vault catchup event after successful catchup
-	vm.log.Printf("Stored and notified vault catchup event for vault %s, blocks %s-%s", vault.Address, startBlockHash, endBlockHash)
+	tx, err := vm.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	deleted, err := tx.DeleteVaultEventsInRange(normalizedVaultAddress, fromBlock, toBlock)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	replayed, err := vm.replayVaultEvents(ctx, tx, &vault, fromBlock, toBlock)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Replayed events were appended, restore nonce order by block
+	if err := tx.RenumberVaultEventNonces(normalizedVaultAddress); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.StoreVaultCatchupEvent(vault.Address, startBlockHash, endBlockHash); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to store catchup event of vault %s: %w", vault.Address, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	vm.publishReplayedEvents(bus.VaultReindexed{VaultAddress: vault.Address, FromBlock: fromBlock, ToBlock: toBlock, BlockHash: endBlockHash})
+
+	vm.log.Info("Re-indexed vault", logging.VaultAddress(vault.Address), "from_block", fromBlock, "to_block", toBlock, "deleted", deleted, "replayed", replayed)
 	return nil
 }
 
-// IsVaultAddress checks if an address is a tracked vault
+// ReindexVault rebuilds a vault's events, and their subscription matches, from its deployment block while
+// live indexing continues. Class history and storage diffs come from state updates and are kept.
+//
+// The bulk of the replay runs in its own transaction up to the head at the time the reindex starts,
+// live blocks keep being indexed meanwhile. The remaining blocks are replayed with block processing
+// paused, replacing whatever live indexing stored for them, and everything commits at once so readers
+// never see a partially rebuilt vault and no live event is lost or stored twice.
+func (vm *Manager) ReindexVault(ctx context.Context, address string, barrier BlockBarrier) error {
+	vm.mu.Lock()
+	if _, running := vm.reindexing[address]; running {
+		vm.mu.Unlock()
+		return fmt.Errorf("vault %s is already being reindexed", address)
+	}
+	if _, catchingUp := vm.catchingUp[address]; catchingUp {
+		vm.mu.Unlock()
+		return fmt.Errorf("vault %s is still catching up", address)
+	}
+	vm.reindexing[address] = struct{}{}
+	vm.mu.Unlock()
+	defer func() {
+		vm.mu.Lock()
+		delete(vm.reindexing, address)
+		vm.mu.Unlock()
+	}()
+
+	vault, err := vm.db.GetVaultRegistryByAddress(address)
+	if err != nil {
+		return fmt.Errorf("failed to get vault %s: %w", address, err)
+	}
+	normalizedVaultAddress, err := utils.NormalizeHexAddress(vault.Address)
+	if err != nil {
+		return err
+	}
+	head, err := vm.db.GetLastBlock()
+	if err != nil {
+		return err
+	}
+
+	tx, err := vm.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+
+	vm.log.Info("Reindexing vault", logging.VaultAddress(vault.Address), "deployed_at", vault.DeployedAt)
+	if err := tx.DeleteVaultEvents(normalizedVaultAddress); err != nil {
+		return err
+	}
+	if err := tx.ResetVaultRegistry(vault.Address); err != nil {
+		return err
+	}
+	vault.LastBlockIndexed = nil
+	if _, err := vm.initializeVault(ctx, tx, &vault); err != nil {
+		return err
+	}
+	nextBlock, err := vm.nextBlockToIndex(ctx, &vault)
+	if err != nil {
+		return err
+	}
+	reindexed := bus.VaultReindexed{VaultAddress: vault.Address, FromBlock: nextBlock - 1}
+	if head != nil {
+		if err := vm.reindexUpTo(ctx, tx, &vault, head.BlockNumber); err != nil {
+			return err
+		}
+	}
+
+	err = barrier.WithBlocksPaused(func(head *models.StarknetBlocks) error {
+		if head != nil {
+			fromBlock, err := vm.nextBlockToIndex(ctx, &vault)
+			if err != nil {
+				return err
+			}
+			// Rows above the replayed range were written by live indexing during the replay
+			if err := tx.DeleteVaultEventsAfter(normalizedVaultAddress, fromBlock-1); err != nil {
+				return err
+			}
+			if err := vm.reindexUpTo(ctx, tx, &vault, head.BlockNumber); err != nil {
+				return err
+			}
+		}
+		// Replayed events were appended, restore nonce order by block
+		if err := tx.RenumberVaultEventNonces(normalizedVaultAddress); err != nil {
+			return err
+		}
+		if err := tx.StoreVaultReindexEvent(vault.Address, vault.DeployedAt, *vault.LastBlockIndexed); err != nil {
+			return err
+		}
+		nextBlock, err := vm.nextBlockToIndex(ctx, &vault)
+		if err != nil {
+			return err
+		}
+		reindexed.ToBlock, reindexed.BlockHash = nextBlock-1, *vault.LastBlockIndexed
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		committed = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reindex vault %s: %w", vault.Address, err)
+	}
+
+	vm.setLastBlockIndexed(vault.Address, *vault.LastBlockIndexed)
+	vm.publishReplayedEvents(reindexed)
+	vm.log.Info("Reindexed vault", logging.VaultAddress(vault.Address), logging.BlockHash(*vault.LastBlockIndexed))
+	return nil
+}
+
+// reindexUpTo replays the vault's events from its cursor to toBlock within tx and advances the cursor.
+// Unlike catchupVault it stores no CatchupVault event, the reindex reports once when it commits.
+func (vm *Manager) reindexUpTo(ctx context.Context, tx *db.DB, vault *models.VaultRegistry, toBlock uint64) error {
+	fromBlock, err := vm.nextBlockToIndex(ctx, vault)
+	if err != nil {
+		return err
+	}
+	if fromBlock > toBlock {
+		return nil
+	}
+	if _, err := vm.replayVaultEvents(ctx, tx, vault, fromBlock, toBlock); err != nil {
+		return err
+	}
+	endBlockHash, err := vm.blockHash(ctx, toBlock)
+	if err != nil {
+		return err
+	}
+	if err := tx.UpdateVaultRegistry(vault.Address, endBlockHash); err != nil {
+		return err
+	}
+	vault.LastBlockIndexed = &endBlockHash
+	return nil
+}
+
+// ReindexAllVaults reindexes every registered vault, one at a time
+func (vm *Manager) ReindexAllVaults(ctx context.Context, barrier BlockBarrier) error {
+	vaultRegistry, err := vm.db.GetVaultRegistry()
+	if err != nil {
+		return fmt.Errorf("failed to get vault registry: %w", err)
+	}
+	var errs []error
+	for _, vault := range vaultRegistry {
+		if err := vm.ReindexVault(ctx, vault.Address, barrier); err != nil {
+			vm.log.Error("Failed to reindex vault", logging.VaultAddress(vault.Address), "error", err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SetSubscriptionBackfill backfills subscription matches over the blocks vaults catch up and replay
+func (vm *Manager) SetSubscriptionBackfill(subscriptions SubscriptionBackfill) {
+	vm.subscriptions = subscriptions
+}
+
+// SetBus publishes the vault events stored by initialization, catchup, reindexes and recatchups,
+// and catchup and replay completions, on b
+func (vm *Manager) SetBus(b *bus.Bus) {
+	vm.bus = b
+}
+
+// publishVaultEvents publishes committed events indexed from the node
+func (vm *Manager) publishVaultEvents(events []*models.Event) {
+	if len(events) == 0 {
+		return
+	}
+	published := make([]bus.Event, len(events))
+	for i, event := range events {
+		published[i] = bus.VaultEvent{Event: event, Catchup: true}
+	}
+	vm.bus.Publish(published...)
+}
+
+// publishReplayedEvents publishes a committed reindex or recatchup followed by the events it
+// stored, read back a page at a time so a vault's whole history is never held in memory
+func (vm *Manager) publishReplayedEvents(reindexed bus.VaultReindexed) {
+	if vm.bus == nil {
+		return
+	}
+	vm.bus.Publish(reindexed)
+	normalizedVaultAddress, err := utils.NormalizeHexAddress(reindexed.VaultAddress)
+	if err != nil {
+		vm.log.Error("Failed to publish replayed events", logging.VaultAddress(reindexed.VaultAddress), "error", err)
+		return
+	}
+	for afterNonce := 0; ; {
+		events, err := vm.db.GetVaultEventsInRange(normalizedVaultAddress, reindexed.FromBlock, reindexed.ToBlock, afterNonce, replayedEventsPage)
+		if err != nil {
+			vm.log.Error("Failed to publish replayed events", logging.VaultAddress(reindexed.VaultAddress), "error", err)
+			return
+		}
+		if len(events) == 0 {
+			return
+		}
+		vm.publishVaultEvents(events)
+		afterNonce = events[len(events)-1].EventNonce
+	}
+}
+
+// SetVaultPaused pauses or resumes live indexing of a tracked vault
+func (vm *Manager) SetVaultPaused(address string, paused bool) {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	if vault, exists := vm.vaultRegistryMap[address]; exists {
+		vault.Paused = paused
+	}
+}
+
+// RemoveVault stops tracking a vault
+func (vm *Manager) RemoveVault(address string) {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+	delete(vm.vaultRegistryMap, address)
+	delete(vm.catchingUp, address)
+}
+
+// IsVaultAddress checks if an address is a tracked vault indexed live, one that is neither paused
+// nor still catching up
 func (vm *Manager) IsVaultAddress(address string) bool {
-	_, exists := vm.vaultRegistryMap[address]
-	return exists
+	vm.mu.RLock()
+	defer vm.mu.RUnlock()
+	vault, exists := vm.vaultRegistryMap[address]
+	_, catchingUp := vm.catchingUp[address]
+	return exists && !vault.Paused && !catchingUp
+}
+
+// IsTrackedVault checks if an address is a tracked vault that is not paused, including vaults still
+// catching up
+func (vm *Manager) IsTrackedVault(address string) bool {
+	vm.mu.RLock()
+	defer vm.mu.RUnlock()
+	vault, exists := vm.vaultRegistryMap[address]
+	return exists && !vault.Paused
+}
+
+// TrackedVault is the indexing state of a tracked vault
+type TrackedVault struct {
+	Address          string
+	Paused           bool
+	LastBlockIndexed *string
+	// CatchingUp is set until the vault's startup catchup hands over to live indexing
+	CatchingUp bool
+	// CatchupBlock is the last block the catchup indexed and CatchupTarget the block it works towards
+	CatchupBlock  uint64
+	CatchupTarget uint64
+}
+
+// TrackedVaults returns the indexing state of the tracked vaults sorted by address
+func (vm *Manager) TrackedVaults() []TrackedVault {
+	vm.mu.RLock()
+	defer vm.mu.RUnlock()
+	vaults := make([]TrackedVault, 0, len(vm.vaultRegistryMap))
+	for address, vault := range vm.vaultRegistryMap {
+		progress, catchingUp := vm.catchingUp[address]
+		vaults = append(vaults, TrackedVault{
+			Address:          address,
+			Paused:           vault.Paused,
+			LastBlockIndexed: vault.LastBlockIndexed,
+			CatchingUp:       catchingUp,
+			CatchupBlock:     progress.block,
+			CatchupTarget:    progress.target,
+		})
+	}
+	sort.Slice(vaults, func(i, j int) bool { return vaults[i].Address < vaults[j].Address })
+	return vaults
 }
 
 // GetVaultAddresses returns all tracked vault addresses
 func (vm *Manager) GetVaultAddresses() map[string]struct{} {
+	vm.mu.RLock()
+	defer vm.mu.RUnlock()
 
 	//Hacky faster fix, instead update the usage of this function to avoid translating here
 	addresses := make(map[string]struct{})
@@ -259,33 +1035,54 @@ func (vm *Manager) GetVaultAddresses() map[string]struct{} {
 	return addresses
 }
 
-// processDeploymentBlockEvents processes events from the deployment block
-func (vm *Manager) processDeploymentBlockEvents(events *rpc.EventChunk, vault *models.VaultRegistry) error {
-	eventNameHash := utils.Keccak256("ContractDeployed")
-	for index, event := range events.Events {
-		vm.log.Printf("index: %v", index)
-		vm.log.Printf("Event from address: %v", event.FromAddress.String())
-		vm.log.Printf("UDC address: %v", vm.udcAddress)
+// contractDeployedSelector selects the UDC's ContractDeployed event
+var contractDeployedSelector = utils.Keccak256("ContractDeployed")
 
-		if eventNameHash == event.Keys[0].String() && event.FromAddress.String() == vm.udcAddress {
-			vm.log.Printf("Match")
+// processDeploymentBlockEvents processes events from the deployment block and returns the stored ones
+func (vm *Manager) processDeploymentBlockEvents(ctx context.Context, tx *db.DB, events *rpc.EventChunk, vault *models.VaultRegistry) ([]*models.Event, error) {
+	var stored []*models.Event
+	for _, event := range events.Events {
+		if contractDeployedSelector == event.Keys[0].String() && event.FromAddress.String() == vm.udcAddress {
 			address := utils.FeltToHexString(event.Data[0].Bytes())
-			vm.log.Printf("Address: %v", address)
-			vm.log.Printf("Vault address: %v", vault.Address)
+			vm.log.Debug("Found UDC deployment", "address", address, logging.VaultAddress(vault.Address), logging.BlockNumber(event.BlockNumber))
 
 			normalizedVaultAddress, err := utils.NormalizeHexAddress(vault.Address)
 			if err != nil {
-				vm.log.Printf("Error normalizing address: %v", err)
-				return err
+				return nil, err
 			}
 
 			if address == normalizedVaultAddress {
-				txHash := utils.FeltToHexString(event.TransactionHash.Bytes())
-				eventKeys := utils.FeltArrayToStringArrays(event.Keys)
-				eventData := utils.FeltArrayToStringArrays(event.Data)
-				blockHash := utils.FeltToHexString(event.BlockHash.Bytes())
+				// ContractDeployed data is address, deployer, unique, class hash, calldata..., salt
+				if len(vm.vaultClassHashes) > 0 && len(event.Data) > 3 {
+					if _, ok := vm.vaultClassHashes[event.Data[3].String()]; !ok {
+						vm.log.Warn("Vault was deployed with a class that is not a configured vault class", logging.VaultAddress(vault.Address), "class_hash", event.Data[3].String())
+					}
+				}
+				deployed := &models.Event{
+					TransactionHash: utils.FeltToHexString(event.TransactionHash.Bytes()),
+					BlockNumber:     event.BlockNumber,
+					BlockHash:       utils.FeltToHexString(event.BlockHash.Bytes()),
+					VaultAddress:    address,
+					EventName:       "ContractDeployed",
+					EventKeys:       utils.FeltArrayToStringArrays(event.Keys),
+					EventData:       utils.FeltArrayToStringArrays(event.Data),
+				}
+				blockHash := deployed.BlockHash
 
-				vm.db.StoreEvent(txHash, address, event.BlockNumber, blockHash, "ContractDeployed", eventKeys, eventData)
+				if err := tx.StoreEvent(deployed.TransactionHash, address, event.BlockNumber, blockHash, deployed.EventName, deployed.EventKeys, deployed.EventData, nil); err != nil {
+					return nil, err
+				}
+				stored = append(stored, deployed)
+				if len(event.Data) > 3 {
+					if err := vm.recordClass(tx, &models.VaultClass{
+						VaultAddress: address,
+						BlockNumber:  event.BlockNumber,
+						BlockHash:    blockHash,
+						ClassHash:    event.Data[3].String(),
+					}, false); err != nil {
+						return nil, err
+					}
+				}
 				vault.LastBlockIndexed = &blockHash
 				break
 			}
@@ -301,40 +1098,77 @@ func (vm *Manager) processDeploymentBlockEvents(events *rpc.EventChunk, vault *m
 		}
 		normalizedVaultAddress, err := utils.NormalizeHexAddress(vault.Address)
 		if err != nil {
-			vm.log.Printf("Error normalizing address %v", err)
-			return err
+			return nil, err
 		}
 		if utils.FeltToHexString(event.FromAddress.Bytes()) == normalizedVaultAddress {
-			err := vm.ProcessVaultEvent(event.TransactionHash.String(), vault.Address, &junoEvent, event.BlockNumber, *event.BlockHash)
+			vaultEvent, err := vm.processVaultEvent(ctx, tx, event.TransactionHash.String(), vault.Address, &junoEvent, event.BlockNumber, *event.BlockHash)
 			if err != nil {
-				return err
+				return nil, err
 			}
-			vm.db.UpdateVaultRegistry(vault.Address, event.BlockHash.String())
+			stored = append(stored, vaultEvent)
 		}
 	}
-	return nil
+	return stored, nil
+}
+
+// ProcessVaultEvent processes a vault event within the block processor's transaction and returns
+// the stored event
+func (vm *Manager) ProcessVaultEvent(ctx context.Context, txHash string, vaultAddress string, event *core.Event, blockNumber uint64, blockHash felt.Felt) (*models.Event, error) {
+	return vm.processVaultEvent(ctx, vm.db, txHash, vaultAddress, event, blockNumber, blockHash)
 }
 
-// ProcessVaultEvent processes a vault event
-func (vm *Manager) ProcessVaultEvent(txHash string, vaultAddress string, event *core.Event, blockNumber uint64, blockHash felt.Felt) error {
+// processVaultEvent decodes a vault event and stores it in tx
+func (vm *Manager) processVaultEvent(ctx context.Context, tx *db.DB, txHash string, vaultAddress string, event *core.Event, blockNumber uint64, blockHash felt.Felt) (*models.Event, error) {
+	vaultEvent, err := vm.decodeVaultEvent(ctx, txHash, vaultAddress, event, blockNumber, blockHash)
+	if err != nil {
+		return nil, err
+	}
+
 	// Store the event in the database
+	if err := tx.StoreEvent(vaultEvent.TransactionHash, vaultEvent.VaultAddress, vaultEvent.BlockNumber, vaultEvent.BlockHash, vaultEvent.EventName, vaultEvent.EventKeys, vaultEvent.EventData, vaultEvent.DecodedData); err != nil {
+		return nil, err
+	}
+	return vaultEvent, nil
+}
+
+// decodeVaultEvent converts a vault event into its stored form. Events no decoder recognises are
+// stored as abi.UnknownEvent.
+func (vm *Manager) decodeVaultEvent(ctx context.Context, txHash string, vaultAddress string, event *core.Event, blockNumber uint64, blockHash felt.Felt) (*models.Event, error) {
 	normalizedVaultAddress, err := utils.NormalizeHexAddress(vaultAddress)
 	if err != nil {
-		vm.log.Printf("Error normalizing address %v", err)
-		return err
+		return nil, err
 	}
 
-	eventName, err := utils.DecodeEventNameVault(event.Keys[0].String())
+	// Decode with the class the vault had at the event's block
+	decoders, err := vm.decodersAt(ctx, normalizedVaultAddress, blockNumber)
 	if err != nil {
-		vm.log.Printf("Unknown Event")
-		return nil
+		return nil, err
+	}
+	keys, data := utils.EventToStringArrays(*event)
+	vaultEvent := &models.Event{
+		TransactionHash: txHash,
+		BlockNumber:     blockNumber,
+		BlockHash:       utils.FeltToHexString(blockHash.Bytes()),
+		VaultAddress:    normalizedVaultAddress,
+		EventKeys:       keys,
+		EventData:       data,
+	}
+	for _, decoder := range decoders {
+		decoded, ok := decoder.DecodeEvent(keys, data)
+		if !ok {
+			continue
+		}
+		vaultEvent.EventName, vaultEvent.DecodedData = decoded.Name, decoded.Payload
+		if decoded.Err != nil {
+			vm.log.Warn("Stored vault event without payload", logging.VaultAddress(normalizedVaultAddress), logging.BlockNumber(blockNumber), "error", decoded.Err)
+		}
+		vm.log.Debug("Decoded vault event", logging.VaultAddress(normalizedVaultAddress), logging.BlockNumber(blockNumber), "event", decoded.Name, "transaction_hash", txHash)
+		return vaultEvent, nil
 	}
 
-	// Store the event in the database
-	eventKeys, eventData := utils.EventToStringArrays(*event)
-	blockHashNormalized := utils.FeltToHexString(blockHash.Bytes())
-	if err := vm.db.StoreEvent(txHash, normalizedVaultAddress, blockNumber, blockHashNormalized, eventName, eventKeys, eventData); err != nil {
-		return err
+	vaultEvent.EventName = abi.UnknownEvent
+	if len(vaultEvent.EventKeys) > 0 {
+		vm.log.Debug("Unknown vault event", logging.VaultAddress(normalizedVaultAddress), logging.BlockNumber(blockNumber), "selector", vaultEvent.EventKeys[0])
 	}
-	return nil
+	return vaultEvent, nil
 }
@@ -0,0 +1,464 @@
+//go:build integration
+
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"junoplugin/db"
+	"junoplugin/db/dbtest"
+	"junoplugin/models"
+	"junoplugin/network/networktest"
+	"junoplugin/plugin/bus"
+	"junoplugin/utils"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/NethermindEth/juno/core"
+	"github.com/NethermindEth/juno/core/felt"
+)
+
+const (
+	testUDC   = "0x4a"
+	testVault = "0xbeef"
+)
+
+// storedEvent is a row of the events table
+type storedEvent struct {
+	BlockNumber     uint64
+	EventName       string
+	TransactionHash string
+}
+
+func vaultEvents(t *testing.T, dbClient *db.DB, address string) []storedEvent {
+	t.Helper()
+	rows, err := dbClient.Pool.Query(context.Background(), `
+		SELECT block_number, event_name, transaction_hash FROM events
+		WHERE vault_address = $1 ORDER BY event_nonce`, address)
+	if err != nil {
+		t.Fatalf("Failed to query events: %v", err)
+	}
+	defer rows.Close()
+	var events []storedEvent
+	for rows.Next() {
+		var event storedEvent
+		if err := rows.Scan(&event.BlockNumber, &event.EventName, &event.TransactionHash); err != nil {
+			t.Fatalf("Failed to scan event: %v", err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// driverEvent is a driver_events notification
+type driverEvent struct {
+	Type           string  `json:"type"`
+	BlockHash      *string `json:"block_hash"`
+	StartBlockHash *string `json:"start_block_hash"`
+	EndBlockHash   *string `json:"end_block_hash"`
+	VaultAddress   *string `json:"vault_address"`
+}
+
+func nextDriverEvent(t *testing.T, notifications *dbtest.Notifications) driverEvent {
+	t.Helper()
+	var event driverEvent
+	notification := notifications.Next(2 * time.Second)
+	if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+		t.Fatalf("Failed to parse driver event %s: %v", notification.Payload, err)
+	}
+	return event
+}
+
+func value(s *string) string {
+	if s == nil {
+		return "<nil>"
+	}
+	return *s
+}
+
+func TestManagerInitializeAndCatchup(t *testing.T) {
+	dbClient, dbURL := dbtest.New(t)
+	node := networktest.NewServer(t, 20)
+	deposit := utils.Keccak256("Deposit")
+	node.AddEvents(
+		networktest.ContractDeployed(testUDC, testVault, "0xc1", 5),
+		networktest.Event{BlockNumber: 5, From: testVault, Keys: []string{deposit}, Data: []string{"0x1"}},
+		networktest.Event{BlockNumber: 8, From: testVault, Keys: []string{deposit}, Data: []string{"0x2"}},
+		networktest.Event{BlockNumber: 12, From: testVault, Keys: []string{deposit}, Data: []string{"0x3"}},
+		// Events of other contracts are not the vault's
+		networktest.Event{BlockNumber: 8, From: "0xcafe", Keys: []string{deposit}},
+	)
+	node.SetClass(testVault, 5, "0xc1")
+	node.SetClass(testVault, 11, "0xc2")
+
+	vm := NewManager(dbClient, node.Network(t), testUDC, []string{"0xc1", "0xc2"}, 4, 1, false, slog.New(slog.DiscardHandler))
+	t.Cleanup(vm.Stop)
+	ctx := context.Background()
+	eventBus := bus.New(slog.New(slog.DiscardHandler))
+	vm.SetBus(eventBus)
+	subscription, err := eventBus.Subscribe(bus.Options{Name: "test"})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	dbClient.BeginTx(ctx)
+	if err := dbClient.InsertVault(&models.VaultRegistry{Address: testVault, DeployedAt: networktest.BlockHash(5)}); err != nil {
+		t.Fatalf("Failed to register vault: %v", err)
+	}
+	dbClient.CommitTx()
+	registered, err := dbClient.GetVaultRegistryByAddress(testVault)
+	if err != nil {
+		t.Fatalf("Failed to get vault: %v", err)
+	}
+
+	// Initialization indexes the deployment block
+	if err := vm.InitializeVault(ctx, &registered); err != nil {
+		t.Fatalf("Failed to initialize vault: %v", err)
+	}
+	events := vaultEvents(t, dbClient, testVault)
+	if len(events) != 2 || events[0].EventName != "ContractDeployed" || events[1].EventName != "Deposit" || events[1].BlockNumber != 5 {
+		t.Fatalf("Expected the deployment and a deposit in block 5, got %+v", events)
+	}
+	if !vm.IsTrackedVault(testVault) {
+		t.Error("Expected the initialized vault to be tracked")
+	}
+	vault, err := dbClient.GetVaultRegistryByAddress(testVault)
+	if err != nil {
+		t.Fatalf("Failed to get vault: %v", err)
+	}
+	if value(vault.LastBlockIndexed) != networktest.BlockHash(5) {
+		t.Errorf("Expected the vault to be indexed up to block 5, got %s", value(vault.LastBlockIndexed))
+	}
+	expectPublished(t, subscription, "ContractDeployed@5", "Deposit@5")
+
+	// Catchup runs in windows of 4 blocks, each stored with a driver event, and picks up the upgrade
+	notifications := dbtest.Listen(t, dbURL, "driver_events")
+	if err := vm.CatchupVault(ctx, vault, 15); err != nil {
+		t.Fatalf("Failed to catch up vault: %v", err)
+	}
+	expected := []driverEvent{
+		{Type: "CatchupVault", StartBlockHash: ptr(networktest.BlockHash(5)), EndBlockHash: ptr(networktest.BlockHash(9))},
+		{Type: "VaultUpgraded", BlockHash: ptr(networktest.BlockHash(11))},
+		{Type: "CatchupVault", StartBlockHash: ptr(networktest.BlockHash(9)), EndBlockHash: ptr(networktest.BlockHash(13))},
+		{Type: "CatchupVault", StartBlockHash: ptr(networktest.BlockHash(13)), EndBlockHash: ptr(networktest.BlockHash(15))},
+	}
+	for i, want := range expected {
+		got := nextDriverEvent(t, notifications)
+		if got.Type != want.Type || value(got.VaultAddress) != testVault || value(got.BlockHash) != value(want.BlockHash) ||
+			value(got.StartBlockHash) != value(want.StartBlockHash) || value(got.EndBlockHash) != value(want.EndBlockHash) {
+			t.Errorf("Driver event %d: expected %s %s %s-%s of %s, got %s %s %s-%s of %s", i,
+				want.Type, value(want.BlockHash), value(want.StartBlockHash), value(want.EndBlockHash), testVault,
+				got.Type, value(got.BlockHash), value(got.StartBlockHash), value(got.EndBlockHash), value(got.VaultAddress))
+		}
+	}
+
+	events = vaultEvents(t, dbClient, testVault)
+	if len(events) != 4 || events[2].BlockNumber != 8 || events[3].BlockNumber != 12 {
+		t.Fatalf("Expected the deposits of blocks 8 and 12 after the deployment block's events, got %+v", events)
+	}
+	if events[3].TransactionHash != networktest.TransactionHash(12) {
+		t.Errorf("Expected transaction hash %s, got %s", networktest.TransactionHash(12), events[3].TransactionHash)
+	}
+	history, err := dbClient.GetVaultClassHistory(testVault)
+	if err != nil {
+		t.Fatalf("Failed to get class history: %v", err)
+	}
+	if len(history) != 2 || history[0].ClassHash != "0xc1" || history[1].ClassHash != "0xc2" || history[1].BlockNumber != 11 {
+		t.Errorf("Expected 0xc1 from block 5 and 0xc2 from block 11, got %+v", history)
+	}
+	vault, err = dbClient.GetVaultRegistryByAddress(testVault)
+	if err != nil {
+		t.Fatalf("Failed to get vault: %v", err)
+	}
+	if value(vault.LastBlockIndexed) != networktest.BlockHash(15) {
+		t.Errorf("Expected the vault to be indexed up to block 15, got %s", value(vault.LastBlockIndexed))
+	}
+	expectPublished(t, subscription, "Deposit@8", "Deposit@12", "caught up 6-15")
+
+	// A vault caught up to the target is left alone
+	if err := vm.CatchupVault(ctx, vault, 15); err != nil {
+		t.Fatalf("Failed to catch up vault again: %v", err)
+	}
+	notifications.ExpectNone(200 * time.Millisecond)
+	if events := vaultEvents(t, dbClient, testVault); len(events) != 4 {
+		t.Errorf("Expected no new events, got %d", len(events))
+	}
+	expectPublished(t, subscription)
+}
+
+// liveBarrier stands in for the block processor, running whatever blocks arrived before pausing
+type liveBarrier struct {
+	dbClient    *db.DB
+	beforePause func()
+}
+
+func (b *liveBarrier) WithBlocksPaused(fn func(head *models.StarknetBlocks) error) error {
+	if b.beforePause != nil {
+		b.beforePause()
+	}
+	head, err := b.dbClient.GetLastBlock()
+	if err != nil {
+		return err
+	}
+	return fn(head)
+}
+
+// processLiveBlock indexes the vault events of a block of node the way the block processor does
+func processLiveBlock(t *testing.T, vm *Manager, dbClient *db.DB, number uint64, events ...networktest.Event) {
+	t.Helper()
+	ctx := context.Background()
+	var blockHash felt.Felt
+	if _, err := blockHash.SetString(networktest.BlockHash(number)); err != nil {
+		t.Fatalf("Invalid block hash: %v", err)
+	}
+
+	dbClient.BeginTx(ctx)
+	for _, event := range events {
+		coreEvent := &core.Event{From: feltOf(t, event.From)}
+		for _, key := range event.Keys {
+			coreEvent.Keys = append(coreEvent.Keys, feltOf(t, key))
+		}
+		for _, data := range event.Data {
+			coreEvent.Data = append(coreEvent.Data, feltOf(t, data))
+		}
+		if _, err := vm.ProcessVaultEvent(ctx, networktest.TransactionHash(number), testVault, coreEvent, number, blockHash); err != nil {
+			dbClient.RollbackTx()
+			t.Fatalf("Failed to process event of block %d: %v", number, err)
+		}
+	}
+	block := &models.StarknetBlocks{
+		BlockNumber: number,
+		BlockHash:   networktest.BlockHash(number),
+		ParentHash:  networktest.BlockHash(number - 1),
+		Status:      models.BlockStatusMined,
+	}
+	if err := dbClient.InsertBlock(block); err != nil {
+		dbClient.RollbackTx()
+		t.Fatalf("Failed to insert block %d: %v", number, err)
+	}
+	dbClient.CommitTx()
+}
+
+func feltOf(t *testing.T, value string) *felt.Felt {
+	t.Helper()
+	parsed, err := new(felt.Felt).SetString(value)
+	if err != nil {
+		t.Fatalf("Invalid felt %s: %v", value, err)
+	}
+	return parsed
+}
+
+func TestManagerReindexWhileIndexingLive(t *testing.T) {
+	dbClient, _ := dbtest.New(t)
+	node := networktest.NewServer(t, 20)
+	deposit := utils.Keccak256("Deposit")
+	live := map[uint64]networktest.Event{
+		16: {BlockNumber: 16, From: testVault, Keys: []string{deposit}, Data: []string{"0x4"}},
+		17: {BlockNumber: 17, From: testVault, Keys: []string{deposit}, Data: []string{"0x5"}},
+		18: {BlockNumber: 18, From: testVault, Keys: []string{deposit}, Data: []string{"0x6"}},
+	}
+	node.AddEvents(
+		networktest.ContractDeployed(testUDC, testVault, "0xc1", 5),
+		networktest.Event{BlockNumber: 8, From: testVault, Keys: []string{deposit}, Data: []string{"0x1"}},
+		networktest.Event{BlockNumber: 12, From: testVault, Keys: []string{deposit}, Data: []string{"0x2"}},
+		live[16], live[17], live[18],
+	)
+	node.SetClass(testVault, 5, "0xc1")
+
+	vm := NewManager(dbClient, node.Network(t), testUDC, []string{"0xc1"}, 4, 1, false, slog.New(slog.DiscardHandler))
+	t.Cleanup(vm.Stop)
+	ctx := context.Background()
+
+	dbClient.BeginTx(ctx)
+	if err := dbClient.InsertVault(&models.VaultRegistry{Address: testVault, DeployedAt: networktest.BlockHash(5)}); err != nil {
+		t.Fatalf("Failed to register vault: %v", err)
+	}
+	dbClient.CommitTx()
+	vault, err := dbClient.GetVaultRegistryByAddress(testVault)
+	if err != nil {
+		t.Fatalf("Failed to get vault: %v", err)
+	}
+	if err := vm.InitializeVault(ctx, &vault); err != nil {
+		t.Fatalf("Failed to initialize vault: %v", err)
+	}
+	if vault, err = dbClient.GetVaultRegistryByAddress(testVault); err != nil {
+		t.Fatalf("Failed to get vault: %v", err)
+	}
+	if err := vm.CatchupVault(ctx, vault, 15); err != nil {
+		t.Fatalf("Failed to catch up vault: %v", err)
+	}
+	processLiveBlock(t, vm, dbClient, 15)
+	processLiveBlock(t, vm, dbClient, 16, live[16])
+
+	eventBus := bus.New(slog.New(slog.DiscardHandler))
+	vm.SetBus(eventBus)
+	subscription, err := eventBus.Subscribe(bus.Options{Name: "test"})
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	// Block 17 is indexed live while the reindex holds its transaction open, the swap replaces it
+	barrier := &liveBarrier{dbClient: dbClient, beforePause: func() {
+		processLiveBlock(t, vm, dbClient, 17, live[17])
+		if events := vaultEvents(t, dbClient, testVault); len(events) != 5 {
+			t.Errorf("Expected the live event of block 17 to be visible before the swap, got %+v", events)
+		}
+	}}
+	if err := vm.ReindexVault(ctx, testVault, barrier); err != nil {
+		t.Fatalf("Failed to reindex vault: %v", err)
+	}
+	processLiveBlock(t, vm, dbClient, 18, live[18])
+
+	// Every event is stored once, in block order, with contiguous nonces
+	rows, err := dbClient.Pool.Query(ctx, `
+		SELECT event_nonce, block_number, event_name FROM events
+		WHERE vault_address = $1 ORDER BY event_nonce`, testVault)
+	if err != nil {
+		t.Fatalf("Failed to query events: %v", err)
+	}
+	defer rows.Close()
+	var got []string
+	for i := 1; rows.Next(); i++ {
+		var nonce int
+		var event storedEvent
+		if err := rows.Scan(&nonce, &event.BlockNumber, &event.EventName); err != nil {
+			t.Fatalf("Failed to scan event: %v", err)
+		}
+		if nonce != i {
+			t.Errorf("Expected nonce %d, got %d", i, nonce)
+		}
+		got = append(got, fmt.Sprintf("%s@%d", event.EventName, event.BlockNumber))
+	}
+	expected := []string{"ContractDeployed@5", "Deposit@8", "Deposit@12", "Deposit@16", "Deposit@17", "Deposit@18"}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Expected events %v, got %v", expected, got)
+	}
+
+	vault, err = dbClient.GetVaultRegistryByAddress(testVault)
+	if err != nil {
+		t.Fatalf("Failed to get vault: %v", err)
+	}
+	if value(vault.LastBlockIndexed) != networktest.BlockHash(17) {
+		t.Errorf("Expected the reindex to end at block 17, got %s", value(vault.LastBlockIndexed))
+	}
+	// Subscribers get the replayed range and its committed events
+	expectPublished(t, subscription, "reindexed 5-17", "ContractDeployed@5", "Deposit@8", "Deposit@12", "Deposit@16", "Deposit@17")
+
+	// The reindex reports once, over the whole replayed range
+	var reindexes []driverEvent
+	driverRows, err := dbClient.Pool.Query(ctx, `
+		SELECT start_block_hash, end_block_hash FROM driver_events
+		WHERE type = 'ReindexVault' AND vault_address = $1`, testVault)
+	if err != nil {
+		t.Fatalf("Failed to query driver events: %v", err)
+	}
+	defer driverRows.Close()
+	for driverRows.Next() {
+		var event driverEvent
+		if err := driverRows.Scan(&event.StartBlockHash, &event.EndBlockHash); err != nil {
+			t.Fatalf("Failed to scan driver event: %v", err)
+		}
+		reindexes = append(reindexes, event)
+	}
+	if len(reindexes) != 1 || value(reindexes[0].StartBlockHash) != networktest.BlockHash(5) || value(reindexes[0].EndBlockHash) != networktest.BlockHash(17) {
+		t.Errorf("Expected one ReindexVault event over blocks 5-17, got %+v", reindexes)
+	}
+}
+
+func TestManagerClassHistoryRollback(t *testing.T) {
+	dbClient, _ := dbtest.New(t)
+	node := networktest.NewServer(t, 20)
+	node.AddEvents(networktest.ContractDeployed(testUDC, testVault, "0xc1", 5))
+	node.SetClass(testVault, 5, "0xc1")
+
+	vm := NewManager(dbClient, node.Network(t), testUDC, []string{"0xc1", "0xc2"}, 4, 1, false, slog.New(slog.DiscardHandler))
+	t.Cleanup(vm.Stop)
+	ctx := context.Background()
+
+	dbClient.BeginTx(ctx)
+	if err := dbClient.InsertVault(&models.VaultRegistry{Address: testVault, DeployedAt: networktest.BlockHash(5)}); err != nil {
+		t.Fatalf("Failed to register vault: %v", err)
+	}
+	dbClient.CommitTx()
+	vault, err := dbClient.GetVaultRegistryByAddress(testVault)
+	if err != nil {
+		t.Fatalf("Failed to get vault: %v", err)
+	}
+	if err := vm.InitializeVault(ctx, &vault); err != nil {
+		t.Fatalf("Failed to initialize vault: %v", err)
+	}
+
+	expectClass := func(blockNumber uint64, expected string) {
+		t.Helper()
+		classHash, err := vm.classAt(testVault, blockNumber)
+		if err != nil {
+			t.Fatalf("Failed to get class at block %d: %v", blockNumber, err)
+		}
+		if classHash != expected {
+			t.Errorf("Expected class %s at block %d, got %s", expected, blockNumber, classHash)
+		}
+	}
+
+	// An upgrade rolled back with its block is dropped from the history
+	dbClient.BeginTx(ctx)
+	if err := vm.RecordVaultUpgrade(testVault, 16, networktest.BlockHash(16), "0xc2"); err != nil {
+		t.Fatalf("Failed to record upgrade: %v", err)
+	}
+	expectClass(16, "0xc2")
+	dbClient.RollbackTx()
+	expectClass(16, "0xc1")
+
+	// A revert rolled back keeps the reverted classes
+	dbClient.BeginTx(ctx)
+	if err := vm.RevertVaultUpgrades(5, networktest.BlockHash(5)); err != nil {
+		t.Fatalf("Failed to revert upgrades: %v", err)
+	}
+	expectClass(5, "")
+	dbClient.RollbackTx()
+	expectClass(5, "0xc1")
+
+	// A committed upgrade stays
+	dbClient.BeginTx(ctx)
+	if err := vm.RecordVaultUpgrade(testVault, 16, networktest.BlockHash(16), "0xc2"); err != nil {
+		t.Fatalf("Failed to record upgrade: %v", err)
+	}
+	dbClient.CommitTx()
+	expectClass(16, "0xc2")
+}
+
+// expectPublished checks the events buffered for subscription, vault events as name@block,
+// catchups as "caught up from-to" and replays as "reindexed from-to"
+func expectPublished(t *testing.T, subscription *bus.Subscription, expected ...string) {
+	t.Helper()
+	var got []string
+	for len(subscription.Events()) > 0 {
+		switch event := (<-subscription.Events()).(type) {
+		case bus.VaultEvent:
+			if !event.Catchup || event.Event.VaultAddress != testVault {
+				t.Errorf("Expected catchup events of %s, got %+v", testVault, event)
+			}
+			got = append(got, fmt.Sprintf("%s@%d", event.Event.EventName, event.Event.BlockNumber))
+		case bus.VaultCaughtUp:
+			if event.BlockHash != networktest.BlockHash(event.ToBlock) {
+				t.Errorf("Expected the hash of block %d, got %s", event.ToBlock, event.BlockHash)
+			}
+			got = append(got, fmt.Sprintf("caught up %d-%d", event.FromBlock, event.ToBlock))
+		case bus.VaultReindexed:
+			if event.VaultAddress != testVault || event.BlockHash != networktest.BlockHash(event.ToBlock) {
+				t.Errorf("Expected the hash of block %d of %s, got %+v", event.ToBlock, testVault, event)
+			}
+			got = append(got, fmt.Sprintf("reindexed %d-%d", event.FromBlock, event.ToBlock))
+		default:
+			got = append(got, fmt.Sprintf("%+v", event))
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v to be published, got %v", expected, got)
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
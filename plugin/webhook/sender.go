@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"junoplugin/models"
+	"junoplugin/plugin/config"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// userAgent is the User-Agent of webhook requests
+const userAgent = "pitchlake-webhook"
+
+// maxResponseBody is how much of a response is read so the connection can be reused
+const maxResponseBody = 64 << 10
+
+// Result is the outcome of sending a webhook
+type Result struct {
+	// StatusCode is the response status, 0 when no response was received
+	StatusCode int
+	Duration   time.Duration
+	// RetryAfter is the wait the receiver asked for with a Retry-After header
+	RetryAfter time.Duration
+	// Err is set unless the receiver answered with a 2xx status
+	Err error
+}
+
+// Retryable reports whether sending again may succeed: the receiver could not be reached, timed out,
+// is rate limiting or failed. Other statuses, redirects included, are final.
+func (r Result) Retryable() bool {
+	if r.Err == nil {
+		return false
+	}
+	switch {
+	case r.StatusCode == 0, r.StatusCode >= 500:
+		return true
+	case r.StatusCode == http.StatusRequestTimeout, r.StatusCode == http.StatusTooManyRequests:
+		return true
+	default:
+		return false
+	}
+}
+
+// Sender signs and posts webhook requests
+type Sender struct {
+	client *http.Client
+}
+
+// NewSender creates a sender whose requests time out after timeout, config.DefaultWebhookTimeout
+// when 0. Redirects are not followed, the signature is only meant for the subscription's URL.
+func NewSender(timeout time.Duration) *Sender {
+	if timeout <= 0 {
+		timeout = config.DefaultWebhookTimeout
+	}
+	return &Sender{client: &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+// Send posts body to the subscription's URL, signed with its secret
+func (s *Sender) Send(ctx context.Context, subscription *models.WebhookSubscription, deliveryID, eventName string, body []byte) Result {
+	start := time.Now()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return Result{Err: fmt.Errorf("failed to create request: %w", err)}
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", userAgent)
+	request.Header.Set(DeliveryHeader, deliveryID)
+	request.Header.Set(EventHeader, eventName)
+	request.Header.Set(SignatureHeader, Sign(subscription.Secret, start, body))
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return Result{Duration: time.Since(start), Err: err}
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxResponseBody))
+
+	result := Result{StatusCode: response.StatusCode, Duration: time.Since(start)}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		result.Err = fmt.Errorf("receiver answered %s", response.Status)
+		result.RetryAfter = parseRetryAfter(response.Header.Get("Retry-After"), time.Now())
+	}
+	return result
+}
+
+// parseRetryAfter parses a Retry-After header in seconds or as an HTTP date, 0 when unset or invalid
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0)
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+	return 0
+}
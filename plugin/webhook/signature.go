@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Request headers
+const (
+	// SignatureHeader holds the Sign signature of the request body
+	SignatureHeader = "X-Pitchlake-Signature"
+	// DeliveryHeader holds the delivery id, the same across the attempts of a delivery
+	DeliveryHeader = "X-Pitchlake-Delivery"
+	// EventHeader holds the name of the vault event sent
+	EventHeader = "X-Pitchlake-Event"
+)
+
+// DefaultTolerance is how old a signature Verify accepts by default
+const DefaultTolerance = 5 * time.Minute
+
+// Sign returns the signature of body sent at timestamp: t=<unix seconds>,v1=<hex HMAC-SHA256 of
+// "<unix seconds>.<body>" keyed with secret>. Signing the timestamp lets receivers reject replays.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac(secret, t, body))
+}
+
+// Verify checks header is a signature of body made with secret less than tolerance from now.
+// Receivers call it with the SignatureHeader of each request, DefaultTolerance when tolerance is 0.
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+	var t string
+	var signatures [][]byte
+	for part := range strings.SplitSeq(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			// Several v1 signatures are accepted so secrets can be rotated
+			if signature, err := hex.DecodeString(value); err == nil {
+				signatures = append(signatures, signature)
+			}
+		}
+	}
+	seconds, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid signature timestamp %q", t)
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("signature timestamp %s is outside the %v tolerance", time.Unix(seconds, 0).UTC(), tolerance)
+	}
+	expected := mac(secret, t, body)
+	for _, signature := range signatures {
+		if hmac.Equal(signature, expected) {
+			return nil
+		}
+	}
+	return errors.New("signature does not match")
+}
+
+func mac(secret, t string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(t))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"delivery_id":"1"}`)
+	now := time.Unix(1700000000, 0)
+	signature := Sign("secret", now, body)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    []byte
+		now     time.Time
+		wantErr bool
+	}{
+		{"valid", "secret", signature, body, now, false},
+		{"within tolerance", "secret", signature, body, now.Add(4 * time.Minute), false},
+		{"rotated secret", "secret", Sign("old", now, body) + "," + signature[len("t=1700000000,"):], body, now, false},
+		{"wrong secret", "other", signature, body, now, true},
+		{"altered body", "secret", signature, []byte(`{"delivery_id":"2"}`), now, true},
+		{"stale", "secret", signature, body, now.Add(6 * time.Minute), true},
+		{"from the future", "secret", signature, body, now.Add(-6 * time.Minute), true},
+		{"altered timestamp", "secret", "t=1700000001" + signature[len("t=1700000000"):], body, now, true},
+		{"no timestamp", "secret", signature[len("t=1700000000,"):], body, now, true},
+		{"empty", "secret", "", body, now, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, 0, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"30", 30 * time.Second},
+		{"-1", 0},
+		{"Mon, 01 Jan 2024 00:02:00 GMT", 2 * time.Minute},
+		{"Sun, 31 Dec 2023 23:00:00 GMT", 0},
+		{"soon", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.expected {
+			t.Errorf("Expected Retry-After %q to be %v, got %v", tt.value, tt.expected, got)
+		}
+	}
+}
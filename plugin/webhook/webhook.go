@@ -0,0 +1,458 @@
+// Package webhook sends the vault events the plugin commits to the webhook subscriptions stored in
+// Postgres, as HTTP POST requests signed with the subscription's secret.
+//
+// The dispatcher receives the committed VaultEvents from the bus and queues a delivery for every
+// enabled subscription whose vault and event filters match. Each subscription has a worker sending
+// its deliveries in order, retrying failed ones with backoff. Every attempt is logged in
+// webhook_deliveries and the deliveries given up on are stored in webhook_dead_letters, from where
+// pitchlakectl can send them again. A subscription whose queue is full has its new deliveries
+// dead-lettered rather than holding up indexing. Subscriptions are reloaded periodically, so the
+// ones added, disabled or removed with pitchlakectl are picked up without a restart.
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"junoplugin/logging"
+	"junoplugin/metrics"
+	"junoplugin/models"
+	"junoplugin/plugin/bus"
+	"junoplugin/plugin/config"
+	"junoplugin/utils"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// Store holds the subscriptions, delivery logs and dead letters, it is implemented by db.DB
+type Store interface {
+	// GetWebhookSubscriptions returns every subscription, the disabled ones included
+	GetWebhookSubscriptions() ([]*models.WebhookSubscription, error)
+	// InsertWebhookDelivery logs a delivery attempt
+	InsertWebhookDelivery(delivery *models.WebhookDelivery) error
+	// InsertWebhookDeadLetter stores a delivery given up on
+	InsertWebhookDeadLetter(letter *models.WebhookDeadLetter) error
+}
+
+// Dispatcher defaults, see Options
+const (
+	DefaultRetryDelay     = time.Second
+	DefaultMaxRetryDelay  = 5 * time.Minute
+	DefaultQueueSize      = 1000
+	DefaultReloadInterval = 30 * time.Second
+)
+
+// errStopped is the error of the deliveries dead-lettered because the dispatcher stopped
+var errStopped = errors.New("webhook dispatcher stopped")
+
+// Options configures a dispatcher, zero values select the defaults
+type Options struct {
+	// MaxAttempts is the number of times a delivery is sent before it is dead-lettered
+	MaxAttempts int
+	// Timeout bounds each request
+	Timeout time.Duration
+	// RetryDelay is the wait after a failed attempt, doubling up to MaxRetryDelay. A longer
+	// Retry-After of the receiver is honoured up to MaxRetryDelay.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	// QueueSize is the number of deliveries a subscription holds before dead-lettering new ones
+	QueueSize int
+	// ReloadInterval is how often the subscriptions are read again from the store
+	ReloadInterval time.Duration
+}
+
+// Payload is the JSON body of a webhook request
+type Payload struct {
+	DeliveryID     string `json:"delivery_id"`
+	SubscriptionID int64  `json:"subscription_id"`
+	// Catchup is set for events indexed from the node rather than from a live block
+	Catchup bool          `json:"catchup"`
+	Event   *models.Event `json:"event"`
+}
+
+// Dispatcher sends the committed vault events to the webhook subscriptions in the background
+type Dispatcher struct {
+	store        Store
+	bus          *bus.Bus
+	sender       *Sender
+	options      Options
+	log          *slog.Logger
+	subscription *bus.Subscription
+	// workers are the workers of the enabled subscriptions by ID, only used by run and, once it
+	// returned, by Stop
+	workers map[int64]*worker
+	// ctx stops run, the workers are stopped after it returned so nothing is queued to a stopped one
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewDispatcher creates a dispatcher sending the vault events published on eventBus to the
+// subscriptions of store
+func NewDispatcher(store Store, eventBus *bus.Bus, options Options, logger *slog.Logger) *Dispatcher {
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = config.DefaultWebhookMaxAttempts
+	}
+	if options.RetryDelay <= 0 {
+		options.RetryDelay = DefaultRetryDelay
+	}
+	if options.MaxRetryDelay < options.RetryDelay {
+		options.MaxRetryDelay = max(DefaultMaxRetryDelay, options.RetryDelay)
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = DefaultQueueSize
+	}
+	if options.ReloadInterval <= 0 {
+		options.ReloadInterval = DefaultReloadInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		store:   store,
+		bus:     eventBus,
+		sender:  NewSender(options.Timeout),
+		options: options,
+		log:     logging.Component(logger, "webhook"),
+		workers: make(map[int64]*worker),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+}
+
+// Start loads the subscriptions and sends the vault events published from now on until Stop is called
+func (d *Dispatcher) Start() error {
+	if err := d.reload(); err != nil {
+		return err
+	}
+	subscription, err := d.bus.Subscribe(bus.Options{
+		Name:   "webhooks",
+		Filter: bus.Filter{Kinds: []bus.Kind{bus.KindVaultEvent}},
+		// Dispatching only queues deliveries, the slow receivers fill their own queue
+		Policy: bus.Block,
+	})
+	if err != nil {
+		d.stopWorkers()
+		return fmt.Errorf("failed to subscribe to the bus: %w", err)
+	}
+	d.subscription = subscription
+	d.log.Info("Starting webhook dispatcher", "subscriptions", len(d.workers))
+	go d.run()
+	return nil
+}
+
+// Stop stops the workers. The deliveries not sent yet, including those of the events still
+// buffered, are dead-lettered.
+func (d *Dispatcher) Stop() {
+	d.cancel()
+	if d.subscription == nil {
+		// Start failed or was never called
+		d.stopWorkers()
+		return
+	}
+	<-d.done
+	d.subscription.Close()
+	// The buffered events are dead-lettered rather than queued, the workers would only dead-letter them
+	for event := range d.subscription.Events() {
+		if vaultEvent, ok := event.(bus.VaultEvent); ok {
+			for _, delivery := range d.deliveries(vaultEvent) {
+				d.deadLetter(delivery, 0, errStopped.Error())
+			}
+		}
+	}
+	d.stopWorkers()
+}
+
+func (d *Dispatcher) run() {
+	defer close(d.done)
+	ticker := time.NewTicker(d.options.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.reload(); err != nil {
+				d.log.Error("Failed to reload webhook subscriptions", "error", err)
+			}
+		case event, ok := <-d.subscription.Events():
+			if !ok {
+				return
+			}
+			if vaultEvent, ok := event.(bus.VaultEvent); ok {
+				d.dispatch(vaultEvent)
+			}
+		}
+	}
+}
+
+// reload starts a worker for each new enabled subscription, updates the existing ones and stops
+// the workers of the subscriptions disabled or removed
+func (d *Dispatcher) reload() error {
+	subscriptions, err := d.store.GetWebhookSubscriptions()
+	if err != nil {
+		return fmt.Errorf("failed to load webhook subscriptions: %w", err)
+	}
+	enabled := make(map[int64]bool, len(subscriptions))
+	for _, subscription := range subscriptions {
+		if !subscription.Enabled {
+			continue
+		}
+		target, err := newTarget(subscription)
+		if err != nil {
+			d.log.Warn("Skipping webhook subscription", "subscription", subscription.ID, "error", err)
+			continue
+		}
+		enabled[subscription.ID] = true
+		if w, ok := d.workers[subscription.ID]; ok {
+			w.target.Store(target)
+			continue
+		}
+		w := d.newWorker(target)
+		d.workers[subscription.ID] = w
+		go w.run()
+		d.log.Info("Added webhook subscription", "subscription", subscription.ID, "url", subscription.URL)
+	}
+	for id, w := range d.workers {
+		if !enabled[id] {
+			w.stop()
+			delete(d.workers, id)
+			d.log.Info("Removed webhook subscription", "subscription", id)
+		}
+	}
+	return nil
+}
+
+func (d *Dispatcher) stopWorkers() {
+	for id, w := range d.workers {
+		w.stop()
+		delete(d.workers, id)
+	}
+}
+
+// dispatch queues a delivery of event for every subscription it matches
+func (d *Dispatcher) dispatch(event bus.VaultEvent) {
+	for _, delivery := range d.deliveries(event) {
+		select {
+		case d.workers[delivery.subscriptionID].queue <- delivery:
+		default:
+			d.deadLetter(delivery, 0, "delivery queue is full")
+		}
+	}
+}
+
+// deliveries creates a delivery of event for every subscription it matches
+func (d *Dispatcher) deliveries(event bus.VaultEvent) []*delivery {
+	var deliveries []*delivery
+	for id, w := range d.workers {
+		if !w.target.Load().matches(event.Event) {
+			continue
+		}
+		delivery, err := newDelivery(id, event)
+		if err != nil {
+			d.log.Error("Failed to create webhook delivery", "subscription", id, "error", err)
+			continue
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries
+}
+
+// logAttempt stores an attempt in the delivery log
+func (d *Dispatcher) logAttempt(delivery *delivery, attempt int, result Result) {
+	record := &models.WebhookDelivery{
+		SubscriptionID: delivery.subscriptionID,
+		DeliveryID:     delivery.id,
+		EventName:      delivery.event.EventName,
+		VaultAddress:   delivery.event.VaultAddress,
+		BlockNumber:    delivery.event.BlockNumber,
+		Attempt:        attempt,
+		StatusCode:     result.StatusCode,
+		DurationMs:     result.Duration.Milliseconds(),
+	}
+	outcome := "success"
+	if result.Err != nil {
+		outcome = "failure"
+		record.Error = result.Err.Error()
+		d.log.Warn("Webhook delivery failed", "subscription", delivery.subscriptionID, "delivery", delivery.id,
+			"attempt", attempt, "error", result.Err)
+	}
+	metrics.WebhookDeliveries.WithLabelValues(outcome).Inc()
+	if err := d.store.InsertWebhookDelivery(record); err != nil {
+		d.log.Error("Failed to log webhook delivery", "subscription", delivery.subscriptionID, "delivery", delivery.id, "error", err)
+	}
+}
+
+// deadLetter stores a delivery given up on after attempts attempts
+func (d *Dispatcher) deadLetter(delivery *delivery, attempts int, reason string) {
+	letter := &models.WebhookDeadLetter{
+		SubscriptionID: delivery.subscriptionID,
+		DeliveryID:     delivery.id,
+		EventName:      delivery.event.EventName,
+		Payload:        delivery.body,
+		Attempts:       attempts,
+		Error:          reason,
+	}
+	if err := d.store.InsertWebhookDeadLetter(letter); err != nil {
+		d.log.Error("Failed to store webhook dead letter", "subscription", delivery.subscriptionID, "delivery", delivery.id, "error", err)
+		return
+	}
+	metrics.WebhookDeadLetters.Inc()
+	d.log.Warn("Dead-lettered webhook delivery", "subscription", delivery.subscriptionID, "delivery", delivery.id,
+		"attempts", attempts, "error", reason)
+}
+
+// target is a subscription with its filters as sets
+type target struct {
+	subscription *models.WebhookSubscription
+	vaults       map[string]struct{}
+	eventNames   map[string]struct{}
+}
+
+func newTarget(subscription *models.WebhookSubscription) (*target, error) {
+	t := &target{subscription: subscription}
+	if len(subscription.VaultAddresses) > 0 {
+		t.vaults = make(map[string]struct{}, len(subscription.VaultAddresses))
+		for _, address := range subscription.VaultAddresses {
+			normalized, err := utils.NormalizeHexAddress(address)
+			if err != nil {
+				return nil, fmt.Errorf("invalid vault address %s: %w", address, err)
+			}
+			t.vaults[normalized] = struct{}{}
+		}
+	}
+	if len(subscription.EventNames) > 0 {
+		t.eventNames = make(map[string]struct{}, len(subscription.EventNames))
+		for _, name := range subscription.EventNames {
+			t.eventNames[name] = struct{}{}
+		}
+	}
+	return t, nil
+}
+
+func (t *target) matches(event *models.Event) bool {
+	if t.vaults != nil {
+		normalized, err := utils.NormalizeHexAddress(event.VaultAddress)
+		if err != nil {
+			return false
+		}
+		if _, ok := t.vaults[normalized]; !ok {
+			return false
+		}
+	}
+	if t.eventNames != nil {
+		if _, ok := t.eventNames[event.EventName]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// delivery is an event to send to a subscription
+type delivery struct {
+	id             string
+	subscriptionID int64
+	event          *models.Event
+	body           []byte
+}
+
+func newDelivery(subscriptionID int64, event bus.VaultEvent) (*delivery, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate delivery id: %w", err)
+	}
+	d := &delivery{id: hex.EncodeToString(id[:]), subscriptionID: subscriptionID, event: event.Event}
+	body, err := json.Marshal(Payload{
+		DeliveryID:     d.id,
+		SubscriptionID: subscriptionID,
+		Catchup:        event.Catchup,
+		Event:          event.Event,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode payload: %w", err)
+	}
+	d.body = body
+	return d, nil
+}
+
+// worker sends the deliveries of a subscription in order
+type worker struct {
+	dispatcher *Dispatcher
+	// target is swapped by reload, the next attempt uses the new URL and secret
+	target atomic.Pointer[target]
+	queue  chan *delivery
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (d *Dispatcher) newWorker(t *target) *worker {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &worker{
+		dispatcher: d,
+		queue:      make(chan *delivery, d.options.QueueSize),
+		ctx:        ctx,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	w.target.Store(t)
+	return w
+}
+
+// stop cancels the delivery being sent and waits for the worker to dead-letter its queue
+func (w *worker) stop() {
+	w.cancel()
+	<-w.done
+}
+
+func (w *worker) run() {
+	defer close(w.done)
+	for {
+		select {
+		case <-w.ctx.Done():
+			for {
+				select {
+				case delivery := <-w.queue:
+					w.dispatcher.deadLetter(delivery, 0, errStopped.Error())
+				default:
+					return
+				}
+			}
+		case delivery := <-w.queue:
+			w.deliver(delivery)
+		}
+	}
+}
+
+// deliver sends a delivery until the receiver accepts it, dead-lettering it once it fails for good
+func (w *worker) deliver(delivery *delivery) {
+	options := w.dispatcher.options
+	retryDelay := options.RetryDelay
+	for attempt := 1; ; attempt++ {
+		if w.ctx.Err() != nil {
+			w.dispatcher.deadLetter(delivery, attempt-1, errStopped.Error())
+			return
+		}
+		result := w.dispatcher.sender.Send(w.ctx, w.target.Load().subscription, delivery.id, delivery.event.EventName, delivery.body)
+		w.dispatcher.logAttempt(delivery, attempt, result)
+		if result.Err == nil {
+			return
+		}
+		if !result.Retryable() || attempt >= options.MaxAttempts {
+			w.dispatcher.deadLetter(delivery, attempt, result.Err.Error())
+			return
+		}
+
+		wait := max(retryDelay, min(result.RetryAfter, options.MaxRetryDelay))
+		retryDelay = min(2*retryDelay, options.MaxRetryDelay)
+		timer := time.NewTimer(wait)
+		select {
+		case <-w.ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,120 @@
+//go:build integration
+
+package webhook
+
+import (
+	"junoplugin/db/dbtest"
+	"junoplugin/models"
+	"junoplugin/plugin/bus"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDispatcherStoresDeliveriesAndDeadLetters(t *testing.T) {
+	dbClient, _ := dbtest.New(t)
+	accepting, rejecting := newReceiver(t, http.StatusServiceUnavailable), newReceiver(t, http.StatusGone)
+
+	accepted := &models.WebhookSubscription{URL: accepting.URL, Secret: "secret", EventNames: []string{"Deposit"}, Enabled: true}
+	rejected := &models.WebhookSubscription{URL: rejecting.URL, Secret: "secret", VaultAddresses: []string{"0xbeef"}, Enabled: true}
+	for _, subscription := range []*models.WebhookSubscription{accepted, rejected} {
+		if err := dbClient.InsertWebhookSubscription(subscription); err != nil {
+			t.Fatalf("Failed to insert subscription: %v", err)
+		}
+	}
+	eventBus := bus.New(slog.New(slog.DiscardHandler))
+	d := newTestDispatcher(t, dbClient, eventBus, 3)
+
+	eventBus.Publish(vaultEvent("0xbeef", "Deposit", 1))
+	accepting.waitFor(t, 2, 5*time.Second)
+	rejecting.waitFor(t, 1, 5*time.Second)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		letters, err := dbClient.GetWebhookDeadLetters(0, 10)
+		if err != nil {
+			t.Fatalf("Failed to get dead letters: %v", err)
+		}
+		deliveries, err := dbClient.GetWebhookDeliveries(accepted.ID, 10)
+		if err != nil {
+			t.Fatalf("Failed to get deliveries: %v", err)
+		}
+		if len(letters) == 1 && len(deliveries) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected 1 dead letter and 2 logged attempts, got %d and %d", len(letters), len(deliveries))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	d.Stop()
+
+	// The accepting receiver failed once, then accepted the delivery
+	deliveries, err := dbClient.GetWebhookDeliveries(accepted.ID, 10)
+	if err != nil {
+		t.Fatalf("Failed to get deliveries: %v", err)
+	}
+	for i, expected := range []struct {
+		attempt int
+		status  int
+		failed  bool
+	}{{2, http.StatusOK, false}, {1, http.StatusServiceUnavailable, true}} {
+		delivery := deliveries[i]
+		if delivery.Attempt != expected.attempt || delivery.StatusCode != expected.status || (delivery.Error != "") != expected.failed {
+			t.Errorf("Expected attempt %d answered %d, got %+v", expected.attempt, expected.status, delivery)
+		}
+		if delivery.VaultAddress != "0xbeef" || delivery.BlockNumber != 1 || delivery.EventName != "Deposit" {
+			t.Errorf("Expected the Deposit of 0xbeef in block 1, got %+v", delivery)
+		}
+	}
+
+	// The rejecting one is dead-lettered with the body to send again
+	letters, err := dbClient.GetWebhookDeadLetters(rejected.ID, 10)
+	if err != nil {
+		t.Fatalf("Failed to get dead letters: %v", err)
+	}
+	if len(letters) != 1 {
+		t.Fatalf("Expected 1 dead letter, got %d", len(letters))
+	}
+	letter, subscription, err := dbClient.GetWebhookDeadLetter(letters[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to get dead letter: %v", err)
+	}
+	if letter.Attempts != 1 || subscription.ID != rejected.ID || subscription.Secret != "secret" {
+		t.Errorf("Expected a dead letter of subscription %d after 1 attempt, got %+v of %+v", rejected.ID, letter, subscription)
+	}
+	payload := decodePayload(t, letter.Payload)
+	if payload.DeliveryID != letter.DeliveryID || payload.Event.EventName != "Deposit" {
+		t.Errorf("Expected the payload of delivery %s, got %+v", letter.DeliveryID, payload)
+	}
+
+	// Redelivering it from its dead letter succeeds now the receiver accepts it
+	sent := NewSender(time.Second).Send(t.Context(), subscription, letter.DeliveryID, letter.EventName, letter.Payload)
+	if sent.Err != nil {
+		t.Fatalf("Failed to redeliver: %v", sent.Err)
+	}
+	if err := dbClient.DeleteWebhookDeadLetter(letter.ID); err != nil {
+		t.Fatalf("Failed to delete dead letter: %v", err)
+	}
+	if letter, _, err := dbClient.GetWebhookDeadLetter(letter.ID); err != nil || letter != nil {
+		t.Errorf("Expected the dead letter to be deleted, got %+v, %v", letter, err)
+	}
+
+	// Removing a subscription removes its log
+	if found, err := dbClient.SetWebhookSubscriptionEnabled(accepted.ID, false); err != nil || !found {
+		t.Fatalf("Failed to disable subscription: %v", err)
+	}
+	if found, err := dbClient.DeleteWebhookSubscription(accepted.ID); err != nil || !found {
+		t.Fatalf("Failed to delete subscription: %v", err)
+	}
+	if deliveries, err := dbClient.GetWebhookDeliveries(accepted.ID, 10); err != nil || len(deliveries) != 0 {
+		t.Errorf("Expected the deliveries to be deleted, got %d, %v", len(deliveries), err)
+	}
+	subscriptions, err := dbClient.GetWebhookSubscriptions()
+	if err != nil {
+		t.Fatalf("Failed to get subscriptions: %v", err)
+	}
+	if len(subscriptions) != 1 || subscriptions[0].ID != rejected.ID || subscriptions[0].VaultAddresses[0] != "0xbeef" {
+		t.Errorf("Expected only subscription %d to remain, got %+v", rejected.ID, subscriptions)
+	}
+}
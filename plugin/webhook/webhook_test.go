@@ -0,0 +1,409 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"junoplugin/models"
+	"junoplugin/plugin/bus"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStore holds subscriptions, delivery logs and dead letters in memory
+type fakeStore struct {
+	mu            sync.Mutex
+	subscriptions []*models.WebhookSubscription
+	deliveries    []*models.WebhookDelivery
+	deadLetters   []*models.WebhookDeadLetter
+}
+
+func (s *fakeStore) GetWebhookSubscriptions() ([]*models.WebhookSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscriptions := make([]*models.WebhookSubscription, len(s.subscriptions))
+	for i, subscription := range s.subscriptions {
+		copied := *subscription
+		subscriptions[i] = &copied
+	}
+	return subscriptions, nil
+}
+
+func (s *fakeStore) InsertWebhookDelivery(delivery *models.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delivery.ID = int64(len(s.deliveries) + 1)
+	s.deliveries = append(s.deliveries, delivery)
+	return nil
+}
+
+func (s *fakeStore) InsertWebhookDeadLetter(letter *models.WebhookDeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	letter.ID = int64(len(s.deadLetters) + 1)
+	s.deadLetters = append(s.deadLetters, letter)
+	return nil
+}
+
+func (s *fakeStore) addSubscription(subscription *models.WebhookSubscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	subscription.ID = int64(len(s.subscriptions) + 1)
+	s.subscriptions = append(s.subscriptions, subscription)
+}
+
+// waitForDeliveries waits for n logged attempts, failing t when they are not logged within timeout
+func (s *fakeStore) waitForDeliveries(t *testing.T, n int, timeout time.Duration) []*models.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		s.mu.Lock()
+		deliveries := append([]*models.WebhookDelivery(nil), s.deliveries...)
+		s.mu.Unlock()
+		if len(deliveries) >= n {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d logged attempts, got %d", n, len(deliveries))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitForDeadLetters waits for n dead letters, failing t when they are not stored within timeout
+func (s *fakeStore) waitForDeadLetters(t *testing.T, n int, timeout time.Duration) []*models.WebhookDeadLetter {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		s.mu.Lock()
+		letters := append([]*models.WebhookDeadLetter(nil), s.deadLetters...)
+		s.mu.Unlock()
+		if len(letters) >= n {
+			return letters
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d dead letters, got %d", n, len(letters))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// receivedRequest is a request received by a receiver
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver is an httptest webhook endpoint answering with its statuses in order, then 200
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedRequest
+	// hold, when set, holds up requests until it is closed or the request is cancelled
+	hold chan struct{}
+}
+
+func newReceiver(t testing.TB, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) serve(w http.ResponseWriter, request *http.Request) {
+	body, _ := io.ReadAll(request.Body)
+	r.mu.Lock()
+	r.requests = append(r.requests, receivedRequest{header: request.Header.Clone(), body: body})
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	hold := r.hold
+	r.mu.Unlock()
+
+	if hold != nil {
+		select {
+		case <-hold:
+		case <-request.Context().Done():
+			return
+		}
+	}
+	if status == http.StatusTooManyRequests {
+		w.Header().Set("Retry-After", "0")
+	}
+	w.WriteHeader(status)
+}
+
+// waitFor waits for n requests, failing t when they are not received within timeout
+func (r *receiver) waitFor(t *testing.T, n int, timeout time.Duration) []receivedRequest {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for {
+		r.mu.Lock()
+		requests := append([]receivedRequest(nil), r.requests...)
+		r.mu.Unlock()
+		if len(requests) >= n {
+			return requests
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d requests, got %d", n, len(requests))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newTestDispatcher(t *testing.T, store Store, eventBus *bus.Bus, maxAttempts int) *Dispatcher {
+	t.Helper()
+	d := NewDispatcher(store, eventBus, Options{
+		MaxAttempts:    maxAttempts,
+		Timeout:        time.Second,
+		RetryDelay:     time.Millisecond,
+		MaxRetryDelay:  5 * time.Millisecond,
+		ReloadInterval: 10 * time.Millisecond,
+	}, slog.New(slog.DiscardHandler))
+	if err := d.Start(); err != nil {
+		t.Fatalf("Failed to start dispatcher: %v", err)
+	}
+	return d
+}
+
+func vaultEvent(vaultAddress, eventName string, blockNumber uint64) bus.VaultEvent {
+	return bus.VaultEvent{Event: &models.Event{
+		TransactionHash: "0x1",
+		BlockNumber:     blockNumber,
+		BlockHash:       "0x" + strconv.FormatUint(blockNumber, 16),
+		VaultAddress:    vaultAddress,
+		EventName:       eventName,
+		EventKeys:       []string{"0x2"},
+		EventData:       []string{"0x3"},
+	}}
+}
+
+func decodePayload(t *testing.T, body []byte) *Payload {
+	t.Helper()
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("Failed to decode payload %s: %v", body, err)
+	}
+	return &payload
+}
+
+func TestDispatcherSendsMatchingEvents(t *testing.T) {
+	deposits, settlements := newReceiver(t), newReceiver(t)
+	store := &fakeStore{}
+	store.addSubscription(&models.WebhookSubscription{
+		URL: deposits.URL, Secret: "deposits", VaultAddresses: []string{"0x0beef"}, EventNames: []string{"Deposit"}, Enabled: true,
+	})
+	store.addSubscription(&models.WebhookSubscription{URL: deposits.URL, Secret: "disabled"})
+	store.addSubscription(&models.WebhookSubscription{
+		URL: settlements.URL, Secret: "settlements", EventNames: []string{"OptionRoundSettled"}, Enabled: true,
+	})
+	eventBus := bus.New(slog.New(slog.DiscardHandler))
+	d := newTestDispatcher(t, store, eventBus, 3)
+
+	eventBus.Publish(
+		vaultEvent("0xbeef", "Deposit", 1),
+		vaultEvent("0xbeef", "Withdrawal", 1),
+		vaultEvent("0xcafe", "Deposit", 2),
+		vaultEvent("0xcafe", "OptionRoundSettled", 2),
+	)
+	eventBus.Publish(bus.VaultEvent{Event: vaultEvent("0xbeef", "Deposit", 3).Event, Catchup: true})
+	depositRequests := deposits.waitFor(t, 2, 5*time.Second)
+	settlementRequests := settlements.waitFor(t, 1, 5*time.Second)
+	store.waitForDeliveries(t, 3, 5*time.Second)
+	d.Stop()
+
+	expected := []struct {
+		requests     []receivedRequest
+		secret       string
+		subscription int64
+		vaultAddress string
+		eventNames   []string
+		blocks       []uint64
+	}{
+		{depositRequests, "deposits", 1, "0xbeef", []string{"Deposit", "Deposit"}, []uint64{1, 3}},
+		{settlementRequests, "settlements", 3, "0xcafe", []string{"OptionRoundSettled"}, []uint64{2}},
+	}
+	for _, e := range expected {
+		if len(e.requests) != len(e.blocks) {
+			t.Fatalf("Expected %d requests for subscription %d, got %d", len(e.blocks), e.subscription, len(e.requests))
+		}
+		for i, request := range e.requests {
+			if err := Verify(e.secret, request.header.Get(SignatureHeader), request.body, 0, time.Now()); err != nil {
+				t.Errorf("Expected a valid signature, got %v", err)
+			}
+			if request.header.Get("Content-Type") != "application/json" {
+				t.Errorf("Expected a JSON request, got %s", request.header.Get("Content-Type"))
+			}
+			payload := decodePayload(t, request.body)
+			if payload.SubscriptionID != e.subscription || payload.DeliveryID != request.header.Get(DeliveryHeader) {
+				t.Errorf("Expected delivery %s of subscription %d, got %+v", request.header.Get(DeliveryHeader), e.subscription, payload)
+			}
+			if payload.Event.VaultAddress != e.vaultAddress || payload.Event.EventName != e.eventNames[i] ||
+				payload.Event.BlockNumber != e.blocks[i] || request.header.Get(EventHeader) != e.eventNames[i] {
+				t.Errorf("Expected %s of vault %s in block %d, got %+v", e.eventNames[i], e.vaultAddress, e.blocks[i], payload.Event)
+			}
+		}
+	}
+	if payload := decodePayload(t, depositRequests[1].body); !payload.Catchup {
+		t.Error("Expected the catchup event to be flagged")
+	}
+}
+
+func TestDispatcherRetriesFailedDeliveries(t *testing.T) {
+	server := newReceiver(t, http.StatusInternalServerError, http.StatusTooManyRequests)
+	store := &fakeStore{}
+	store.addSubscription(&models.WebhookSubscription{URL: server.URL, Secret: "secret", Enabled: true})
+	eventBus := bus.New(slog.New(slog.DiscardHandler))
+	d := newTestDispatcher(t, store, eventBus, 3)
+
+	eventBus.Publish(vaultEvent("0xbeef", "Deposit", 1))
+	requests := server.waitFor(t, 3, 5*time.Second)
+	deliveries := store.waitForDeliveries(t, 3, 5*time.Second)
+	d.Stop()
+
+	deliveryID := requests[0].header.Get(DeliveryHeader)
+	for _, request := range requests {
+		if request.header.Get(DeliveryHeader) != deliveryID {
+			t.Errorf("Expected every attempt to be delivery %s, got %s", deliveryID, request.header.Get(DeliveryHeader))
+		}
+	}
+	for i, status := range []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusOK} {
+		delivery := deliveries[i]
+		if delivery.Attempt != i+1 || delivery.StatusCode != status || delivery.DeliveryID != deliveryID {
+			t.Errorf("Expected attempt %d of %s answered %d, got %+v", i+1, deliveryID, status, delivery)
+		}
+		if (delivery.Error != "") != (status != http.StatusOK) {
+			t.Errorf("Unexpected error %q of attempt %d", delivery.Error, i+1)
+		}
+	}
+	if letters := store.waitForDeadLetters(t, 0, 0); len(letters) != 0 {
+		t.Errorf("Expected no dead letters, got %d", len(letters))
+	}
+}
+
+func TestDispatcherDeadLetters(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		attempts int
+	}{
+		{"out of attempts", []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusInternalServerError}, 3},
+		{"rejected", []int{http.StatusBadRequest}, 1},
+		{"redirected", []int{http.StatusFound}, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newReceiver(t, tt.statuses...)
+			store := &fakeStore{}
+			store.addSubscription(&models.WebhookSubscription{URL: server.URL, Secret: "secret", Enabled: true})
+			eventBus := bus.New(slog.New(slog.DiscardHandler))
+			d := newTestDispatcher(t, store, eventBus, 3)
+
+			eventBus.Publish(vaultEvent("0xbeef", "Deposit", 1))
+			letters := store.waitForDeadLetters(t, 1, 5*time.Second)
+			d.Stop()
+
+			letter := letters[0]
+			if letter.Attempts != tt.attempts || letter.SubscriptionID != 1 || letter.EventName != "Deposit" {
+				t.Errorf("Expected a Deposit of subscription 1 dead-lettered after %d attempts, got %+v", tt.attempts, letter)
+			}
+			if payload := decodePayload(t, letter.Payload); payload.DeliveryID != letter.DeliveryID {
+				t.Errorf("Expected the payload of delivery %s, got %+v", letter.DeliveryID, payload)
+			}
+			if deliveries := store.waitForDeliveries(t, 0, 0); len(deliveries) != tt.attempts {
+				t.Errorf("Expected %d logged attempts, got %d", tt.attempts, len(deliveries))
+			}
+		})
+	}
+}
+
+func TestDispatcherLoadsNewSubscriptions(t *testing.T) {
+	server := newReceiver(t)
+	store := &fakeStore{}
+	eventBus := bus.New(slog.New(slog.DiscardHandler))
+	d := newTestDispatcher(t, store, eventBus, 3)
+	defer d.Stop()
+
+	store.addSubscription(&models.WebhookSubscription{URL: server.URL, Secret: "secret", Enabled: true})
+	// Events published before the reload picks the subscription up are not sent to it
+	deadline := time.Now().Add(5 * time.Second)
+	for block := uint64(1); len(server.waitFor(t, 0, 0)) == 0; block++ {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the new subscription to receive events")
+		}
+		eventBus.Publish(vaultEvent("0xbeef", "Deposit", block))
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDispatcherStopDeadLettersPendingDeliveries(t *testing.T) {
+	server := newReceiver(t)
+	server.hold = make(chan struct{})
+	defer close(server.hold)
+	store := &fakeStore{}
+	store.addSubscription(&models.WebhookSubscription{URL: server.URL, Secret: "secret", Enabled: true})
+	eventBus := bus.New(slog.New(slog.DiscardHandler))
+	d := newTestDispatcher(t, store, eventBus, 3)
+
+	eventBus.Publish(vaultEvent("0xbeef", "Deposit", 1), vaultEvent("0xbeef", "Deposit", 2), vaultEvent("0xbeef", "Deposit", 3))
+	server.waitFor(t, 1, 5*time.Second)
+	d.Stop()
+
+	letters := store.waitForDeadLetters(t, 3, 0)
+	if len(letters) != 3 {
+		t.Fatalf("Expected 3 dead letters, got %d", len(letters))
+	}
+	// The delivery held up was attempted once, the queued ones never were
+	attempts := map[uint64]int{}
+	for _, letter := range letters {
+		attempts[decodePayload(t, letter.Payload).Event.BlockNumber] = letter.Attempts
+	}
+	for block, expected := range map[uint64]int{1: 1, 2: 0, 3: 0} {
+		if attempts[block] != expected {
+			t.Errorf("Expected the delivery of block %d dead-lettered after %d attempts, got %d", block, expected, attempts[block])
+		}
+	}
+}
+
+func TestDispatcherStopDeadLettersBufferedEvents(t *testing.T) {
+	server := newReceiver(t)
+	store := &fakeStore{}
+	store.addSubscription(&models.WebhookSubscription{URL: server.URL, Secret: "secret", Enabled: true})
+	eventBus := bus.New(slog.New(slog.DiscardHandler))
+	d := newTestDispatcher(t, store, eventBus, 3)
+
+	// Stop dispatching first, as Stop does, so that the events published next stay buffered in the
+	// bus subscription
+	d.cancel()
+	<-d.done
+	eventBus.Publish(vaultEvent("0xbeef", "Deposit", 1), vaultEvent("0xbeef", "Deposit", 2))
+	d.Stop()
+
+	letters := store.waitForDeadLetters(t, 2, 0)
+	if len(letters) != 2 {
+		t.Fatalf("Expected 2 dead letters, got %d", len(letters))
+	}
+	for i, letter := range letters {
+		if block := decodePayload(t, letter.Payload).Event.BlockNumber; block != uint64(i+1) {
+			t.Errorf("Expected dead letter %d for block %d, got block %d", i, i+1, block)
+		}
+		if letter.Attempts != 0 || letter.Error != errStopped.Error() {
+			t.Errorf("Expected dead letter %d unattempted with %q, got %d attempts with %q", i, errStopped, letter.Attempts, letter.Error)
+		}
+	}
+	if deliveries := store.waitForDeliveries(t, 0, 0); len(deliveries) != 0 {
+		t.Errorf("Expected no attempts, got %d", len(deliveries))
+	}
+}
+
+func TestDispatcherStopWithoutStart(t *testing.T) {
+	d := NewDispatcher(&fakeStore{}, bus.New(slog.New(slog.DiscardHandler)), Options{}, slog.New(slog.DiscardHandler))
+	d.Stop()
+}
@@ -0,0 +1,152 @@
+// Package tracing records OpenTelemetry spans of block processing, catchup, RPC calls and database
+// transactions. Setup installs the package's tracer provider, exporting over OTLP/HTTP or as JSON to
+// stdout or a file; until then spans are not recorded. The provider is kept here rather than set as
+// otel's global one, so Juno's tracing is left alone.
+//
+// Operations start their span with Start on the context they were given, which makes it a child of
+// the caller's span, and close it with End.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"junoplugin/logging"
+	"os"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Exporters
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// ServiceName is the service.name of the exported spans
+const ServiceName = "pitchlake-plugin"
+
+// instrumentationName names the tracer spans are started with
+const instrumentationName = "junoplugin"
+
+// Options selects where spans are exported
+type Options struct {
+	// Exporter is ExporterOTLP, ExporterStdout, ExporterFile or, when empty, ExporterNone
+	Exporter string
+	// Endpoint is the OTLP/HTTP endpoint URL, the OTEL_EXPORTER_OTLP_* variables apply when empty
+	Endpoint string
+	// File is the file ExporterFile appends spans to
+	File string
+	// SampleRatio is the share of traces recorded, all of them when 0
+	SampleRatio float64
+}
+
+// tracer is the tracer Start uses, a no-op one until Setup or SetTracerProvider
+var tracer atomic.Pointer[trace.Tracer]
+
+func init() {
+	SetTracerProvider(noop.NewTracerProvider())
+}
+
+// SetTracerProvider makes Start record spans with provider
+func SetTracerProvider(provider trace.TracerProvider) {
+	t := provider.Tracer(instrumentationName)
+	tracer.Store(&t)
+}
+
+// Setup installs a tracer provider exporting as opts selects. The returned function flushes the
+// spans still buffered and stops exporting, it is a no-op when tracing is disabled.
+func Setup(opts Options) (shutdown func(context.Context) error, err error) {
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	switch opts.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var options []otlptracehttp.Option
+		if opts.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(opts.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(context.Background(), options...)
+	case ExporterStdout:
+		exporter, err = newJSONExporter(os.Stdout)
+	case ExporterFile:
+		if opts.File == "" {
+			return nil, errors.New("trace file is required by the file exporter")
+		}
+		file, err = os.OpenFile(opts.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		exporter, err = newJSONExporter(file)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, expected %s, %s, %s or %s", opts.Exporter, ExporterNone, ExporterOTLP, ExporterStdout, ExporterFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", opts.Exporter, err)
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if opts.SampleRatio > 0 && opts.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(opts.SampleRatio)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", ServiceName))),
+	)
+	SetTracerProvider(provider)
+	return func(ctx context.Context) error {
+		SetTracerProvider(noop.NewTracerProvider())
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}, nil
+}
+
+// newJSONExporter writes a JSON object per span to w
+func newJSONExporter(w io.Writer) (sdktrace.SpanExporter, error) {
+	return stdouttrace.New(stdouttrace.WithWriter(w))
+}
+
+// Start starts a span named name, a child of the span in ctx if any
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return (*tracer.Load()).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends span, marking it failed with err when err is set
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// BlockNumber is the block_number attribute, keyed like the logging field
+func BlockNumber(number uint64) attribute.KeyValue {
+	return attribute.Int64(logging.KeyBlockNumber, int64(number))
+}
+
+// BlockHash is the block_hash attribute
+func BlockHash(hash string) attribute.KeyValue {
+	return attribute.String(logging.KeyBlockHash, hash)
+}
+
+// VaultAddress is the vault_address attribute
+func VaultAddress(address string) attribute.KeyValue {
+	return attribute.String(logging.KeyVaultAddress, address)
+}
@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{name: "disabled"},
+		{name: "none", opts: Options{Exporter: ExporterNone}},
+		{name: "otlp", opts: Options{Exporter: ExporterOTLP, Endpoint: "http://localhost:4318"}},
+		{name: "file without path", opts: Options{Exporter: ExporterFile}, wantErr: true},
+		{name: "unknown exporter", opts: Options{Exporter: "jaeger"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shutdown, err := Setup(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil {
+				shutdown(context.Background())
+			}
+		})
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := Setup(Options{Exporter: ExporterFile, File: path})
+	if err != nil {
+		t.Fatalf("Failed to set up tracing: %v", err)
+	}
+
+	ctx, parent := Start(context.Background(), "NewBlock", BlockNumber(7))
+	_, child := Start(ctx, "starknet_getEvents")
+	End(child, errors.New("rate limited"))
+	End(parent, nil)
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("Failed to shut down tracing: %v", err)
+	}
+
+	// Spans started after shutdown are not recorded
+	_, span := Start(context.Background(), "dropped")
+	span.End()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open trace file: %v", err)
+	}
+	defer file.Close()
+	type exported struct {
+		Name        string
+		SpanContext struct{ TraceID, SpanID string }
+		Parent      struct{ SpanID string }
+		Status      struct{ Code string }
+		Attributes  []struct{ Key string }
+	}
+	spans := make(map[string]exported)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var span exported
+		if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+			t.Fatalf("Failed to parse span: %v", err)
+		}
+		spans[span.Name] = span
+	}
+
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d: %v", len(spans), spans)
+	}
+	parentSpan, childSpan := spans["NewBlock"], spans["starknet_getEvents"]
+	if childSpan.Parent.SpanID != parentSpan.SpanContext.SpanID || childSpan.SpanContext.TraceID != parentSpan.SpanContext.TraceID {
+		t.Errorf("Expected the RPC span to be a child of the block span, got %+v and %+v", childSpan, parentSpan)
+	}
+	if childSpan.Status.Code != "Error" {
+		t.Errorf("Expected the failed span's status to be Error, got %q", childSpan.Status.Code)
+	}
+	if len(parentSpan.Attributes) != 1 || parentSpan.Attributes[0].Key != "block_number" {
+		t.Errorf("Expected a block_number attribute, got %+v", parentSpan.Attributes)
+	}
+}
@@ -78,7 +78,9 @@ func DecimalStringToHexString(decimalString string) (string, error) {
 	return "0x" + hexString, nil
 }
 
-var vaultEventNames = []string{
+// VaultEventNames are the events of the original vault class, matched by their selector when no ABI
+// of the vault's class is registered
+var VaultEventNames = []string{
 	"Deposit",
 	"Withdrawal",
 	"WithdrawalQueued",
@@ -140,11 +142,19 @@ func Keccak256(eventName string) string {
 // 	return "", fmt.Errorf("event name not found for key: %s", eventKey)
 // }
 
+// vaultEventSelectors maps the selectors of VaultEventNames to the names
+var vaultEventSelectors = func() map[string]string {
+	selectors := make(map[string]string, len(VaultEventNames))
+	for _, name := range VaultEventNames {
+		selectors[Keccak256(name)] = name
+	}
+	return selectors
+}()
+
+// DecodeEventNameVault returns the name of the original vault class's event with the given selector
 func DecodeEventNameVault(eventKey string) (string, error) {
-	for _, name := range vaultEventNames {
-		if Keccak256(name) == eventKey {
-			return name, nil
-		}
+	if name, ok := vaultEventSelectors[eventKey]; ok {
+		return name, nil
 	}
 	return "", fmt.Errorf("event name not found for key: %s", eventKey)
 }
@@ -200,3 +210,25 @@ func NormalizeHexAddress(hexStr string) (string, error) {
 
 	return "0x" + trimmed, nil
 }
+
+// feltPrime is the Starknet field prime, 2^251 + 17*2^192 + 1
+var feltPrime, _ = new(big.Int).SetString("800000000000011000000000000000000000000000000000000000000000001", 16)
+
+// ValidateFeltHex checks that hexStr is a 0x prefixed hex string that fits in a felt
+// and returns it in the normalized form used across the indexer (lowercase, no leading zeros)
+// Example:
+// Input:  "0x050AA16A833664C92D4163B14FED470786FA4411FFD3B3ADDBB97A70AE56EFBD"
+// Output: "0x50aa16a833664c92d4163b14fed470786fa4411ffd3b3addbb97a70ae56efbd"
+func ValidateFeltHex(hexStr string) (string, error) {
+	if !strings.HasPrefix(hexStr, "0x") || len(hexStr) == 2 {
+		return "", fmt.Errorf("invalid hex value %q: must be 0x prefixed", hexStr)
+	}
+	value, ok := new(big.Int).SetString(hexStr[2:], 16)
+	if !ok {
+		return "", fmt.Errorf("invalid hex value %q", hexStr)
+	}
+	if value.Cmp(feltPrime) >= 0 {
+		return "", fmt.Errorf("invalid hex value %q: exceeds felt range", hexStr)
+	}
+	return "0x" + value.Text(16), nil
+}
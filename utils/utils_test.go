@@ -256,3 +256,65 @@ func TestBigIntToHexString(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateFeltHex(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    string
+		expectError bool
+	}{
+		{
+			input:       "0x050aa16a833664c92d4163b14fed470786fa4411ffd3b3addbb97a70ae56efbd",
+			expected:    "0x50aa16a833664c92d4163b14fed470786fa4411ffd3b3addbb97a70ae56efbd",
+			expectError: false,
+		},
+		{
+			input:       "0x050AA16A833664C92D4163B14FED470786FA4411FFD3B3ADDBB97A70AE56EFBD",
+			expected:    "0x50aa16a833664c92d4163b14fed470786fa4411ffd3b3addbb97a70ae56efbd",
+			expectError: false,
+		},
+		{
+			input:       "0x0",
+			expected:    "0x0",
+			expectError: false,
+		},
+		{
+			input:       "0x800000000000011000000000000000000000000000000000000000000000001",
+			expectError: true,
+		},
+		{
+			input:       "50aa16a833664c92d4163b14fed470786fa4411ffd3b3addbb97a70ae56efbd",
+			expectError: true,
+		},
+		{
+			input:       "0x",
+			expectError: true,
+		},
+		{
+			input:       "0xzz",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ValidateFeltHex(tt.input)
+
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			if result != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, result)
+			}
+		})
+	}
+}